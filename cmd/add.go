@@ -12,6 +12,8 @@ func init() {
 	rootCmd.AddCommand(addCmd)
 	addCmd.Flags().BoolVarP(&magnet, "magnet", "m", false, "use a magnet link instead of a .torrent file to add a torrent")
 	addCmd.Flags().StringVarP(&directory, "directory", "d", "", "specify the directory to save the torrent")
+	addCmd.Flags().BoolVarP(&sequential, "sequential", "s", false, "download the torrent's pieces in order")
+	addCmd.Flags().BoolVarP(&firstLast, "first-last", "f", false, "download the first and last pieces of each file first")
 }
 
 var (
@@ -20,7 +22,7 @@ var (
 		Short: "adds a new torrent from a .torrent file or magnet link",
 		Args:  cobra.MinimumNArgs(1),
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := cli.Add(args[0], magnet, directory); err != nil {
+			if err := cli.Add(args[0], magnet, directory, sequential, firstLast); err != nil {
 				fmt.Fprintln(os.Stderr, "Adding torrent failed:", err)
 			} else {
 				fmt.Println("Added torrent")
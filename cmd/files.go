@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kylec725/graytorrent/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(filesCmd)
+	filesCmd.Flags().BoolVarP(&isInfoHash, "infohash", "i", false, "select a torrent with its infohash")
+	filesCmd.Flags().StringVarP(&priority, "set", "s", "", "set the priority of the listed files (every file if none are listed): skip, low, normal or high")
+}
+
+var (
+	filesCmd = &cobra.Command{
+		Use:   "files ID [FILE...]",
+		Short: "lists a torrent's files or changes their priorities",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.Files(args[0], isInfoHash, args[1:], priority); err != nil {
+				fmt.Fprintln(os.Stderr, "Files failed:", err)
+			} else if priority != "" {
+				fmt.Println("Changed file priorities")
+			}
+		},
+	}
+)
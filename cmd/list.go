@@ -10,6 +10,7 @@ import (
 
 func init() {
 	rootCmd.AddCommand(listCmd)
+	listCmd.Flags().BoolVarP(&showTrackers, "trackers", "t", false, "show each torrent's trackers")
 }
 
 var (
@@ -17,7 +18,7 @@ var (
 		Use:   "ls",
 		Short: "list the currently managed torrents",
 		Run: func(cmd *cobra.Command, args []string) {
-			if err := cli.List(); err != nil {
+			if err := cli.List(showTrackers); err != nil {
 				fmt.Fprintln(os.Stderr, "Listing torrents failed:", err)
 			}
 		},
@@ -0,0 +1,31 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kylec725/graytorrent/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(orderCmd)
+	orderCmd.Flags().BoolVarP(&isInfoHash, "infohash", "i", false, "select a torrent with its infohash")
+	orderCmd.Flags().BoolVarP(&sequential, "sequential", "s", false, "download the torrent's pieces in order")
+	orderCmd.Flags().BoolVarP(&firstLast, "first-last", "f", false, "download the first and last pieces of each file first")
+}
+
+var (
+	orderCmd = &cobra.Command{
+		Use:   "order ID",
+		Short: "sets the order a torrent's pieces are downloaded in, rarest first without any flags",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.Order(args[0], isInfoHash, sequential, firstLast); err != nil {
+				fmt.Fprintln(os.Stderr, "Order failed:", err)
+			} else {
+				fmt.Println("Changed download order")
+			}
+		},
+	}
+)
@@ -23,11 +23,16 @@ var (
 	logFile  *os.File
 
 	// Flags
-	debug      bool
-	magnet     bool
-	isInfoHash bool
-	directory  string
-	rmFiles    bool
+	debug        bool
+	magnet       bool
+	isInfoHash   bool
+	directory    string
+	rmFiles      bool
+	showTrackers bool
+	runTracker   bool
+	priority     string
+	sequential   bool
+	firstLast    bool
 
 	rootCmd = &cobra.Command{
 		Use:     "gray",
@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kylec725/graytorrent/internal/cli"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(scrapeCmd)
+	scrapeCmd.Flags().BoolVarP(&isInfoHash, "infohash", "i", false, "select a torrent with its infohash")
+}
+
+var (
+	scrapeCmd = &cobra.Command{
+		Use:   "scrape FILE|ID",
+		Short: "shows the seeders and leechers of a torrent file or managed torrent",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := cli.Scrape(args[0], isInfoHash); err != nil {
+				fmt.Fprintln(os.Stderr, "Scraping torrent failed:", err)
+			}
+		},
+	}
+)
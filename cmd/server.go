@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"encoding/hex"
 	"fmt"
 	"io/ioutil"
 	"net"
@@ -9,8 +10,10 @@ import (
 	"os/signal"
 	"strconv"
 	"syscall"
+	"time"
 
 	"github.com/kylec725/graytorrent/internal/config"
+	"github.com/kylec725/graytorrent/internal/trackerserver"
 	pb "github.com/kylec725/graytorrent/rpc"
 	"github.com/kylec725/graytorrent/torrent"
 	log "github.com/sirupsen/logrus"
@@ -27,6 +30,8 @@ func init() {
 	serverCmd.AddCommand(serverStopCmd)
 	serverMainCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "logs additional information for debugging")
 	serverStartCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "logs additional information for debugging")
+	serverMainCmd.PersistentFlags().BoolVarP(&runTracker, "tracker", "t", false, "also runs a tracker for HTTP and UDP announces")
+	serverStartCmd.PersistentFlags().BoolVarP(&runTracker, "tracker", "t", false, "also runs a tracker for HTTP and UDP announces")
 }
 
 var (
@@ -48,6 +53,10 @@ var (
 			if err != nil {
 				log.WithField("error", err).Info("Error when starting a new session for server")
 			}
+			var trackerServer *trackerserver.Server
+			if runTracker || config.GetConfig().Tracker.Enabled {
+				trackerServer = startTracker()
+			}
 
 			// Initialize signal catching
 			signalChan := make(chan os.Signal, 1)
@@ -58,6 +67,9 @@ var (
 
 				// Cleanup
 				session.Close()
+				if trackerServer != nil {
+					trackerServer.Close()
+				}
 				server.Stop()
 				logFile.Close()
 
@@ -113,6 +125,9 @@ var (
 			if debug {
 				serverMain = append(serverMain, "-d")
 			}
+			if runTracker {
+				serverMain = append(serverMain, "-t")
+			}
 
 			daemon := exec.Command(os.Args[0], serverMain...)
 			daemon.Start()
@@ -166,6 +181,30 @@ var (
 	}
 )
 
+// startTracker starts the embedded tracker with the settings under [tracker] in the config, an invalid allow-list keeps
+// it from starting since leaving out entries could leave it open to every torrent
+func startTracker() *trackerserver.Server {
+	cfg := config.GetConfig().Tracker
+	var allowed [][20]byte
+	for _, hexHash := range cfg.Allowed {
+		decoded, err := hex.DecodeString(hexHash)
+		if err != nil || len(decoded) != 20 {
+			log.WithField("infohash", hexHash).Warn("Not starting the tracker, invalid infohash in its allow-list")
+			return nil
+		}
+		var infoHash [20]byte
+		copy(infoHash[:], decoded)
+		allowed = append(allowed, infoHash)
+	}
+
+	trackerServer, err := trackerserver.New(":"+strconv.Itoa(cfg.Port), time.Duration(cfg.Interval)*time.Second, allowed)
+	if err != nil {
+		log.WithFields(log.Fields{"error": err.Error(), "port": cfg.Port}).Warn("Failed to start the tracker")
+		return nil
+	}
+	return trackerServer
+}
+
 func savePID(pid int) {
 	file, err := os.Create(pidFile)
 	if err != nil {
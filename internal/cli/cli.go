@@ -5,9 +5,11 @@ import (
 	"context"
 	"encoding/hex"
 	"fmt"
+	"os"
 	"path/filepath"
 	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/kylec725/graytorrent/internal/config"
 	pb "github.com/kylec725/graytorrent/rpc"
@@ -15,8 +17,8 @@ import (
 	"google.golang.org/grpc"
 )
 
-// List the currently managed torrents
-func List() error {
+// List the currently managed torrents, and their trackers if showTrackers is set
+func List(showTrackers bool) error {
 	// Set up a connection to the server.
 	serverAddr := "localhost:" + strconv.Itoa(config.GetConfig().Network.ServerPort)
 	conn, err := grpc.Dial(serverAddr, grpc.WithInsecure())
@@ -41,13 +43,18 @@ func List() error {
 
 	for _, to := range reply.Torrents {
 		torrentPrint(to)
+		if showTrackers {
+			for _, tr := range to.GetTrackers() {
+				trackerPrint(tr)
+			}
+		}
 	}
 
 	return nil
 }
 
 // Add a new torrent
-func Add(name string, magnet bool, directory string) error {
+func Add(name string, magnet bool, directory string, sequential, firstLast bool) error {
 	// Set up a connection to the server.
 	serverAddr := "localhost:" + strconv.Itoa(config.GetConfig().Network.ServerPort)
 	conn, err := grpc.Dial(serverAddr, grpc.WithInsecure())
@@ -79,6 +86,8 @@ func Add(name string, magnet bool, directory string) error {
 		}
 	}
 	request.Directory = directory
+	request.Sequential = sequential
+	request.FirstLast = firstLast
 
 	_, err = client.Add(ctx, &request)
 	if err != nil {
@@ -210,22 +219,199 @@ func Stop(input string, isInfoHash bool) error {
 	return nil
 }
 
+// Scrape shows the swarm statistics of a managed torrent or a .torrent file from each of its trackers
+func Scrape(input string, isInfoHash bool) error {
+	// Set up a connection to the server.
+	serverAddr := "localhost:" + strconv.Itoa(config.GetConfig().Network.ServerPort)
+	conn, err := grpc.Dial(serverAddr, grpc.WithInsecure())
+	if err != nil {
+		return errors.WithMessage(err, "Did not connect")
+	}
+	defer conn.Close()
+
+	client := pb.NewTorrentServiceClient(conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var request pb.ScrapeRequest
+
+	if stat, err := os.Stat(input); err == nil && !stat.IsDir() {
+		fileAbsPath, err := filepath.Abs(input)
+		if err != nil {
+			return errors.WithMessage(err, "Could not resolve filepath")
+		}
+		request.Request = &pb.ScrapeRequest_File{File: fileAbsPath}
+	} else if isInfoHash {
+		infoHash, err := hex.DecodeString(input)
+		if err != nil {
+			return errors.WithMessage(err, "Could not parse infohash")
+		}
+		request.Request = &pb.ScrapeRequest_TorrentRequest{TorrentRequest: &pb.TorrentRequest{InfoHash: infoHash}}
+	} else {
+		id, err := strconv.Atoi(input)
+		if err != nil {
+			return errors.WithMessage(err, "Could not parse ID or find torrent file")
+		}
+		request.Request = &pb.ScrapeRequest_TorrentRequest{TorrentRequest: &pb.TorrentRequest{Id: uint32(id)}}
+	}
+
+	reply, err := client.Scrape(ctx, &request)
+	if err != nil {
+		return errors.WithMessage(err, "Failed to scrape torrent")
+	}
+
+	for _, tr := range reply.Trackers {
+		if tr.GetError() != "" {
+			fmt.Printf("%-50s error: %s\n", tr.GetAnnounce(), tr.GetError())
+			continue
+		}
+		fmt.Printf("%-50s seeders: %d leechers: %d downloaded: %d\n", tr.GetAnnounce(), tr.GetComplete(), tr.GetIncomplete(), tr.GetDownloaded())
+	}
+
+	return nil
+}
+
+// Files lists a torrent's files, or changes the priority of the selected files (every file if none are selected) if
+// priority is set
+func Files(input string, isInfoHash bool, files []string, priority string) error {
+	// Set up a connection to the server.
+	serverAddr := "localhost:" + strconv.Itoa(config.GetConfig().Network.ServerPort)
+	conn, err := grpc.Dial(serverAddr, grpc.WithInsecure())
+	if err != nil {
+		return errors.WithMessage(err, "Did not connect")
+	}
+	defer conn.Close()
+
+	client := pb.NewTorrentServiceClient(conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var torrentRequest pb.TorrentRequest
+	if isInfoHash {
+		infoHash, err := hex.DecodeString(input)
+		if err != nil {
+			return errors.WithMessage(err, "Could not parse infohash")
+		}
+		torrentRequest.InfoHash = infoHash
+	} else {
+		id, err := strconv.Atoi(input)
+		if err != nil {
+			return errors.WithMessage(err, "Could not parse ID")
+		}
+		torrentRequest.Id = uint32(id)
+	}
+
+	if priority != "" {
+		value, ok := pb.File_Priority_value[strings.ToUpper(priority)]
+		if !ok {
+			return errors.Errorf("Unknown priority %s, use skip, low, normal or high", priority)
+		}
+		request := pb.PriorityRequest{TorrentRequest: &torrentRequest, Priority: pb.File_Priority(value)}
+		for _, file := range files {
+			index, err := strconv.Atoi(file)
+			if err != nil {
+				return errors.WithMessage(err, "Could not parse file index")
+			}
+			request.Files = append(request.Files, uint32(index))
+		}
+		if _, err = client.SetPriority(ctx, &request); err != nil {
+			return errors.WithMessage(err, "Failed to set file priority")
+		}
+		return nil
+	}
+
+	reply, err := client.Files(ctx, &torrentRequest)
+	if err != nil {
+		return errors.WithMessage(err, "Failed to list files")
+	}
+	for _, file := range reply.Files {
+		progress := 100.0
+		if file.GetLength() > 0 {
+			progress = float64(file.GetDone()) / float64(file.GetLength()) * 100
+		}
+		fmt.Printf("%d: %-50s size: %s progress: %.1f%% priority: %s\n", file.GetIndex(), file.GetPath(),
+			sizePretty(file.GetLength()), progress, strings.ToLower(file.GetPriority().String()))
+	}
+	return nil
+}
+
+// Order sets the order a torrent's pieces are downloaded in, rarest first unless sequential or firstLast is set
+func Order(input string, isInfoHash, sequential, firstLast bool) error {
+	// Set up a connection to the server.
+	serverAddr := "localhost:" + strconv.Itoa(config.GetConfig().Network.ServerPort)
+	conn, err := grpc.Dial(serverAddr, grpc.WithInsecure())
+	if err != nil {
+		return errors.WithMessage(err, "Did not connect")
+	}
+	defer conn.Close()
+
+	client := pb.NewTorrentServiceClient(conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var torrentRequest pb.TorrentRequest
+	if isInfoHash {
+		infoHash, err := hex.DecodeString(input)
+		if err != nil {
+			return errors.WithMessage(err, "Could not parse infohash")
+		}
+		torrentRequest.InfoHash = infoHash
+	} else {
+		id, err := strconv.Atoi(input)
+		if err != nil {
+			return errors.WithMessage(err, "Could not parse ID")
+		}
+		torrentRequest.Id = uint32(id)
+	}
+
+	request := pb.OrderRequest{TorrentRequest: &torrentRequest, Sequential: sequential, FirstLast: firstLast}
+	if _, err = client.SetOrder(ctx, &request); err != nil {
+		return errors.WithMessage(err, "Failed to set download order")
+	}
+	return nil
+}
+
 func torrentPrint(to *pb.Torrent) {
-	curr := to.GetTotalLength() - to.GetLeft()
-	progress := float64(curr) / float64(to.GetTotalLength()) * 100
+	curr := to.GetWanted() - uint64(to.GetLeft()) // Progress only counts the files that aren't skipped
+	progress := 100.0
+	if to.GetWanted() > 0 {
+		progress = float64(curr) / float64(to.GetWanted()) * 100
+	}
 
-	fmt.Printf("%d: %-50s %s %s %s %s %s %s\n",
+	order := "rarest first"
+	if to.GetSequential() {
+		order = "sequential"
+	}
+	if to.GetFirstLast() {
+		order += ", first and last pieces first"
+	}
+
+	fmt.Printf("%d: %-50s %s %s %s %s %s %s %s\n",
 		to.Id,
 		to.GetName(),
 		fmt.Sprintf("infohash: %s", hex.EncodeToString(to.GetInfoHash())),
-		fmt.Sprintf("size: %s", sizePretty(to.GetTotalLength())),
+		fmt.Sprintf("size: %s", sizePretty(uint64(to.GetTotalLength()))),
 		fmt.Sprintf("progress: %.1f%%", progress),
 		fmt.Sprintf("state: %s", to.GetState().String()),
 		fmt.Sprintf("download: %s", ratePretty(to.GetDownRate())),
 		fmt.Sprintf("upload: %s", ratePretty(to.GetUpRate())),
+		fmt.Sprintf("order: %s", order),
 	)
 }
 
+func trackerPrint(tr *pb.Tracker) {
+	status := "working"
+	if tr.GetFailure() != "" {
+		status = "failing: " + tr.GetFailure()
+	} else if !tr.GetWorking() {
+		status = "not working"
+	}
+	if tr.GetWarning() != "" {
+		status += fmt.Sprintf(" (warning: %s)", tr.GetWarning())
+	}
+	fmt.Printf("    tier %d: %-50s %s\n", tr.GetTier(), tr.GetAnnounce(), status)
+}
+
 func ratePretty(rate uint32) string {
 	floatRate := float64(rate)
 	suffix := "B/s"
@@ -240,7 +426,7 @@ func ratePretty(rate uint32) string {
 	return fmt.Sprintf("%.2f "+suffix, floatRate)
 }
 
-func sizePretty(size uint32) string {
+func sizePretty(size uint64) string {
 	floatSize := float64(size)
 	suffix := "B"
 	if floatSize >= 1024 {
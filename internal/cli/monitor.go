@@ -45,7 +45,7 @@ func Monitor() error {
 	for {
 		if err := callClear(); err != nil {
 			return err
-		} else if err = List(); err != nil {
+		} else if err = List(false); err != nil {
 			return err
 		}
 		time.Sleep(refreshTime)
@@ -8,6 +8,9 @@ import (
 	"math/rand"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/kylec725/graytorrent/internal/bitfield"
@@ -25,23 +28,54 @@ var (
 
 // TorrentInfo contains information about a torrent
 type TorrentInfo struct {
-	Name        string            `json:"Name"`
-	Paths       []Path            `json:"Paths"`
-	Bitfield    bitfield.Bitfield `json:"Bitfield"`    // bitfield of current pieces
-	PieceLength int               `json:"PieceLength"` // number of bytes per piece
-	TotalPieces int               `json:"TotalPieces"` // total pieces in the torrent
-	TotalLength int               `json:"TotalLength"` // total length of the torrent
-	Left        int               `json:"Left"`        // number of bytes left to torrent
-	InfoHash    [20]byte          `json:"InfoHash"`
-	PieceHashes [][20]byte        `json:"PieceHashes"`
-	PeerID      [20]byte          `json:"PeerID"`
-	Directory   string            `json:"Directory"` // What directory the torrent's file(s) will be
+	Uploaded      int64             `json:"Uploaded"`   // Bytes sent to peers over the torrent's lifetime, first so atomic access is aligned
+	Downloaded    int64             `json:"Downloaded"` // Bytes of verified pieces received over the torrent's lifetime, accessed atomically
+	Name          string            `json:"Name"`
+	Paths         []Path            `json:"Paths"`
+	Bitfield      bitfield.Bitfield `json:"Bitfield"`      // bitfield of current pieces
+	PieceLength   int               `json:"PieceLength"`   // number of bytes per piece
+	TotalPieces   int               `json:"TotalPieces"`   // total pieces in the torrent
+	TotalLength   int               `json:"TotalLength"`   // total length of the torrent
+	Left          int               `json:"Left"`          // number of bytes left to torrent in files that aren't skipped
+	InfoHash      [20]byte          `json:"InfoHash"`      // SHA-1 infohash, or the truncated SHA-256 infohash of v2 only torrents
+	PieceHashes   [][20]byte        `json:"PieceHashes"`   // Empty for v2 only torrents
+	InfoHashV2    [32]byte          `json:"InfoHashV2"`    // SHA-256 infohash of v2 and hybrid torrents (BEP 52)
+	PieceHashesV2 [][32]byte        `json:"PieceHashesV2"` // Merkle roots of each piece in v2 torrents, zero until the file's piece layer is known
+	PeerID        [20]byte          `json:"PeerID"`
+	Key           uint32            `json:"Key"`        // Sent to trackers so they know us if our IP changes, kept across restarts
+	Directory     string            `json:"Directory"`  // What directory the torrent's file(s) will be
+	Private       bool              `json:"Private"`    // Peers should only come from the torrent's trackers
+	WebSeeds      []string          `json:"WebSeeds"`   // HTTP mirrors of the torrent's files (BEP 19)
+	Sequential    bool              `json:"Sequential"` // Pieces are downloaded in order, so files can be played while downloading
+	FirstLast     bool              `json:"FirstLast"`  // The first and last pieces of each file are downloaded before the rest
+	Metadata      []byte            `json:"Metadata"`   // Bencoded info dictionary, served to peers that got the torrent from a magnet link
 }
 
 // Path stores info about each file in a torrent
 type Path struct {
-	Length int    `json:"Length"`
-	Path   string `json:"Path"`
+	Length     int      `json:"Length"`
+	Path       string   `json:"Path"`
+	Pad        bool     `json:"Pad"`        // Padding that aligns the next file to a piece, never stored on disk
+	PiecesRoot [32]byte `json:"PiecesRoot"` // Merkle root of the file's blocks in v2 and hybrid torrents
+	Executable bool     `json:"Executable"` // Set the executable bits once the file is complete
+	Hidden     bool     `json:"Hidden"`     // Hidden file, which names starting with a dot already are on unix
+	Symlink    string   `json:"Symlink"`    // Target of a symlink, relative to the torrent's directory
+	Priority   Priority `json:"Priority"`   // Whether and how soon the file is downloaded
+}
+
+// HasData returns whether the path's part of the pieces is stored on disk, padding and symlinks have none
+func (path Path) HasData() bool {
+	return !path.Pad && path.Symlink == ""
+}
+
+// setAttr applies a file's attributes (BEP 47), root is the directory that symlink paths are relative to
+func (path *Path) setAttr(attr string, symlinkPath []string, root string) {
+	path.Pad = strings.Contains(attr, "p")
+	path.Executable = strings.Contains(attr, "x")
+	path.Hidden = strings.Contains(attr, "h")
+	if strings.Contains(attr, "l") && len(symlinkPath) > 0 {
+		path.Symlink = filepath.Join(root, filepath.Join(symlinkPath...))
+	}
 }
 
 // Min returns the minimum of two integers
@@ -52,7 +86,7 @@ func Min(x, y int) int {
 	return y
 }
 
-// SetPeerID sets a new peer ID
+// SetPeerID sets a new peer ID along with a new tracker key
 func (info *TorrentInfo) SetPeerID() {
 	rand.Seed(time.Now().UnixNano())
 	const chars = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
@@ -66,14 +100,60 @@ func (info *TorrentInfo) SetPeerID() {
 	for i, c := range id {
 		info.PeerID[i] = byte(c)
 	}
+	info.SetKey()
+}
+
+// SetKey sets a new random tracker key, which is never zero so that torrents saved without one can be told apart
+func (info *TorrentInfo) SetKey() {
+	info.Key = rand.Uint32()
+	for info.Key == 0 {
+		info.Key = rand.Uint32()
+	}
+}
+
+// AddUploaded counts bytes sent to a peer
+func (info *TorrentInfo) AddUploaded(n int) {
+	atomic.AddInt64(&info.Uploaded, int64(n))
+}
+
+// AddDownloaded counts bytes of a verified piece
+func (info *TorrentInfo) AddDownloaded(n int) {
+	atomic.AddInt64(&info.Downloaded, int64(n))
+}
+
+// Transferred returns the bytes uploaded and downloaded over the torrent's lifetime
+func (info *TorrentInfo) Transferred() (int, int) {
+	return int(atomic.LoadInt64(&info.Uploaded)), int(atomic.LoadInt64(&info.Downloaded))
+}
+
+// V2 returns whether the torrent is a v2 or hybrid torrent
+func (info *TorrentInfo) V2() bool {
+	return info.InfoHashV2 != [32]byte{}
+}
+
+// TruncatedV2 returns the first 20 bytes of the v2 infohash, which v2 peers use in place of the SHA-1 infohash
+func (info *TorrentInfo) TruncatedV2() [20]byte {
+	var truncated [20]byte
+	copy(truncated[:], info.InfoHashV2[:])
+	return truncated
+}
+
+// MatchesInfoHash returns whether a handshake's infohash refers to the torrent, hybrid torrents also match their truncated v2 infohash
+func (info *TorrentInfo) MatchesInfoHash(infoHash [20]byte) bool {
+	return infoHash == info.InfoHash || (info.V2() && infoHash == info.TruncatedV2())
 }
 
 // GetPaths retrieves the paths from metainfo
 func GetPaths(m metainfo.Metainfo) []Path {
+	if m.V2() {
+		return getPathsV2(m)
+	}
+
 	// Single file
-	if m.Info.Length > 0 {
+	if m.Info.Length > 0 || len(m.Info.Files) == 0 {
 		paths := make([]Path, 1)
 		paths[0] = Path{Length: m.Info.Length, Path: m.Info.Name}
+		paths[0].setAttr(m.Info.Attr, m.Info.SymlinkPath, "")
 		return paths
 	}
 
@@ -82,12 +162,38 @@ func GetPaths(m metainfo.Metainfo) []Path {
 	for _, file := range m.Info.Files {
 		newPath := filepath.Join(file.Path...)
 		newPath = filepath.Join(m.Info.Name, newPath)
-		paths = append(paths, Path{Length: file.Length, Path: newPath})
+		path := Path{Length: file.Length, Path: newPath}
+		path.setAttr(file.Attr, file.SymlinkPath, m.Info.Name)
+		paths = append(paths, path)
 	}
 
 	return paths
 }
 
+// getPathsV2 retrieves the paths from a v2 file tree, every file starts at a new piece so padding follows files that don't end on one
+func getPathsV2(m metainfo.Metainfo) []Path {
+	files := m.Info.FileTree
+	// A single file torrent's tree only contains the torrent's name
+	if len(files) == 1 && len(files[0].Path) == 1 && files[0].Path[0] == m.Info.Name {
+		path := Path{Length: files[0].Length, Path: m.Info.Name, PiecesRoot: files[0].PiecesRoot}
+		path.setAttr(files[0].Attr, files[0].SymlinkPath, "")
+		return []Path{path}
+	}
+
+	var paths []Path
+	for i, file := range files {
+		newPath := filepath.Join(m.Info.Name, filepath.Join(file.Path...))
+		path := Path{Length: file.Length, Path: newPath, PiecesRoot: file.PiecesRoot}
+		path.setAttr(file.Attr, file.SymlinkPath, m.Info.Name)
+		paths = append(paths, path)
+		if padLength := (m.Info.PieceLength - file.Length%m.Info.PieceLength) % m.Info.PieceLength; padLength > 0 && i < len(files)-1 {
+			padPath := filepath.Join(m.Info.Name, ".pad", strconv.Itoa(padLength))
+			paths = append(paths, Path{Length: padLength, Path: padPath, Pad: true})
+		}
+	}
+	return paths
+}
+
 // PieceSize returns the size of a piece at a specified index
 func (info *TorrentInfo) PieceSize(index int) int {
 	if index == info.TotalPieces-1 {
@@ -10,7 +10,11 @@ type contextKey string // Custom key types are recommended
 
 // Context keys
 var (
-	KeyPort = contextKey("port")
+	KeyPort       = contextKey("port")
+	KeyDHT        = contextKey("dht")        // The session's DHT node, unset if the DHT is disabled
+	KeyUTP        = contextKey("utp")        // The session's uTP socket
+	KeyLSD        = contextKey("lsd")        // The session's local service discovery, unset if it is disabled
+	KeyUDPTracker = contextKey("udptracker") // The session's UDP tracker client
 )
 
 // Port returns the port number from the current context
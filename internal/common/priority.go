@@ -0,0 +1,121 @@
+package common
+
+import "strings"
+
+// Priority controls whether and how soon a file is downloaded
+type Priority uint8
+
+// File priorities, normal is the zero value so that saves from older versions download every file
+const (
+	PriorityNormal Priority = iota
+	PrioritySkip            // Not downloaded, unless it shares pieces with other files
+	PriorityLow
+	PriorityHigh
+)
+
+func (priority Priority) String() string {
+	switch priority {
+	case PriorityNormal:
+		return "Normal"
+	case PrioritySkip:
+		return "Skip"
+	case PriorityLow:
+		return "Low"
+	case PriorityHigh:
+		return "High"
+	default:
+		return "Unknown"
+	}
+}
+
+// ParsePriority reads a priority from its name
+func ParsePriority(name string) (Priority, bool) {
+	for _, priority := range []Priority{PriorityNormal, PrioritySkip, PriorityLow, PriorityHigh} {
+		if strings.EqualFold(name, priority.String()) {
+			return priority, true
+		}
+	}
+	return PriorityNormal, false
+}
+
+// Rank orders priorities from skip to high, for comparing them
+func (priority Priority) Rank() int {
+	switch priority {
+	case PrioritySkip:
+		return 0
+	case PriorityLow:
+		return 1
+	case PriorityHigh:
+		return 3
+	default:
+		return 2
+	}
+}
+
+// PiecePriorities returns the priority of each piece, which is the highest priority of the files it is part of.
+// Torrents without any files, such as ones still fetching their metadata, download every piece
+func (info *TorrentInfo) PiecePriorities() []Priority {
+	priorities := make([]Priority, info.TotalPieces)
+	if len(info.Paths) == 0 {
+		return priorities
+	}
+	for i := range priorities {
+		priorities[i] = PrioritySkip
+	}
+
+	offset := 0 // Offset of the current file in the torrent
+	for _, path := range info.Paths {
+		start, end := offset, offset+path.Length
+		offset = end
+		if !path.HasData() || path.Length == 0 {
+			continue
+		}
+		for i := start / info.PieceLength; i <= (end-1)/info.PieceLength && i < info.TotalPieces; i++ {
+			if path.Priority.Rank() > priorities[i].Rank() {
+				priorities[i] = path.Priority
+			}
+		}
+	}
+	return priorities
+}
+
+// FirstLastPieces returns which pieces are the first or last piece of a file that isn't skipped, media files often
+// need both ends of the file to start playing
+func (info *TorrentInfo) FirstLastPieces() []bool {
+	firstLast := make([]bool, info.TotalPieces)
+	offset := 0 // Offset of the current file in the torrent
+	for _, path := range info.Paths {
+		start, end := offset, offset+path.Length
+		offset = end
+		if !path.HasData() || path.Length == 0 || path.Priority == PrioritySkip {
+			continue
+		}
+		for _, i := range []int{start / info.PieceLength, (end - 1) / info.PieceLength} {
+			if i < info.TotalPieces {
+				firstLast[i] = true
+			}
+		}
+	}
+	return firstLast
+}
+
+// WantedLength returns the number of bytes in the pieces of files that aren't skipped
+func (info *TorrentInfo) WantedLength() int {
+	length := 0
+	for i, priority := range info.PiecePriorities() {
+		if priority != PrioritySkip {
+			length += info.PieceSize(i)
+		}
+	}
+	return length
+}
+
+// UpdateLeft counts the bytes left in the pieces of files that aren't skipped
+func (info *TorrentInfo) UpdateLeft() {
+	info.Left = 0
+	for i, priority := range info.PiecePriorities() {
+		if priority != PrioritySkip && !info.Bitfield.Has(i) {
+			info.Left += info.PieceSize(i)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/dht"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/viper"
 )
@@ -10,6 +11,7 @@ import (
 type Config struct {
 	Torrent TorrentConfig
 	Network NetworkConfig
+	Tracker TrackerConfig
 }
 
 // TorrentConfig provides settings for torrents
@@ -20,11 +22,24 @@ type TorrentConfig struct {
 
 // NetworkConfig provides settings for network options
 type NetworkConfig struct {
-	ListenerPort          []int  `mapstructure:"listener_port"`
-	ServerAddress         string `mapstructure:"server_port"`
-	ServerPort            int    `mapstructure:"server_port"`
-	MaxGlobalConnections  int    `mapstructure:"max_global_connections"`
-	MaxTorrentConnections int    `mapstructure:"max_torrent_connections"`
+	ListenerPort          []int    `mapstructure:"listener_port"`
+	ServerAddress         string   `mapstructure:"server_port"`
+	ServerPort            int      `mapstructure:"server_port"`
+	MaxGlobalConnections  int      `mapstructure:"max_global_connections"`
+	MaxTorrentConnections int      `mapstructure:"max_torrent_connections"`
+	DHT                   bool     `mapstructure:"dht"`
+	DHTBootstrap          []string `mapstructure:"dht_bootstrap"`
+	Encryption            string   `mapstructure:"encryption"` // disabled, prefer or require
+	PreferUTP             bool     `mapstructure:"prefer_utp"` // Try uTP before TCP when connecting to peers
+	LSD                   bool     `mapstructure:"lsd"`        // Find peers on the local network
+}
+
+// TrackerConfig provides settings for the embedded tracker
+type TrackerConfig struct {
+	Enabled  bool     `mapstructure:"enabled"`
+	Port     int      `mapstructure:"port"`     // Used for both HTTP and UDP
+	Interval int      `mapstructure:"interval"` // Seconds between announces
+	Allowed  []string `mapstructure:"allowed"`  // Hex infohashes of the tracked torrents, every torrent is tracked if empty
 }
 
 // InitConfig initializes the config file and default values
@@ -36,6 +51,15 @@ func InitConfig() {
 	viper.SetDefault("network.max_torrent_connections", 30)
 	viper.SetDefault("network.server_address", "localhost")
 	viper.SetDefault("network.server_port", 7001)
+	viper.SetDefault("network.dht", true)
+	viper.SetDefault("network.dht_bootstrap", dht.DefaultBootstrap)
+	viper.SetDefault("network.encryption", "prefer")
+	viper.SetDefault("network.prefer_utp", true)
+	viper.SetDefault("network.lsd", true)
+	viper.SetDefault("tracker.enabled", false)
+	viper.SetDefault("tracker.port", 6969)
+	viper.SetDefault("tracker.interval", 1800)
+	viper.SetDefault("tracker.allowed", []string{})
 
 	viper.SetConfigName("config")
 	viper.SetConfigType("toml")
@@ -4,7 +4,6 @@ import (
 	"net"
 	"os"
 	"strconv"
-	"strings"
 
 	"github.com/pkg/errors"
 )
@@ -25,7 +24,7 @@ func OpenPort(portRange []int) (uint16, error) {
 		return 0, errors.Wrap(ErrBadPortRange, "OpenPort")
 	}
 	for port := portRange[0]; port <= portRange[1]; port++ {
-		_, err := net.Dial("tcp", hostname+":"+strconv.Itoa(port))
+		_, err := net.Dial("tcp", net.JoinHostPort(hostname, strconv.Itoa(port)))
 		if err != nil {
 			return uint16(port), nil
 		}
@@ -33,11 +32,13 @@ func OpenPort(portRange []int) (uint16, error) {
 	return 0, errors.Wrap(ErrNoOpenPort, "OpenPort")
 }
 
-// PortFromAddr returns the port from a string address
+// PortFromAddr returns the port from a string address, IPv6 hosts must be in brackets
 func PortFromAddr(addr string) (uint16, error) {
-	split := strings.Split(addr, ":")
-	portString := split[len(split)-1]
-	port, err := strconv.Atoi(portString)
+	_, portString, err := net.SplitHostPort(addr)
+	if err != nil {
+		return 0, errors.Wrap(err, "PortFromAddr")
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
 	if err != nil {
 		return 0, errors.Wrap(err, "PortFromAddr")
 	}
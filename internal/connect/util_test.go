@@ -28,3 +28,19 @@ func TestPortFromAddr(t *testing.T) {
 		assert.Equal(uint16(5000), port)
 	}
 }
+
+func TestPortFromAddrIPv6(t *testing.T) {
+	assert := assert.New(t)
+
+	port, err := PortFromAddr("[2001:db8::1]:6881")
+	if assert.Nil(err) {
+		assert.Equal(uint16(6881), port)
+	}
+	port, err = PortFromAddr("[::]:51413")
+	if assert.Nil(err) {
+		assert.Equal(uint16(51413), port)
+	}
+
+	_, err = PortFromAddr("2001:db8::1")
+	assert.NotNil(err)
+}
@@ -0,0 +1,638 @@
+/*
+Package dht implements a Mainline DHT node (BEP 5) for finding peers
+without trackers. Nodes speak KRPC over UDP and keep a Kademlia
+routing table that can be saved between sessions.
+*/
+package dht
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const alpha = 3                       // Number of queries a lookup sends out at once
+const queryTimeout = 5 * time.Second  // How long to wait for a response to a query
+const tokenRotation = 5 * time.Minute // How often the secret for announce tokens changes
+const refreshTime = 15 * time.Minute  // How often to refresh the routing table
+const peerExpiry = 30 * time.Minute   // How long to store peers that announced to us
+const maxStoredPeers = 100            // Max peers to store and return per infohash
+const maxPacketSize = 65535
+
+// Errors
+var (
+	ErrTimeout = errors.New("Query timed out")
+	ErrClosed  = errors.New("DHT node is closed")
+	ErrNoNodes = errors.New("Routing table has no nodes")
+)
+
+// DefaultBootstrap are well known routers used to join the DHT
+var DefaultBootstrap = []string{
+	"router.bittorrent.com:6881",
+	"dht.transmissionbt.com:6881",
+	"router.utorrent.com:6881",
+}
+
+// DHT is a node in the Mainline DHT
+type DHT struct {
+	ID nodeID
+
+	conn       net.PacketConn
+	ipv6       bool // Whether the socket can reach IPv6 nodes
+	table      *table
+	mu         sync.Mutex
+	pending    map[string]chan krpcMsg           // Outstanding queries by transaction ID
+	txID       uint16                            // Last transaction ID that was used
+	peers      map[[20]byte]map[string]time.Time // Peers that announced to us by infohash
+	secret     []byte
+	prevSecret []byte
+	done       chan struct{}
+}
+
+// New creates a DHT node that communicates over conn
+func New(conn net.PacketConn) *DHT {
+	id := randomID()
+	d := &DHT{
+		ID:      id,
+		conn:    conn,
+		table:   newTable(id),
+		pending: make(map[string]chan krpcMsg),
+		peers:   make(map[[20]byte]map[string]time.Time),
+		done:    make(chan struct{}),
+	}
+	if conn != nil {
+		if addr, ok := conn.LocalAddr().(*net.UDPAddr); ok {
+			d.ipv6 = addr.IP.To4() == nil // Sockets bound to :: are dual-stack
+		}
+	}
+	d.secret = newSecret()
+	d.prevSecret = d.secret
+	return d
+}
+
+// FromContext returns the session's DHT node from the context, if there is one
+func FromContext(ctx context.Context) (*DHT, bool) {
+	d, ok := ctx.Value(common.KeyDHT).(*DHT)
+	return d, ok && d != nil
+}
+
+// Port returns the UDP port the node is listening on
+func (d *DHT) Port() uint16 {
+	if addr, ok := d.conn.LocalAddr().(*net.UDPAddr); ok {
+		return uint16(addr.Port)
+	}
+	return 0
+}
+
+// Nodes returns the number of nodes in the routing table
+func (d *DHT) Nodes() int {
+	return d.table.len()
+}
+
+// Run handles incoming packets and maintains the routing table until the node is closed
+func (d *DHT) Run() {
+	go d.maintain()
+
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := d.conn.ReadFrom(buf)
+		if err != nil {
+			select {
+			case <-d.done:
+				return
+			default:
+			}
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				continue
+			}
+			log.WithField("error", err.Error()).Debug("DHT read failed")
+			return
+		}
+		udpAddr, ok := addr.(*net.UDPAddr)
+		if !ok {
+			continue
+		}
+		msg, err := decodeMsg(buf[:n])
+		if err != nil {
+			continue
+		}
+		d.handleMsg(msg, udpAddr)
+	}
+}
+
+// Close stops the node
+func (d *DHT) Close() error {
+	select {
+	case <-d.done:
+		return nil
+	default:
+	}
+	close(d.done)
+	return d.conn.Close()
+}
+
+// maintain rotates token secrets, expires stored peers and refreshes the routing table
+func (d *DHT) maintain() {
+	tokenTicker := time.NewTicker(tokenRotation)
+	refreshTicker := time.NewTicker(refreshTime)
+	defer tokenTicker.Stop()
+	defer refreshTicker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case <-tokenTicker.C:
+			d.mu.Lock()
+			d.prevSecret = d.secret
+			d.secret = newSecret()
+			for infoHash, peers := range d.peers {
+				for addr, announced := range peers {
+					if time.Since(announced) > peerExpiry {
+						delete(peers, addr)
+					}
+				}
+				if len(peers) == 0 {
+					delete(d.peers, infoHash)
+				}
+			}
+			d.mu.Unlock()
+		case <-refreshTicker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+			d.lookup(ctx, randomID(), false)
+			cancel()
+		}
+	}
+}
+
+// Bootstrap joins the DHT through the given nodes by looking up our own ID
+func (d *DHT) Bootstrap(ctx context.Context, addrs []string) {
+	var wg sync.WaitGroup
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			if err := d.Ping(addr); err != nil {
+				log.WithFields(log.Fields{"node": addr, "error": err.Error()}).Debug("DHT bootstrap node did not respond")
+			}
+		}(addr)
+	}
+	wg.Wait()
+	d.lookup(ctx, d.ID, false)
+	log.WithField("nodes", d.table.len()).Debug("DHT bootstrapped")
+}
+
+// Ping sends a ping to a node and adds it to the routing table if it responds
+func (d *DHT) Ping(addr string) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return errors.Wrap(err, "Ping")
+	}
+	_, err = d.query(udpAddr, "ping", map[string]interface{}{})
+	return errors.Wrap(err, "Ping")
+}
+
+// GetPeers searches the DHT for peers of a torrent
+func (d *DHT) GetPeers(ctx context.Context, infoHash [20]byte) ([]string, error) {
+	if d.table.len() == 0 {
+		return nil, errors.Wrap(ErrNoNodes, "GetPeers")
+	}
+	peers, _ := d.lookup(ctx, infoHash, true)
+	return peers, nil
+}
+
+// Announce searches the DHT for peers of a torrent, then announces that we are downloading it on the given port
+func (d *DHT) Announce(ctx context.Context, infoHash [20]byte, port uint16) ([]string, error) {
+	if d.table.len() == 0 {
+		return nil, errors.Wrap(ErrNoNodes, "Announce")
+	}
+	peers, closest := d.lookup(ctx, infoHash, true)
+
+	var wg sync.WaitGroup
+	for _, c := range closest {
+		wg.Add(1)
+		go func(c contact) {
+			defer wg.Done()
+			args := map[string]interface{}{
+				"info_hash":    string(infoHash[:]),
+				"port":         int(port),
+				"token":        c.token,
+				"implied_port": 0,
+			}
+			if _, err := d.query(c.addr, "announce_peer", args); err != nil {
+				log.WithFields(log.Fields{"node": c.addr.String(), "error": err.Error()}).Trace("DHT announce failed")
+			}
+		}(c)
+	}
+	wg.Wait()
+	return peers, nil
+}
+
+// contact is a node that responded during a lookup
+type contact struct {
+	addr  *net.UDPAddr
+	token string
+}
+
+// lookup iteratively queries the nodes closest to target, returning any peers found and the closest nodes that responded
+func (d *DHT) lookup(ctx context.Context, target nodeID, getPeers bool) ([]string, []contact) {
+	type result struct {
+		n     *node
+		resp  map[string]interface{}
+		err   error
+		token string
+	}
+
+	shortlist := d.table.closest(target, k)
+	seen := make(map[string]bool)
+	for _, n := range shortlist {
+		seen[n.addr.String()] = true
+	}
+	queried := make(map[string]bool)
+	tokens := make(map[string]string)
+	peerSet := make(map[string]bool)
+	var peers []string
+	var responded []*node
+
+	method, key := "find_node", "target"
+	if getPeers {
+		method, key = "get_peers", "info_hash"
+	}
+	newArgs := func() map[string]interface{} { // Each query gets its own arguments since query adds our ID
+		args := map[string]interface{}{key: string(target[:])}
+		if d.ipv6 {
+			args["want"] = []interface{}{"n4", "n6"}
+		}
+		return args
+	}
+
+	results := make(chan result)
+	inflight := 0
+	for {
+		// Query the closest nodes we haven't asked yet
+		for _, n := range shortlist {
+			if inflight >= alpha {
+				break
+			}
+			if queried[n.addr.String()] {
+				continue
+			}
+			queried[n.addr.String()] = true
+			inflight++
+			go func(n *node) {
+				resp, err := d.query(n.addr, method, newArgs())
+				select {
+				case results <- result{n: n, resp: resp, err: err, token: str(resp, "token")}:
+				case <-ctx.Done():
+				}
+			}(n)
+		}
+		if inflight == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return peers, nil
+		case res := <-results:
+			inflight--
+			if res.err != nil {
+				continue
+			}
+			responded = append(responded, res.n)
+			if res.token != "" {
+				tokens[res.n.addr.String()] = res.token
+			}
+			if values, ok := res.resp["values"].([]interface{}); ok {
+				for _, value := range values {
+					compact, _ := value.(string)
+					if addr, ok := decodePeer(compact); ok && !peerSet[addr] {
+						peerSet[addr] = true
+						peers = append(peers, addr)
+					}
+				}
+			}
+			found := decodeNodes(str(res.resp, "nodes"), net.IPv4len)
+			if d.ipv6 {
+				found = append(found, decodeNodes(str(res.resp, "nodes6"), net.IPv6len)...)
+			}
+			for _, n := range found {
+				if !seen[n.addr.String()] {
+					seen[n.addr.String()] = true
+					shortlist = append(shortlist, n)
+				}
+			}
+			sortByDistance(shortlist, target)
+			if len(shortlist) > k*2 { // Keep some extra candidates in case the closest don't respond
+				shortlist = shortlist[:k*2]
+			}
+		}
+	}
+
+	sortByDistance(responded, target)
+	var closest []contact
+	for _, n := range responded {
+		if len(closest) == k {
+			break
+		}
+		if token, ok := tokens[n.addr.String()]; ok {
+			closest = append(closest, contact{addr: n.addr, token: token})
+		}
+	}
+	return peers, closest
+}
+
+// query sends a query to a node and waits for its response
+func (d *DHT) query(addr *net.UDPAddr, method string, args map[string]interface{}) (map[string]interface{}, error) {
+	d.mu.Lock()
+	d.txID++
+	tx := make([]byte, 2)
+	binary.BigEndian.PutUint16(tx, d.txID)
+	response := make(chan krpcMsg, 1)
+	d.pending[string(tx)] = response
+	d.mu.Unlock()
+
+	defer func() {
+		d.mu.Lock()
+		delete(d.pending, string(tx))
+		d.mu.Unlock()
+	}()
+
+	args["id"] = string(d.ID[:])
+	if err := d.send(addr, krpcMsg{"t": string(tx), "y": "q", "q": method, "a": args}); err != nil {
+		return nil, errors.Wrap(err, "query")
+	}
+
+	select {
+	case msg := <-response:
+		if str(msg, "y") == "e" {
+			return nil, errors.Wrap(ErrRemote, "query")
+		}
+		resp := dict(msg, "r")
+		id, ok := readID(resp, "id")
+		if !ok {
+			return nil, errors.Wrap(ErrMalformed, "query")
+		}
+		d.table.insert(&node{id: id, addr: addr, lastSeen: time.Now()})
+		return resp, nil
+	case <-time.After(queryTimeout):
+		d.forget(addr)
+		return nil, errors.Wrap(ErrTimeout, "query")
+	case <-d.done:
+		return nil, errors.Wrap(ErrClosed, "query")
+	}
+}
+
+// forget removes an unresponsive node from the routing table
+func (d *DHT) forget(addr *net.UDPAddr) {
+	for _, n := range d.table.nodes() {
+		if n.addr.String() == addr.String() {
+			d.table.remove(n.id)
+		}
+	}
+}
+
+func (d *DHT) send(addr *net.UDPAddr, msg krpcMsg) error {
+	data, err := encodeMsg(msg)
+	if err != nil {
+		return errors.Wrap(err, "send")
+	}
+	_, err = d.conn.WriteTo(data, addr)
+	return errors.Wrap(err, "send")
+}
+
+// handleMsg routes responses to their queries and answers incoming queries
+func (d *DHT) handleMsg(msg krpcMsg, addr *net.UDPAddr) {
+	switch str(msg, "y") {
+	case "r", "e":
+		d.mu.Lock()
+		response, ok := d.pending[str(msg, "t")]
+		d.mu.Unlock()
+		if ok {
+			select {
+			case response <- msg:
+			default:
+			}
+		}
+	case "q":
+		d.handleQuery(msg, addr)
+	}
+}
+
+func (d *DHT) handleQuery(msg krpcMsg, addr *net.UDPAddr) {
+	tx := str(msg, "t")
+	args := dict(msg, "a")
+	id, ok := readID(args, "id")
+	if !ok {
+		d.sendError(addr, tx, errProtocol, "Invalid id")
+		return
+	}
+	d.table.insert(&node{id: id, addr: addr, lastSeen: time.Now()})
+
+	resp := map[string]interface{}{"id": string(d.ID[:])}
+	switch str(msg, "q") {
+	case "ping":
+	case "find_node":
+		target, ok := readID(args, "target")
+		if !ok {
+			d.sendError(addr, tx, errProtocol, "Invalid target")
+			return
+		}
+		d.addNodes(resp, args, addr, target)
+	case "get_peers":
+		infoHash, ok := readID(args, "info_hash")
+		if !ok {
+			d.sendError(addr, tx, errProtocol, "Invalid info_hash")
+			return
+		}
+		resp["token"] = d.token(addr.IP, d.currentSecret())
+		if values := d.storedPeers(infoHash, addr.IP.To4() == nil); len(values) > 0 {
+			resp["values"] = values
+		} else {
+			d.addNodes(resp, args, addr, infoHash)
+		}
+	case "announce_peer":
+		infoHash, ok := readID(args, "info_hash")
+		if !ok {
+			d.sendError(addr, tx, errProtocol, "Invalid info_hash")
+			return
+		}
+		if !d.validToken(str(args, "token"), addr.IP) {
+			d.sendError(addr, tx, errProtocol, "Bad token")
+			return
+		}
+		port, _ := integer(args, "port")
+		if implied, _ := integer(args, "implied_port"); implied != 0 {
+			port = int64(addr.Port)
+		}
+		if port <= 0 || port > 65535 {
+			d.sendError(addr, tx, errProtocol, "Invalid port")
+			return
+		}
+		d.storePeer(infoHash, encodePeer(addr.IP, int(port)))
+	default:
+		d.sendError(addr, tx, errMethod, "Method Unknown")
+		return
+	}
+
+	if err := d.send(addr, krpcMsg{"t": tx, "y": "r", "r": resp}); err != nil {
+		log.WithFields(log.Fields{"node": addr.String(), "error": err.Error()}).Trace("DHT response failed")
+	}
+}
+
+// addNodes adds the closest nodes to a response, in the address families the querying node wants (BEP 32)
+func (d *DHT) addNodes(resp, args map[string]interface{}, addr *net.UDPAddr, target nodeID) {
+	n4, n6 := addr.IP.To4() != nil, addr.IP.To4() == nil // Same family as the query by default
+	if want, ok := args["want"].([]interface{}); ok {
+		n4, n6 = false, false
+		for _, w := range want {
+			switch w {
+			case "n4":
+				n4 = true
+			case "n6":
+				n6 = true
+			}
+		}
+	}
+
+	closest := d.table.closest(target, d.table.len()) // Both families are ranked together
+	if n4 {
+		resp["nodes"] = encodeNodes(closest, net.IPv4len)
+	}
+	if n6 {
+		resp["nodes6"] = encodeNodes(closest, net.IPv6len)
+	}
+}
+
+func (d *DHT) sendError(addr *net.UDPAddr, tx string, code int, reason string) {
+	d.send(addr, krpcMsg{"t": tx, "y": "e", "e": []interface{}{code, reason}})
+}
+
+func (d *DHT) storePeer(infoHash [20]byte, compact string) {
+	if compact == "" {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	peers, ok := d.peers[infoHash]
+	if !ok {
+		peers = make(map[string]time.Time)
+		d.peers[infoHash] = peers
+	}
+	if _, ok := peers[compact]; !ok && len(peers) >= maxStoredPeers {
+		return
+	}
+	peers[compact] = time.Now()
+}
+
+// storedPeers returns the peers of one address family that announced a torrent
+func (d *DHT) storedPeers(infoHash [20]byte, ipv6 bool) []interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var values []interface{}
+	for compact := range d.peers[infoHash] {
+		if (len(compact) == compactPeer6Len) == ipv6 {
+			values = append(values, compact)
+		}
+	}
+	return values
+}
+
+func newSecret() []byte {
+	secret := make([]byte, 8)
+	rand.Read(secret)
+	return secret
+}
+
+func (d *DHT) currentSecret() []byte {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.secret
+}
+
+// token returns the announce token for an IP address, tokens are only valid for the node they were given to
+func (d *DHT) token(ip net.IP, secret []byte) string {
+	hash := sha1.Sum(append(append([]byte{}, ip...), secret...))
+	return string(hash[:8])
+}
+
+func (d *DHT) validToken(token string, ip net.IP) bool {
+	d.mu.Lock()
+	secret, prevSecret := d.secret, d.prevSecret
+	d.mu.Unlock()
+	return token == d.token(ip, secret) || token == d.token(ip, prevSecret)
+}
+
+type savedTable struct {
+	ID    string      `json:"ID"`
+	Nodes []savedNode `json:"Nodes"`
+}
+
+type savedNode struct {
+	ID   string `json:"ID"`
+	Addr string `json:"Addr"`
+}
+
+// Save writes the node's ID and routing table to a file
+func (d *DHT) Save(filename string) error {
+	saved := savedTable{ID: hex.EncodeToString(d.ID[:])}
+	for _, n := range d.table.nodes() {
+		saved.Nodes = append(saved.Nodes, savedNode{ID: hex.EncodeToString(n.id[:]), Addr: n.addr.String()})
+	}
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return errors.Wrap(err, "Save")
+	}
+	err = ioutil.WriteFile(filename, data, 0644)
+	return errors.Wrap(err, "Save")
+}
+
+// Load restores the node's ID and routing table from a file, it should be called before Run
+func (d *DHT) Load(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) { // Nothing saved yet
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "Load")
+	}
+
+	var saved savedTable
+	if err = json.Unmarshal(data, &saved); err != nil {
+		return errors.Wrap(err, "Load")
+	}
+	id, err := hex.DecodeString(saved.ID)
+	if err != nil || len(id) != len(d.ID) {
+		return errors.Wrap(ErrMalformed, "Load")
+	}
+	copy(d.ID[:], id)
+	d.table = newTable(d.ID)
+
+	// Saved nodes are treated as stale so they are replaced by any nodes that respond
+	for _, sn := range saved.Nodes {
+		var n node
+		id, err := hex.DecodeString(sn.ID)
+		if err != nil || len(id) != len(n.id) {
+			continue
+		}
+		copy(n.id[:], id)
+		if n.addr, err = net.ResolveUDPAddr("udp", sn.Addr); err != nil {
+			continue
+		}
+		d.table.insert(&n)
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package dht
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestNode(t *testing.T) *DHT {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.Nil(t, err)
+	d := New(conn)
+	go d.Run()
+	t.Cleanup(func() { d.Close() })
+	return d
+}
+
+func (d *DHT) addr() string {
+	return d.conn.LocalAddr().String()
+}
+
+func TestAnnounceGetPeers(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Every node joins through the first one
+	nodes := make([]*DHT, 6)
+	for i := range nodes {
+		nodes[i] = newTestNode(t)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, d := range nodes[1:] {
+		d.Bootstrap(ctx, []string{nodes[0].addr()})
+	}
+	for _, d := range nodes {
+		assert.NotZero(d.Nodes())
+	}
+
+	var infoHash [20]byte
+	copy(infoHash[:], "aaaaaaaaaaaaaaaaaaaa")
+
+	// Nobody has announced yet
+	peers, err := nodes[1].GetPeers(ctx, infoHash)
+	require.Nil(err)
+	assert.Empty(peers)
+
+	_, err = nodes[1].Announce(ctx, infoHash, 6881)
+	require.Nil(err)
+
+	peers, err = nodes[len(nodes)-1].GetPeers(ctx, infoHash)
+	require.Nil(err)
+	assert.Equal([]string{"127.0.0.1:6881"}, peers)
+}
+
+func TestGetPeersNoNodes(t *testing.T) {
+	d := newTestNode(t)
+	_, err := d.GetPeers(context.Background(), [20]byte{})
+	assert.ErrorIs(t, err, ErrNoNodes)
+}
+
+func TestAnnounceBadToken(t *testing.T) {
+	assert := assert.New(t)
+
+	a, b := newTestNode(t), newTestNode(t)
+	udpAddr, _ := net.ResolveUDPAddr("udp4", b.addr())
+
+	args := map[string]interface{}{"info_hash": string(make([]byte, 20)), "port": 6881, "token": "bad"}
+	_, err := a.query(udpAddr, "announce_peer", args)
+	assert.ErrorIs(err, ErrRemote)
+	assert.Empty(b.storedPeers([20]byte{}, false))
+}
+
+func TestSaveLoad(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	a, b := newTestNode(t), newTestNode(t)
+	require.Nil(a.Ping(b.addr()))
+
+	filename := filepath.Join(t.TempDir(), "dht.json")
+	require.Nil(a.Save(filename))
+
+	c := New(nil)
+	require.Nil(c.Load(filename))
+	assert.Equal(a.ID, c.ID)
+	if nodes := c.table.nodes(); assert.Len(nodes, 1) {
+		assert.Equal(b.ID, nodes[0].id)
+		assert.Equal(b.addr(), nodes[0].addr.String())
+	}
+
+	// Missing files are not an error
+	assert.Nil(c.Load(filepath.Join(t.TempDir(), "missing.json")))
+}
+
+func TestAddNodesWant(t *testing.T) {
+	assert := assert.New(t)
+
+	d := New(nil)
+	d.table.insert(&node{id: randomID(), addr: &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6881}, lastSeen: time.Now()})
+	d.table.insert(&node{id: randomID(), addr: &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 6881}, lastSeen: time.Now()})
+	ipv4 := &net.UDPAddr{IP: net.IPv4(10, 0, 0, 2), Port: 6881}
+
+	// Nodes of the querying node's family by default
+	resp := map[string]interface{}{}
+	d.addNodes(resp, map[string]interface{}{}, ipv4, d.ID)
+	assert.Len(resp["nodes"], compactNodeLen)
+	assert.NotContains(resp, "nodes6")
+
+	resp = map[string]interface{}{}
+	d.addNodes(resp, map[string]interface{}{"want": []interface{}{"n4", "n6"}}, ipv4, d.ID)
+	assert.Len(resp["nodes"], compactNodeLen)
+	assert.Len(resp["nodes6"], compactNode6Len)
+
+	// Announced peers are returned to nodes of the same family
+	d.storePeer([20]byte{}, encodePeer(net.IPv4(10, 0, 0, 3), 6881))
+	d.storePeer([20]byte{}, encodePeer(net.ParseIP("2001:db8::3"), 6881))
+	assert.Len(d.storedPeers([20]byte{}, false), 1)
+	assert.Len(d.storedPeers([20]byte{}, true), 1)
+}
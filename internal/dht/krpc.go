@@ -0,0 +1,154 @@
+package dht
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strconv"
+
+	bencode "github.com/jackpal/bencode-go"
+	"github.com/pkg/errors"
+)
+
+const compactNodeLen = 26  // 20 byte ID, 4 byte IP, 2 byte port
+const compactNode6Len = 38 // 20 byte ID, 16 byte IP, 2 byte port
+const compactPeerLen = 6   // 4 byte IP, 2 byte port
+const compactPeer6Len = 18 // 16 byte IP, 2 byte port
+
+// KRPC error codes
+const (
+	errGeneric  = 201
+	errProtocol = 203
+	errMethod   = 204
+)
+
+// Errors
+var (
+	ErrMalformed = errors.New("Received malformed KRPC message")
+	ErrRemote    = errors.New("Node responded with an error")
+)
+
+// krpcMsg is a decoded KRPC message
+type krpcMsg map[string]interface{}
+
+func decodeMsg(data []byte) (krpcMsg, error) {
+	decoded, err := bencode.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "decodeMsg")
+	}
+	msg, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, errors.Wrap(ErrMalformed, "decodeMsg")
+	}
+	return msg, nil
+}
+
+func encodeMsg(msg krpcMsg) ([]byte, error) {
+	var buf bytes.Buffer
+	err := bencode.Marshal(&buf, map[string]interface{}(msg))
+	return buf.Bytes(), errors.Wrap(err, "encodeMsg")
+}
+
+// str returns a string value from a dictionary
+func str(dict map[string]interface{}, key string) string {
+	value, _ := dict[key].(string)
+	return value
+}
+
+// integer returns an integer value from a dictionary
+func integer(dict map[string]interface{}, key string) (int64, bool) {
+	value, ok := dict[key].(int64)
+	return value, ok
+}
+
+// dict returns a nested dictionary from a dictionary
+func dict(d map[string]interface{}, key string) map[string]interface{} {
+	value, _ := d[key].(map[string]interface{})
+	return value
+}
+
+// readID reads a 20 byte node ID from a dictionary
+func readID(d map[string]interface{}, key string) (nodeID, bool) {
+	var id nodeID
+	value := str(d, key)
+	if len(value) != len(id) {
+		return id, false
+	}
+	copy(id[:], value)
+	return id, true
+}
+
+// encodeNodes serializes up to k nodes of one address family into compact node info, ipLen is 4 for IPv4 and 16 for IPv6
+func encodeNodes(nodes []*node, ipLen int) string {
+	var buf []byte
+	for _, n := range nodes {
+		ip := familyIP(n.addr.IP, ipLen)
+		if ip == nil {
+			continue
+		} else if len(buf) == k*(20+ipLen+2) {
+			break
+		}
+		entry := make([]byte, 20+ipLen+2)
+		copy(entry[0:20], n.id[:])
+		copy(entry[20:20+ipLen], ip)
+		binary.BigEndian.PutUint16(entry[20+ipLen:], uint16(n.addr.Port))
+		buf = append(buf, entry...)
+	}
+	return string(buf)
+}
+
+// decodeNodes parses compact node info, "nodes" has IPv4 nodes and "nodes6" has IPv6 nodes (BEP 32)
+func decodeNodes(data string, ipLen int) []*node {
+	var nodes []*node
+	entryLen := 20 + ipLen + 2
+	for i := 0; i+entryLen <= len(data); i += entryLen {
+		var id nodeID
+		copy(id[:], data[i:i+20])
+		ip := make(net.IP, ipLen)
+		copy(ip, data[i+20:i+20+ipLen])
+		port := binary.BigEndian.Uint16([]byte(data[i+20+ipLen : i+entryLen]))
+		if port == 0 {
+			continue
+		}
+		nodes = append(nodes, &node{id: id, addr: &net.UDPAddr{IP: ip, Port: int(port)}})
+	}
+	return nodes
+}
+
+// familyIP returns the IP in the form for an address family, or nil if it belongs to the other family
+func familyIP(ip net.IP, ipLen int) net.IP {
+	ip4 := ip.To4()
+	if ipLen == net.IPv4len {
+		return ip4
+	} else if ip4 != nil {
+		return nil
+	}
+	return ip.To16()
+}
+
+// encodePeer serializes a peer address into compact peer info
+func encodePeer(ip net.IP, port int) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	} else if ip = ip.To16(); ip == nil {
+		return ""
+	}
+	entry := make([]byte, len(ip)+2)
+	copy(entry, ip)
+	binary.BigEndian.PutUint16(entry[len(ip):], uint16(port))
+	return string(entry)
+}
+
+// decodePeer parses IPv4 or IPv6 compact peer info into an address
+func decodePeer(data string) (string, bool) {
+	if len(data) != compactPeerLen && len(data) != compactPeer6Len {
+		return "", false
+	}
+	ipLen := len(data) - 2
+	ip := net.IP([]byte(data[:ipLen]))
+	port := binary.BigEndian.Uint16([]byte(data[ipLen:]))
+	if port == 0 {
+		return "", false
+	}
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(port))), true
+}
@@ -0,0 +1,154 @@
+package dht
+
+import (
+	"bytes"
+	"crypto/rand"
+	"math/bits"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const k = 8                        // Max nodes per bucket, also the number of closest nodes a lookup converges on
+const staleTime = 15 * time.Minute // Nodes that haven't been seen in this long may be replaced
+
+type nodeID [20]byte
+
+// node is a contact in the routing table
+type node struct {
+	id       nodeID
+	addr     *net.UDPAddr
+	lastSeen time.Time
+}
+
+func randomID() nodeID {
+	var id nodeID
+	rand.Read(id[:])
+	return id
+}
+
+// distance returns the XOR distance between two IDs
+func (id nodeID) distance(other nodeID) nodeID {
+	var d nodeID
+	for i := range id {
+		d[i] = id[i] ^ other[i]
+	}
+	return d
+}
+
+// prefixLen returns the number of leading bits two IDs share
+func (id nodeID) prefixLen(other nodeID) int {
+	for i := range id {
+		if x := id[i] ^ other[i]; x != 0 {
+			return i*8 + bits.LeadingZeros8(x)
+		}
+	}
+	return 160
+}
+
+// table is a Kademlia routing table with one bucket per shared prefix length
+type table struct {
+	mu      sync.Mutex
+	self    nodeID
+	buckets [160][]*node
+}
+
+func newTable(self nodeID) *table {
+	return &table{self: self}
+}
+
+// insert adds or refreshes a node, returns false if the node's bucket was full
+func (t *table) insert(n *node) bool {
+	if n.id == t.self || n.addr == nil || n.addr.Port == 0 {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	index := t.self.prefixLen(n.id)
+	bucket := t.buckets[index]
+	for i := range bucket {
+		if bucket[i].id == n.id { // Move refreshed nodes to the back of the bucket
+			bucket[i].addr = n.addr
+			bucket[i].lastSeen = n.lastSeen
+			refreshed := bucket[i]
+			bucket = append(bucket[:i], bucket[i+1:]...)
+			t.buckets[index] = append(bucket, refreshed)
+			return true
+		}
+	}
+
+	if len(bucket) < k {
+		t.buckets[index] = append(bucket, n)
+		return true
+	}
+	// Replace the least recently seen node if it has gone stale
+	if time.Since(bucket[0].lastSeen) > staleTime {
+		t.buckets[index] = append(bucket[1:], n)
+		return true
+	}
+	return false
+}
+
+// remove deletes a node from the table
+func (t *table) remove(id nodeID) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	index := t.self.prefixLen(id)
+	if index >= len(t.buckets) {
+		return
+	}
+	bucket := t.buckets[index]
+	for i := range bucket {
+		if bucket[i].id == id {
+			t.buckets[index] = append(bucket[:i], bucket[i+1:]...)
+			return
+		}
+	}
+}
+
+// closest returns up to count nodes sorted by distance to the target
+func (t *table) closest(target nodeID, count int) []*node {
+	all := t.nodes()
+	sortByDistance(all, target)
+	if len(all) > count {
+		all = all[:count]
+	}
+	return all
+}
+
+// nodes returns a copy of every node in the table
+func (t *table) nodes() []*node {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var all []*node
+	for _, bucket := range t.buckets {
+		for _, n := range bucket {
+			copied := *n
+			all = append(all, &copied)
+		}
+	}
+	return all
+}
+
+// len returns the number of nodes in the table
+func (t *table) len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	total := 0
+	for _, bucket := range t.buckets {
+		total += len(bucket)
+	}
+	return total
+}
+
+func sortByDistance(nodes []*node, target nodeID) {
+	sort.Slice(nodes, func(i, j int) bool {
+		di, dj := nodes[i].id.distance(target), nodes[j].id.distance(target)
+		return bytes.Compare(di[:], dj[:]) < 0
+	})
+}
@@ -0,0 +1,95 @@
+package dht
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixLen(t *testing.T) {
+	assert := assert.New(t)
+
+	var a, b nodeID
+	assert.Equal(160, a.prefixLen(b))
+	b[0] = 0x80
+	assert.Equal(0, a.prefixLen(b))
+	b[0] = 0x00
+	b[2] = 0x10
+	assert.Equal(19, a.prefixLen(b))
+}
+
+func TestTable(t *testing.T) {
+	assert := assert.New(t)
+
+	var self nodeID
+	tbl := newTable(self)
+	addr := &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 6881}
+
+	// Fill the bucket for nodes that share no prefix with us
+	for i := 0; i < k; i++ {
+		var id nodeID
+		id[0] = 0x80
+		id[19] = byte(i)
+		assert.True(tbl.insert(&node{id: id, addr: addr, lastSeen: time.Now()}))
+	}
+	var extra nodeID
+	extra[0] = 0xff
+	assert.False(tbl.insert(&node{id: extra, addr: addr, lastSeen: time.Now()}))
+	assert.False(tbl.insert(&node{id: self, addr: addr, lastSeen: time.Now()}))
+	assert.Equal(k, tbl.len())
+
+	// Stale nodes get replaced
+	tbl.buckets[0][0].lastSeen = time.Now().Add(-2 * staleTime)
+	assert.True(tbl.insert(&node{id: extra, addr: addr, lastSeen: time.Now()}))
+	assert.Equal(k, tbl.len())
+
+	var target nodeID
+	target[0] = 0x80
+	target[19] = 0x03
+	closest := tbl.closest(target, 2)
+	if assert.Len(closest, 2) {
+		assert.Equal(target, closest[0].id)
+	}
+
+	tbl.remove(target)
+	assert.Equal(k-1, tbl.len())
+}
+
+func TestCompactEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	var id nodeID
+	id[0] = 0x01
+	nodes := []*node{
+		{id: id, addr: &net.UDPAddr{IP: net.IPv4(10, 0, 0, 1), Port: 6881}},
+		{id: id, addr: &net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 6881}},
+	}
+	encoded := encodeNodes(nodes, net.IPv4len) // IPv6 nodes go in nodes6
+	assert.Len(encoded, compactNodeLen)
+	decoded := decodeNodes(encoded, net.IPv4len)
+	if assert.Len(decoded, 1) {
+		assert.Equal(id, decoded[0].id)
+		assert.Equal("10.0.0.1:6881", decoded[0].addr.String())
+	}
+
+	encoded = encodeNodes(nodes, net.IPv6len)
+	assert.Len(encoded, compactNode6Len)
+	decoded = decodeNodes(encoded, net.IPv6len)
+	if assert.Len(decoded, 1) {
+		assert.Equal("[2001:db8::1]:6881", decoded[0].addr.String())
+	}
+
+	peer := encodePeer(net.IPv4(10, 0, 0, 2), 51413)
+	addr, ok := decodePeer(peer)
+	assert.True(ok)
+	assert.Equal("10.0.0.2:51413", addr)
+	peer = encodePeer(net.ParseIP("2001:db8::2"), 51413)
+	assert.Len(peer, compactPeer6Len)
+	addr, ok = decodePeer(peer)
+	assert.True(ok)
+	assert.Equal("[2001:db8::2]:51413", addr)
+	_, ok = decodePeer("short")
+	assert.False(ok)
+}
@@ -0,0 +1,212 @@
+/*
+Package lsd implements Local Service Discovery (BEP 14), which finds peers
+on the local network. Clients multicast BT-SEARCH announces with the
+infohashes of their torrents and listen for the announces of others.
+*/
+package lsd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const maxPacketSize = 1400
+const peersBuffer = 16 // Addresses queued for each torrent before new ones are dropped
+
+// DefaultGroup is the IPv4 multicast group for announces
+var DefaultGroup = &net.UDPAddr{IP: net.IPv4(239, 192, 152, 143), Port: 6771}
+
+// Errors
+var (
+	ErrMalformed = errors.New("Received malformed BT-SEARCH announce")
+	ErrClosed    = errors.New("LSD service is closed")
+)
+
+// LSD listens for announces on the local network and sends our own
+type LSD struct {
+	group  *net.UDPAddr
+	conn   *net.UDPConn // Joined to the multicast group
+	send   *net.UDPConn
+	port   uint16 // Peer listener port that we announce
+	cookie string // Identifies our own announces when they loop back
+	mu     sync.Mutex
+	peers  map[[20]byte]chan string // Addresses of LAN peers by infohash for torrents we watch
+	done   chan struct{}
+}
+
+// New starts listening for announces on the default group, port is the peer listener port we announce
+func New(port uint16) (*LSD, error) {
+	l, err := newLSD(DefaultGroup, nil, port)
+	return l, errors.Wrap(err, "New")
+}
+
+// newLSD joins a multicast group on the given interface, or on the system default if ifi is nil
+func newLSD(group *net.UDPAddr, ifi *net.Interface, port uint16) (*LSD, error) {
+	conn, err := net.ListenMulticastUDP("udp4", ifi, group)
+	if err != nil {
+		return nil, err
+	}
+
+	// Send from an address of the interface so the announces go out on it
+	local := &net.UDPAddr{}
+	if ifi != nil {
+		addrs, _ := ifi.Addrs()
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.To4() != nil {
+				local.IP = ipNet.IP
+				break
+			}
+		}
+	}
+	send, err := net.ListenUDP("udp4", local)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	cookie := make([]byte, 8)
+	rand.Read(cookie)
+	l := &LSD{
+		group:  group,
+		conn:   conn,
+		send:   send,
+		port:   port,
+		cookie: hex.EncodeToString(cookie),
+		peers:  make(map[[20]byte]chan string),
+		done:   make(chan struct{}),
+	}
+	go l.listen()
+	return l, nil
+}
+
+// FromContext returns the session's LSD service from the context, if there is one
+func FromContext(ctx context.Context) (*LSD, bool) {
+	l, ok := ctx.Value(common.KeyLSD).(*LSD)
+	return l, ok && l != nil
+}
+
+// Close stops listening for announces
+func (l *LSD) Close() error {
+	select {
+	case <-l.done:
+		return nil
+	default:
+	}
+	close(l.done)
+	l.send.Close()
+	return l.conn.Close()
+}
+
+// Announce multicasts that we have the torrents with the given infohashes
+func (l *LSD) Announce(infoHashes ...[20]byte) error {
+	_, err := l.send.WriteTo(l.encode(infoHashes), l.group)
+	return errors.Wrap(err, "Announce")
+}
+
+// Watch returns a channel of addresses of LAN peers that announce the torrent, Unwatch stops it
+func (l *LSD) Watch(infoHash [20]byte) <-chan string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	peers, ok := l.peers[infoHash]
+	if !ok {
+		peers = make(chan string, peersBuffer)
+		l.peers[infoHash] = peers
+	}
+	return peers
+}
+
+// Unwatch stops delivering peers of a torrent
+func (l *LSD) Unwatch(infoHash [20]byte) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.peers, infoHash)
+}
+
+func (l *LSD) listen() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := l.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-l.done:
+				return
+			default:
+				continue
+			}
+		}
+
+		port, infoHashes, cookie, err := decode(buf[:n])
+		if err != nil {
+			log.WithFields(log.Fields{"addr": addr.String(), "error": err.Error()}).Trace("Bad LSD announce")
+			continue
+		} else if cookie == l.cookie { // Our own announce
+			continue
+		}
+
+		peerAddr := net.JoinHostPort(addr.IP.String(), strconv.Itoa(int(port)))
+		l.mu.Lock()
+		for _, infoHash := range infoHashes {
+			if peers, ok := l.peers[infoHash]; ok {
+				select {
+				case peers <- peerAddr:
+				default: // The torrent isn't keeping up
+				}
+			}
+		}
+		l.mu.Unlock()
+	}
+}
+
+func (l *LSD) encode(infoHashes [][20]byte) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("BT-SEARCH * HTTP/1.1\r\n")
+	fmt.Fprintf(&buf, "Host: %s\r\n", l.group.String())
+	fmt.Fprintf(&buf, "Port: %d\r\n", l.port)
+	for _, infoHash := range infoHashes {
+		fmt.Fprintf(&buf, "Infohash: %s\r\n", hex.EncodeToString(infoHash[:]))
+	}
+	fmt.Fprintf(&buf, "cookie: %s\r\n", l.cookie)
+	buf.WriteString("\r\n\r\n")
+	return buf.Bytes()
+}
+
+// decode parses a BT-SEARCH announce, it returns the announced port, infohashes and the sender's cookie if it set one
+func decode(data []byte) (uint16, [][20]byte, string, error) {
+	reader := bufio.NewReader(bytes.NewReader(data))
+	request, err := http.ReadRequest(reader)
+	if err != nil || request.Method != "BT-SEARCH" {
+		return 0, nil, "", ErrMalformed
+	}
+
+	port, err := strconv.ParseUint(request.Header.Get("Port"), 10, 16)
+	if err != nil || port == 0 {
+		return 0, nil, "", ErrMalformed
+	}
+	var infoHashes [][20]byte
+	for _, value := range request.Header.Values("Infohash") {
+		decoded, err := hex.DecodeString(strings.TrimSpace(value))
+		if err != nil || len(decoded) != 20 {
+			return 0, nil, "", ErrMalformed
+		}
+		var infoHash [20]byte
+		copy(infoHash[:], decoded)
+		infoHashes = append(infoHashes, infoHash)
+	}
+	if len(infoHashes) == 0 {
+		return 0, nil, "", ErrMalformed
+	}
+	return uint16(port), infoHashes, request.Header.Get("Cookie"), nil
+}
@@ -0,0 +1,93 @@
+package lsd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLoopback starts a service on loopback multicast, tests are skipped if the system doesn't support it
+func newLoopback(t *testing.T, group *net.UDPAddr, port uint16) *LSD {
+	ifi, err := net.InterfaceByName("lo")
+	if err != nil || ifi.Flags&net.FlagLoopback == 0 {
+		t.Skip("No loopback interface")
+	}
+	l, err := newLSD(group, ifi, port)
+	if err != nil {
+		t.Skip("Loopback multicast is not available:", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestEncodeDecode(t *testing.T) {
+	assert := assert.New(t)
+
+	l := &LSD{group: DefaultGroup, port: 6881, cookie: "abc"}
+	infoHashes := [][20]byte{{1, 2, 3}, {4, 5, 6}}
+	data := l.encode(infoHashes)
+	assert.Contains(string(data), "Host: 239.192.152.143:6771\r\n")
+
+	port, decoded, cookie, err := decode(data)
+	assert.Nil(err)
+	assert.Equal(uint16(6881), port)
+	assert.Equal(infoHashes, decoded)
+	assert.Equal("abc", cookie)
+
+	// Headers are case insensitive and the cookie is optional
+	port, decoded, cookie, err = decode([]byte("BT-SEARCH * HTTP/1.1\r\nhost: 239.192.152.143:6771\r\nport: 51413\r\ninfohash: 0102030000000000000000000000000000000000\r\n\r\n\r\n"))
+	assert.Nil(err)
+	assert.Equal(uint16(51413), port)
+	assert.Equal(infoHashes[:1], decoded)
+	assert.Empty(cookie)
+
+	_, _, _, err = decode([]byte("BT-SEARCH * HTTP/1.1\r\nPort: 6881\r\nInfohash: 0102\r\n\r\n"))
+	assert.ErrorIs(err, ErrMalformed)
+	_, _, _, err = decode([]byte("M-SEARCH * HTTP/1.1\r\nPort: 6881\r\n\r\n"))
+	assert.ErrorIs(err, ErrMalformed)
+}
+
+func TestAnnounceLoopback(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	group := &net.UDPAddr{IP: net.IPv4(239, 192, 152, 143), Port: 16771}
+	a := newLoopback(t, group, 6881)
+	b := newLoopback(t, group, 6882)
+
+	infoHash := [20]byte{1, 2, 3}
+	peersA := a.Watch(infoHash)
+	peersB := b.Watch(infoHash)
+	other := b.Watch([20]byte{4, 5, 6})
+
+	require.Nil(a.Announce(infoHash))
+	select {
+	case addr := <-peersB:
+		assert.Equal("127.0.0.1:6881", addr)
+	case <-time.After(2 * time.Second):
+		t.Fatal("Announce was not received")
+	}
+
+	// Our own announces and announces for other torrents are ignored
+	select {
+	case addr := <-peersA:
+		t.Error("Received own announce from", addr)
+	case addr := <-other:
+		t.Error("Received announce for another torrent from", addr)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Nothing is delivered after unwatching
+	b.Unwatch(infoHash)
+	require.Nil(a.Announce(infoHash))
+	select {
+	case addr, ok := <-peersB:
+		if ok {
+			t.Error("Received announce after unwatching from", addr)
+		}
+	case <-time.After(100 * time.Millisecond):
+	}
+}
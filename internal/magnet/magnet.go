@@ -5,7 +5,8 @@ torrents from magnet links.
 package magnet
 
 import (
-	"fmt"
+	"encoding/base32"
+	"encoding/hex"
 	"net/url"
 	"strings"
 
@@ -15,48 +16,105 @@ import (
 const magnetStr = "magnet"
 const urn = "urn"
 const btih = "btih"
+const btmh = "btmh"            // v2 infohash as a multihash (BEP 52)
+const sha256Multihash = "1220" // Multihash prefix of a 32 byte SHA-256 digest
 
 // Errors
 var (
 	ErrNotMagnet = errors.New("Link provided does not have the magnet schema")
 	ErrXT        = errors.New("Magnet link must provide a valid xt value")
+	ErrInfoHash  = errors.New("Magnet link has a malformed infohash")
 )
 
 // Magnet is a struct holding the metadata from a torrent magnet link
 type Magnet struct {
-	InfoHash [20]byte
-	dn       string // display name
-	tr       string
-	xpe      string
+	InfoHash   [20]byte // v1 infohash, or the truncated v2 infohash of v2 only links
+	InfoHashV2 [32]byte // Unset without a btmh xt value
+	Name       string   // display name (dn)
+	Trackers   []string // tracker urls (tr)
+	Peers      []string // peer addresses (x.pe)
 }
 
 // New unpacks a magnet link string
 func New(s string) (Magnet, error) {
 	var m Magnet
-	fmt.Println("link:", s)
 
 	u, err := url.Parse(s)
 	if err != nil {
-		return Magnet{}, err
+		return Magnet{}, errors.Wrap(err, "New")
 	}
 
 	if u.Scheme != magnetStr {
-		return Magnet{}, errors.Wrap(ErrNotMagnet, "Unmarshal")
+		return Magnet{}, errors.Wrap(ErrNotMagnet, "New")
 	}
 
-	fmt.Println("query:", u.RawQuery)
 	q := u.Query()
 
-	// xt is a required value
-	if _, ok := q["xt"]; !ok {
-		return Magnet{}, errors.Wrap(ErrXT, "Unmarshal")
+	// xt is a required value, there may be several but we only need the btih and btmh ones
+	foundV1, foundV2 := false, false
+	for _, value := range q["xt"] {
+		xt := strings.Split(value, ":")
+		if len(xt) != 3 || xt[0] != urn {
+			continue
+		}
+		switch xt[1] {
+		case btih:
+			if m.InfoHash, err = decodeInfoHash(xt[2]); err != nil {
+				return Magnet{}, errors.Wrap(err, "New")
+			}
+			foundV1 = true
+		case btmh:
+			if m.InfoHashV2, err = decodeMultihash(xt[2]); err != nil {
+				return Magnet{}, errors.Wrap(err, "New")
+			}
+			foundV2 = true
+		}
 	}
-	xt := strings.Split(q["xt"][0], ":")
-	fmt.Println("xt:", xt)
-
-	if xt[0] != urn || xt[1] != btih {
-		return Magnet{}, errors.Wrap(ErrXT, "Unmarshal")
+	if !foundV1 && !foundV2 {
+		return Magnet{}, errors.Wrap(ErrXT, "New")
+	} else if !foundV1 {
+		copy(m.InfoHash[:], m.InfoHashV2[:])
 	}
 
+	m.Name = q.Get("dn")
+	m.Trackers = q["tr"]
+	m.Peers = q["x.pe"]
+
 	return m, nil
 }
+
+// decodeInfoHash reads an infohash in either its hex or base32 form
+func decodeInfoHash(s string) ([20]byte, error) {
+	var infoHash [20]byte
+	var decoded []byte
+	var err error
+
+	switch len(s) {
+	case 40:
+		decoded, err = hex.DecodeString(s)
+	case 32:
+		decoded, err = base32.StdEncoding.DecodeString(strings.ToUpper(s))
+	default:
+		return infoHash, ErrInfoHash
+	}
+	if err != nil || len(decoded) != 20 {
+		return infoHash, ErrInfoHash
+	}
+
+	copy(infoHash[:], decoded)
+	return infoHash, nil
+}
+
+// decodeMultihash reads a hex encoded SHA-256 multihash
+func decodeMultihash(s string) ([32]byte, error) {
+	var infoHash [32]byte
+	if len(s) != 68 || !strings.HasPrefix(s, sha256Multihash) {
+		return infoHash, ErrInfoHash
+	}
+	decoded, err := hex.DecodeString(s[len(sha256Multihash):])
+	if err != nil {
+		return infoHash, ErrInfoHash
+	}
+	copy(infoHash[:], decoded)
+	return infoHash, nil
+}
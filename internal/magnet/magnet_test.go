@@ -1,6 +1,7 @@
 package magnet
 
 import (
+	"encoding/hex"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -8,8 +9,58 @@ import (
 
 func TestMagnetUnmarshal(t *testing.T) {
 	assert := assert.New(t)
-	link := "magnet:?xt=urn:btih:<info-hash>&dn=<name>&tr=<tracker-url>&x.pe=<peer-address>"
+	link := "magnet:?xt=urn:btih:74df948ea813e7938a207b0bb23d0edf2b74f4b1&dn=change&tr=udp%3A%2F%2Ftracker.example.com%3A80&tr=http%3A%2F%2Ftracker.example.org%2Fannounce&x.pe=10.0.0.1%3A6881"
 
-	_, err := New(link)
-	assert.Nil(err)
+	m, err := New(link)
+	if assert.Nil(err) {
+		assert.Equal("74df948ea813e7938a207b0bb23d0edf2b74f4b1", hex.EncodeToString(m.InfoHash[:]))
+		assert.Equal("change", m.Name)
+		assert.Equal([]string{"udp://tracker.example.com:80", "http://tracker.example.org/announce"}, m.Trackers)
+		assert.Equal([]string{"10.0.0.1:6881"}, m.Peers)
+	}
+}
+
+func TestMagnetBase32(t *testing.T) {
+	assert := assert.New(t)
+	link := "magnet:?xt=urn:btih:OTPZJDVICPTZHCRAPMF3EPIO34VXJ5FR"
+
+	m, err := New(link)
+	if assert.Nil(err) {
+		assert.Equal("74df948ea813e7938a207b0bb23d0edf2b74f4b1", hex.EncodeToString(m.InfoHash[:]))
+	}
+}
+
+func TestMagnetErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := New("http://example.com/?xt=urn:btih:74df948ea813e7938a207b0bb23d0edf2b74f4b1")
+	assert.ErrorIs(err, ErrNotMagnet)
+
+	_, err = New("magnet:?dn=change")
+	assert.ErrorIs(err, ErrXT)
+
+	_, err = New("magnet:?xt=urn:btih:<info-hash>")
+	assert.ErrorIs(err, ErrInfoHash)
+}
+
+func TestMagnetV2(t *testing.T) {
+	assert := assert.New(t)
+	hashV2 := "caf1e1c30e81cb361b9ee167c4aa64228a7fa4fa9f6105232b28ad099f3a302e"
+
+	// v2 only links use the truncated infohash
+	m, err := New("magnet:?xt=urn:btmh:1220" + hashV2)
+	if assert.Nil(err) {
+		assert.Equal(hashV2, hex.EncodeToString(m.InfoHashV2[:]))
+		assert.Equal(hashV2[:40], hex.EncodeToString(m.InfoHash[:]))
+	}
+
+	// Hybrid links keep both
+	m, err = New("magnet:?xt=urn:btih:74df948ea813e7938a207b0bb23d0edf2b74f4b1&xt=urn:btmh:1220" + hashV2)
+	if assert.Nil(err) {
+		assert.Equal(hashV2, hex.EncodeToString(m.InfoHashV2[:]))
+		assert.Equal("74df948ea813e7938a207b0bb23d0edf2b74f4b1", hex.EncodeToString(m.InfoHash[:]))
+	}
+
+	_, err = New("magnet:?xt=urn:btmh:1114" + hashV2)
+	assert.ErrorIs(err, ErrInfoHash)
 }
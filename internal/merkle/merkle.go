@@ -0,0 +1,119 @@
+/*
+Package merkle builds and verifies the SHA-256 merkle trees that
+BitTorrent v2 uses to hash each file (BEP 52). Leaves are the hashes of
+16 KiB blocks, and every layer is padded up to a power of two.
+*/
+package merkle
+
+import (
+	"crypto/sha256"
+)
+
+// BlockSize is the amount of file data hashed into each leaf
+const BlockSize = 16384
+
+// Hash of two child nodes
+func hashPair(left, right [32]byte) [32]byte {
+	var pair [64]byte
+	copy(pair[:32], left[:])
+	copy(pair[32:], right[:])
+	return sha256.Sum256(pair[:])
+}
+
+// NextPow2 returns the smallest power of two that is at least n
+func NextPow2(n int) int {
+	width := 1
+	for width < n {
+		width *= 2
+	}
+	return width
+}
+
+// Log2 returns the base 2 logarithm of a power of two
+func Log2(n int) int {
+	height := 0
+	for n > 1 {
+		n /= 2
+		height++
+	}
+	return height
+}
+
+// PadHash returns the root of a subtree with 2^height leaves of zeros, it pads layers above the leaves
+func PadHash(height int) [32]byte {
+	var pad [32]byte
+	for i := 0; i < height; i++ {
+		pad = hashPair(pad, pad)
+	}
+	return pad
+}
+
+// Leaves hashes data in blocks, the last block may be shorter
+func Leaves(data []byte) [][32]byte {
+	leaves := make([][32]byte, 0, (len(data)+BlockSize-1)/BlockSize)
+	for start := 0; start < len(data); start += BlockSize {
+		end := start + BlockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		leaves = append(leaves, sha256.Sum256(data[start:end]))
+	}
+	return leaves
+}
+
+// layers builds every layer of a tree from its base layer, which is padded with pad up to width nodes
+func layers(base [][32]byte, width int, pad [32]byte) [][][32]byte {
+	layer := make([][32]byte, width)
+	copy(layer, base)
+	for i := len(base); i < width; i++ {
+		layer[i] = pad
+	}
+
+	tree := [][][32]byte{layer}
+	for len(layer) > 1 {
+		next := make([][32]byte, len(layer)/2)
+		for i := range next {
+			next[i] = hashPair(layer[2*i], layer[2*i+1])
+		}
+		tree = append(tree, next)
+		layer = next
+	}
+	return tree
+}
+
+// Root returns the root of a tree from its base layer, which is padded with pad up to width nodes
+func Root(base [][32]byte, width int, pad [32]byte) [32]byte {
+	tree := layers(base, width, pad)
+	return tree[len(tree)-1][0]
+}
+
+// Proof returns the uncle hashes that connect the subtree of length nodes starting at index up to the root
+func Proof(base [][32]byte, width int, pad [32]byte, index, length int) [][32]byte {
+	tree := layers(base, width, pad)
+	var proof [][32]byte
+	node := index / length
+	for height := Log2(length); height < len(tree)-1; height++ {
+		proof = append(proof, tree[height][node^1])
+		node /= 2
+	}
+	return proof
+}
+
+// Verify checks that a run of hashes starting at index hashes up to root with the uncle hashes of its proof,
+// the number of hashes must be a power of two and index a multiple of it
+func Verify(root [32]byte, hashes [][32]byte, index int, proof [][32]byte) bool {
+	if len(hashes) == 0 || NextPow2(len(hashes)) != len(hashes) || index%len(hashes) != 0 {
+		return false
+	}
+	node := index / len(hashes)
+	current := Root(hashes, len(hashes), [32]byte{})
+	for _, uncle := range proof {
+		if node%2 == 0 {
+			current = hashPair(current, uncle)
+		} else {
+			current = hashPair(uncle, current)
+		}
+		node /= 2
+	}
+	return node == 0 && current == root
+}
@@ -0,0 +1,59 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoot(t *testing.T) {
+	assert := assert.New(t)
+
+	data := make([]byte, 3*BlockSize+100)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	leaves := Leaves(data)
+	assert.Len(leaves, 4)
+	assert.Equal(sha256.Sum256(data[3*BlockSize:]), leaves[3])
+
+	// Missing leaves are zeros
+	var zero [32]byte
+	left := hashPair(leaves[0], leaves[1])
+	right := hashPair(leaves[2], leaves[3])
+	assert.Equal(hashPair(left, right), Root(leaves, 4, zero))
+	assert.Equal(hashPair(hashPair(left, right), hashPair(hashPair(zero, zero), hashPair(zero, zero))), Root(leaves, 8, zero))
+	assert.Equal(hashPair(hashPair(left, right), PadHash(2)), Root(leaves, 8, zero))
+
+	assert.Equal(1, NextPow2(1))
+	assert.Equal(8, NextPow2(5))
+	assert.Equal(3, Log2(8))
+}
+
+func TestProof(t *testing.T) {
+	assert := assert.New(t)
+
+	base := make([][32]byte, 11)
+	for i := range base {
+		base[i] = sha256.Sum256([]byte{byte(i)})
+	}
+	pad := PadHash(2)
+	root := Root(base, 16, pad)
+
+	for _, length := range []int{2, 4, 8, 16} {
+		for index := 0; index < 16; index += length {
+			hashes := layers(base, 16, pad)[0][index : index+length]
+			proof := Proof(base, 16, pad, index, length)
+			assert.Len(proof, 4-Log2(length))
+			assert.True(Verify(root, hashes, index, proof), "length %d index %d", length, index)
+		}
+	}
+
+	hashes := layers(base, 16, pad)[0][4:8]
+	proof := Proof(base, 16, pad, 4, 4)
+	assert.False(Verify(root, hashes, 0, proof))
+	assert.False(Verify(root, hashes[:3], 4, proof))
+	hashes[0][0]++
+	assert.False(Verify(root, hashes, 4, proof))
+}
@@ -7,7 +7,9 @@ package metainfo
 import (
 	"bytes"
 	"crypto/sha1"
-	"os"
+	"crypto/sha256"
+	"io/ioutil"
+	"sort"
 	"strconv"
 
 	bencode "github.com/jackpal/bencode-go"
@@ -17,13 +19,22 @@ import (
 // Errors
 var (
 	ErrPieceHashes = errors.New("Got malformed pieces from metainfo")
+	ErrFileTree    = errors.New("Got malformed file tree from metainfo")
+	ErrPieceLayers = errors.New("Got malformed piece layers from metainfo")
+	ErrNotV2       = errors.New("Torrent is not a v2 torrent")
 )
 
+const metaVersion2 = 2 // meta version of v2 and hybrid torrents (BEP 52)
+
 // Metainfo stores metainfo about a torrent file
 type Metainfo struct {
-	Info         bencodeInfo `bencode:"info"`
-	Announce     string      `bencode:"announce"`
-	AnnounceList [][]string  `bencode:"announce-list"`
+	Info         bencodeInfo             `bencode:"info"`
+	Announce     string                  `bencode:"announce"`
+	AnnounceList [][]string              `bencode:"announce-list"`
+	URLList      []string                `bencode:"url-list,omitempty"` // Web seeds (BEP 19)
+	PieceLayers  map[[32]byte][][32]byte `bencode:"-"`                  // Piece layer of each file's merkle tree keyed by pieces root (BEP 52)
+
+	infoBytes []byte // The bencoded info dictionary as it appears in the torrent
 }
 
 type bencodeInfo struct {
@@ -33,11 +44,26 @@ type bencodeInfo struct {
 	Length      int           `bencode:"length,omitempty"`  // Single file mode
 	Files       []bencodeFile `bencode:"files,omitempty"`   // Multiple file mode
 	Private     int           `bencode:"private,omitempty"` // Only use peers from tracker
+	MetaVersion int           `bencode:"meta version,omitempty"`
+	FileTree    []FileV2      `bencode:"-"`                      // Files of v2 and hybrid torrents, in the order of the file tree
+	Attr        string        `bencode:"attr,omitempty"`         // Attributes of a single file (BEP 47)
+	SymlinkPath []string      `bencode:"symlink path,omitempty"` // Target of a single file that is a symlink
 }
 
 type bencodeFile struct {
-	Length int      `bencode:"length"`
-	Path   []string `bencode:"path"`
+	Length      int      `bencode:"length"`
+	Path        []string `bencode:"path"`
+	Attr        string   `bencode:"attr,omitempty"`         // Any of p (pad), x (executable), h (hidden) and l (symlink) (BEP 47)
+	SymlinkPath []string `bencode:"symlink path,omitempty"` // Target of the symlink relative to the torrent's root
+}
+
+// FileV2 is a file in a v2 torrent's file tree
+type FileV2 struct {
+	Length      int
+	Path        []string
+	PiecesRoot  [32]byte // Root of the file's merkle tree, unset for empty files
+	Attr        string
+	SymlinkPath []string
 }
 
 func (m Metainfo) String() string {
@@ -66,23 +92,214 @@ func (m Metainfo) String() string {
 
 // New grabs bencoded metainfo and stores it into the Metainfo struct
 func New(filename string) (Metainfo, error) {
-	file, err := os.Open(filename)
+	data, err := ioutil.ReadFile(filename)
 	if err != nil {
 		return Metainfo{}, errors.Wrap(err, "Meta")
 	}
-	defer file.Close()
 
 	var m Metainfo
-	err = bencode.Unmarshal(file, &m)
+	err = bencode.Unmarshal(bytes.NewReader(data), &m)
 	if err != nil {
 		return Metainfo{}, errors.Wrap(err, "Meta")
 	}
+	m.URLList = urlList(data)
+
+	decoded, err := bencode.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Metainfo{}, errors.Wrap(err, "Meta")
+	}
+	dict, _ := decoded.(map[string]interface{})
+	if err = m.parseInfo(dict["info"]); err != nil {
+		return Metainfo{}, errors.Wrap(err, "Meta")
+	}
+	if m.PieceLayers, err = pieceLayers(dict["piece layers"]); err != nil {
+		return Metainfo{}, errors.Wrap(err, "Meta")
+	}
+
+	return m, nil
+}
+
+// parseInfo keeps the bencoded info dictionary for hashing, and reads the file tree of v2 torrents
+func (m *Metainfo) parseInfo(decoded interface{}) error {
+	info, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	// Dictionary keys are sorted when encoding, so a well formed info dictionary encodes back to the same bytes
+	var serialInfo bytes.Buffer
+	if err := bencode.Marshal(&serialInfo, info); err != nil {
+		return errors.Wrap(err, "parseInfo")
+	}
+	m.infoBytes = serialInfo.Bytes()
+
+	if m.Info.MetaVersion != metaVersion2 {
+		return nil
+	}
+	tree, ok := info["file tree"].(map[string]interface{})
+	if !ok {
+		return errors.Wrap(ErrFileTree, "parseInfo")
+	}
+	files, err := walkFileTree(tree, nil)
+	if err != nil {
+		return errors.Wrap(err, "parseInfo")
+	}
+	m.Info.FileTree = files
+	return nil
+}
+
+// walkFileTree flattens a file tree into its files, a file is a directory entry containing an empty key
+func walkFileTree(tree map[string]interface{}, dir []string) ([]FileV2, error) {
+	names := make([]string, 0, len(tree))
+	for name := range tree {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var files []FileV2
+	for _, name := range names {
+		node, ok := tree[name].(map[string]interface{})
+		if !ok || name == "." || name == ".." {
+			return nil, ErrFileTree
+		}
+		path := append(append([]string{}, dir...), name)
+
+		if name == "" { // File properties
+			if len(dir) == 0 || len(tree) != 1 {
+				return nil, ErrFileTree
+			}
+			length, ok := node["length"].(int64)
+			if !ok || length < 0 {
+				return nil, ErrFileTree
+			}
+			file := FileV2{Length: int(length), Path: dir}
+			file.Attr, _ = node["attr"].(string)
+			if symlink, ok := node["symlink path"].([]interface{}); ok {
+				for _, part := range symlink {
+					if part, ok := part.(string); ok {
+						file.SymlinkPath = append(file.SymlinkPath, part)
+					}
+				}
+			}
+			if length > 0 {
+				root, ok := node["pieces root"].(string)
+				if !ok || len(root) != 32 {
+					return nil, ErrFileTree
+				}
+				copy(file.PiecesRoot[:], root)
+			}
+			files = append(files, file)
+			continue
+		}
+
+		subFiles, err := walkFileTree(node, path)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, subFiles...)
+	}
+	return files, nil
+}
+
+// pieceLayers splits the piece layers dictionary into the hashes of each file
+func pieceLayers(decoded interface{}) (map[[32]byte][][32]byte, error) {
+	dict, ok := decoded.(map[string]interface{})
+	if !ok {
+		return nil, nil
+	}
+	layers := make(map[[32]byte][][32]byte, len(dict))
+	for key, value := range dict {
+		hashes, ok := value.(string)
+		if !ok || len(key) != 32 || len(hashes)%32 != 0 {
+			return nil, errors.Wrap(ErrPieceLayers, "pieceLayers")
+		}
+		var root [32]byte
+		copy(root[:], key)
+		layer := make([][32]byte, len(hashes)/32)
+		for i := range layer {
+			copy(layer[i][:], hashes[32*i:32*(i+1)])
+		}
+		layers[root] = layer
+	}
+	return layers, nil
+}
+
+// urlList reads the web seeds of a torrent, url-list may be a single URL or a list of them
+func urlList(data []byte) []string {
+	decoded, err := bencode.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil
+	}
+	dict, _ := decoded.(map[string]interface{})
+	switch value := dict["url-list"].(type) {
+	case string:
+		if value != "" {
+			return []string{value}
+		}
+	case []interface{}:
+		var urls []string
+		for _, item := range value {
+			if url, ok := item.(string); ok && url != "" {
+				urls = append(urls, url)
+			}
+		}
+		return urls
+	}
+	return nil
+}
+
+// NewFromInfo creates metainfo from a bencoded info dictionary, such as one received from peers
+func NewFromInfo(infoBytes []byte, announceList [][]string) (Metainfo, error) {
+	var info bencodeInfo
+	err := bencode.Unmarshal(bytes.NewReader(infoBytes), &info)
+	if err != nil {
+		return Metainfo{}, errors.Wrap(err, "NewFromInfo")
+	}
+
+	m := Metainfo{Info: info, AnnounceList: announceList}
+	if len(announceList) > 0 && len(announceList[0]) > 0 {
+		m.Announce = announceList[0][0]
+	}
 
+	// Piece layers aren't part of the info dictionary, v2 peers send them with hash messages
+	decoded, err := bencode.Decode(bytes.NewReader(infoBytes))
+	if err != nil {
+		return Metainfo{}, errors.Wrap(err, "NewFromInfo")
+	}
+	if err = m.parseInfo(decoded); err != nil {
+		return Metainfo{}, errors.Wrap(err, "NewFromInfo")
+	}
 	return m, nil
 }
 
+// InfoBytes returns the bencoded info dictionary, which is what peers send each other as metadata
+func (m Metainfo) InfoBytes() []byte {
+	return m.infoBytes
+}
+
+// V1 returns whether the torrent has v1 piece hashes, which is true for hybrid torrents
+func (m Metainfo) V1() bool {
+	return m.Info.Pieces != ""
+}
+
+// V2 returns whether the torrent has a v2 file tree, which is true for hybrid torrents
+func (m Metainfo) V2() bool {
+	return m.Info.MetaVersion == metaVersion2
+}
+
+// IsPrivate returns whether the torrent may only use peers from its trackers (BEP 27)
+func (m Metainfo) IsPrivate() bool {
+	return m.Info.Private == 1
+}
+
 // Length returns the total torrent length
 func (m Metainfo) Length() int {
+	if !m.V1() {
+		totalLen := 0
+		for _, file := range m.Info.FileTree {
+			totalLen += file.Length
+		}
+		return totalLen
+	}
 	totalLen := m.Info.Length
 	for _, file := range m.Info.Files {
 		totalLen += file.Length
@@ -92,6 +309,9 @@ func (m Metainfo) Length() int {
 
 // InfoHash generates the infohash of the torrent file
 func (m Metainfo) InfoHash() ([20]byte, error) {
+	if m.infoBytes != nil {
+		return sha1.Sum(m.infoBytes), nil
+	}
 	var serialInfo bytes.Buffer
 	err := bencode.Marshal(&serialInfo, m.Info)
 	if err != nil {
@@ -102,6 +322,14 @@ func (m Metainfo) InfoHash() ([20]byte, error) {
 	return infoHash, nil
 }
 
+// InfoHashV2 generates the SHA-256 infohash of a v2 or hybrid torrent
+func (m Metainfo) InfoHashV2() ([32]byte, error) {
+	if !m.V2() || m.infoBytes == nil {
+		return [32]byte{}, errors.Wrap(ErrNotV2, "InfoHashV2")
+	}
+	return sha256.Sum256(m.infoBytes), nil
+}
+
 // PieceHashes returns an array of the piece hashes of the torrent
 func (m Metainfo) PieceHashes() ([][20]byte, error) {
 	piecesBytes := []byte(m.Info.Pieces)
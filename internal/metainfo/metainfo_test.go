@@ -1,11 +1,17 @@
 package metainfo
 
 import (
+	"crypto/sha1"
+	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const debugMetainfo = false
@@ -90,3 +96,55 @@ func TestPieceHashes(t *testing.T) {
 		}
 	}
 }
+
+func TestURLList(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"http://example.com/file"}, urlList([]byte("d8:url-list23:http://example.com/filee")))
+	assert.Equal([]string{"http://a.com/", "http://b.com/"}, urlList([]byte("d8:url-listl13:http://a.com/13:http://b.com/0:ee")))
+	assert.Nil(urlList([]byte("d8:announce3:urle")))
+}
+
+func TestFileTree(t *testing.T) {
+	assert := assert.New(t)
+
+	root := strings.Repeat("r", 32)
+	info := "d9:file treed1:ad0:d6:lengthi0eee1:bd1:cd0:d6:lengthi5e11:pieces root32:" + root + "eeee12:meta versioni2e4:name4:tree12:piece lengthi16384ee"
+	torrent := "d4:info" + info + "12:piece layersd32:" + root + "32:" + root + "ee"
+	filename := filepath.Join(t.TempDir(), "tree.torrent")
+	require.Nil(t, ioutil.WriteFile(filename, []byte(torrent), 0644))
+
+	meta, err := New(filename)
+	if assert.Nil(err) {
+		var piecesRoot [32]byte
+		copy(piecesRoot[:], root)
+		assert.True(meta.V2())
+		assert.False(meta.V1())
+		assert.Equal([]FileV2{{Length: 0, Path: []string{"a"}}, {Length: 5, Path: []string{"b", "c"}, PiecesRoot: piecesRoot}}, meta.Info.FileTree)
+		assert.Equal(map[[32]byte][][32]byte{piecesRoot: {piecesRoot}}, meta.PieceLayers)
+		assert.Equal(5, meta.Length())
+
+		// Infohashes are taken over the info dictionary as it appears in the torrent
+		infoHash, err := meta.InfoHash()
+		assert.Nil(err)
+		assert.Equal(sha1.Sum([]byte(info)), infoHash)
+		infoHashV2, err := meta.InfoHashV2()
+		assert.Nil(err)
+		assert.Equal(sha256.Sum256([]byte(info)), infoHashV2)
+	}
+
+	fromInfo, err := NewFromInfo([]byte(info), nil)
+	if assert.Nil(err) {
+		assert.Equal(meta.Info.FileTree, fromInfo.Info.FileTree)
+		assert.Nil(fromInfo.PieceLayers)
+	}
+
+	// Files need a length, and a pieces root unless they are empty
+	_, err = NewFromInfo([]byte("d9:file treed1:ad0:d6:lengthi5eeee12:meta versioni2e4:name4:treee"), nil)
+	assert.ErrorIs(err, ErrFileTree)
+	_, err = NewFromInfo([]byte("d9:file treed1:ad0:dee1:bd0:deee12:meta versioni2e4:name4:treee"), nil)
+	assert.ErrorIs(err, ErrFileTree)
+
+	_, err = Metainfo{}.InfoHashV2()
+	assert.ErrorIs(err, ErrNotV2)
+}
@@ -0,0 +1,322 @@
+/*
+Package mse implements Message Stream Encryption, the obfuscated handshake
+that peers use to hide BitTorrent traffic. A Diffie-Hellman key exchange
+sets up RC4 streams keyed with the torrent's infohash.
+*/
+package mse
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rc4"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"math/big"
+	"net"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Crypto methods that can be provided and selected
+const (
+	CryptoPlaintext uint32 = 0x01
+	CryptoRC4       uint32 = 0x02
+)
+
+const keyLen = 96       // Length of the public keys and the shared secret
+const maxPadLen = 512   // Max length of the random padding
+const rc4Discard = 1024 // Bytes of each RC4 key stream that are thrown away
+const plaintextPrefix = "\x13BitTorrent protocol"
+
+// Errors
+var (
+	ErrSync     = errors.New("Failed to find the start of the encrypted stream")
+	ErrSKey     = errors.New("Peer requested an unknown torrent")
+	ErrVC       = errors.New("Received bad verification constant")
+	ErrPadLen   = errors.New("Received padding that is too long")
+	ErrProvide  = errors.New("No crypto method is supported by both sides")
+	ErrSelected = errors.New("Peer selected a crypto method we did not provide")
+)
+
+var (
+	prime, _  = new(big.Int).SetString("FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B139B22514A08798E3404DDEF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245E485B576625E7EC6F44C42E9A63A36210000000000090563", 16)
+	generator = big.NewInt(2)
+	vc        = make([]byte, 8) // Verification constant
+)
+
+// Conn is a connection that has completed the MSE handshake, it decrypts reads and encrypts writes if RC4 was selected
+type Conn struct {
+	net.Conn
+	prefix []byte // Data already received that Read returns first
+	enc    *rc4.Cipher
+	dec    *rc4.Cipher
+	mu     sync.Mutex
+}
+
+// Read reads decrypted data from the connection
+func (c *Conn) Read(b []byte) (int, error) {
+	if len(c.prefix) > 0 {
+		n := copy(b, c.prefix)
+		c.prefix = c.prefix[n:]
+		return n, nil
+	}
+	n, err := c.Conn.Read(b)
+	if c.dec != nil {
+		c.dec.XORKeyStream(b[:n], b[:n])
+	}
+	return n, err
+}
+
+// Write encrypts data and writes it to the connection
+func (c *Conn) Write(b []byte) (int, error) {
+	if c.enc == nil {
+		return c.Conn.Write(b)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	encrypted := make([]byte, len(b))
+	c.enc.XORKeyStream(encrypted, b)
+	return c.Conn.Write(encrypted)
+}
+
+// Encrypted returns whether the connection's payload stream is encrypted
+func (c *Conn) Encrypted() bool {
+	return c.enc != nil
+}
+
+// IsPlaintext checks whether an incoming connection starts with a plaintext BitTorrent handshake,
+// the returned connection still yields the bytes that were read
+func IsPlaintext(conn net.Conn) (net.Conn, bool, error) {
+	prefix := make([]byte, len(plaintextPrefix))
+	if _, err := io.ReadFull(conn, prefix); err != nil {
+		return nil, false, errors.Wrap(err, "IsPlaintext")
+	}
+	return &Conn{Conn: conn, prefix: prefix}, string(prefix) == plaintextPrefix, nil
+}
+
+// Initiate performs the MSE handshake for an outgoing connection to a peer of the torrent with the given infohash
+func Initiate(conn net.Conn, infoHash [20]byte, provide uint32) (*Conn, error) {
+	private, public, err := newKeys()
+	if err != nil {
+		return nil, errors.Wrap(err, "Initiate")
+	}
+	if err = writePadded(conn, public); err != nil {
+		return nil, errors.Wrap(err, "Initiate")
+	}
+
+	peerPublic := make([]byte, keyLen)
+	if _, err = io.ReadFull(conn, peerPublic); err != nil {
+		return nil, errors.Wrap(err, "Initiate")
+	}
+	secret := sharedSecret(private, peerPublic)
+	enc := newCipher("keyA", secret, infoHash[:])
+	dec := newCipher("keyB", secret, infoHash[:])
+
+	// Identify the torrent and offer crypto methods
+	req2 := hash([]byte("req2"), infoHash[:])
+	req3 := hash([]byte("req3"), secret)
+	for i := range req2 {
+		req2[i] ^= req3[i]
+	}
+	offer := make([]byte, len(vc)+8) // Sent without padding or an initial payload, the handshake follows once the stream is set up
+	copy(offer, vc)
+	binary.BigEndian.PutUint32(offer[8:12], provide)
+	enc.XORKeyStream(offer, offer)
+	msg := append(hash([]byte("req1"), secret), req2...)
+	if _, err = conn.Write(append(msg, offer...)); err != nil {
+		return nil, errors.Wrap(err, "Initiate")
+	}
+
+	// The peer's padding ends where its encrypted verification constant starts
+	encVC := make([]byte, len(vc))
+	dec.XORKeyStream(encVC, vc)
+	if err = syncTo(conn, encVC); err != nil {
+		return nil, errors.Wrap(err, "Initiate")
+	}
+	reply := make([]byte, 6)
+	if _, err = io.ReadFull(conn, reply); err != nil {
+		return nil, errors.Wrap(err, "Initiate")
+	}
+	dec.XORKeyStream(reply, reply)
+	selected := binary.BigEndian.Uint32(reply[0:4])
+	if err = skipPad(conn, dec, binary.BigEndian.Uint16(reply[4:6])); err != nil {
+		return nil, errors.Wrap(err, "Initiate")
+	}
+
+	switch {
+	case selected == CryptoRC4 && provide&CryptoRC4 != 0:
+		return &Conn{Conn: conn, enc: enc, dec: dec}, nil
+	case selected == CryptoPlaintext && provide&CryptoPlaintext != 0:
+		return &Conn{Conn: conn}, nil
+	default:
+		return nil, errors.Wrap(ErrSelected, "Initiate")
+	}
+}
+
+// Receive performs the MSE handshake for an incoming connection, skeys are the infohashes of the torrents we serve
+// and allowed are the crypto methods we accept, RC4 is selected whenever possible
+func Receive(conn net.Conn, skeys [][20]byte, allowed uint32) (*Conn, [20]byte, error) {
+	var infoHash [20]byte
+	peerPublic := make([]byte, keyLen)
+	if _, err := io.ReadFull(conn, peerPublic); err != nil {
+		return nil, infoHash, errors.Wrap(err, "Receive")
+	}
+	private, public, err := newKeys()
+	if err != nil {
+		return nil, infoHash, errors.Wrap(err, "Receive")
+	}
+	if err = writePadded(conn, public); err != nil {
+		return nil, infoHash, errors.Wrap(err, "Receive")
+	}
+	secret := sharedSecret(private, peerPublic)
+
+	// The peer's padding ends where the hash of the secret starts
+	if err = syncTo(conn, hash([]byte("req1"), secret)); err != nil {
+		return nil, infoHash, errors.Wrap(err, "Receive")
+	}
+	req := make([]byte, sha1.Size)
+	if _, err = io.ReadFull(conn, req); err != nil {
+		return nil, infoHash, errors.Wrap(err, "Receive")
+	}
+	req3 := hash([]byte("req3"), secret)
+	found := false
+	for _, skey := range skeys {
+		req2 := hash([]byte("req2"), skey[:])
+		for i := range req2 {
+			req2[i] ^= req3[i]
+		}
+		if bytes.Equal(req, req2) {
+			infoHash, found = skey, true
+			break
+		}
+	}
+	if !found {
+		return nil, infoHash, errors.Wrap(ErrSKey, "Receive")
+	}
+	enc := newCipher("keyB", secret, infoHash[:])
+	dec := newCipher("keyA", secret, infoHash[:])
+
+	offer := make([]byte, len(vc)+6)
+	if _, err = io.ReadFull(conn, offer); err != nil {
+		return nil, infoHash, errors.Wrap(err, "Receive")
+	}
+	dec.XORKeyStream(offer, offer)
+	if !bytes.Equal(offer[:len(vc)], vc) {
+		return nil, infoHash, errors.Wrap(ErrVC, "Receive")
+	}
+	provide := binary.BigEndian.Uint32(offer[8:12])
+	if err = skipPad(conn, dec, binary.BigEndian.Uint16(offer[12:14])); err != nil {
+		return nil, infoHash, errors.Wrap(err, "Receive")
+	}
+	iaLen := make([]byte, 2)
+	if _, err = io.ReadFull(conn, iaLen); err != nil {
+		return nil, infoHash, errors.Wrap(err, "Receive")
+	}
+	dec.XORKeyStream(iaLen, iaLen)
+	initial := make([]byte, binary.BigEndian.Uint16(iaLen))
+	if _, err = io.ReadFull(conn, initial); err != nil {
+		return nil, infoHash, errors.Wrap(err, "Receive")
+	}
+	dec.XORKeyStream(initial, initial)
+
+	var selected uint32
+	if provide&allowed&CryptoRC4 != 0 {
+		selected = CryptoRC4
+	} else if provide&allowed&CryptoPlaintext != 0 {
+		selected = CryptoPlaintext
+	} else {
+		return nil, infoHash, errors.Wrap(ErrProvide, "Receive")
+	}
+	reply := make([]byte, len(vc)+6) // Sent without padding
+	copy(reply, vc)
+	binary.BigEndian.PutUint32(reply[8:12], selected)
+	enc.XORKeyStream(reply, reply)
+	if _, err = conn.Write(reply); err != nil {
+		return nil, infoHash, errors.Wrap(err, "Receive")
+	}
+
+	if selected == CryptoRC4 {
+		return &Conn{Conn: conn, prefix: initial, enc: enc, dec: dec}, infoHash, nil
+	}
+	return &Conn{Conn: conn, prefix: initial}, infoHash, nil
+}
+
+// newKeys generates a Diffie-Hellman key pair, the public key is padded to keyLen bytes
+func newKeys() (*big.Int, []byte, error) {
+	privateBytes := make([]byte, 20)
+	if _, err := rand.Read(privateBytes); err != nil {
+		return nil, nil, err
+	}
+	private := new(big.Int).SetBytes(privateBytes)
+	public := new(big.Int).Exp(generator, private, prime)
+	return private, public.FillBytes(make([]byte, keyLen)), nil
+}
+
+func sharedSecret(private *big.Int, peerPublic []byte) []byte {
+	secret := new(big.Int).Exp(new(big.Int).SetBytes(peerPublic), private, prime)
+	return secret.FillBytes(make([]byte, keyLen))
+}
+
+func hash(parts ...[]byte) []byte {
+	h := sha1.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return h.Sum(nil)
+}
+
+// newCipher creates an RC4 stream from the shared secret and the torrent's infohash
+func newCipher(name string, secret, skey []byte) *rc4.Cipher {
+	c, _ := rc4.NewCipher(hash([]byte(name), secret, skey)) // A 20 byte key is always valid
+	discard := make([]byte, rc4Discard)
+	c.XORKeyStream(discard, discard)
+	return c
+}
+
+// writePadded sends a public key followed by random padding
+func writePadded(conn net.Conn, public []byte) error {
+	padLen := make([]byte, 2)
+	if _, err := rand.Read(padLen); err != nil {
+		return err
+	}
+	pad := make([]byte, int(binary.BigEndian.Uint16(padLen))%(maxPadLen+1))
+	if _, err := rand.Read(pad); err != nil {
+		return err
+	}
+	_, err := conn.Write(append(public, pad...))
+	return err
+}
+
+// syncTo reads from the connection until just after the marker, which must appear within maxPadLen bytes
+func syncTo(conn net.Conn, marker []byte) error {
+	buf := make([]byte, len(marker), len(marker)+maxPadLen)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		return err
+	}
+	next := make([]byte, 1)
+	for !bytes.Equal(buf[len(buf)-len(marker):], marker) {
+		if len(buf) == cap(buf) {
+			return ErrSync
+		}
+		if _, err := io.ReadFull(conn, next); err != nil {
+			return err
+		}
+		buf = append(buf, next[0])
+	}
+	return nil
+}
+
+// skipPad reads and discards encrypted padding
+func skipPad(conn net.Conn, dec *rc4.Cipher, padLen uint16) error {
+	if padLen > maxPadLen {
+		return ErrPadLen
+	}
+	pad := make([]byte, padLen)
+	if _, err := io.ReadFull(conn, pad); err != nil {
+		return err
+	}
+	dec.XORKeyStream(pad, pad)
+	return nil
+}
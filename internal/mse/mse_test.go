@@ -0,0 +1,143 @@
+package mse
+
+import (
+	"io"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type result struct {
+	conn     *Conn
+	infoHash [20]byte
+	err      error
+}
+
+// handshake runs both sides of the MSE handshake over a loopback connection
+func handshake(t *testing.T, infoHash [20]byte, skeys [][20]byte, provide, allowed uint32) (result, result) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer listener.Close()
+
+	results := make(chan result, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			results <- result{err: err}
+			return
+		}
+		peekConn, plaintext, err := IsPlaintext(conn)
+		if err != nil || plaintext {
+			results <- result{err: ErrVC}
+			conn.Close()
+			return
+		}
+		encConn, infoHash, err := Receive(peekConn, skeys, allowed)
+		if err != nil {
+			conn.Close()
+		}
+		results <- result{conn: encConn, infoHash: infoHash, err: err}
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	require.Nil(t, err)
+	encConn, err := Initiate(conn, infoHash, provide)
+	if err != nil {
+		conn.Close()
+	}
+	return result{conn: encConn, infoHash: infoHash, err: err}, <-results
+}
+
+func TestHandshakeRC4(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	infoHash := [20]byte{1, 2, 3}
+	other := [20]byte{4, 5, 6}
+	initiator, receiver := handshake(t, infoHash, [][20]byte{other, infoHash}, CryptoRC4|CryptoPlaintext, CryptoRC4|CryptoPlaintext)
+	require.Nil(initiator.err)
+	require.Nil(receiver.err)
+	defer initiator.conn.Close()
+	defer receiver.conn.Close()
+
+	assert.Equal(infoHash, receiver.infoHash)
+	assert.True(initiator.conn.Encrypted())
+	assert.True(receiver.conn.Encrypted())
+
+	// Data passes through both directions
+	msg := []byte("\x13BitTorrent protocol")
+	go initiator.conn.Write(msg)
+	buf := make([]byte, len(msg))
+	_, err := io.ReadFull(receiver.conn, buf)
+	require.Nil(err)
+	assert.Equal(msg, buf)
+
+	go receiver.conn.Write([]byte("reply"))
+	buf = make([]byte, 5)
+	_, err = io.ReadFull(initiator.conn, buf)
+	require.Nil(err)
+	assert.Equal([]byte("reply"), buf)
+}
+
+func TestHandshakePlaintext(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// The receiver only accepts plaintext so the stream isn't encrypted after the handshake
+	infoHash := [20]byte{1, 2, 3}
+	initiator, receiver := handshake(t, infoHash, [][20]byte{infoHash}, CryptoRC4|CryptoPlaintext, CryptoPlaintext)
+	require.Nil(initiator.err)
+	require.Nil(receiver.err)
+	defer initiator.conn.Close()
+	defer receiver.conn.Close()
+	assert.False(initiator.conn.Encrypted())
+	assert.False(receiver.conn.Encrypted())
+
+	// Nothing in common
+	initiator, receiver = handshake(t, infoHash, [][20]byte{infoHash}, CryptoRC4, CryptoPlaintext)
+	assert.NotNil(initiator.err)
+	assert.ErrorIs(receiver.err, ErrProvide)
+}
+
+func TestHandshakeUnknownTorrent(t *testing.T) {
+	initiator, receiver := handshake(t, [20]byte{1}, [][20]byte{{2}}, CryptoRC4, CryptoRC4)
+	assert.NotNil(t, initiator.err)
+	assert.ErrorIs(t, receiver.err, ErrSKey)
+}
+
+func TestIsPlaintext(t *testing.T) {
+	assert := assert.New(t)
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	go remote.Write([]byte(plaintextPrefix + "rest"))
+
+	conn, plaintext, err := IsPlaintext(local)
+	assert.Nil(err)
+	assert.True(plaintext)
+
+	// The bytes that were checked are read again
+	buf := make([]byte, len(plaintextPrefix)+4)
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(err)
+	assert.Equal(plaintextPrefix+"rest", string(buf))
+}
+
+func TestParsePolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	policy, err := ParsePolicy("require")
+	assert.Nil(err)
+	assert.Equal(PolicyRequire, policy)
+	assert.Equal(CryptoRC4, policy.Provide())
+
+	policy, err = ParsePolicy("")
+	assert.Nil(err)
+	assert.Equal(PolicyDisabled, policy)
+
+	policy, err = ParsePolicy("sometimes")
+	assert.ErrorIs(err, ErrPolicy)
+	assert.Equal(PolicyPrefer, policy)
+}
@@ -0,0 +1,41 @@
+package mse
+
+import "github.com/pkg/errors"
+
+// Policy decides when peer connections are encrypted
+type Policy string
+
+// Encryption policies
+const (
+	PolicyDisabled Policy = "disabled" // Only use plaintext connections
+	PolicyPrefer   Policy = "prefer"   // Try encryption first, fall back to plaintext
+	PolicyRequire  Policy = "require"  // Only use encrypted connections
+)
+
+// ErrPolicy is returned for unknown policies
+var ErrPolicy = errors.New("Unknown encryption policy")
+
+// ParsePolicy reads a policy from the config, an empty value disables encryption
+func ParsePolicy(s string) (Policy, error) {
+	switch policy := Policy(s); policy {
+	case PolicyDisabled, PolicyPrefer, PolicyRequire:
+		return policy, nil
+	case "":
+		return PolicyDisabled, nil
+	default:
+		return PolicyPrefer, errors.Wrap(ErrPolicy, "ParsePolicy")
+	}
+}
+
+// Provide returns the crypto methods to offer when we start a handshake
+func (policy Policy) Provide() uint32 {
+	if policy == PolicyRequire {
+		return CryptoRC4
+	}
+	return CryptoRC4 | CryptoPlaintext
+}
+
+// Allowed returns the crypto methods to accept when a peer starts a handshake
+func (policy Policy) Allowed() uint32 {
+	return policy.Provide()
+}
@@ -0,0 +1,44 @@
+package peer
+
+import (
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/config"
+	"github.com/kylec725/graytorrent/internal/mse"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+// EncryptionPolicy returns the configured policy for encrypting peer connections
+func EncryptionPolicy() mse.Policy {
+	policy, err := mse.ParsePolicy(config.GetConfig().Network.Encryption)
+	if err != nil {
+		log.WithField("error", err.Error()).Warn("Invalid encryption policy, using prefer")
+	}
+	return policy
+}
+
+// encrypt performs the MSE handshake on a dialed connection, if the peer doesn't support it
+// we reconnect in plaintext unless encryption is required
+func (p *Peer) encrypt(info *common.TorrentInfo) error {
+	policy := EncryptionPolicy()
+	if policy == mse.PolicyDisabled {
+		return nil
+	}
+
+	p.Conn.Conn.SetDeadline(time.Now().Add(peerTimeout))
+	conn, err := mse.Initiate(p.Conn.Conn, info.InfoHash, policy.Provide())
+	p.Conn.Conn.SetDeadline(time.Time{})
+	if err == nil {
+		p.Conn.Conn = conn
+		return nil
+	} else if policy == mse.PolicyRequire {
+		return errors.Wrap(err, "encrypt")
+	}
+
+	log.WithFields(log.Fields{"peer": p.String(), "error": err.Error()}).Trace("Encrypted handshake failed, retrying in plaintext")
+	p.Conn.Close()
+	err = p.dial()
+	return errors.Wrap(err, "encrypt")
+}
@@ -0,0 +1,166 @@
+package peer
+
+import (
+	"bytes"
+	"net"
+
+	bencode "github.com/jackpal/bencode-go"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const clientVersion = "graytorrent 0.1.0" // Sent as v in the extension handshake
+const localReqq = maxQueue                // Number of outstanding requests we allow from a peer
+
+// ExtHandshake is the bencoded dictionary exchanged by the extension protocol (BEP 10)
+type ExtHandshake struct {
+	M            map[string]int `bencode:"m"`                       // Extension names mapped to their message IDs
+	V            string         `bencode:"v,omitempty"`             // Client name and version
+	P            int            `bencode:"p,omitempty"`             // Local TCP listen port
+	Reqq         int            `bencode:"reqq,omitempty"`          // Number of outstanding requests allowed
+	YourIP       string         `bencode:"yourip,omitempty"`        // Compact IP of the receiver as seen by the sender
+	MetadataSize int            `bencode:"metadata_size,omitempty"` // Size of the info dictionary (BEP 9)
+}
+
+// ExtensionHandler processes an extended message received from a peer
+type ExtensionHandler func(p *Peer, info *common.TorrentInfo, payload []byte) error
+
+type extension struct {
+	name    string
+	id      uint8 // Extended message ID that peers use to send us this extension's messages
+	handler ExtensionHandler
+}
+
+var (
+	extensionsByName = make(map[string]*extension)
+	extensionsByID   = make(map[uint8]*extension)
+)
+
+// Extensions that share peers outside of the tracker are not advertised for private torrents
+var privateDisabled = map[string]bool{"ut_pex": true}
+
+// RegisterExtension plugs in a handler for an extension by name, it should be called before any peers connect
+func RegisterExtension(name string, handler ExtensionHandler) {
+	if ext, ok := extensionsByName[name]; ok {
+		ext.handler = handler
+		return
+	}
+	ext := &extension{name: name, id: uint8(len(extensionsByName) + 1), handler: handler}
+	extensionsByName[name] = ext
+	extensionsByID[ext.id] = ext
+}
+
+// extensionID returns the local message ID of a registered extension
+func extensionID(name string) uint8 {
+	if ext, ok := extensionsByName[name]; ok {
+		return ext.id
+	}
+	return 0
+}
+
+// SupportsExtension returns whether the peer has advertised support for an extension
+func (p *Peer) SupportsExtension(name string) bool {
+	id, ok := p.extensions[name]
+	return ok && id != 0
+}
+
+// Extended returns an extended message for the peer, using the message ID the peer assigned to the extension
+func (p *Peer) Extended(name string, payload []byte) (message.Message, bool) {
+	if !p.SupportsExtension(name) {
+		return message.Message{}, false
+	}
+	return message.Extended(p.extensions[name], payload), true
+}
+
+// localExtHandshake builds the extension handshake we send to peers
+func (p *Peer) localExtHandshake(info *common.TorrentInfo, port uint16) ExtHandshake {
+	ext := ExtHandshake{
+		M:    make(map[string]int),
+		V:    clientVersion,
+		P:    int(port),
+		Reqq: localReqq,
+	}
+	for name, e := range extensionsByName {
+		if info.Private && privateDisabled[name] {
+			continue
+		} else if name == "ut_metadata" && len(info.Metadata) == 0 && info.TotalPieces > 0 { // Only while fetching it
+			continue
+		}
+		ext.M[name] = int(e.id)
+	}
+	ext.MetadataSize = len(info.Metadata)
+	if p.Conn != nil {
+		var ip net.IP
+		switch addr := p.Conn.Conn.RemoteAddr().(type) {
+		case *net.TCPAddr:
+			ip = addr.IP
+		case *net.UDPAddr: // Connected over uTP
+			ip = addr.IP
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			ext.YourIP = string(ip4)
+		} else if ip != nil {
+			ext.YourIP = string(ip.To16())
+		}
+	}
+	return ext
+}
+
+// sendExtHandshake sends our extension handshake to the peer
+func (p *Peer) sendExtHandshake(info *common.TorrentInfo, port uint16) error {
+	var payload bytes.Buffer
+	if err := bencode.Marshal(&payload, p.localExtHandshake(info, port)); err != nil {
+		return errors.Wrap(err, "sendExtHandshake")
+	}
+	msg := message.Extended(0, payload.Bytes())
+	err := p.sendMessage(&msg)
+	return errors.Wrap(err, "sendExtHandshake")
+}
+
+// readExtHandshake records the capabilities a peer sent in its extension handshake
+func (p *Peer) readExtHandshake(payload []byte) (ExtHandshake, error) {
+	var ext ExtHandshake
+	if err := bencode.Unmarshal(bytes.NewReader(payload), &ext); err != nil {
+		return ExtHandshake{}, errors.Wrap(err, "readExtHandshake")
+	}
+
+	// Later handshakes only update the extensions they mention, an ID of 0 disables the extension
+	for name, id := range ext.M {
+		if id < 0 || id > 255 {
+			continue
+		}
+		p.extensions[name] = uint8(id)
+	}
+	if ext.V != "" {
+		p.Client = ext.V
+	}
+	if ext.Reqq > 0 {
+		p.reqq = ext.Reqq
+	}
+	return ext, nil
+}
+
+// handleExtended dispatches an extended message to the handler of its extension
+func (p *Peer) handleExtended(msg *message.Message, info *common.TorrentInfo) error {
+	if len(msg.Payload) == 0 {
+		return errors.Wrap(ErrMessage, "handleExtended")
+	}
+
+	id, payload := msg.Payload[0], msg.Payload[1:]
+	if id == 0 {
+		ext, err := p.readExtHandshake(payload)
+		if err == nil {
+			log.WithFields(log.Fields{"peer": p.String(), "client": ext.V, "extensions": len(ext.M)}).Trace("Received extension handshake")
+		}
+		return errors.Wrap(err, "handleExtended")
+	}
+
+	ext, ok := extensionsByID[id]
+	if !ok { // Ignore extensions we never advertised
+		return nil
+	}
+	err := ext.handler(p, info, payload)
+	return errors.Wrap(err, "handleExtended")
+}
@@ -0,0 +1,82 @@
+package peer
+
+import (
+	"bytes"
+	"testing"
+
+	bencode "github.com/jackpal/bencode-go"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtHandshake(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	info := &common.TorrentInfo{TotalPieces: 8, Metadata: []byte("d4:name4:teste")}
+	p := New("peer", nil, info)
+
+	// The local handshake advertises every registered extension
+	local := p.localExtHandshake(info, 6881)
+	assert.Equal(int(extensionID("ut_metadata")), local.M["ut_metadata"])
+	assert.Equal(len(info.Metadata), local.MetadataSize)
+	assert.Equal(6881, local.P)
+	assert.Equal(clientVersion, local.V)
+
+	// Metadata is only advertised if we can serve it, or while fetching it
+	local = p.localExtHandshake(&common.TorrentInfo{TotalPieces: 8}, 6881)
+	assert.NotContains(local.M, "ut_metadata")
+	assert.Zero(local.MetadataSize)
+	local = p.localExtHandshake(&common.TorrentInfo{}, 0)
+	assert.Contains(local.M, "ut_metadata")
+
+	var payload bytes.Buffer
+	require.Nil(bencode.Marshal(&payload, ExtHandshake{M: map[string]int{"ut_metadata": 3, "ut_pex": 0}, V: "test 1.0", Reqq: 250}))
+	msg := message.Extended(0, payload.Bytes())
+	require.Nil(p.handleExtended(&msg, info))
+
+	assert.True(p.SupportsExtension("ut_metadata"))
+	assert.False(p.SupportsExtension("ut_pex"))
+	assert.Equal("test 1.0", p.Client)
+	assert.Equal(250, p.reqq)
+
+	ext, ok := p.Extended("ut_metadata", []byte("data"))
+	if assert.True(ok) {
+		assert.Equal(message.MsgExtended, ext.ID)
+		assert.Equal([]byte("\x03data"), ext.Payload)
+	}
+	_, ok = p.Extended("ut_pex", nil)
+	assert.False(ok)
+}
+
+func TestRegisterExtension(t *testing.T) {
+	assert := assert.New(t)
+
+	var received []byte
+	RegisterExtension("gt_test", func(p *Peer, info *common.TorrentInfo, payload []byte) error {
+		received = payload
+		return nil
+	})
+	id := extensionID("gt_test")
+	assert.NotZero(id)
+
+	// Registering the same name again replaces the handler but keeps the ID
+	RegisterExtension("gt_test", func(p *Peer, info *common.TorrentInfo, payload []byte) error {
+		received = append([]byte("replaced "), payload...)
+		return nil
+	})
+	assert.Equal(id, extensionID("gt_test"))
+
+	info := &common.TorrentInfo{TotalPieces: 8}
+	p := New("peer", nil, info)
+	msg := message.Extended(id, []byte("hello"))
+	if assert.Nil(p.handleMessage(&msg, info, nil)) {
+		assert.Equal([]byte("replaced hello"), received)
+	}
+
+	// Unknown extension IDs are ignored
+	msg = message.Extended(200, []byte("hello"))
+	assert.Nil(p.handleMessage(&msg, info, nil))
+}
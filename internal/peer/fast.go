@@ -0,0 +1,170 @@
+package peer
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"net"
+
+	"github.com/kylec725/graytorrent/internal/bitfield"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/peer/handshake"
+	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/kylec725/graytorrent/internal/picker"
+	"github.com/pkg/errors"
+)
+
+const allowedFastCount = 10 // Number of pieces a choked peer may request from us
+const maxSuggested = 32     // Number of suggested pieces to remember
+
+// Errors
+var (
+	ErrNoFast = errors.New("Received fast extension message from peer without support")
+)
+
+// supportsFast returns whether the peer's handshake advertised the fast extension
+func (p *Peer) supportsFast() bool {
+	h := handshake.Handshake{Reserved: p.reserved}
+	return h.Fast()
+}
+
+// sendBitfield tells the peer which pieces we have, it must be the first message after the handshake
+func (p *Peer) sendBitfield(info *common.TorrentInfo) error {
+	msg := message.Bitfield(info.Bitfield)
+	if p.supportsFast() { // Left only counts files that aren't skipped, so count the pieces we have
+		have := 0
+		for i := 0; i < info.TotalPieces; i++ {
+			if info.Bitfield.Has(i) {
+				have++
+			}
+		}
+		if have == info.TotalPieces {
+			msg = message.HaveAll()
+		} else if have == 0 {
+			msg = message.HaveNone()
+		}
+	}
+	if _, err := p.Conn.Write(msg.Encode()); err != nil {
+		return errors.Wrap(err, "sendBitfield")
+	}
+	if !p.supportsFast() {
+		return nil
+	}
+
+	// Let the peer request a few pieces that we have while it is choked
+	host, _, _ := net.SplitHostPort(p.String())
+	for _, index := range allowedFastSet(net.ParseIP(host), info.InfoHash, info.TotalPieces, allowedFastCount) {
+		p.localAllowedFast[index] = true
+		if info.Bitfield.Has(index) {
+			msg := message.AllowedFast(uint32(index))
+			if _, err := p.Conn.Write(msg.Encode()); err != nil {
+				return errors.Wrap(err, "sendBitfield")
+			}
+		}
+	}
+	return nil
+}
+
+// allowedFastSet generates the canonical allowed fast set for an IPv4 address (BEP 6)
+func allowedFastSet(ip net.IP, infoHash [20]byte, numPieces, count int) []int {
+	ip4 := ip.To4()
+	if ip4 == nil || numPieces == 0 {
+		return nil
+	}
+	if count > numPieces {
+		count = numPieces
+	}
+
+	x := make([]byte, 0, 24)
+	x = append(x, ip4[0], ip4[1], ip4[2], 0)
+	x = append(x, infoHash[:]...)
+	var set []int
+	for len(set) < count {
+		hash := sha1.Sum(x)
+		x = hash[:]
+		for i := 0; i < 5 && len(set) < count; i++ {
+			index := int(binary.BigEndian.Uint32(x[i*4:i*4+4]) % uint32(numPieces))
+			if !containsPiece(set, index) {
+				set = append(set, index)
+			}
+		}
+	}
+	return set
+}
+
+func containsPiece(pieces []int, index int) bool {
+	for _, piece := range pieces {
+		if piece == index {
+			return true
+		}
+	}
+	return false
+}
+
+// handleHaveAll marks every piece as available from the peer
+func (p *Peer) handleHaveAll(info *common.TorrentInfo) error {
+	if !p.supportsFast() {
+		return errors.Wrap(ErrNoFast, "handleHaveAll")
+	}
+	all := make(bitfield.Bitfield, len(p.bitfield))
+	for i := 0; i < info.TotalPieces; i++ {
+		all.Set(i)
+	}
+	p.setBitfield(all)
+	return nil
+}
+
+// handleHaveNone marks every piece as unavailable from the peer
+func (p *Peer) handleHaveNone() error {
+	if !p.supportsFast() {
+		return errors.Wrap(ErrNoFast, "handleHaveNone")
+	}
+	p.setBitfield(make(bitfield.Bitfield, len(p.bitfield)))
+	return nil
+}
+
+// handleSuggest remembers a piece the peer would like us to download
+func (p *Peer) handleSuggest(info *common.TorrentInfo, index int) error {
+	if !p.supportsFast() {
+		return errors.Wrap(ErrNoFast, "handleSuggest")
+	} else if index >= info.TotalPieces || containsPiece(p.suggested, index) {
+		return nil
+	}
+	p.suggested = append(p.suggested, index)
+	if len(p.suggested) > maxSuggested {
+		p.suggested = p.suggested[1:]
+	}
+	return nil
+}
+
+// handleAllowedFast records a piece that the peer lets us request while we are choked
+func (p *Peer) handleAllowedFast(info *common.TorrentInfo, index int) error {
+	if !p.supportsFast() {
+		return errors.Wrap(ErrNoFast, "handleAllowedFast")
+	} else if index < info.TotalPieces {
+		p.allowedFast[index] = true
+	}
+	return nil
+}
+
+// handleReject hands a block back to the picker as soon as the peer rejects it
+func (p *Peer) handleReject(msg *message.Message) error {
+	if !p.supportsFast() {
+		return errors.Wrap(ErrNoFast, "handleReject")
+	}
+	p.returnWork(picker.Block{
+		Index:  int(binary.BigEndian.Uint32(msg.Payload[0:4])),
+		Begin:  int(binary.BigEndian.Uint32(msg.Payload[4:8])),
+		Length: int(binary.BigEndian.Uint32(msg.Payload[8:12])),
+	})
+	return nil
+}
+
+// rejectRequest tells a peer with the fast extension that we won't answer its request
+func (p *Peer) rejectRequest(msg *message.Message) error {
+	if !p.supportsFast() {
+		return nil // Peers without the fast extension aren't told about ignored requests
+	}
+	reject := message.Message{ID: message.MsgReject, Payload: msg.Payload}
+	err := p.sendMessage(&reject)
+	return errors.Wrap(err, "rejectRequest")
+}
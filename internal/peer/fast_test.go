@@ -0,0 +1,132 @@
+package peer
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/bitfield"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/connect"
+	"github.com/kylec725/graytorrent/internal/peer/handshake"
+	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/kylec725/graytorrent/internal/picker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllowedFastSet(t *testing.T) {
+	assert := assert.New(t)
+
+	// Test vectors from BEP 6
+	var infoHash [20]byte
+	for i := range infoHash {
+		infoHash[i] = 0xaa
+	}
+	ip := net.ParseIP("80.4.4.200")
+	assert.Equal([]int{1059, 431, 808, 1217, 287, 376, 1188}, allowedFastSet(ip, infoHash, 1313, 7))
+	assert.Equal([]int{1059, 431, 808, 1217, 287, 376, 1188, 353, 508}, allowedFastSet(ip, infoHash, 1313, 9))
+
+	assert.Len(allowedFastSet(ip, infoHash, 3, 10), 3)
+	assert.Nil(allowedFastSet(net.ParseIP("::1"), infoHash, 1313, 10))
+}
+
+func newFastPeer(info *common.TorrentInfo) Peer {
+	p := New("10.0.0.1:6881", nil, info)
+	h := handshake.New(info, false)
+	p.reserved = h.Reserved
+	return p
+}
+
+func TestFastMessages(t *testing.T) {
+	assert := assert.New(t)
+
+	info := &common.TorrentInfo{TotalPieces: 12}
+	p := newFastPeer(&common.TorrentInfo{TotalPieces: 12})
+	p.picker = picker.New(info)
+
+	// The picker counts the pieces the peer has
+	msg := message.HaveAll()
+	assert.Nil(p.handleMessage(&msg, info, nil))
+	for i := 0; i < info.TotalPieces; i++ {
+		assert.True(p.bitfield.Has(i))
+		assert.Equal(1, p.picker.Availability(i))
+	}
+	msg = message.HaveNone()
+	assert.Nil(p.handleMessage(&msg, info, nil))
+	for i := 0; i < info.TotalPieces; i++ {
+		assert.False(p.bitfield.Has(i))
+		assert.Equal(0, p.picker.Availability(i))
+	}
+	msg = message.Have(4)
+	assert.Nil(p.handleMessage(&msg, info, nil))
+	assert.Nil(p.handleMessage(&msg, info, nil))
+	assert.Equal(1, p.picker.Availability(4))
+	msg = message.Have(12)
+	assert.ErrorIs(p.handleMessage(&msg, info, nil), ErrMessage)
+
+	msg = message.AllowedFast(3)
+	assert.Nil(p.handleMessage(&msg, info, nil))
+	assert.True(p.allowedFast[3])
+	msg = message.Suggest(5)
+	assert.Nil(p.handleMessage(&msg, info, nil))
+	assert.Equal([]int{5}, p.suggested)
+
+	// Peers that didn't advertise the fast extension can't send its messages
+	slow := New("10.0.0.2:6881", nil, info)
+	msg = message.HaveAll()
+	assert.ErrorIs(slow.handleMessage(&msg, info, nil), ErrNoFast)
+}
+
+func TestReject(t *testing.T) {
+	assert := assert.New(t)
+
+	info := &common.TorrentInfo{TotalPieces: 2, PieceLength: 4 * blockSize, TotalLength: 8 * blockSize, Left: 8 * blockSize}
+	p := newFastPeer(info)
+	p.picker = picker.New(info)
+
+	// Choking doesn't drop our requests with the fast extension, rejects hand back each block
+	var blks []picker.Block
+	for i := 0; i < 3; i++ {
+		blk, ok := p.picker.PickBlock(bitfield.Bitfield{0xc0}, nil, p.String())
+		require.True(t, ok)
+		p.requests[blk] = true
+		blks = append(blks, blk)
+	}
+
+	msg := message.Choke()
+	assert.Nil(p.handleMessage(&msg, info, nil))
+	assert.Len(p.requests, 3)
+
+	msg = message.Reject(uint32(blks[0].Index), uint32(blks[0].Begin), uint32(blks[0].Length))
+	assert.Nil(p.handleMessage(&msg, info, nil))
+	assert.Len(p.requests, 2)
+	blk, ok := p.picker.PickBlock(bitfield.Bitfield{0xc0}, nil, "10.0.0.2:6881")
+	assert.True(ok)
+	assert.Equal(blks[0], blk)
+}
+
+func TestRejectRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	info := &common.TorrentInfo{TotalPieces: 2, Bitfield: []byte{0x00}}
+	p := newFastPeer(info)
+	p.Conn = &connect.Conn{Conn: local, Timeout: time.Second}
+
+	// Requests while we are choking are rejected
+	errs := make(chan error, 1)
+	req := message.Request(1, 0, blockSize)
+	go func() { errs <- p.handleMessage(&req, info, nil) }()
+	buf := make([]byte, 64)
+	n, err := remote.Read(buf)
+	if assert.Nil(err) {
+		reply := message.Decode(buf[4:n])
+		assert.Equal(message.MsgReject, reply.ID)
+		assert.Equal(req.Payload, reply.Payload)
+	}
+	assert.Nil(<-errs)
+}
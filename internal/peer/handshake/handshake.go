@@ -9,6 +9,18 @@ import (
 
 const protocol = "BitTorrent protocol"
 
+// Reserved bits for protocol extensions, stored as byte index and bitmask
+const (
+	extensionByte = 5
+	extensionBit  = 0x10 // BEP 10 extension protocol
+	dhtByte       = 7
+	dhtBit        = 0x01 // BEP 5 DHT
+	fastByte      = 7
+	fastBit       = 0x04 // BEP 6 fast extension
+	v2Byte        = 7
+	v2Bit         = 0x10 // BEP 52 BitTorrent v2
+)
+
 // Errors
 var (
 	ErrPstrLen = errors.New("Got bad pstr length")
@@ -19,17 +31,28 @@ var (
 // Handshake is a message for starting the BitTorrent protocol
 type Handshake struct {
 	Pstr     string
+	Reserved [8]byte
 	InfoHash [20]byte
 	PeerID   [20]byte
 }
 
-// New returns a new handshake for a given torrent
-func New(info *common.TorrentInfo) Handshake {
-	return Handshake{
+// New returns a new handshake for a given torrent, the DHT is only advertised if we run a node (hasDHT) that the torrent
+// can use
+func New(info *common.TorrentInfo, hasDHT bool) Handshake {
+	h := Handshake{
 		Pstr:     protocol,
 		InfoHash: info.InfoHash,
 		PeerID:   info.PeerID,
 	}
+	h.Reserved[extensionByte] |= extensionBit
+	if hasDHT && !info.Private { // Private torrents don't use the DHT
+		h.Reserved[dhtByte] |= dhtBit
+	}
+	h.Reserved[fastByte] |= fastBit
+	if info.V2() {
+		h.Reserved[v2Byte] |= v2Bit
+	}
+	return h
 }
 
 // Encode serializes a handshake
@@ -39,38 +62,58 @@ func (h *Handshake) Encode() []byte {
 	handshake[0] = pstrLen
 	curr := 1
 	curr += copy(handshake[curr:], h.Pstr)
-	curr += copy(handshake[curr:], make([]byte, 8)) // TODO: Extensions
+	curr += copy(handshake[curr:], h.Reserved[:])
 	curr += copy(handshake[curr:], h.InfoHash[:])
 	curr += copy(handshake[curr:], h.PeerID[:])
 	return handshake
 }
 
-// Read reads in a handshake from a stream and returns the infohash
-func Read(reader io.Reader) ([20]byte, error) {
+// Extensions returns whether the handshake advertises the extension protocol
+func (h *Handshake) Extensions() bool {
+	return h.Reserved[extensionByte]&extensionBit != 0
+}
+
+// DHT returns whether the handshake advertises support for the DHT
+func (h *Handshake) DHT() bool {
+	return h.Reserved[dhtByte]&dhtBit != 0
+}
+
+// Fast returns whether the handshake advertises the fast extension
+func (h *Handshake) Fast() bool {
+	return h.Reserved[fastByte]&fastBit != 0
+}
+
+// V2 returns whether the handshake advertises BitTorrent v2
+func (h *Handshake) V2() bool {
+	return h.Reserved[v2Byte]&v2Bit != 0
+}
+
+// Read reads in a handshake from a stream
+func Read(reader io.Reader) (Handshake, error) {
 	buf := make([]byte, 1)
 	if _, err := io.ReadFull(reader, buf); err != nil {
-		return [20]byte{}, errors.Wrap(err, "Read")
+		return Handshake{}, errors.Wrap(err, "Read")
 	}
 
 	pstrLen := buf[0]
 	if pstrLen == 0 {
-		return [20]byte{}, errors.Wrap(ErrPstrLen, "rcvHandshake")
+		return Handshake{}, errors.Wrap(ErrPstrLen, "Read")
 	}
 
 	buf = make([]byte, 48+pstrLen)
 	if _, err := io.ReadFull(reader, buf); err != nil {
-		return [20]byte{}, errors.Wrap(err, "rcvHandshake")
+		return Handshake{}, errors.Wrap(err, "Read")
 	}
 
 	pstr := string(buf[:pstrLen])
 	if pstr != protocol {
-		return [20]byte{}, errors.Wrap(ErrPstr, "rcvHandshake")
+		return Handshake{}, errors.Wrap(ErrPstr, "Read")
 	}
 
-	var infoHash [20]byte
-	// var infoHash, peerID [20]byte
-	copy(infoHash[:], buf[pstrLen+8:pstrLen+28])
-	// copy(peerID[:], buf[ pstrLen+28 : pstrLen+48 ])  // TODO: need to verify the received peerID
+	h := Handshake{Pstr: pstr}
+	copy(h.Reserved[:], buf[pstrLen:pstrLen+8])
+	copy(h.InfoHash[:], buf[pstrLen+8:pstrLen+28])
+	copy(h.PeerID[:], buf[pstrLen+28:pstrLen+48]) // TODO: need to verify the received peerID
 
-	return infoHash, nil
+	return h, nil
 }
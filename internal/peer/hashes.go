@@ -0,0 +1,162 @@
+package peer
+
+import (
+	"encoding/binary"
+
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/merkle"
+	"github.com/kylec725/graytorrent/internal/peer/handshake"
+	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/kylec725/graytorrent/internal/write"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const maxHashRequest = 512 // Most hashes to ask for in one hash request
+
+// Errors
+var (
+	ErrNoV2   = errors.New("Received hash message from peer without v2 support")
+	ErrHashes = errors.New("Received hashes that don't match the file's pieces root")
+)
+
+// hashRequest is the header shared by hash request, hashes and hash reject messages
+type hashRequest struct {
+	piecesRoot  [32]byte
+	baseLayer   int
+	index       int
+	length      int
+	proofLayers int
+}
+
+func decodeHashRequest(payload []byte) hashRequest {
+	var req hashRequest
+	copy(req.piecesRoot[:], payload[0:32])
+	req.baseLayer = int(binary.BigEndian.Uint32(payload[32:36]))
+	req.index = int(binary.BigEndian.Uint32(payload[36:40]))
+	req.length = int(binary.BigEndian.Uint32(payload[40:44]))
+	req.proofLayers = int(binary.BigEndian.Uint32(payload[44:48]))
+	return req
+}
+
+// supportsV2 returns whether the peer's handshake advertised BitTorrent v2
+func (p *Peer) supportsV2() bool {
+	h := handshake.Handshake{Reserved: p.reserved}
+	return h.V2()
+}
+
+// pieceLayer returns the layer of the merkle trees that holds piece hashes, counting up from the blocks
+func pieceLayer(info *common.TorrentInfo) int {
+	return merkle.Log2(info.PieceLength / merkle.BlockSize)
+}
+
+// knownHashes returns whether we have the hashes of every piece in a range
+func knownHashes(info *common.TorrentInfo, first, count int) bool {
+	for _, hash := range info.PieceHashesV2[first : first+count] {
+		if hash == [32]byte{} {
+			return false
+		}
+	}
+	return true
+}
+
+// requestPieceLayers asks the peer for the piece layers we are missing, such as after getting a v2 torrent from a magnet link
+func (p *Peer) requestPieceLayers(info *common.TorrentInfo) error {
+	for _, path := range info.Paths {
+		if path.Pad || path.Length <= info.PieceLength {
+			continue
+		}
+		first, count, _ := write.FilePieces(info, path.PiecesRoot)
+		width := merkle.NextPow2(count)
+		length := common.Min(width, maxHashRequest)
+		proofLayers := merkle.Log2(width) - merkle.Log2(length) // Enough uncles to verify the hashes against the pieces root
+		for index := 0; index < count; index += length {
+			if knownHashes(info, first+index, common.Min(length, count-index)) {
+				continue
+			}
+			msg := message.HashRequest(path.PiecesRoot, uint32(pieceLayer(info)), uint32(index), uint32(length), uint32(proofLayers))
+			if err := p.sendMessage(&msg); err != nil {
+				return errors.Wrap(err, "requestPieceLayers")
+			}
+		}
+	}
+	return nil
+}
+
+// handleHashRequest sends the peer piece hashes from a file's piece layer, we only keep piece layers so requests for other layers are rejected
+func (p *Peer) handleHashRequest(msg *message.Message, info *common.TorrentInfo) error {
+	if !p.supportsV2() {
+		return errors.Wrap(ErrNoV2, "handleHashRequest")
+	}
+	req := decodeHashRequest(msg.Payload)
+	reject := message.HashReject(req.piecesRoot, uint32(req.baseLayer), uint32(req.index), uint32(req.length), uint32(req.proofLayers))
+
+	first, count, ok := write.FilePieces(info, req.piecesRoot)
+	if !ok || count < 2 || req.baseLayer != pieceLayer(info) || !knownHashes(info, first, count) {
+		err := p.sendMessage(&reject)
+		return errors.Wrap(err, "handleHashRequest")
+	}
+	width := merkle.NextPow2(count)
+	if req.length < 2 || merkle.NextPow2(req.length) != req.length || req.index%req.length != 0 ||
+		req.index+req.length > width || req.proofLayers > merkle.Log2(width)-merkle.Log2(req.length) {
+		err := p.sendMessage(&reject)
+		return errors.Wrap(err, "handleHashRequest")
+	}
+
+	pad := merkle.PadHash(pieceLayer(info))
+	layer := info.PieceHashesV2[first : first+count]
+	hashes := make([][32]byte, req.length)
+	for i := range hashes {
+		if req.index+i < count {
+			hashes[i] = layer[req.index+i]
+		} else {
+			hashes[i] = pad
+		}
+	}
+	proof := merkle.Proof(layer, width, pad, req.index, req.length)[:req.proofLayers]
+	resp := message.Hashes(req.piecesRoot, uint32(req.baseLayer), uint32(req.index), uint32(req.length), uint32(req.proofLayers), append(hashes, proof...))
+	err := p.sendMessage(&resp)
+	return errors.Wrap(err, "handleHashRequest")
+}
+
+// handleHashes verifies piece hashes from the peer against the file's pieces root and fills in the torrent's piece layer
+func (p *Peer) handleHashes(msg *message.Message, info *common.TorrentInfo) error {
+	if !p.supportsV2() {
+		return errors.Wrap(ErrNoV2, "handleHashes")
+	} else if (len(msg.Payload)-48)%32 != 0 {
+		return errors.Wrap(ErrMessage, "handleHashes")
+	}
+	req := decodeHashRequest(msg.Payload)
+	var received [][32]byte
+	for data := msg.Payload[48:]; len(data) > 0; data = data[32:] {
+		var hash [32]byte
+		copy(hash[:], data)
+		received = append(received, hash)
+	}
+
+	first, count, ok := write.FilePieces(info, req.piecesRoot)
+	if !ok || req.baseLayer != pieceLayer(info) || req.length < 1 || len(received) < req.length {
+		return nil // Not something we asked for
+	}
+	hashes, proof := received[:req.length], received[req.length:]
+	if !merkle.Verify(req.piecesRoot, hashes, req.index, proof) {
+		return errors.Wrap(ErrHashes, "handleHashes")
+	}
+	for i, hash := range hashes {
+		if req.index+i < count {
+			info.PieceHashesV2[first+req.index+i] = hash
+		}
+	}
+	log.WithFields(log.Fields{"peer": p.String(), "index": req.index, "length": req.length}).Trace("Received piece hashes")
+	return nil
+}
+
+// handleHashReject notes that the peer won't send us hashes, other peers are asked when they connect
+func (p *Peer) handleHashReject(msg *message.Message) error {
+	if !p.supportsV2() {
+		return errors.Wrap(ErrNoV2, "handleHashReject")
+	}
+	req := decodeHashRequest(msg.Payload)
+	log.WithFields(log.Fields{"peer": p.String(), "index": req.index, "length": req.length}).Debug("Peer rejected hash request")
+	return nil
+}
@@ -0,0 +1,118 @@
+package peer
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/connect"
+	"github.com/kylec725/graytorrent/internal/merkle"
+	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newV2Info returns a v2 torrent with one file of five pieces and the file's piece layer
+func newV2Info() (*common.TorrentInfo, [][32]byte) {
+	pieceLength := 2 * merkle.BlockSize
+	layer := make([][32]byte, 5)
+	for i := range layer {
+		rand.Read(layer[i][:])
+	}
+	root := merkle.Root(layer, 8, merkle.PadHash(1))
+	info := &common.TorrentInfo{
+		Name:          "file",
+		Paths:         []common.Path{{Length: 5*pieceLength - 100, Path: "file", PiecesRoot: root}},
+		PieceLength:   pieceLength,
+		TotalPieces:   5,
+		TotalLength:   5*pieceLength - 100,
+		InfoHashV2:    [32]byte{1},
+		PieceHashesV2: make([][32]byte, 5),
+	}
+	return info, layer
+}
+
+// readMessage reads a length prefixed message from a connection
+func readMessage(t *testing.T, conn net.Conn) *message.Message {
+	buf := make([]byte, 4)
+	_, err := io.ReadFull(conn, buf)
+	require.Nil(t, err)
+	buf = make([]byte, binary.BigEndian.Uint32(buf))
+	_, err = io.ReadFull(conn, buf)
+	require.Nil(t, err)
+	return message.Decode(buf)
+}
+
+func TestHashes(t *testing.T) {
+	assert := assert.New(t)
+
+	seed, layer := newV2Info()
+	copy(seed.PieceHashesV2, layer)
+	leech := *seed
+	leech.PieceHashesV2 = make([][32]byte, 5)
+	root := seed.Paths[0].PiecesRoot
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	seeder := newFastPeer(seed)
+	seeder.Conn = &connect.Conn{Conn: local, Timeout: time.Second}
+	leecher := newFastPeer(&leech)
+
+	// Pieces 2 and 3 need the uncles of two layers to reach the pieces root
+	errs := make(chan error, 1)
+	req := message.HashRequest(root, 1, 2, 2, 2)
+	go func() { errs <- seeder.handleMessage(&req, seed, nil) }()
+	resp := readMessage(t, remote)
+	assert.Nil(<-errs)
+	assert.Equal(message.MsgHashes, resp.ID)
+	assert.Len(resp.Payload, 48+4*32)
+	assert.Nil(leecher.handleMessage(resp, &leech, nil))
+	assert.Equal([][32]byte{{}, {}, layer[2], layer[3], {}}, leech.PieceHashesV2)
+
+	// The rest of the layer is padded
+	req = message.HashRequest(root, 1, 0, 8, 0)
+	go func() { errs <- seeder.handleMessage(&req, seed, nil) }()
+	resp = readMessage(t, remote)
+	assert.Nil(<-errs)
+	assert.Nil(leecher.handleMessage(resp, &leech, nil))
+	assert.Equal(layer, leech.PieceHashesV2)
+
+	// Hashes that don't lead to the pieces root are refused
+	resp.Payload[48]++
+	assert.ErrorIs(leecher.handleMessage(resp, &leech, nil), ErrHashes)
+
+	// Requests for files or layers we don't have are rejected
+	for _, req := range []message.Message{message.HashRequest([32]byte{9}, 1, 0, 8, 0), message.HashRequest(root, 0, 0, 8, 0), message.HashRequest(root, 1, 1, 2, 0)} {
+		go func(req message.Message) { errs <- seeder.handleMessage(&req, seed, nil) }(req)
+		resp = readMessage(t, remote)
+		assert.Nil(<-errs)
+		assert.Equal(message.MsgHashReject, resp.ID)
+		assert.Equal(req.Payload, resp.Payload)
+	}
+}
+
+func TestRequestPieceLayers(t *testing.T) {
+	assert := assert.New(t)
+
+	info, layer := newV2Info()
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	p := newFastPeer(info)
+	p.Conn = &connect.Conn{Conn: local, Timeout: time.Second}
+
+	errs := make(chan error, 1)
+	go func() { errs <- p.requestPieceLayers(info) }()
+	req := readMessage(t, remote)
+	assert.Nil(<-errs)
+	assert.Equal(message.HashRequest(info.Paths[0].PiecesRoot, 1, 0, 8, 0), *req)
+
+	// Nothing is requested once the layer is known
+	copy(info.PieceHashesV2, layer)
+	assert.Nil(p.requestPieceLayers(info))
+}
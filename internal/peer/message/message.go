@@ -21,6 +21,15 @@ const (
 	MsgPiece         messageID = 7
 	MsgCancel        messageID = 8
 	MsgPort          messageID = 9
+	MsgSuggest       messageID = 13 // Fast extension (BEP 6)
+	MsgHaveAll       messageID = 14
+	MsgHaveNone      messageID = 15
+	MsgReject        messageID = 16
+	MsgAllowedFast   messageID = 17
+	MsgExtended      messageID = 20
+	MsgHashRequest   messageID = 21 // BitTorrent v2 (BEP 52)
+	MsgHashes        messageID = 22
+	MsgHashReject    messageID = 23
 )
 
 // Message stores the message type id and payload
@@ -95,12 +104,95 @@ func Request(index, begin, length uint32) Message {
 
 // Piece returns a piece message containing a block
 func Piece(index, begin uint32, block []byte) Message {
-	payload := make([]byte, 4+len(block))
-	binary.BigEndian.PutUint32(payload, index)
-	copy(payload[4:], block)
+	payload := make([]byte, 8+len(block))
+	binary.BigEndian.PutUint32(payload[0:4], index)
+	binary.BigEndian.PutUint32(payload[4:8], begin)
+	copy(payload[8:], block)
 	return Message{ID: MsgPiece, Payload: payload}
 }
 
+// Cancel returns a cancel message for a block we requested
+func Cancel(index, begin, length uint32) Message {
+	msg := Request(index, begin, length)
+	msg.ID = MsgCancel
+	return msg
+}
+
+// Suggest returns a suggest piece message
+func Suggest(index uint32) Message {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, index)
+	return Message{ID: MsgSuggest, Payload: payload}
+}
+
+// HaveAll returns a have all message, it replaces the bitfield when we have every piece
+func HaveAll() Message {
+	return Message{ID: MsgHaveAll}
+}
+
+// HaveNone returns a have none message, it replaces the bitfield when we have no pieces
+func HaveNone() Message {
+	return Message{ID: MsgHaveNone}
+}
+
+// Reject returns a reject request message for a block
+func Reject(index, begin, length uint32) Message {
+	msg := Request(index, begin, length)
+	msg.ID = MsgReject
+	return msg
+}
+
+// AllowedFast returns an allowed fast message for a piece the peer may request while choked
+func AllowedFast(index uint32) Message {
+	payload := make([]byte, 4)
+	binary.BigEndian.PutUint32(payload, index)
+	return Message{ID: MsgAllowedFast, Payload: payload}
+}
+
+// Port returns a port message containing our DHT port
+func Port(port uint16) Message {
+	payload := make([]byte, 2)
+	binary.BigEndian.PutUint16(payload, port)
+	return Message{ID: MsgPort, Payload: payload}
+}
+
+// Extended returns an extension protocol message for the given extended message ID
+func Extended(extID uint8, payload []byte) Message {
+	extPayload := make([]byte, 1+len(payload))
+	extPayload[0] = extID
+	copy(extPayload[1:], payload)
+	return Message{ID: MsgExtended, Payload: extPayload}
+}
+
+// HashRequest returns a request for length hashes of a layer of a file's merkle tree starting at index,
+// along with the uncle hashes of proofLayers layers above them
+func HashRequest(piecesRoot [32]byte, baseLayer, index, length, proofLayers uint32) Message {
+	payload := make([]byte, 48)
+	copy(payload[0:32], piecesRoot[:])
+	binary.BigEndian.PutUint32(payload[32:36], baseLayer)
+	binary.BigEndian.PutUint32(payload[36:40], index)
+	binary.BigEndian.PutUint32(payload[40:44], length)
+	binary.BigEndian.PutUint32(payload[44:48], proofLayers)
+	return Message{ID: MsgHashRequest, Payload: payload}
+}
+
+// Hashes returns a response to a hash request, the requested hashes are followed by the proof's uncle hashes
+func Hashes(piecesRoot [32]byte, baseLayer, index, length, proofLayers uint32, hashes [][32]byte) Message {
+	msg := HashRequest(piecesRoot, baseLayer, index, length, proofLayers)
+	msg.ID = MsgHashes
+	for _, hash := range hashes {
+		msg.Payload = append(msg.Payload, hash[:]...)
+	}
+	return msg
+}
+
+// HashReject returns a reject message for a hash request
+func HashReject(piecesRoot [32]byte, baseLayer, index, length, proofLayers uint32) Message {
+	msg := HashRequest(piecesRoot, baseLayer, index, length, proofLayers)
+	msg.ID = MsgHashReject
+	return msg
+}
+
 func (msg *Message) String() string {
 	if msg == nil {
 		return "Keep Alive"
@@ -126,6 +218,24 @@ func (msg *Message) String() string {
 		return "Cancel"
 	case MsgPort:
 		return "Port"
+	case MsgSuggest:
+		return "Suggest"
+	case MsgHaveAll:
+		return "Have All"
+	case MsgHaveNone:
+		return "Have None"
+	case MsgReject:
+		return "Reject"
+	case MsgAllowedFast:
+		return "Allowed Fast"
+	case MsgExtended:
+		return "Extended"
+	case MsgHashRequest:
+		return "Hash Request"
+	case MsgHashes:
+		return "Hashes"
+	case MsgHashReject:
+		return "Hash Reject"
 	default:
 		return fmt.Sprintf("Unknown: %d", msg.ID)
 	}
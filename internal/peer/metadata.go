@@ -0,0 +1,273 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"strconv"
+
+	bencode "github.com/jackpal/bencode-go"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/peer/handshake"
+	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/pkg/errors"
+)
+
+const metadataPieceSize = 16384         // ut_metadata transfers the info dictionary in 16 KiB pieces
+const maxMetadataSize = 8 * 1024 * 1024 // Refuse info dictionaries larger than 8 MiB
+
+// ut_metadata message types
+const (
+	metadataRequest = 0
+	metadataData    = 1
+	metadataReject  = 2
+)
+
+// Errors
+var (
+	ErrNoExtensions   = errors.New("Peer does not support the extension protocol")
+	ErrNoMetadata     = errors.New("Peer does not support ut_metadata")
+	ErrMetadataSize   = errors.New("Peer sent an invalid metadata size")
+	ErrMetadataPiece  = errors.New("Peer sent a malformed metadata piece")
+	ErrMetadataReject = errors.New("Peer rejected a metadata request")
+	ErrMetadataHash   = errors.New("Received metadata does not match the infohash")
+	ErrBencode        = errors.New("Malformed bencoded data")
+)
+
+type metadataMsg struct {
+	MsgType   int `bencode:"msg_type"`
+	Piece     int `bencode:"piece"`
+	TotalSize int `bencode:"total_size,omitempty"`
+}
+
+func init() {
+	RegisterExtension("ut_metadata", handleMetadata)
+}
+
+// FetchMetadata downloads and verifies a torrent's info dictionary from the peer (BEP 9), the peer must already be dialed
+func (p *Peer) FetchMetadata(ctx context.Context, info *common.TorrentInfo) ([]byte, error) {
+	if err := p.encrypt(info); err != nil {
+		return nil, errors.Wrap(err, "FetchMetadata")
+	}
+
+	// Unblock any pending reads or writes if we get cancelled
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			p.Conn.Close()
+		case <-done:
+		}
+	}()
+
+	h := handshake.New(info, false) // We don't accept connections while fetching, so no DHT port is sent either
+	if _, err := p.Conn.Write(h.Encode()); err != nil {
+		return nil, errors.Wrap(err, "FetchMetadata")
+	}
+	rcvd, err := handshake.Read(p.Conn.Conn)
+	if err != nil {
+		return nil, errors.Wrap(err, "FetchMetadata")
+	} else if !bytes.Equal(rcvd.InfoHash[:], info.InfoHash[:]) {
+		return nil, errors.Wrap(ErrInfoHash, "FetchMetadata")
+	} else if !rcvd.Extensions() {
+		return nil, errors.Wrap(ErrNoExtensions, "FetchMetadata")
+	}
+
+	// Advertise ut_metadata support, we don't accept connections while fetching so no port is sent
+	p.reserved = rcvd.Reserved
+	if err = p.sendExtHandshake(info, 0); err != nil {
+		return nil, errors.Wrap(err, "FetchMetadata")
+	}
+
+	var metadata []byte
+	var received []bool
+	remaining := 0
+	for {
+		msg, err := p.readMessage()
+		if err != nil {
+			return nil, errors.Wrap(err, "FetchMetadata")
+		} else if msg == nil || msg.ID != message.MsgExtended || len(msg.Payload) == 0 {
+			continue // Ignore anything that isn't part of the extension protocol
+		}
+
+		switch msg.Payload[0] {
+		case 0: // Extension handshake
+			if metadata != nil { // Ignore repeated handshakes
+				continue
+			}
+			ext, err := p.readExtHandshake(msg.Payload[1:])
+			if err != nil {
+				return nil, errors.Wrap(err, "FetchMetadata")
+			} else if !p.SupportsExtension("ut_metadata") {
+				return nil, errors.Wrap(ErrNoMetadata, "FetchMetadata")
+			} else if ext.MetadataSize <= 0 || ext.MetadataSize > maxMetadataSize {
+				return nil, errors.Wrap(ErrMetadataSize, "FetchMetadata")
+			}
+
+			metadata = make([]byte, ext.MetadataSize)
+			remaining = (ext.MetadataSize + metadataPieceSize - 1) / metadataPieceSize
+			received = make([]bool, remaining)
+			if err = p.requestMetadata(remaining); err != nil {
+				return nil, errors.Wrap(err, "FetchMetadata")
+			}
+		case extensionID("ut_metadata"):
+			if metadata == nil {
+				continue
+			}
+			index, block, err := readMetadataPiece(msg.Payload[1:])
+			if err != nil {
+				return nil, errors.Wrap(err, "FetchMetadata")
+			}
+			if index < 0 || index >= len(received) {
+				return nil, errors.Wrap(ErrMetadataPiece, "FetchMetadata")
+			}
+			start := index * metadataPieceSize
+			if len(block) != common.Min(metadataPieceSize, len(metadata)-start) {
+				return nil, errors.Wrap(ErrMetadataPiece, "FetchMetadata")
+			}
+			if !received[index] {
+				copy(metadata[start:], block)
+				received[index] = true
+				remaining--
+			}
+
+			if remaining == 0 {
+				// v2 only magnet links identify the torrent with its truncated SHA-256 infohash
+				var truncated [20]byte
+				hashV2 := sha256.Sum256(metadata)
+				copy(truncated[:], hashV2[:])
+				if sha1.Sum(metadata) != info.InfoHash && truncated != info.InfoHash {
+					return nil, errors.Wrap(ErrMetadataHash, "FetchMetadata")
+				}
+				return metadata, nil
+			}
+		}
+	}
+}
+
+// requestMetadata asks the peer for every piece of the metadata
+func (p *Peer) requestMetadata(numPieces int) error {
+	for i := 0; i < numPieces; i++ {
+		var payload bytes.Buffer
+		if err := bencode.Marshal(&payload, metadataMsg{MsgType: metadataRequest, Piece: i}); err != nil {
+			return errors.Wrap(err, "requestMetadata")
+		}
+		msg, _ := p.Extended("ut_metadata", payload.Bytes())
+		if err := p.sendMessage(&msg); err != nil {
+			return errors.Wrap(err, "requestMetadata")
+		}
+	}
+	return nil
+}
+
+// handleMetadata answers ut_metadata requests from peers that are connected for downloading with pieces of the info
+// dictionary, requests are rejected if we don't have it
+func handleMetadata(p *Peer, info *common.TorrentInfo, payload []byte) error {
+	var msg metadataMsg
+	if err := bencode.Unmarshal(bytes.NewReader(payload), &msg); err != nil {
+		return errors.Wrap(err, "handleMetadata")
+	} else if msg.MsgType != metadataRequest {
+		return nil
+	}
+
+	var reply bytes.Buffer
+	start := msg.Piece * metadataPieceSize
+	if msg.Piece < 0 || start >= len(info.Metadata) {
+		if err := bencode.Marshal(&reply, metadataMsg{MsgType: metadataReject, Piece: msg.Piece}); err != nil {
+			return errors.Wrap(err, "handleMetadata")
+		}
+	} else {
+		if err := bencode.Marshal(&reply, metadataMsg{MsgType: metadataData, Piece: msg.Piece, TotalSize: len(info.Metadata)}); err != nil {
+			return errors.Wrap(err, "handleMetadata")
+		}
+		reply.Write(info.Metadata[start:common.Min(start+metadataPieceSize, len(info.Metadata))])
+	}
+	if replyMsg, ok := p.Extended("ut_metadata", reply.Bytes()); ok {
+		err := p.sendMessage(&replyMsg)
+		return errors.Wrap(err, "handleMetadata")
+	}
+	return nil
+}
+
+// readMetadataPiece parses a ut_metadata message, returning the piece index and the data that follows the dictionary
+func readMetadataPiece(payload []byte) (int, []byte, error) {
+	dictLen, err := bencodeLen(payload)
+	if err != nil {
+		return 0, nil, errors.Wrap(err, "readMetadataPiece")
+	}
+	var msg metadataMsg
+	if err = bencode.Unmarshal(bytes.NewReader(payload[:dictLen]), &msg); err != nil {
+		return 0, nil, errors.Wrap(err, "readMetadataPiece")
+	}
+
+	switch msg.MsgType {
+	case metadataData:
+		return msg.Piece, payload[dictLen:], nil
+	case metadataReject:
+		return 0, nil, errors.Wrap(ErrMetadataReject, "readMetadataPiece")
+	default:
+		return 0, nil, errors.Wrap(ErrMetadataPiece, "readMetadataPiece")
+	}
+}
+
+// readMessage reads a single length prefixed message from the peer
+func (p *Peer) readMessage() (*message.Message, error) {
+	buf := make([]byte, 4)
+	if _, err := p.Conn.Read(buf); err != nil {
+		return nil, errors.Wrap(err, "readMessage")
+	}
+	length := binary.BigEndian.Uint32(buf)
+	if length == 0 { // Keep-alive
+		return nil, nil
+	} else if length > maxMetadataSize {
+		return nil, errors.Wrap(ErrMessage, "readMessage")
+	}
+
+	buf = make([]byte, length)
+	if _, err := p.Conn.Read(buf); err != nil {
+		return nil, errors.Wrap(err, "readMessage")
+	}
+	return message.Decode(buf), nil
+}
+
+// bencodeLen returns the length of the first bencoded value in data
+func bencodeLen(data []byte) (int, error) {
+	if len(data) == 0 {
+		return 0, ErrBencode
+	}
+
+	switch data[0] {
+	case 'i':
+		end := bytes.IndexByte(data, 'e')
+		if end < 0 {
+			return 0, ErrBencode
+		}
+		return end + 1, nil
+	case 'l', 'd':
+		curr := 1
+		for curr < len(data) && data[curr] != 'e' {
+			n, err := bencodeLen(data[curr:])
+			if err != nil {
+				return 0, err
+			}
+			curr += n
+		}
+		if curr >= len(data) {
+			return 0, ErrBencode
+		}
+		return curr + 1, nil
+	default:
+		colon := bytes.IndexByte(data, ':')
+		if colon < 0 {
+			return 0, ErrBencode
+		}
+		strLen, err := strconv.Atoi(string(data[:colon]))
+		if err != nil || strLen < 0 || colon+1+strLen > len(data) {
+			return 0, ErrBencode
+		}
+		return colon + 1 + strLen, nil
+	}
+}
@@ -0,0 +1,172 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	bencode "github.com/jackpal/bencode-go"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/connect"
+	"github.com/kylec725/graytorrent/internal/peer/handshake"
+	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBencodeLen(t *testing.T) {
+	assert := assert.New(t)
+
+	n, err := bencodeLen([]byte("d8:msg_typei1e5:piecei0eeextra"))
+	if assert.Nil(err) {
+		assert.Equal(25, n)
+	}
+	n, err = bencodeLen([]byte("l4:spami42eee"))
+	if assert.Nil(err) {
+		assert.Equal(12, n)
+	}
+	_, err = bencodeLen([]byte("d8:msg_type"))
+	assert.NotNil(err)
+	_, err = bencodeLen([]byte("10:short"))
+	assert.NotNil(err)
+}
+
+// servePeerMetadata acts as a remote peer that serves metadata over the extension protocol
+func servePeerMetadata(t *testing.T, conn net.Conn, info *common.TorrentInfo, metadata []byte) {
+	defer conn.Close()
+	if _, err := handshake.Read(conn); err != nil {
+		t.Error(err)
+		return
+	}
+	h := handshake.New(info, false)
+	conn.Write(h.Encode())
+
+	readMsg := func() *message.Message {
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil
+		}
+		buf = make([]byte, binary.BigEndian.Uint32(buf))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return nil
+		}
+		return message.Decode(buf)
+	}
+
+	const remoteID = 3
+	for {
+		msg := readMsg()
+		if msg == nil {
+			return
+		} else if msg.ID != message.MsgExtended {
+			continue
+		}
+
+		var payload bytes.Buffer
+		if msg.Payload[0] == 0 {
+			bencode.Marshal(&payload, ExtHandshake{M: map[string]int{"ut_metadata": remoteID}, MetadataSize: len(metadata)})
+			reply := message.Extended(0, payload.Bytes())
+			conn.Write(reply.Encode())
+			continue
+		}
+
+		var req metadataMsg
+		bencode.Unmarshal(bytes.NewReader(msg.Payload[1:]), &req)
+		start := req.Piece * metadataPieceSize
+		end := common.Min(start+metadataPieceSize, len(metadata))
+		bencode.Marshal(&payload, metadataMsg{MsgType: metadataData, Piece: req.Piece, TotalSize: len(metadata)})
+		payload.Write(metadata[start:end])
+		reply := message.Extended(extensionID("ut_metadata"), payload.Bytes())
+		conn.Write(reply.Encode())
+	}
+}
+
+// metadataPeer starts a remote peer on loopback and returns a peer connected to it
+func metadataPeer(t *testing.T, info *common.TorrentInfo, metadata []byte) Peer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	go func() {
+		defer listener.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		servePeerMetadata(t, conn, info, metadata)
+	}()
+
+	p := New(listener.Addr().String(), nil, info)
+	require.Nil(t, p.Dial(context.Background()))
+	return p
+}
+
+func TestFetchMetadata(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	// Metadata spanning multiple pieces
+	metadata := bytes.Repeat([]byte("graytorrent"), 3000)
+	info := &common.TorrentInfo{InfoHash: sha1.Sum(metadata)}
+	info.SetPeerID()
+
+	p := metadataPeer(t, info, metadata)
+	data, err := p.FetchMetadata(context.Background(), info)
+	require.Nil(err)
+	assert.Equal(metadata, data)
+}
+
+func TestFetchMetadataBadHash(t *testing.T) {
+	assert := assert.New(t)
+
+	metadata := []byte("d4:name4:teste")
+	info := &common.TorrentInfo{InfoHash: sha1.Sum([]byte("something else"))}
+	info.SetPeerID()
+
+	p := metadataPeer(t, info, metadata)
+	_, err := p.FetchMetadata(context.Background(), info)
+	assert.ErrorIs(err, ErrMetadataHash)
+}
+
+func TestServeMetadata(t *testing.T) {
+	assert := assert.New(t)
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	msgs := readMessages(remote)
+
+	metadata := bytes.Repeat([]byte("graytorrent"), 3000)
+	info := &common.TorrentInfo{TotalPieces: 1, Metadata: metadata}
+	p := New("10.0.0.1:6881", nil, info)
+	p.Conn = &connect.Conn{Conn: local, Timeout: time.Second}
+	p.extensions["ut_metadata"] = 3
+
+	request := func(piece int) *message.Message {
+		var payload bytes.Buffer
+		require.Nil(t, bencode.Marshal(&payload, metadataMsg{MsgType: metadataRequest, Piece: piece}))
+		msg := message.Extended(extensionID("ut_metadata"), payload.Bytes())
+		require.Nil(t, p.handleMessage(&msg, info, nil))
+		reply := nextMessage(t, msgs)
+		require.Equal(t, message.MsgExtended, reply.ID)
+		require.Equal(t, byte(3), reply.Payload[0])
+		return reply
+	}
+
+	// Pieces of the info dictionary are sent with the ID the peer gave ut_metadata, the last piece is shorter
+	index, block, err := readMetadataPiece(request(2).Payload[1:])
+	assert.Nil(err)
+	assert.Equal(2, index)
+	assert.Equal(metadata[2*metadataPieceSize:], block)
+	index, block, err = readMetadataPiece(request(0).Payload[1:])
+	assert.Nil(err)
+	assert.Equal(0, index)
+	assert.Equal(metadata[:metadataPieceSize], block)
+
+	// Pieces past the end are rejected
+	_, _, err = readMetadataPiece(request(3).Payload[1:])
+	assert.ErrorIs(err, ErrMetadataReject)
+}
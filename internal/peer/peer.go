@@ -14,7 +14,10 @@ import (
 	"github.com/kylec725/graytorrent/internal/bitfield"
 	"github.com/kylec725/graytorrent/internal/common"
 	"github.com/kylec725/graytorrent/internal/connect"
+	"github.com/kylec725/graytorrent/internal/dht"
 	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/kylec725/graytorrent/internal/picker"
+	"github.com/kylec725/graytorrent/internal/utp"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -23,6 +26,44 @@ const requestTimeout = 15 * time.Second    // How long to wait on requests befor
 const keepAliveTimeout = 120 * time.Second // How long to wait before removing a peer with no messages
 const sendKeepAlive = 90 * time.Second     // How long to wait before sending a keep alive message
 const adjustTime = 5 * time.Second         // How often in seconds to adjust the transfer rates
+const utpDialTimeout = 5 * time.Second     // Time to wait on a uTP connection before falling back to TCP
+
+// Source is where we learned about a peer
+type Source uint8
+
+// Peer sources
+const (
+	SourceTracker  Source = iota // Announced by a tracker
+	SourceIncoming               // Connected to us
+	SourceDHT                    // Found in the DHT
+	SourcePEX                    // Shared by another peer
+	SourceMagnet                 // Listed in a magnet link
+	SourceLSD                    // Announced on the local network
+)
+
+// Public returns whether the source finds peers outside of a torrent's trackers, private torrents can't use them
+func (source Source) Public() bool {
+	return source == SourceDHT || source == SourcePEX || source == SourceLSD
+}
+
+func (source Source) String() string {
+	switch source {
+	case SourceTracker:
+		return "Tracker"
+	case SourceIncoming:
+		return "Incoming"
+	case SourceDHT:
+		return "DHT"
+	case SourcePEX:
+		return "PEX"
+	case SourceMagnet:
+		return "Magnet"
+	case SourceLSD:
+		return "LSD"
+	default:
+		return "Unknown"
+	}
+}
 
 // Peer stores info about connecting to peers as well as their state
 type Peer struct {
@@ -33,18 +74,33 @@ type Peer struct {
 	PeerChoking    bool
 	PeerInterested bool
 	Send           chan message.Message // Used by outer goroutines to send messages, allows us to handle errors internally
+	Client         string               // Client name and version the peer reported, if any
+	Source         Source               // Where we learned about the peer
+	Discovered     chan<- Peer          // Peers shared by this peer are sent here, nil to ignore them
 
-	bitfield     bitfield.Bitfield
-	workPieces   map[int]workPiece // Map to keep track of what pieces we're trying to get
-	queue        int               // How many requests have been sent out
-	queueSize    int               // How many requests can be queued at a time
-	bytesRcvd    uint32            // Number of bytes received since the last adjustment time
-	bytesSent    uint32            // Number of bytes sent since the last adjustment time
-	lastMsgRcvd  time.Time
-	lastMsgSent  time.Time
-	lastRequest  time.Time // Last time a request was sent
-	lastPiece    time.Time // Last time a piece was received
-	lastUnchoked time.Time
+	done             <-chan struct{}  // Closed once the peer stops working
+	pex              chan []string    // Connected peers to share through PEX
+	pexSent          map[string]bool  // Peers we have already shared through PEX
+	dht              *dht.DHT         // The session's DHT node, nil if the DHT is disabled
+	utp              *utp.Socket      // The session's uTP socket, nil to only connect over TCP
+	reserved         [8]byte          // Reserved bytes from the peer's handshake
+	extensions       map[string]uint8 // Extension message IDs assigned by the peer
+	reqq             int              // Number of outstanding requests the peer allows, 0 if unknown
+	bitfield         bitfield.Bitfield
+	picker           *picker.Picker        // Chooses the pieces we request, shared by the torrent's peers
+	requests         map[picker.Block]bool // Blocks we requested that the peer hasn't sent yet
+	allowedFast      map[int]bool          // Pieces the peer lets us request while choked
+	localAllowedFast map[int]bool          // Pieces we let the peer request while choked
+	suggested        []int                 // Pieces the peer suggested we download, oldest first
+	uploads          []message.Message     // Requests from the peer that we haven't answered yet, oldest first
+	queueSize        int                   // How many requests can be queued at a time
+	bytesRcvd        uint32                // Number of bytes received since the last adjustment time
+	bytesSent        uint32                // Number of bytes sent since the last adjustment time
+	lastMsgRcvd      time.Time
+	lastMsgSent      time.Time
+	lastRequest      time.Time // Last time a request was sent
+	lastPiece        time.Time // Last time a piece was received
+	lastUnchoked     time.Time
 }
 
 func (p Peer) String() string {
@@ -58,6 +114,10 @@ func New(addr string, conn net.Conn, info *common.TorrentInfo) Peer {
 		peerConn = &connect.Conn{Conn: conn, Timeout: peerTimeout}
 	}
 	bitfieldSize := int(math.Ceil(float64(info.TotalPieces) / 8))
+	source := SourceTracker
+	if conn != nil {
+		source = SourceIncoming
+	}
 	return Peer{
 		Addr:           addr,
 		Conn:           peerConn,
@@ -66,30 +126,38 @@ func New(addr string, conn net.Conn, info *common.TorrentInfo) Peer {
 		PeerChoking:    true,
 		PeerInterested: false,
 		Send:           make(chan message.Message),
+		Source:         source,
 
-		bitfield:    make([]byte, bitfieldSize),
-		workPieces:  make(map[int]workPiece),
-		queue:       0,
-		queueSize:   minQueue,
-		bytesRcvd:   0,
-		bytesSent:   0,
-		lastMsgRcvd: time.Now(),
-		lastMsgSent: time.Now(),
-		lastRequest: time.Now(),
-		lastPiece:   time.Now(),
+		pex:              make(chan []string, 1),
+		pexSent:          make(map[string]bool),
+		extensions:       make(map[string]uint8),
+		bitfield:         make([]byte, bitfieldSize),
+		requests:         make(map[picker.Block]bool),
+		allowedFast:      make(map[int]bool),
+		localAllowedFast: make(map[int]bool),
+		queueSize:        minQueue,
+		bytesRcvd:        0,
+		bytesSent:        0,
+		lastMsgRcvd:      time.Now(),
+		lastMsgSent:      time.Now(),
+		lastRequest:      time.Now(),
+		lastPiece:        time.Now(),
 	}
 }
 
 // TODO: in seeding mode, we should disconnect from peers with the full file
 
-// StartWork makes a peer wait for pieces to download
-func (p *Peer) StartWork(ctx context.Context, info *common.TorrentInfo, work chan int, results chan<- int, deadPeers chan<- string) {
+// StartWork makes a peer download the pieces it is given by the picker
+func (p *Peer) StartWork(ctx context.Context, info *common.TorrentInfo, pk *picker.Picker, results chan<- int, deadPeers chan<- string) {
 	peerLog := log.WithField("peer", p.String())
+	p.picker = pk
+	p.picker.AddPeer(p.bitfield)
 
 	// Setup peer connection
 	connCtx, connCancel := context.WithCancel(ctx)
 	connection := make(chan []byte, 2) // Buffer so that connection can exit if we haven't read the data yet
 	go p.Conn.Poll(connCtx, connection)
+	p.done = connCtx.Done()
 
 	// Create ticker to update the adaptive queuing rate
 	adapRateTicker := time.NewTicker(adjustTime)
@@ -97,12 +165,41 @@ func (p *Peer) StartWork(ctx context.Context, info *common.TorrentInfo, work cha
 	// Cleanup
 	defer func() {
 		deadPeers <- p.String() // Notify main to remove this peer from its list
-		p.clearWork(work)
+		p.clearWork()
+		p.picker.RemovePeer(p.bitfield)
 		connCancel()
 		adapRateTicker.Stop()
 		peerLog.Debug("Peer shutdown")
 	}()
 
+	// Let the peer know which extensions we support
+	if p.supportsExtensions() {
+		if err := p.sendExtHandshake(info, common.Port(ctx)); err != nil {
+			peerLog.WithField("error", err.Error()).Debug("Error sending extension handshake")
+			return
+		}
+	}
+
+	// Let the peer know where our DHT node is, private torrents keep the DHT out of their swarm
+	if !info.Private {
+		p.dht, _ = dht.FromContext(ctx)
+	}
+	if p.dht != nil && p.supportsDHT() {
+		msg := message.Port(p.dht.Port())
+		if err := p.sendMessage(&msg); err != nil {
+			peerLog.WithField("error", err.Error()).Debug("Error sending port")
+			return
+		}
+	}
+
+	// Ask v2 peers for the piece hashes we don't have yet
+	if info.V2() && p.supportsV2() {
+		if err := p.requestPieceLayers(info); err != nil {
+			peerLog.WithField("error", err.Error()).Debug("Error requesting piece layers")
+			return
+		}
+	}
+
 	// Figure out if we're interested // TODO: only pull new work pieces when we're interested
 	for i := 0; i < info.TotalPieces; i++ {
 		if !info.Bitfield.Has(i) && p.bitfield.Has(i) {
@@ -113,6 +210,7 @@ func (p *Peer) StartWork(ctx context.Context, info *common.TorrentInfo, work cha
 
 	// Work loop
 	for {
+		cancelled := p.picker.Cancelled()
 		select {
 		case <-ctx.Done():
 			return
@@ -122,7 +220,7 @@ func (p *Peer) StartWork(ctx context.Context, info *common.TorrentInfo, work cha
 			}
 			p.lastMsgRcvd = time.Now()
 			msg := message.Decode(data)
-			if err := p.handleMessage(msg, info, work, results); err != nil {
+			if err := p.handleMessage(msg, info, results); err != nil {
 				peerLog.WithFields(log.Fields{"type": msg.String(), "size": len(msg.Payload), "error": err.Error()}).Debug("Error handling message")
 				return
 			}
@@ -131,10 +229,29 @@ func (p *Peer) StartWork(ctx context.Context, info *common.TorrentInfo, work cha
 				peerLog.WithFields(log.Fields{"type": msg.String(), "error": err.Error()}).Debug("Error sending message")
 				return
 			}
+			if err := p.handleSent(&msg); err != nil {
+				peerLog.WithFields(log.Fields{"type": msg.String(), "error": err.Error()}).Debug("Error handling sent message")
+				return
+			}
+		case <-cancelled: // Blocks we requested may have come from other peers
+			if err := p.cancelWork(); err != nil {
+				peerLog.WithField("error", err.Error()).Debug("Error cancelling requests")
+				return
+			}
+		case <-p.uploadReady():
+			if err := p.serveUpload(info); err != nil {
+				peerLog.WithField("error", err.Error()).Debug("Error serving request")
+				return
+			}
+		case addrs := <-p.pex:
+			if err := p.sendPex(info, addrs); err != nil {
+				peerLog.WithField("error", err.Error()).Debug("Error sending PEX message")
+				return
+			}
 		case <-adapRateTicker.C:
 			p.adjustRate()
 			if p.lastRequest.Sub(p.lastPiece) >= requestTimeout {
-				p.clearWork(work)
+				p.clearWork()
 				msg := message.NotInterested()
 				if err := p.sendMessage(&msg); err != nil {
 					peerLog.WithFields(log.Fields{"type": msg.String(), "error": err.Error()}).Debug("Error sending message")
@@ -151,33 +268,15 @@ func (p *Peer) StartWork(ctx context.Context, info *common.TorrentInfo, work cha
 			if time.Since(p.lastMsgRcvd) >= keepAliveTimeout { // Check if peer has passed the keep-alive time
 				return
 			}
+			if p.picker.Banned(p.String()) { // Blamed for pieces that failed verification
+				peerLog.Debug("Disconnecting banned peer")
+				return
+			}
 		}
 
-		if err := p.fillQueue(); err != nil {
+		if err := p.fillQueue(info); err != nil {
 			peerLog.WithField("error", err.Error()).Debug("Error filling queue")
 			return
 		}
-
-		// WARNING: peer might be endlessly grabbing pieces if it is choked
-
-		// Find new work piece if queue is open
-		if p.queue < p.queueSize {
-			select {
-			case index := <-work:
-				// Send the work back if the peer does not have the piece
-				if !p.bitfield.Has(index) {
-					work <- index
-					continue
-				}
-
-				p.addWorkPiece(info, index)
-
-				if err := p.fillQueue(); err != nil {
-					peerLog.WithField("error", err.Error()).Debug("Error filling queue")
-					return
-				}
-			default: // Don't block if we can't find work
-			}
-		}
 	}
 }
@@ -0,0 +1,138 @@
+package peer
+
+import (
+	"bytes"
+
+	bencode "github.com/jackpal/bencode-go"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const maxPexPeers = 50    // Max peers to add or drop in a single PEX message
+const pexReachable = 0x10 // added.f flag for peers that accept incoming connections
+const compactLen6 = 18    // Length of an IPv6 compact peer
+
+// pexMsg is the bencoded dictionary of a ut_pex message (BEP 11)
+type pexMsg struct {
+	Added    string `bencode:"added"`              // Compact peers that connected since the last message
+	AddedF   string `bencode:"added.f"`            // One flags byte for each added peer
+	Dropped  string `bencode:"dropped"`            // Compact peers that disconnected since the last message
+	Added6   string `bencode:"added6,omitempty"`   // Same as added for IPv6 peers
+	Added6F  string `bencode:"added6.f,omitempty"` // Same as added.f for IPv6 peers
+	Dropped6 string `bencode:"dropped6,omitempty"` // Same as dropped for IPv6 peers
+}
+
+func init() {
+	RegisterExtension("ut_pex", handlePex)
+}
+
+// SendPex queues the addresses of the torrent's connected peers to be shared with the peer, it does not block
+func (p *Peer) SendPex(addrs []string) {
+	select {
+	case <-p.pex: // Replace a list that hasn't been sent yet
+	default:
+	}
+	select {
+	case p.pex <- addrs:
+	default:
+	}
+}
+
+// sendPex sends the peer the changes in our connected peers since the last PEX message
+func (p *Peer) sendPex(info *common.TorrentInfo, addrs []string) error {
+	if info.Private || !p.SupportsExtension("ut_pex") {
+		return nil
+	}
+
+	var msg pexMsg
+	current := make(map[string]bool)
+	added := 0
+	for _, addr := range addrs {
+		if addr == p.String() {
+			continue
+		}
+		current[addr] = true
+		if p.pexSent[addr] || added == maxPexPeers {
+			continue
+		}
+		if compact, ok := CompactAddr(addr); ok {
+			if len(compact) == compactLen6 {
+				msg.Added6 += string(compact)
+				msg.Added6F += string([]byte{pexReachable})
+			} else {
+				msg.Added += string(compact)
+				msg.AddedF += string([]byte{pexReachable})
+			}
+			p.pexSent[addr] = true
+			added++
+		}
+	}
+	dropped := 0
+	for addr := range p.pexSent {
+		if current[addr] || dropped == maxPexPeers {
+			continue
+		}
+		if compact, ok := CompactAddr(addr); ok {
+			if len(compact) == compactLen6 {
+				msg.Dropped6 += string(compact)
+			} else {
+				msg.Dropped += string(compact)
+			}
+			dropped++
+		}
+		delete(p.pexSent, addr)
+	}
+	if added == 0 && dropped == 0 {
+		return nil
+	}
+
+	var payload bytes.Buffer
+	if err := bencode.Marshal(&payload, msg); err != nil {
+		return errors.Wrap(err, "sendPex")
+	}
+	pexMessage, _ := p.Extended("ut_pex", payload.Bytes())
+	err := p.sendMessage(&pexMessage)
+	return errors.Wrap(err, "sendPex")
+}
+
+// handlePex sends the peers shared through PEX to the torrent
+func handlePex(p *Peer, info *common.TorrentInfo, payload []byte) error {
+	if info.Private { // Private torrents only get peers from their trackers
+		return nil
+	}
+	var msg pexMsg
+	if err := bencode.Unmarshal(bytes.NewReader(payload), &msg); err != nil {
+		return errors.Wrap(err, "handlePex")
+	}
+
+	added, err := Unmarshal([]byte(msg.Added), info)
+	if err != nil {
+		return errors.Wrap(err, "handlePex")
+	}
+	added6, err := Unmarshal6([]byte(msg.Added6), info)
+	if err != nil {
+		return errors.Wrap(err, "handlePex")
+	}
+	added = append(added, added6...)
+	if len(added) > maxPexPeers {
+		added = added[:maxPexPeers]
+	}
+	log.WithFields(log.Fields{"peer": p.String(), "added": len(added)}).Trace("Received PEX message")
+	if p.Discovered == nil || len(added) == 0 {
+		return nil
+	}
+
+	// Deliver in the background so the torrent can't block the peer's work loop
+	go func(discovered chan<- Peer, done <-chan struct{}) {
+		for i := range added {
+			added[i].Source = SourcePEX
+			select {
+			case discovered <- added[i]:
+			case <-done:
+				return
+			}
+		}
+	}(p.Discovered, p.done)
+	return nil
+}
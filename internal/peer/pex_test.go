@@ -0,0 +1,156 @@
+package peer
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	"time"
+
+	bencode "github.com/jackpal/bencode-go"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/connect"
+	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readPex reads a ut_pex message sent over a pipe
+func readPex(t *testing.T, conn net.Conn) pexMsg {
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	require.Nil(t, err)
+	msg := message.Decode(buf[4:n])
+	require.Equal(t, message.MsgExtended, msg.ID)
+
+	var pex pexMsg
+	require.Nil(t, bencode.Unmarshal(bytes.NewReader(msg.Payload[1:]), &pex))
+	return pex
+}
+
+func TestSendPex(t *testing.T) {
+	assert := assert.New(t)
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	info := &common.TorrentInfo{TotalPieces: 8}
+	p := New("10.0.0.1:6881", nil, info)
+	p.Conn = &connect.Conn{Conn: local, Timeout: time.Second}
+	p.extensions["ut_pex"] = 2
+
+	errs := make(chan error, 1)
+	go func() { errs <- p.sendPex(info, []string{"10.0.0.1:6881", "10.0.0.2:6881", "10.0.0.3:51413"}) }()
+	pex := readPex(t, remote)
+	assert.Nil(<-errs)
+	assert.Equal("\x0a\x00\x00\x02\x1a\xe1\x0a\x00\x00\x03\xc8\xd5", pex.Added) // The peer itself is not shared
+	assert.Equal("\x10\x10", pex.AddedF)
+	assert.Empty(pex.Dropped)
+
+	// Only changes are sent
+	go func() { errs <- p.sendPex(info, []string{"10.0.0.3:51413"}) }()
+	pex = readPex(t, remote)
+	assert.Nil(<-errs)
+	assert.Empty(pex.Added)
+	assert.Equal("\x0a\x00\x00\x02\x1a\xe1", pex.Dropped)
+
+	// Nothing is sent if nothing changed or the torrent is private
+	assert.Nil(p.sendPex(info, []string{"10.0.0.3:51413"}))
+	assert.Nil(p.sendPex(&common.TorrentInfo{Private: true}, []string{"10.0.0.4:6881"}))
+}
+
+func TestHandlePex(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	info := &common.TorrentInfo{TotalPieces: 8}
+	discovered := make(chan Peer)
+	done := make(chan struct{})
+	defer close(done)
+	p := New("10.0.0.1:6881", nil, info)
+	p.Discovered = discovered
+	p.done = done
+
+	var payload bytes.Buffer
+	require.Nil(bencode.Marshal(&payload, pexMsg{Added: "\x0a\x00\x00\x02\x1a\xe1"}))
+	require.Nil(handlePex(&p, info, payload.Bytes()))
+	select {
+	case found := <-discovered:
+		assert.Equal("10.0.0.2:6881", found.String())
+		assert.Equal(SourcePEX, found.Source)
+	case <-time.After(time.Second):
+		t.Error("PEX peer was not delivered")
+	}
+
+	// Private torrents ignore PEX
+	require.Nil(handlePex(&p, &common.TorrentInfo{TotalPieces: 8, Private: true}, payload.Bytes()))
+	select {
+	case <-discovered:
+		t.Error("PEX peer was delivered for a private torrent")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The extension isn't advertised for private torrents
+	_, ok := p.localExtHandshake(&common.TorrentInfo{Private: true}, 6881).M["ut_pex"]
+	assert.False(ok)
+	_, ok = p.localExtHandshake(info, 6881).M["ut_pex"]
+	assert.True(ok)
+}
+
+func TestPexIPv6(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+
+	info := &common.TorrentInfo{TotalPieces: 8}
+	p := New("10.0.0.1:6881", nil, info)
+	p.Conn = &connect.Conn{Conn: local, Timeout: time.Second}
+	p.extensions["ut_pex"] = 2
+
+	// IPv6 peers are shared in added6
+	errs := make(chan error, 1)
+	go func() { errs <- p.sendPex(info, []string{"10.0.0.2:6881", "[2001:db8::2]:6881"}) }()
+	pex := readPex(t, remote)
+	assert.Nil(<-errs)
+	assert.Equal("\x0a\x00\x00\x02\x1a\xe1", pex.Added)
+	assert.Equal("\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x02\x1a\xe1", pex.Added6)
+	assert.Equal("\x10", pex.Added6F)
+
+	// And are read back from added6
+	discovered := make(chan Peer)
+	done := make(chan struct{})
+	defer close(done)
+	p.Discovered = discovered
+	p.done = done
+	var payload bytes.Buffer
+	require.Nil(bencode.Marshal(&payload, pexMsg{Added6: pex.Added6}))
+	require.Nil(handlePex(&p, info, payload.Bytes()))
+	select {
+	case found := <-discovered:
+		assert.Equal("[2001:db8::2]:6881", found.String())
+	case <-time.After(time.Second):
+		t.Error("PEX peer was not delivered")
+	}
+}
+
+func TestUnmarshal6(t *testing.T) {
+	assert := assert.New(t)
+
+	info := &common.TorrentInfo{TotalPieces: 8}
+	peers, err := Unmarshal6([]byte("\x20\x01\x0d\xb8\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x01\x1a\xe1"), info)
+	if assert.Nil(err) && assert.Len(peers, 1) {
+		assert.Equal("[2001:db8::1]:6881", peers[0].String())
+	}
+	_, err = Unmarshal6([]byte("\x0a\x00\x00\x02\x1a\xe1"), info)
+	assert.ErrorIs(err, ErrBadPeers)
+
+	compact, ok := CompactAddr("[2001:db8::1]:6881")
+	assert.True(ok)
+	assert.Len(compact, 18)
+	compact, ok = CompactAddr("10.0.0.1:6881")
+	assert.True(ok)
+	assert.Len(compact, 6)
+}
@@ -1,22 +1,28 @@
 package peer
 
 import (
+	"bytes"
 	"encoding/binary"
 	"fmt"
 	"math"
+	"net"
+	"strconv"
 	"time"
 
 	"github.com/kylec725/graytorrent/internal/common"
 	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/kylec725/graytorrent/internal/picker"
 	"github.com/kylec725/graytorrent/internal/write"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
-const blockSize = 16384 // 16 kilobytes
-const minQueue = 5      // Minimum number of requests that will be queued
-const maxQueue = 625    // Maximum number of requests that can be sent out
-const rateTime = 20     // How far back in time to keep track of the transfer rates
+const blockSize = picker.BlockSize // 16 kilobytes
+const minQueue = 5                 // Minimum number of requests that will be queued
+const maxQueue = 625               // Maximum number of requests that can be sent out
+const rateTime = 20                // How far back in time to keep track of the transfer rates
+
+var closedChan = make(chan struct{}) // Always ready to receive from, closed in init
 
 // Errors
 var (
@@ -25,20 +31,26 @@ var (
 	ErrPieceHash = errors.New("Received piece with bad hash")
 )
 
+func init() {
+	close(closedChan)
+}
+
 func (p *Peer) sendMessage(msg *message.Message) error {
 	_, err := p.Conn.Write(msg.Encode())
 	p.lastMsgSent = time.Now()
 	return errors.Wrap(err, "sendMessage")
 }
 
-func (p *Peer) handleMessage(msg *message.Message, info *common.TorrentInfo, work chan int, results chan<- int) error {
+func (p *Peer) handleMessage(msg *message.Message, info *common.TorrentInfo, results chan<- int) error {
 	if msg == nil {
 		return nil // keep-alive message
 	}
 	switch msg.ID {
 	case message.MsgChoke:
 		p.PeerChoking = true
-		p.clearWork(work) // Send back our work if we get choked
+		if !p.supportsFast() { // With the fast extension, peers reject each request they won't answer
+			p.clearWork() // Send back our work if we get choked
+		}
 	case message.MsgUnchoke:
 		p.PeerChoking = false
 		p.lastUnchoked = time.Now()
@@ -50,14 +62,17 @@ func (p *Peer) handleMessage(msg *message.Message, info *common.TorrentInfo, wor
 		if len(msg.Payload) != 4 {
 			return errors.Wrap(ErrMessage, "handleMessage")
 		}
-		index := binary.BigEndian.Uint32(msg.Payload)
-		p.bitfield.Set(int(index))
+		index := int(binary.BigEndian.Uint32(msg.Payload))
+		if index >= info.TotalPieces {
+			return errors.Wrap(ErrMessage, "handleMessage")
+		}
+		p.setPiece(index)
 	case message.MsgBitfield:
 		expected := int(math.Ceil(float64(info.TotalPieces) / 8))
 		if len(msg.Payload) != expected {
 			return errors.Wrap(ErrBitfield, "handleMessage")
 		}
-		p.bitfield = msg.Payload
+		p.setBitfield(msg.Payload)
 	case message.MsgRequest:
 		if len(msg.Payload) != 12 {
 			return errors.Wrap(ErrMessage, "handleMessage")
@@ -68,43 +83,117 @@ func (p *Peer) handleMessage(msg *message.Message, info *common.TorrentInfo, wor
 		if len(msg.Payload) < 9 {
 			return errors.Wrap(ErrMessage, "handleMessage")
 		}
-		err := p.handlePiece(msg, info, work, results)
+		err := p.handlePiece(msg, info, results)
 		return errors.Wrap(err, "handleMessage")
 	case message.MsgCancel:
 		if len(msg.Payload) != 12 {
 			return errors.Wrap(ErrMessage, "handleMessage")
 		}
-		fmt.Println("MsgCancel not yet implemented")
+		p.handleCancel(msg)
+	case message.MsgSuggest:
+		if len(msg.Payload) != 4 {
+			return errors.Wrap(ErrMessage, "handleMessage")
+		}
+		err := p.handleSuggest(info, int(binary.BigEndian.Uint32(msg.Payload)))
+		return errors.Wrap(err, "handleMessage")
+	case message.MsgHaveAll:
+		err := p.handleHaveAll(info)
+		return errors.Wrap(err, "handleMessage")
+	case message.MsgHaveNone:
+		err := p.handleHaveNone()
+		return errors.Wrap(err, "handleMessage")
+	case message.MsgReject:
+		if len(msg.Payload) != 12 {
+			return errors.Wrap(ErrMessage, "handleMessage")
+		}
+		err := p.handleReject(msg)
+		return errors.Wrap(err, "handleMessage")
+	case message.MsgAllowedFast:
+		if len(msg.Payload) != 4 {
+			return errors.Wrap(ErrMessage, "handleMessage")
+		}
+		err := p.handleAllowedFast(info, int(binary.BigEndian.Uint32(msg.Payload)))
+		return errors.Wrap(err, "handleMessage")
 	case message.MsgPort:
 		if len(msg.Payload) != 2 {
 			return errors.Wrap(ErrMessage, "handleMessage")
 		}
-		fmt.Println("MsgPort not yet implemented")
+		if p.dht != nil { // Add the peer's DHT node to our routing table
+			port := binary.BigEndian.Uint16(msg.Payload)
+			host, _, err := net.SplitHostPort(p.String())
+			if err != nil || port == 0 {
+				return nil
+			}
+			go p.dht.Ping(net.JoinHostPort(host, strconv.Itoa(int(port))))
+		}
+	case message.MsgExtended:
+		err := p.handleExtended(msg, info)
+		return errors.Wrap(err, "handleMessage")
+	case message.MsgHashRequest:
+		if len(msg.Payload) != 48 {
+			return errors.Wrap(ErrMessage, "handleMessage")
+		}
+		err := p.handleHashRequest(msg, info)
+		return errors.Wrap(err, "handleMessage")
+	case message.MsgHashes:
+		if len(msg.Payload) < 48 {
+			return errors.Wrap(ErrMessage, "handleMessage")
+		}
+		err := p.handleHashes(msg, info)
+		return errors.Wrap(err, "handleMessage")
+	case message.MsgHashReject:
+		if len(msg.Payload) != 48 {
+			return errors.Wrap(ErrMessage, "handleMessage")
+		}
+		err := p.handleHashReject(msg)
+		return errors.Wrap(err, "handleMessage")
 	}
 	return nil
 }
 
-// TODO: limit the client's upload rate, may need to queue requests that come in
+// handleRequest queues a request for a block we can send, the block is read and sent once the work loop gets to it
 func (p *Peer) handleRequest(msg *message.Message, info *common.TorrentInfo) error {
-	if p.AmChoking { // Ignore requests if we are choking
-		return nil
-	}
-
 	index := binary.BigEndian.Uint32(msg.Payload[0:4])
 	begin := binary.BigEndian.Uint32(msg.Payload[4:8])
 	length := binary.BigEndian.Uint32(msg.Payload[8:12])
-	if !info.Bitfield.Has(int(index)) { // Ignore request if we don't have the piece
+	if p.AmChoking && !p.localAllowedFast[int(index)] { // Ignore requests if we are choking
+		err := p.rejectRequest(msg)
+		return errors.Wrap(err, "handleRequest")
+	}
+	if int(index) >= info.TotalPieces || !info.Bitfield.Has(int(index)) { // Ignore request if we don't have the piece
+		err := p.rejectRequest(msg)
+		return errors.Wrap(err, "handleRequest")
+	}
+	if uint64(begin)+uint64(length) > uint64(info.PieceSize(int(index))) || len(p.uploads) >= localReqq { // Ignore request if the bounds aren't possible or too many are queued
+		err := p.rejectRequest(msg)
+		return errors.Wrap(err, "handleRequest")
+	}
+	p.uploads = append(p.uploads, *msg)
+	return nil
+}
+
+// serveUpload sends the block for the oldest queued request
+func (p *Peer) serveUpload(info *common.TorrentInfo) error {
+	if len(p.uploads) == 0 {
 		return nil
 	}
+	msg := p.uploads[0]
+	p.uploads = p.uploads[1:]
+	index := binary.BigEndian.Uint32(msg.Payload[0:4])
+	begin := binary.BigEndian.Uint32(msg.Payload[4:8])
+	length := binary.BigEndian.Uint32(msg.Payload[8:12])
 
 	piece, err := write.ReadPiece(info, int(index))
 	if err != nil {
-		return errors.Wrap(err, "handleRequest")
-	} else if len(piece) < int(begin+length) { // Ignore request if the bounds aren't possible
-		return nil
+		return errors.Wrap(err, "serveUpload")
+	} else if len(piece) < int(begin+length) {
+		err := p.rejectRequest(&msg)
+		return errors.Wrap(err, "serveUpload")
 	}
 	pieceMsg := message.Piece(index, begin, piece[begin:begin+length])
-	_, err = p.Conn.Write(pieceMsg.Encode())
+	if err = p.sendMessage(&pieceMsg); err == nil {
+		info.AddUploaded(int(length)) // Reported to trackers
+	}
 
 	// Update peer's amount uploaded
 	p.bytesSent += uint32(length)
@@ -113,11 +202,54 @@ func (p *Peer) handleRequest(msg *message.Message, info *common.TorrentInfo) err
 		p.bytesSent -= uint32(length)
 	}()
 
-	return errors.Wrap(err, "handleRequest")
+	return errors.Wrap(err, "serveUpload")
 }
 
-// handlePiece adds a block to a piece we are getting
-func (p *Peer) handlePiece(msg *message.Message, info *common.TorrentInfo, work chan int, results chan<- int) error {
+// uploadReady returns a channel that is ready while requests are queued, for the work loop to serve them between messages
+func (p *Peer) uploadReady() <-chan struct{} {
+	if len(p.uploads) == 0 {
+		return nil
+	}
+	return closedChan
+}
+
+// handleCancel drops a queued request that the peer no longer wants, such as a block it got from someone else
+func (p *Peer) handleCancel(msg *message.Message) {
+	for i := range p.uploads {
+		if bytes.Equal(p.uploads[i].Payload, msg.Payload) {
+			p.uploads = append(p.uploads[:i], p.uploads[i+1:]...)
+			return
+		}
+	}
+}
+
+// dropUploads clears the queued requests after we choke the peer, peers with the fast extension are told about each
+// one and may still get their allowed fast pieces
+func (p *Peer) dropUploads() error {
+	var kept []message.Message
+	for i := range p.uploads {
+		if p.localAllowedFast[int(binary.BigEndian.Uint32(p.uploads[i].Payload[0:4]))] {
+			kept = append(kept, p.uploads[i])
+		} else if err := p.rejectRequest(&p.uploads[i]); err != nil {
+			return errors.Wrap(err, "dropUploads")
+		}
+	}
+	p.uploads = kept
+	return nil
+}
+
+// handleSent updates the peer after we send it a message from outside the work loop
+func (p *Peer) handleSent(msg *message.Message) error {
+	switch msg.ID {
+	case message.MsgChoke:
+		err := p.dropUploads()
+		return errors.Wrap(err, "handleSent")
+	}
+	return nil
+}
+
+// handlePiece adds a block to the piece it is part of, the peer that sends the last block verifies and writes the piece
+func (p *Peer) handlePiece(msg *message.Message, info *common.TorrentInfo, results chan<- int) error {
 	index := binary.BigEndian.Uint32(msg.Payload[0:4])
 	begin := binary.BigEndian.Uint32(msg.Payload[4:8])
 	block := msg.Payload[8:]
@@ -129,89 +261,78 @@ func (p *Peer) handlePiece(msg *message.Message, info *common.TorrentInfo, work
 		p.bytesRcvd -= uint32(len(block))
 	}()
 
-	// If piece is not in workPieces, nothing happens
-	if wp, ok := p.workPieces[int(index)]; ok {
-		p.lastPiece = time.Now()
-		p.queue--
-
-		// Update the workpiece
-		if err := write.AddBlock(info, int(index), int(begin), block, wp.piece); err != nil {
-			return errors.Wrap(err, "handlePiece")
-		}
-		wp.left -= len(block)
-		p.workPieces[int(index)] = wp
-
-		// If piece isn't done, request next piece and exit
-		if p.workPieces[int(index)].left > 0 {
-			// err := p.nextBlock(int(index))
-			// return errors.Wrap(err, "handlePiece")
-			return nil
-		}
+	// If we didn't request the block or cancelled it, nothing happens
+	blk := picker.Block{Index: int(index), Begin: int(begin), Length: len(block)}
+	if !p.requests[blk] {
+		return nil
+	}
+	p.lastPiece = time.Now()
+	delete(p.requests, blk)
+	piece, err := p.picker.AddBlock(p.String(), blk, block)
+	if err != nil {
+		return errors.Wrap(err, "handlePiece")
+	} else if piece == nil { // Other blocks of the piece haven't arrived yet
+		return nil
+	}
 
-		// Piece is done: Verify hash then write
-		if !write.VerifyPiece(info, int(index), p.workPieces[int(index)].piece) { // Return to work pool if hash is incorrect
-			delete(p.workPieces, int(index))
-			work <- int(index)
+	// Piece is done: Verify hash then write
+	if !write.HashKnown(info, int(index)) { // Not the peer's fault, download it again once a peer sends the hashes
+		p.picker.Discard(int(index))
+		log.WithFields(log.Fields{"peer": p.String(), "piece index": index}).Debug("Piece hash is not known yet")
+		return nil
+	}
+	if !write.VerifyPiece(info, int(index), piece) { // Blame the peers that sent its blocks and download it again
+		p.picker.Fail(int(index))
+		if p.picker.Banned(p.String()) {
 			return errors.Wrap(ErrPieceHash, "handlePiece")
 		}
-		if err := write.AddPiece(info, int(index), p.workPieces[int(index)].piece); err != nil { // Write piece to file
-			delete(p.workPieces, int(index))
-			work <- int(index)
-			return errors.Wrap(err, "handlePiece")
+		log.WithFields(log.Fields{"peer": p.String(), "piece index": index}).Debug("Piece from multiple peers failed verification")
+		return nil
+	}
+	if err := write.AddPiece(info, int(index), piece); err != nil { // Write piece to file
+		p.picker.Discard(int(index))
+		if p.picker.Skipped(int(index)) { // Its file was removed after it was assembled
+			return nil
 		}
-		log.WithFields(log.Fields{"peer": p.String(), "piece index": index, "DownRate": p.DownRatePretty()}).Trace("Wrote piece to file")
+		return errors.Wrap(err, "handlePiece")
+	}
+	log.WithFields(log.Fields{"peer": p.String(), "piece index": index, "DownRate": p.DownRatePretty()}).Trace("Wrote piece to file")
 
-		// Write was successful
-		results <- int(index) // Notify main that a piece is done
-		delete(p.workPieces, int(index))
+	// Write was successful
+	results <- int(index) // Notify main that a piece is done
 
-		// Send not interested if necessary
-		if len(p.workPieces) == 0 {
-			msg := message.NotInterested()
-			if _, err := p.Conn.Write(msg.Encode()); err != nil {
-				return errors.Wrap(err, "handlePiece")
-			}
-			p.AmInterested = false
+	// Send not interested if necessary
+	if len(p.requests) == 0 {
+		msg := message.NotInterested()
+		if _, err := p.Conn.Write(msg.Encode()); err != nil {
+			return errors.Wrap(err, "handlePiece")
 		}
-	}
-	return nil
-}
-
-// nextBlock requests the next block in a piece
-func (p *Peer) nextBlock(index int) error {
-	if wp, ok := p.workPieces[index]; ok {
-		length := common.Min(wp.size-wp.curr, blockSize)
-		msg := message.Request(uint32(index), uint32(wp.curr), uint32(length)) // Message must be sent before updating the workpiece curr value
-		err := p.sendMessage(&msg)
-		err = errors.WithMessagef(err, "index %d begin %d length %d", index, wp.curr, length)
-
-		wp.curr += length
-		p.workPieces[index] = wp
-		p.queue++
-		p.lastRequest = time.Now()
-		return errors.Wrap(err, "nextBlock")
+		p.AmInterested = false
 	}
 	return nil
 }
 
 // fillQueue sends out as many requests for blocks as the peer's queue allows
-func (p *Peer) fillQueue() error {
+func (p *Peer) fillQueue(info *common.TorrentInfo) error {
 	// Make sure we notify the peer that we are interested, and they are not choking us before we request pieces
 	if !p.AmInterested {
 		p.AmInterested = true
 		msg := message.Interested()
 		_, err := p.Conn.Write(msg.Encode())
 		return errors.Wrap(err, "fillQueue")
-	} else if p.PeerChoking {
-		return nil
 	}
 
-	for i := range p.workPieces {
-		for p.queue < p.queueSize && p.workPieces[i].curr < p.workPieces[i].size {
-			err := p.nextBlock(i)
-			if err != nil {
-				return errors.Wrap(err, "fillQueue")
-			}
+	if len(p.requests) >= p.queueSize {
+		return nil
+	}
+	bf := p.requestable(info) // Only allowed fast pieces can be requested while choked
+	for len(p.requests) < p.queueSize {
+		blk, ok := p.picker.PickBlock(bf, p.suggested, p.String())
+		if !ok {
+			break
+		}
+		if err := p.requestBlock(blk); err != nil {
+			return errors.Wrap(err, "fillQueue")
 		}
 	}
 	return nil
@@ -281,7 +402,11 @@ func (p *Peer) adjustRate() {
 
 	if p.queueSize > maxQueue {
 		p.queueSize = maxQueue
-	} else if p.queueSize < minQueue {
+	}
+	if p.reqq > 0 && p.queueSize > p.reqq { // Don't queue more requests than the peer allows
+		p.queueSize = p.reqq
+	}
+	if p.queueSize < minQueue {
 		p.queueSize = minQueue
 	}
 }
@@ -0,0 +1,172 @@
+package peer
+
+import (
+	"encoding/binary"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/connect"
+	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/kylec725/graytorrent/internal/picker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readMessages decodes the messages written to a connection until it is closed
+func readMessages(conn net.Conn) <-chan *message.Message {
+	msgs := make(chan *message.Message, 16)
+	go func() {
+		defer close(msgs)
+		for {
+			length := make([]byte, 4)
+			if _, err := io.ReadFull(conn, length); err != nil {
+				return
+			}
+			data := make([]byte, binary.BigEndian.Uint32(length))
+			if _, err := io.ReadFull(conn, data); err != nil {
+				return
+			}
+			msgs <- message.Decode(data)
+		}
+	}()
+	return msgs
+}
+
+func nextMessage(t *testing.T, msgs <-chan *message.Message) *message.Message {
+	select {
+	case msg := <-msgs:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("No message was sent")
+		return nil
+	}
+}
+
+func TestUploads(t *testing.T) {
+	assert := assert.New(t)
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	msgs := readMessages(remote)
+
+	info := &common.TorrentInfo{TotalPieces: 2, PieceLength: 2 * blockSize, TotalLength: 4 * blockSize, Bitfield: []byte{0xc0}}
+	p := newFastPeer(info)
+	p.Conn = &connect.Conn{Conn: local, Timeout: time.Second}
+	p.AmChoking = false
+	p.localAllowedFast[1] = true
+
+	// Requests are queued until the work loop serves them
+	reqs := []message.Message{message.Request(0, 0, blockSize), message.Request(0, blockSize, blockSize), message.Request(1, 0, blockSize)}
+	for i := range reqs {
+		assert.Nil(p.handleMessage(&reqs[i], info, nil))
+	}
+	assert.Len(p.uploads, 3)
+	assert.NotNil(p.uploadReady())
+
+	// Cancelled requests are dropped from the queue
+	msg := message.Cancel(0, 0, blockSize)
+	assert.Nil(p.handleMessage(&msg, info, nil))
+	assert.Equal(reqs[1:], p.uploads)
+
+	// Choking the peer rejects its queued requests, except for allowed fast pieces
+	msg = message.Choke()
+	assert.Nil(p.handleSent(&msg))
+	reply := nextMessage(t, msgs)
+	assert.Equal(message.MsgReject, reply.ID)
+	assert.Equal(reqs[1].Payload, reply.Payload)
+	assert.Equal(reqs[2:], p.uploads)
+
+	// Requests past the end of a piece are rejected right away
+	msg = message.Request(1, blockSize, blockSize+1)
+	assert.Nil(p.handleMessage(&msg, info, nil))
+	reply = nextMessage(t, msgs)
+	assert.Equal(message.MsgReject, reply.ID)
+	assert.Len(p.uploads, 1)
+}
+
+func TestEndgameCancel(t *testing.T) {
+	assert := assert.New(t)
+
+	local, remote := net.Pipe()
+	defer local.Close()
+	defer remote.Close()
+	msgs := readMessages(remote)
+
+	info := &common.TorrentInfo{TotalPieces: 1, PieceLength: 2 * blockSize, TotalLength: 2 * blockSize, Bitfield: []byte{0x00}}
+	pk := picker.New(info)
+	p := New("10.0.0.1:6881", nil, info)
+	p.Conn = &connect.Conn{Conn: local, Timeout: time.Second}
+	p.picker = pk
+	p.PeerChoking = false
+	p.AmInterested = true
+	p.setPiece(0)
+
+	// The peer is asked for every block, then another peer is asked for the same ones in endgame mode
+	assert.Nil(p.fillQueue(info))
+	for i := 0; i < 2; i++ {
+		assert.Equal(message.MsgRequest, nextMessage(t, msgs).ID)
+	}
+	assert.Len(p.requests, 2)
+	other := "10.0.0.2:6881"
+	blk, ok := pk.PickBlock(p.bitfield, nil, other)
+	require.True(t, ok)
+	assert.Equal(picker.Block{Index: 0, Begin: 0, Length: blockSize}, blk)
+
+	// A block from the other peer cancels our request for it
+	cancelled := pk.Cancelled()
+	piece, err := pk.AddBlock(other, blk, make([]byte, blockSize))
+	assert.Nil(err)
+	assert.Nil(piece)
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("Duplicate requests were not cancelled")
+	}
+	assert.Nil(p.cancelWork())
+	msg := nextMessage(t, msgs)
+	assert.Equal(message.MsgCancel, msg.ID)
+	assert.Equal(message.Request(0, 0, blockSize).Payload, msg.Payload)
+	assert.Len(p.requests, 1)
+
+	// So does the piece being finished by someone else
+	pk.Done(0)
+	assert.Nil(p.cancelWork())
+	msg = nextMessage(t, msgs)
+	assert.Equal(message.MsgCancel, msg.ID)
+	assert.Equal(message.Request(0, blockSize, blockSize).Payload, msg.Payload)
+	assert.Empty(p.requests)
+}
+
+func TestUnknownHash(t *testing.T) {
+	assert := assert.New(t)
+
+	// A v2 torrent from a magnet link, before any peer sent its piece layer
+	info := &common.TorrentInfo{TotalPieces: 1, PieceLength: 2 * blockSize, TotalLength: 2 * blockSize, Bitfield: []byte{0x00}}
+	info.InfoHashV2[0] = 1
+	info.PieceHashesV2 = make([][32]byte, 1)
+	pk := picker.New(info)
+	p := New("10.0.0.1:6881", nil, info)
+	p.picker = pk
+	p.setPiece(0)
+	for i := 0; i < 2; i++ {
+		blk, ok := pk.PickBlock(p.bitfield, nil, p.String())
+		require.True(t, ok)
+		p.requests[blk] = true
+	}
+
+	// The piece can't be verified, so it is downloaded again without blaming the peer
+	results := make(chan int, 1)
+	for i := 0; i < 2; i++ {
+		msg := message.Piece(0, uint32(i*blockSize), make([]byte, blockSize))
+		assert.Nil(p.handleMessage(&msg, info, results))
+	}
+	assert.Empty(results)
+	assert.False(pk.Banned(p.String()))
+	blk, ok := pk.PickBlock(p.bitfield, nil, p.String())
+	assert.True(ok)
+	assert.Equal(picker.Block{Index: 0, Begin: 0, Length: blockSize}, blk)
+}
@@ -2,14 +2,16 @@ package peer
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"net"
 	"strconv"
 
 	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/config"
 	"github.com/kylec725/graytorrent/internal/connect"
 	"github.com/kylec725/graytorrent/internal/peer/handshake"
-	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/kylec725/graytorrent/internal/utp"
 	"github.com/pkg/errors"
 )
 
@@ -19,70 +21,152 @@ var (
 	ErrInfoHash = errors.New("Received infohash does not match")
 )
 
-// Unmarshal creates a list of Peers from a serialized list of peers
+// Unmarshal creates a list of Peers from a serialized list of IPv4 peers
 func Unmarshal(peersBytes []byte, info *common.TorrentInfo) ([]Peer, error) {
-	if len(peersBytes)%6 != 0 {
-		return nil, errors.Wrap(ErrBadPeers, "Unmarshal")
+	peersList, err := unmarshalCompact(peersBytes, net.IPv4len, info)
+	return peersList, errors.Wrap(err, "Unmarshal")
+}
+
+// Unmarshal6 creates a list of Peers from a serialized list of IPv6 peers (BEP 7)
+func Unmarshal6(peersBytes []byte, info *common.TorrentInfo) ([]Peer, error) {
+	peersList, err := unmarshalCompact(peersBytes, net.IPv6len, info)
+	return peersList, errors.Wrap(err, "Unmarshal6")
+}
+
+// unmarshalCompact parses compact peer info, each entry is an IP address of ipLen bytes followed by a 2 byte port
+func unmarshalCompact(peersBytes []byte, ipLen int, info *common.TorrentInfo) ([]Peer, error) {
+	entryLen := ipLen + 2
+	if len(peersBytes)%entryLen != 0 {
+		return nil, ErrBadPeers
 	}
 
-	numPeers := len(peersBytes) / 6
+	numPeers := len(peersBytes) / entryLen
 	peersList := make([]Peer, numPeers)
 
 	for i := 0; i < numPeers; i++ {
-		host := net.IP(peersBytes[i*6 : i*6+4])
-		port := binary.BigEndian.Uint16(peersBytes[i*6+4 : i*6+6])
+		entry := peersBytes[i*entryLen : (i+1)*entryLen]
+		host := net.IP(entry[:ipLen])
+		port := binary.BigEndian.Uint16(entry[ipLen:])
 		if port == 0 { // Skip empty spaces in a UDP resposne
 			return peersList[:i], nil
 		}
-		addr := net.JoinHostPort(host.String(), strconv.Itoa(int(port)))
-		peersList[i] = New(addr, nil, info)
+		peersList[i] = New(JoinAddr(host, port), nil, info)
 	}
 
 	return peersList, nil
 }
 
-// Dial establishes a TCP connection with a peer
-func (p *Peer) Dial() error {
-	d := net.Dialer{Timeout: peerTimeout}
-	conn, err := d.Dial("tcp", p.String())
+// JoinAddr formats an IP and port as a peer address, IPv6 addresses are put in brackets
+func JoinAddr(ip net.IP, port uint16) string {
+	return net.JoinHostPort(ip.String(), strconv.Itoa(int(port)))
+}
+
+// CompactAddr serializes a peer address into compact peer info, 6 bytes for IPv4 and 18 bytes for IPv6
+func CompactAddr(addr string) ([]byte, bool) {
+	host, portStr, err := net.SplitHostPort(addr)
 	if err != nil {
-		return errors.Wrap(err, "Dial")
+		return nil, false
 	}
-	p.Conn = &connect.Conn{Conn: conn, Timeout: peerTimeout}
-	return nil
+	ip := net.ParseIP(host)
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if ip == nil || err != nil {
+		return nil, false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	compact := make([]byte, len(ip)+2)
+	copy(compact, ip)
+	binary.BigEndian.PutUint16(compact[len(ip):], uint16(port))
+	return compact, true
+}
+
+// Dial establishes a connection with a peer, over uTP if the context has the session's uTP socket and over TCP otherwise
+func (p *Peer) Dial(ctx context.Context) error {
+	p.utp, _ = utp.FromContext(ctx)
+	err := p.dial()
+	return errors.Wrap(err, "Dial")
 }
 
-// InitHandshake sends and receives a handshake from the peer
-func (p *Peer) InitHandshake(info *common.TorrentInfo) error {
-	h := handshake.New(info)
+// dial connects with the preferred transport first and falls back to the other one
+func (p *Peer) dial() error {
+	transports := []func() (net.Conn, error){p.dialTCP}
+	if p.utp != nil {
+		if config.GetConfig().Network.PreferUTP {
+			transports = []func() (net.Conn, error){p.dialUTP, p.dialTCP}
+		} else {
+			transports = append(transports, p.dialUTP)
+		}
+	}
+
+	var conn net.Conn
+	var err error
+	for _, dial := range transports {
+		if conn, err = dial(); err == nil {
+			p.Conn = &connect.Conn{Conn: conn, Timeout: peerTimeout}
+			return nil
+		}
+	}
+	return err
+}
+
+func (p *Peer) dialTCP() (net.Conn, error) {
+	d := net.Dialer{Timeout: peerTimeout}
+	return d.Dial("tcp", p.String())
+}
+
+func (p *Peer) dialUTP() (net.Conn, error) {
+	return p.utp.DialTimeout(p.String(), utpDialTimeout)
+}
+
+// InitHandshake sends and receives a handshake from the peer, hasDHT is whether we run a DHT node
+func (p *Peer) InitHandshake(info *common.TorrentInfo, hasDHT bool) error {
+	if err := p.encrypt(info); err != nil {
+		return errors.Wrap(err, "InitHandshake")
+	}
+	h := handshake.New(info, hasDHT)
 	if _, err := p.Conn.Write(h.Encode()); err != nil {
 		return errors.Wrap(err, "InitHandshake")
 	}
-	infoHash, err := handshake.Read(p.Conn.Conn)
+	rcvd, err := handshake.Read(p.Conn.Conn)
 	if err != nil {
 		return errors.Wrap(err, "InitHandshake")
-	} else if !bytes.Equal(infoHash[:], info.InfoHash[:]) { // Verify the infohash
+	} else if !bytes.Equal(rcvd.InfoHash[:], info.InfoHash[:]) { // Verify the infohash
 		return errors.Wrap(ErrInfoHash, "InitHandshake")
 	}
+	p.reserved = rcvd.Reserved
+
 	// Send bitfield to the peer
-	msg := message.Bitfield(info.Bitfield)
-	_, err = p.Conn.Write(msg.Encode())
+	err = p.sendBitfield(info)
 	return errors.Wrap(err, "InitHandshake")
 }
 
-// RespondHandshake responds to a received handshake form a peer
-func (p *Peer) RespondHandshake(info *common.TorrentInfo) error {
-	h := handshake.New(info)
+// RespondHandshake responds to a received handshake form a peer, hasDHT is whether we run a DHT node
+func (p *Peer) RespondHandshake(info *common.TorrentInfo, rcvd handshake.Handshake, hasDHT bool) error {
+	p.reserved = rcvd.Reserved
+	h := handshake.New(info, hasDHT)
+	h.InfoHash = rcvd.InfoHash // Hybrid torrents answer with whichever infohash the peer used
 	if _, err := p.Conn.Write(h.Encode()); err != nil {
 		return errors.Wrap(err, "RespondHandshake")
 	}
 
 	// Send bitfield to the peer
-	msg := message.Bitfield(info.Bitfield)
-	if _, err := p.Conn.Write(msg.Encode()); err != nil {
+	if err := p.sendBitfield(info); err != nil {
 		return errors.Wrap(err, "RespondHandshake")
 	}
 
 	p.Conn.Timeout = peerTimeout
 	return nil
 }
+
+// supportsExtensions returns whether the peer's handshake advertised the extension protocol
+func (p *Peer) supportsExtensions() bool {
+	h := handshake.Handshake{Reserved: p.reserved}
+	return h.Extensions()
+}
+
+// supportsDHT returns whether the peer's handshake advertised the DHT
+func (p *Peer) supportsDHT() bool {
+	h := handshake.Handshake{Reserved: p.reserved}
+	return h.DHT()
+}
@@ -0,0 +1,88 @@
+package peer
+
+import (
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/bitfield"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/kylec725/graytorrent/internal/picker"
+	"github.com/pkg/errors"
+)
+
+// requestBlock asks the peer for a block from the picker
+func (p *Peer) requestBlock(blk picker.Block) error {
+	msg := message.Request(uint32(blk.Index), uint32(blk.Begin), uint32(blk.Length))
+	err := p.sendMessage(&msg)
+	err = errors.WithMessagef(err, "index %d begin %d length %d", blk.Index, blk.Begin, blk.Length)
+
+	p.requests[blk] = true
+	p.lastRequest = time.Now()
+	return errors.Wrap(err, "requestBlock")
+}
+
+// clearWork gives the blocks we requested from the peer back to the picker
+func (p *Peer) clearWork() {
+	for blk := range p.requests {
+		p.picker.ReturnBlock(p.String(), blk)
+	}
+	p.requests = make(map[picker.Block]bool)
+}
+
+// returnWork gives a single block back to the picker, such as when the peer rejects it
+func (p *Peer) returnWork(blk picker.Block) {
+	if p.requests[blk] {
+		delete(p.requests, blk)
+		p.picker.ReturnBlock(p.String(), blk)
+	}
+}
+
+// cancelWork tells the peer to cancel the requests for blocks that the picker no longer needs from it, such as blocks
+// that another peer sent first in endgame mode
+func (p *Peer) cancelWork() error {
+	for blk := range p.requests {
+		if p.picker.Assigned(p.String(), blk) {
+			continue
+		}
+		delete(p.requests, blk)
+		msg := message.Cancel(uint32(blk.Index), uint32(blk.Begin), uint32(blk.Length))
+		if err := p.sendMessage(&msg); err != nil {
+			return errors.Wrap(err, "cancelWork")
+		}
+	}
+	return nil
+}
+
+// requestable returns the pieces we can request from the peer, only its allowed fast pieces while it is choking us
+func (p *Peer) requestable(info *common.TorrentInfo) bitfield.Bitfield {
+	if !p.PeerChoking {
+		return p.bitfield
+	}
+	fast := make(bitfield.Bitfield, len(p.bitfield))
+	for index := range p.allowedFast {
+		if index < info.TotalPieces && p.bitfield.Has(index) {
+			fast.Set(index)
+		}
+	}
+	return fast
+}
+
+// setBitfield replaces the pieces the peer has, keeping the picker's count of available pieces up to date
+func (p *Peer) setBitfield(bf bitfield.Bitfield) {
+	if p.picker != nil {
+		p.picker.RemovePeer(p.bitfield)
+		p.picker.AddPeer(bf)
+	}
+	p.bitfield = bf
+}
+
+// setPiece records a piece that the peer announced it has
+func (p *Peer) setPiece(index int) {
+	if p.bitfield.Has(index) {
+		return
+	}
+	p.bitfield.Set(index)
+	if p.picker != nil {
+		p.picker.AddPiece(index)
+	}
+}
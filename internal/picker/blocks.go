@@ -0,0 +1,262 @@
+package picker
+
+import (
+	"net"
+
+	"github.com/kylec725/graytorrent/internal/bitfield"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/pkg/errors"
+)
+
+const BlockSize = 16384 // 16 kilobytes, the size of the blocks requested from peers
+const maxStrikes = 3    // Failed pieces a source can send blocks for before it is banned
+
+// Block is part of a piece that is requested from a peer
+type Block struct {
+	Index  int
+	Begin  int
+	Length int
+}
+
+// partial is a piece being assembled from blocks that may come from different sources
+type partial struct {
+	buf         []byte
+	requesters  [][]string // Sources each block was requested from, until it arrives
+	sources     []string   // Source of each block that arrived, empty for blocks that haven't
+	numReceived int
+}
+
+// pieceSize returns the length of a piece, the last piece may be shorter
+func (pk *Picker) pieceSize(index int) int {
+	if index == pk.numPieces-1 {
+		return pk.totalLength - (pk.numPieces-1)*pk.pieceLength
+	}
+	return pk.pieceLength
+}
+
+func (pk *Picker) newPartial(index int) *partial {
+	size := pk.pieceSize(index)
+	numBlocks := (size + BlockSize - 1) / BlockSize
+	pt := &partial{
+		buf:        make([]byte, size),
+		requesters: make([][]string, numBlocks),
+		sources:    make([]string, numBlocks),
+	}
+	pk.partials[index] = pt
+	return pt
+}
+
+// block returns the bounds of one of a piece's blocks
+func (pt *partial) block(index, b int) Block {
+	begin := b * BlockSize
+	return Block{Index: index, Begin: begin, Length: common.Min(len(pt.buf)-begin, BlockSize)}
+}
+
+// request gives a block to a source, pk.mu must be held
+func (pt *partial) request(index, b int, source string) Block {
+	pt.requesters[b] = append(pt.requesters[b], source)
+	return pt.block(index, b)
+}
+
+// PickBlock chooses a block to request from source, from the pieces in bf. Peers are given single blocks, so that
+// several peers can fill one piece, and the blocks are assembled by AddBlock in a buffer shared by the torrent's
+// sources. Blocks of pieces that are already started are picked first so that pieces are finished quickly, then new
+// pieces are picked as Pick does. Once every block we need is being downloaded, PickBlock is in endgame mode and picks
+// blocks that are being downloaded from other sources, from as few sources as possible, so that one slow peer can't
+// hold up the end
+func (pk *Picker) PickBlock(bf bitfield.Bitfield, preferred []int, source string) (Block, bool) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	for index, pt := range pk.partials {
+		if !has(bf, index) {
+			continue
+		}
+		for b := range pt.sources {
+			if pt.sources[b] == "" && len(pt.requesters[b]) == 0 {
+				return pt.request(index, b, source), true
+			}
+		}
+	}
+
+	if index := pk.pickWanted(bf, preferred); index >= 0 {
+		pk.wanted[index] = false
+		pk.numWanted--
+		return pk.newPartial(index).request(index, 0, source), true
+	}
+
+	// Endgame mode
+	pick, pickBlock := -1, 0
+	for index, pt := range pk.partials {
+		if !has(bf, index) {
+			continue
+		}
+		for b := range pt.sources {
+			if pt.sources[b] != "" || contains(pt.requesters[b], source) {
+				continue
+			} else if pick < 0 || len(pt.requesters[b]) < len(pk.partials[pick].requesters[pickBlock]) {
+				pick, pickBlock = index, b
+			}
+		}
+	}
+	if pick >= 0 {
+		return pk.partials[pick].request(pick, pickBlock, source), true
+	}
+	for i := 0; i < pk.numPieces; i++ { // Pieces that web seeds are downloading whole
+		if !pk.done[i] && pk.holders[i] > 0 && pk.partials[i] == nil && has(bf, i) {
+			return pk.newPartial(i).request(i, 0, source), true
+		}
+	}
+	return Block{}, false
+}
+
+// AddBlock stores a block that source sent into its piece. Once every block of the piece is in, the piece is returned
+// for verification. Blocks that are no longer needed, such as ones another source sent first, are ignored
+func (pk *Picker) AddBlock(source string, blk Block, data []byte) ([]byte, error) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	pt, ok := pk.partials[blk.Index]
+	if !ok {
+		return nil, nil
+	}
+	b := blk.Begin / BlockSize
+	if b >= len(pt.sources) || blk != pt.block(blk.Index, b) || len(data) != blk.Length {
+		return nil, errors.Wrap(ErrBlock, "AddBlock")
+	} else if pt.sources[b] != "" {
+		return nil, nil
+	}
+
+	copy(pt.buf[blk.Begin:], data)
+	pt.sources[b] = source
+	pt.numReceived++
+	if len(pt.requesters[b]) > 1 { // Requested from other sources in endgame mode
+		pk.cancel()
+	}
+	pt.requesters[b] = nil
+	if pt.numReceived < len(pt.sources) {
+		return nil, nil
+	}
+	return pt.buf, nil
+}
+
+// ReturnBlock puts back a block that source won't send, such as when it chokes us or rejects the request
+func (pk *Picker) ReturnBlock(source string, blk Block) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	pt, ok := pk.partials[blk.Index]
+	if !ok || blk.Begin/BlockSize >= len(pt.sources) {
+		return
+	}
+	b := blk.Begin / BlockSize
+	for i, requester := range pt.requesters[b] {
+		if requester == source {
+			pt.requesters[b] = append(pt.requesters[b][:i], pt.requesters[b][i+1:]...)
+			break
+		}
+	}
+
+	// Pieces that no one sent anything for go back to being picked by rarity
+	if pt.numReceived > 0 {
+		return
+	}
+	for _, requesters := range pt.requesters {
+		if len(requesters) > 0 {
+			return
+		}
+	}
+	delete(pk.partials, blk.Index)
+	if pk.holders[blk.Index] == 0 {
+		pk.want(blk.Index)
+	}
+}
+
+// Assigned returns whether a block is still needed from source, requests for blocks that aren't can be cancelled
+func (pk *Picker) Assigned(source string, blk Block) bool {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	pt, ok := pk.partials[blk.Index]
+	if !ok || blk.Begin/BlockSize >= len(pt.sources) {
+		return false
+	}
+	return contains(pt.requesters[blk.Begin/BlockSize], source)
+}
+
+// Cancelled returns a channel that is closed once blocks that were requested from sources are no longer needed
+func (pk *Picker) Cancelled() <-chan struct{} {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	return pk.cancelled
+}
+
+// cancel wakes up the sources waiting on Cancelled, pk.mu must be held
+func (pk *Picker) cancel() {
+	close(pk.cancelled)
+	pk.cancelled = make(chan struct{})
+}
+
+// Fail drops a piece that failed verification so that it is downloaded again, and blames the sources of its blocks.
+// A source that sent the whole piece is banned right away, otherwise each source gets a strike and is banned after
+// maxStrikes. Strikes and bans go to the source's IP, so that peers can't get around them by reconnecting from another
+// port, and Banned reports them
+func (pk *Picker) Fail(index int) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	pt := pk.discard(index)
+	if pt == nil {
+		return
+	}
+	blamed := make(map[string]bool)
+	for _, source := range pt.sources {
+		blamed[sourceHost(source)] = true
+	}
+	for host := range blamed {
+		pk.strikes[host]++
+		if len(blamed) == 1 || pk.strikes[host] >= maxStrikes {
+			pk.banned[host] = true
+		}
+	}
+}
+
+// Discard drops the blocks of a piece that couldn't be used, without blaming their sources
+func (pk *Picker) Discard(index int) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	pk.discard(index)
+}
+
+// discard removes a piece's blocks so that it is downloaded again, pk.mu must be held
+func (pk *Picker) discard(index int) *partial {
+	pt, ok := pk.partials[index]
+	if !ok {
+		return nil
+	}
+	delete(pk.partials, index)
+	pk.cancel()
+	if !pk.done[index] && pk.holders[index] == 0 {
+		pk.want(index)
+	}
+	return pt
+}
+
+// Banned returns whether a source, or another source with the same IP, was blamed for sending bad data
+func (pk *Picker) Banned(source string) bool {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	return pk.banned[sourceHost(source)]
+}
+
+// sourceHost returns the IP of a source's address, sources that aren't addresses are kept whole
+func sourceHost(source string) string {
+	if host, _, err := net.SplitHostPort(source); err == nil {
+		return host
+	}
+	return source
+}
+
+func contains(sources []string, source string) bool {
+	for _, s := range sources {
+		if s == source {
+			return true
+		}
+	}
+	return false
+}
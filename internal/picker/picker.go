@@ -0,0 +1,335 @@
+// Package picker chooses which pieces and blocks of a torrent to download from each source, and assembles the blocks
+// that peers send into pieces
+package picker
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+
+	"github.com/kylec725/graytorrent/internal/bitfield"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/pkg/errors"
+)
+
+const randomFirst = 4       // Pieces picked at random before picking the rarest pieces
+const sequentialWindow = 16 // Pieces past the first missing piece that are picked in order in sequential mode
+
+// Errors
+var (
+	ErrBlock = errors.New("Block does not match a requested block")
+)
+
+// Picker hands out the pieces and blocks we still need, each is given to one source at a time outside of endgame mode
+type Picker struct {
+	mu           sync.Mutex
+	numPieces    int
+	pieceLength  int
+	totalLength  int
+	availability []int             // Number of peers that have each piece
+	priorities   []common.Priority // Priority of each piece from the files it is part of
+	wanted       []bool            // Pieces we need that no one is working on
+	sequential   bool              // Pick pieces in order within a window past the first missing piece
+	firstLast    []bool            // Pieces picked before the rest as the first or last piece of a file, nil if not enabled
+	holders      []int             // Number of sources working on each whole piece, more than one in endgame mode
+	partials     map[int]*partial  // Pieces being downloaded block by block
+	done         []bool            // Pieces we have
+	numWanted    int
+	numDone      int
+	strikes      map[string]int  // Number of failed pieces each source's IP sent blocks for
+	banned       map[string]bool // IPs of sources blamed for failed pieces
+	changed      chan struct{}   // Closed when pieces are returned, for sources waiting on work
+	cancelled    chan struct{}   // Closed when blocks that were requested from sources are no longer needed
+}
+
+// New creates a picker for the pieces missing from a torrent's bitfield
+func New(info *common.TorrentInfo) *Picker {
+	pk := &Picker{
+		numPieces:    info.TotalPieces,
+		pieceLength:  info.PieceLength,
+		totalLength:  info.TotalLength,
+		availability: make([]int, info.TotalPieces),
+		priorities:   info.PiecePriorities(),
+		wanted:       make([]bool, info.TotalPieces),
+		holders:      make([]int, info.TotalPieces),
+		partials:     make(map[int]*partial),
+		done:         make([]bool, info.TotalPieces),
+		strikes:      make(map[string]int),
+		banned:       make(map[string]bool),
+		changed:      make(chan struct{}),
+		cancelled:    make(chan struct{}),
+	}
+	pk.SetOrder(info.Sequential, info.FirstLast, info.FirstLastPieces())
+	for i := 0; i < info.TotalPieces; i++ {
+		if has(info.Bitfield, i) {
+			pk.done[i] = true
+			pk.numDone++
+		} else if pk.priorities[i] != common.PrioritySkip {
+			pk.wanted[i] = true
+			pk.numWanted++
+		}
+	}
+	return pk
+}
+
+// AddPeer counts the pieces in a peer's bitfield
+func (pk *Picker) AddPeer(bf bitfield.Bitfield) {
+	pk.updatePeer(bf, 1)
+}
+
+// RemovePeer stops counting the pieces in a peer's bitfield, when the peer disconnects or sends a new one
+func (pk *Picker) RemovePeer(bf bitfield.Bitfield) {
+	pk.updatePeer(bf, -1)
+}
+
+func (pk *Picker) updatePeer(bf bitfield.Bitfield, change int) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	for i := 0; i < pk.numPieces; i++ {
+		if has(bf, i) {
+			pk.availability[i] += change
+		}
+	}
+}
+
+// AddPiece counts a piece that a peer announced it has
+func (pk *Picker) AddPiece(index int) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	if index >= 0 && index < pk.numPieces {
+		pk.availability[index]++
+	}
+}
+
+// Availability returns the number of peers that have a piece
+func (pk *Picker) Availability(index int) int {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	return pk.availability[index]
+}
+
+// SetPriorities changes the priority of each piece, pieces that are no longer skipped can be picked right away. The
+// blocks of skipped pieces that are being downloaded are dropped and their requests cancelled, since their files may
+// be removed
+func (pk *Picker) SetPriorities(priorities []common.Priority) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	for i := 0; i < pk.numPieces && i < len(priorities); i++ {
+		pk.priorities[i] = priorities[i]
+		if priorities[i] == common.PrioritySkip {
+			if pk.wanted[i] {
+				pk.wanted[i] = false
+				pk.numWanted--
+			}
+			if _, ok := pk.partials[i]; ok {
+				delete(pk.partials, i)
+				pk.cancel()
+			}
+		} else if !pk.wanted[i] && priorities[i] != common.PrioritySkip && !pk.done[i] && pk.holders[i] == 0 && pk.partials[i] == nil {
+			pk.want(i)
+		}
+	}
+}
+
+// SetOrder changes whether pieces are picked in order and whether the firstLast pieces, the first and last pieces of
+// each file, are picked before the rest
+func (pk *Picker) SetOrder(sequential, enableFirstLast bool, firstLast []bool) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	pk.sequential = sequential
+	pk.firstLast = nil
+	if enableFirstLast {
+		pk.firstLast = firstLast
+	}
+}
+
+// Skipped returns whether a piece only belongs to skipped files, so it is no longer downloaded
+func (pk *Picker) Skipped(index int) bool {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	return index >= 0 && index < pk.numPieces && pk.priorities[index] == common.PrioritySkip
+}
+
+// Pick chooses a whole piece for sources that download pieces at once, such as web seeds, peers are given blocks with
+// PickBlock. The piece is from bf, the pieces a source can send us, or from any piece if bf is nil. Pieces that only
+// belong to skipped files are never picked. The first preferred piece that we need is picked if there is one, then the
+// first and last pieces of each file and then the pieces in a window past the first missing piece when SetOrder enabled
+// them. Otherwise the pieces of the files with the highest priority are picked, at random for the first few pieces so
+// that we quickly have something to trade, and then rarest first, with ties broken at random. The piece is not given to
+// anyone else unless it is returned. Once every piece we need is being downloaded, Pick is in endgame mode and picks
+// the pieces with the fewest sources again, so that one slow source can't hold up the end. Sources must leave out the
+// pieces they are already working on
+func (pk *Picker) Pick(bf bitfield.Bitfield, preferred []int) (int, bool) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	if pk.numWanted == 0 {
+		return pk.pickEndgame(bf)
+	}
+	pick := pk.pickWanted(bf, preferred)
+	if pick < 0 {
+		return 0, false
+	}
+	pk.take(pick)
+	return pick, true
+}
+
+// pickWanted chooses a piece that no one is working on as Pick does, out of the pieces with the highest priority,
+// -1 if there are none. The first and last pieces of files and then the pieces in the sequential window come before
+// the rest when they are enabled, pk.mu must be held
+func (pk *Picker) pickWanted(bf bitfield.Bitfield, preferred []int) int {
+	available := func(index int) bool {
+		return index >= 0 && index < pk.numPieces && pk.wanted[index] && (bf == nil || has(bf, index))
+	}
+
+	for _, index := range preferred {
+		if available(index) {
+			return index
+		}
+	}
+	if pk.firstLast != nil {
+		if pick := pk.pickInOrder(0, pk.numPieces, func(i int) bool { return available(i) && pk.firstLast[i] }); pick >= 0 {
+			return pick
+		}
+	}
+	if pk.sequential { // Sources without pieces in the window fall back to rarest first so they aren't idle
+		start := 0
+		for start < pk.numPieces && (pk.done[start] || pk.priorities[start] == common.PrioritySkip) {
+			start++
+		}
+		if pick := pk.pickInOrder(start, start+sequentialWindow, available); pick >= 0 {
+			return pick
+		}
+	}
+
+	pick, ties := -1, 0
+	for i := 0; i < pk.numPieces; i++ {
+		if !available(i) {
+			continue
+		}
+		if pick >= 0 && pk.priorities[i].Rank() < pk.priorities[pick].Rank() {
+			continue
+		} else if pick >= 0 && pk.priorities[i].Rank() > pk.priorities[pick].Rank() {
+			pick, ties = i, 1 // Higher priority than everything before it
+			continue
+		}
+		if pk.numDone >= randomFirst && pick >= 0 && pk.availability[i] > pk.availability[pick] {
+			continue
+		} else if pk.numDone >= randomFirst && pick >= 0 && pk.availability[i] < pk.availability[pick] {
+			ties = 0 // Rarer than everything before it
+		}
+		ties++
+		if rand.Intn(ties) == 0 { // Each candidate is kept with equal probability
+			pick = i
+		}
+	}
+	return pick
+}
+
+// pickInOrder chooses the first piece from start up to end that matches, out of the pieces with the highest priority,
+// -1 if there are none, pk.mu must be held
+func (pk *Picker) pickInOrder(start, end int, match func(int) bool) int {
+	pick := -1
+	for i := start; i < end && i < pk.numPieces; i++ {
+		if match(i) && (pick < 0 || pk.priorities[i].Rank() > pk.priorities[pick].Rank()) {
+			pick = i
+		}
+	}
+	return pick
+}
+
+// pickEndgame chooses a piece that is already being downloaded, from as few sources as possible, pk.mu must be held
+func (pk *Picker) pickEndgame(bf bitfield.Bitfield) (int, bool) {
+	pick, ties := -1, 0
+	for i := 0; i < pk.numPieces; i++ {
+		if pk.done[i] || (pk.holders[i] == 0 && pk.partials[i] == nil) || (bf != nil && !has(bf, i)) {
+			continue
+		} else if pick >= 0 && pk.holders[i] > pk.holders[pick] {
+			continue
+		} else if pick >= 0 && pk.holders[i] < pk.holders[pick] {
+			ties = 0
+		}
+		ties++
+		if rand.Intn(ties) == 0 {
+			pick = i
+		}
+	}
+	if pick < 0 {
+		return 0, false
+	}
+	pk.holders[pick]++
+	return pick, true
+}
+
+// take gives a wanted piece to a source, pk.mu must be held
+func (pk *Picker) take(index int) {
+	pk.wanted[index] = false
+	pk.numWanted--
+	pk.holders[index]++
+}
+
+// Wait picks a piece like Pick, waiting for pieces to be returned if there are none to pick
+func (pk *Picker) Wait(ctx context.Context, bf bitfield.Bitfield) (int, error) {
+	for {
+		pk.mu.Lock()
+		changed := pk.changed
+		pk.mu.Unlock()
+		if index, ok := pk.Pick(bf, nil); ok {
+			return index, nil
+		}
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-changed:
+		}
+	}
+}
+
+// Return puts a piece back to be picked again after a source's download of it failed or was abandoned, in endgame mode
+// it is only picked again once no other source is working on it
+func (pk *Picker) Return(index int) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	if index < 0 || index >= pk.numPieces || pk.done[index] || pk.holders[index] == 0 {
+		return
+	}
+	pk.holders[index]--
+	if pk.holders[index] == 0 && pk.partials[index] == nil {
+		pk.want(index)
+	}
+}
+
+// want makes a piece that no one is working on available to pick again unless it is skipped, pk.mu must be held
+func (pk *Picker) want(index int) {
+	if pk.priorities[index] == common.PrioritySkip {
+		return
+	}
+	pk.wanted[index] = true
+	pk.numWanted++
+	close(pk.changed)
+	pk.changed = make(chan struct{})
+}
+
+// Done records that we have a piece
+func (pk *Picker) Done(index int) {
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	if index < 0 || index >= pk.numPieces || pk.done[index] {
+		return
+	}
+	if pk.wanted[index] {
+		pk.wanted[index] = false
+		pk.numWanted--
+	}
+	pk.done[index] = true
+	pk.holders[index] = 0
+	pk.numDone++
+	if _, ok := pk.partials[index]; ok { // Sources still asking for its blocks can cancel them
+		delete(pk.partials, index)
+		pk.cancel()
+	}
+}
+
+// has checks for a piece in a bitfield that may be shorter than the torrent's, such as an unset one
+func has(bf bitfield.Bitfield, index int) bool {
+	return index/8 < len(bf) && bf.Has(index)
+}
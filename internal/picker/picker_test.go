@@ -0,0 +1,386 @@
+package picker
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/bitfield"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newInfo(numPieces int, have ...int) *common.TorrentInfo {
+	info := &common.TorrentInfo{TotalPieces: numPieces, Bitfield: make(bitfield.Bitfield, (numPieces+7)/8)}
+	for _, index := range have {
+		info.Bitfield.Set(index)
+	}
+	return info
+}
+
+func newBitfield(numPieces int, pieces ...int) bitfield.Bitfield {
+	bf := make(bitfield.Bitfield, (numPieces+7)/8)
+	for _, index := range pieces {
+		bf.Set(index)
+	}
+	return bf
+}
+
+func TestRarestFirst(t *testing.T) {
+	assert := assert.New(t)
+
+	pk := New(newInfo(10, 0, 1, 2, 3)) // Past the random first pieces
+	pk.AddPeer(newBitfield(10, 4, 5, 6, 7))
+	pk.AddPeer(newBitfield(10, 4, 5, 6))
+	pk.AddPeer(newBitfield(10, 4, 5))
+	pk.AddPiece(4)
+	assert.Equal(4, pk.Availability(4))
+
+	// Pieces come from the peer's bitfield, rarest first
+	var picks []int
+	peerHas := newBitfield(10, 4, 5, 6, 7)
+	for {
+		index, ok := pk.Pick(peerHas, nil)
+		if !ok {
+			break
+		}
+		picks = append(picks, index)
+	}
+	assert.Equal([]int{7, 6, 5, 4}, picks)
+
+	// Returned pieces can be picked again, pieces we have can't
+	pk.Return(6)
+	pk.Return(2)
+	index, ok := pk.Pick(newBitfield(10, 2, 6), nil)
+	assert.True(ok)
+	assert.Equal(6, index)
+	_, ok = pk.Pick(newBitfield(10, 2, 6), nil)
+	assert.False(ok)
+
+	// Availability drops when peers leave
+	pk.RemovePeer(newBitfield(10, 4, 5))
+	assert.Equal(3, pk.Availability(4))
+	assert.Equal(2, pk.Availability(5))
+}
+
+func TestRandomFirst(t *testing.T) {
+	assert := assert.New(t)
+
+	// The first pieces are picked regardless of availability
+	seen := make(map[int]bool)
+	for i := 0; i < 50; i++ {
+		pk := New(newInfo(4))
+		pk.AddPeer(newBitfield(4, 0, 1, 2))
+		pk.AddPeer(newBitfield(4, 0, 1))
+		pk.AddPeer(newBitfield(4, 0))
+		index, ok := pk.Pick(nil, nil)
+		require.True(t, ok)
+		seen[index] = true
+	}
+	assert.Len(seen, 4)
+}
+
+func TestPreferred(t *testing.T) {
+	assert := assert.New(t)
+
+	pk := New(newInfo(8, 0, 1, 2, 3))
+	peerHas := newBitfield(8, 5, 6)
+
+	// Suggested pieces are picked first if the peer has them
+	index, ok := pk.Pick(peerHas, []int{7, 0, 6})
+	assert.True(ok)
+	assert.Equal(6, index)
+	index, ok = pk.Pick(peerHas, []int{7, 6})
+	assert.True(ok)
+	assert.Equal(5, index)
+}
+
+func TestWait(t *testing.T) {
+	assert := assert.New(t)
+
+	pk := New(newInfo(3))
+	index, err := pk.Wait(context.Background(), newBitfield(3, 1))
+	assert.Nil(err)
+	assert.Equal(1, index)
+
+	// Sources wait for pieces they have to be returned
+	picked := make(chan int)
+	go func() {
+		index, _ := pk.Wait(context.Background(), newBitfield(3, 1))
+		picked <- index
+	}()
+	time.Sleep(10 * time.Millisecond)
+	pk.Return(1)
+	select {
+	case index := <-picked:
+		assert.Equal(1, index)
+	case <-time.After(time.Second):
+		t.Fatal("Returned piece was not picked")
+	}
+
+	for i := 0; i < 3; i++ {
+		pk.Done(i)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = pk.Wait(ctx, nil)
+	assert.ErrorIs(err, context.DeadlineExceeded)
+}
+
+func TestEndgame(t *testing.T) {
+	assert := assert.New(t)
+
+	// Whole pieces, as web seeds download them
+	pk := New(newInfo(6, 0, 1, 2, 3))
+	first, ok := pk.Pick(nil, nil)
+	require.True(t, ok)
+	second, ok := pk.Pick(newBitfield(6, 4, 5), []int{9 - first})
+	require.True(t, ok)
+	assert.Equal(9-first, second)
+
+	// Pieces being downloaded are given to other sources, those with the fewest sources first
+	third, ok := pk.Pick(nil, []int{first})
+	assert.True(ok)
+	fourth, ok := pk.Pick(nil, nil)
+	assert.True(ok)
+	assert.ElementsMatch([]int{first, second}, []int{third, fourth})
+	index, ok := pk.Pick(newBitfield(6, first), nil)
+	assert.True(ok)
+	assert.Equal(first, index)
+
+	// Pieces that are done aren't given out anymore
+	pk.Done(first)
+	_, ok = pk.Pick(newBitfield(6, first), nil)
+	assert.False(ok)
+	pk.Return(first)
+	index, ok = pk.Pick(nil, nil)
+	assert.True(ok)
+	assert.Equal(second, index)
+}
+
+func TestBlockEndgame(t *testing.T) {
+	assert := assert.New(t)
+
+	info := newInfo(1)
+	info.PieceLength = 2 * BlockSize
+	info.TotalLength = 2 * BlockSize
+	pk := New(info)
+	peerHas := newBitfield(1, 0)
+	var blocks []Block
+	for i := 0; i < 2; i++ {
+		blk, ok := pk.PickBlock(peerHas, nil, "a")
+		require.True(t, ok)
+		blocks = append(blocks, blk)
+	}
+
+	// Once every block is requested, other sources are given the blocks with the fewest sources, but never twice
+	blk, ok := pk.PickBlock(peerHas, nil, "b")
+	assert.True(ok)
+	assert.Equal(blocks[0], blk)
+	blk, ok = pk.PickBlock(peerHas, nil, "b")
+	assert.True(ok)
+	assert.Equal(blocks[1], blk)
+	_, ok = pk.PickBlock(peerHas, nil, "b")
+	assert.False(ok)
+	_, err := pk.AddBlock("b", blocks[1], make([]byte, BlockSize))
+	require.Nil(t, err)
+	blk, ok = pk.PickBlock(peerHas, nil, "c")
+	assert.True(ok)
+	assert.Equal(blocks[0], blk)
+
+	// Sources that sent a block first cancel it for the others
+	cancelled := pk.Cancelled()
+	piece, err := pk.AddBlock("c", blocks[0], make([]byte, BlockSize))
+	assert.Nil(err)
+	assert.NotNil(piece)
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("Duplicate requests were not cancelled")
+	}
+	assert.False(pk.Assigned("a", blocks[0]))
+	assert.False(pk.Assigned("b", blocks[0]))
+}
+
+func TestBlocks(t *testing.T) {
+	assert := assert.New(t)
+
+	info := newInfo(2, 1)
+	info.PieceLength = 2*BlockSize + 10
+	info.TotalLength = 3*BlockSize + 10
+	pk := New(info)
+	peerHas := newBitfield(2, 0)
+
+	// The blocks of one piece are spread across sources, the last block is shorter
+	first, ok := pk.PickBlock(peerHas, nil, "a")
+	assert.True(ok)
+	assert.Equal(Block{Index: 0, Begin: 0, Length: BlockSize}, first)
+	second, ok := pk.PickBlock(peerHas, nil, "b")
+	assert.True(ok)
+	assert.Equal(Block{Index: 0, Begin: BlockSize, Length: BlockSize}, second)
+	third, ok := pk.PickBlock(peerHas, nil, "b")
+	assert.True(ok)
+	assert.Equal(Block{Index: 0, Begin: 2 * BlockSize, Length: 10}, third)
+
+	// Returned blocks go to the next source
+	pk.ReturnBlock("b", second)
+	assert.False(pk.Assigned("b", second))
+	blk, ok := pk.PickBlock(peerHas, nil, "c")
+	assert.True(ok)
+	assert.Equal(second, blk)
+
+	// The piece is assembled once every block is in
+	_, err := pk.AddBlock("a", first, make([]byte, 10))
+	assert.ErrorIs(err, ErrBlock)
+	for _, blk := range []Block{third, first} {
+		piece, err := pk.AddBlock("a", blk, bytes.Repeat([]byte{byte(blk.Begin/BlockSize) + 1}, blk.Length))
+		assert.Nil(err)
+		assert.Nil(piece)
+	}
+	piece, err := pk.AddBlock("c", second, bytes.Repeat([]byte{2}, BlockSize))
+	assert.Nil(err)
+	assert.Equal(bytes.Repeat([]byte{1}, BlockSize), piece[:BlockSize])
+	assert.Equal(bytes.Repeat([]byte{2}, BlockSize), piece[BlockSize:2*BlockSize])
+	assert.Equal(bytes.Repeat([]byte{3}, 10), piece[2*BlockSize:])
+}
+
+func TestBlame(t *testing.T) {
+	assert := assert.New(t)
+
+	info := newInfo(maxStrikes + 1)
+	info.PieceLength = 2 * BlockSize
+	info.TotalLength = (maxStrikes + 1) * 2 * BlockSize
+	pk := New(info)
+
+	// Pieces from several sources give each a strike
+	for i := 0; i < maxStrikes; i++ {
+		peerHas := newBitfield(maxStrikes+1, i)
+		for _, source := range []string{"a", "b"} {
+			blk, ok := pk.PickBlock(peerHas, nil, source)
+			require.True(t, ok)
+			_, err := pk.AddBlock(source, blk, make([]byte, blk.Length))
+			require.Nil(t, err)
+		}
+		pk.Fail(i)
+		assert.Equal(i == maxStrikes-1, pk.Banned("a"))
+	}
+
+	// Failed pieces are downloaded again, a source that sent every block is banned right away along with its IP
+	peerHas := newBitfield(maxStrikes+1, 0)
+	for i := 0; i < 2; i++ {
+		blk, ok := pk.PickBlock(peerHas, nil, "10.0.0.3:6881")
+		require.True(t, ok)
+		assert.Equal(0, blk.Index)
+		pk.AddBlock("10.0.0.3:6881", blk, make([]byte, blk.Length))
+	}
+	pk.Fail(0)
+	assert.True(pk.Banned("10.0.0.3:6881"))
+	assert.True(pk.Banned("10.0.0.3:51413"))
+	assert.False(pk.Banned("10.0.0.4:6881"))
+}
+
+func TestPriorities(t *testing.T) {
+	assert := assert.New(t)
+
+	info := newInfo(4)
+	info.PieceLength = BlockSize
+	info.TotalLength = 4 * BlockSize
+	info.Paths = []common.Path{
+		{Length: BlockSize, Priority: common.PriorityLow},
+		{Length: BlockSize, Priority: common.PrioritySkip},
+		{Length: 2 * BlockSize, Priority: common.PriorityHigh},
+	}
+	pk := New(info)
+
+	// Pieces are picked by priority and skipped pieces aren't picked
+	var picks []int
+	for i := 0; i < 3; i++ {
+		index, ok := pk.Pick(nil, nil)
+		require.True(t, ok)
+		picks = append(picks, index)
+	}
+	assert.ElementsMatch([]int{2, 3}, picks[:2])
+	assert.Equal(0, picks[2])
+
+	// Pieces that are no longer skipped can be picked
+	info.Paths[1].Priority = common.PriorityNormal
+	pk.SetPriorities(info.PiecePriorities())
+	index, ok := pk.Pick(nil, nil)
+	assert.True(ok)
+	assert.Equal(1, index)
+}
+
+func TestOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	info := newInfo(40, 0, 1, 2, 3)
+	info.PieceLength = BlockSize
+	info.TotalLength = 40 * BlockSize
+	info.Paths = []common.Path{{Length: 20 * BlockSize}, {Length: 20 * BlockSize}}
+	info.Sequential = true
+	info.FirstLast = true
+	pk := New(info)
+
+	// The first and last pieces of each file come first, then pieces in order
+	var picks []int
+	for i := 0; i < 5; i++ {
+		index, ok := pk.Pick(nil, nil)
+		require.True(t, ok)
+		picks = append(picks, index)
+	}
+	assert.Equal([]int{19, 20, 39, 4, 5}, picks)
+
+	// Sources without pieces in the window get the rarest piece instead, until the window slides over their pieces
+	pk.AddPeer(newBitfield(40, 21, 31))
+	index, ok := pk.Pick(newBitfield(40, 21, 30), nil)
+	assert.True(ok)
+	assert.Equal(30, index)
+	pk.Done(4)
+	pk.Done(5)
+	index, ok = pk.Pick(newBitfield(40, 21, 31), nil)
+	assert.True(ok)
+	assert.Equal(21, index)
+
+	// Turning it off goes back to rarest first
+	pk.SetOrder(false, false, nil)
+	pk.AddPeer(newBitfield(40, 6))
+	index, ok = pk.Pick(newBitfield(40, 6, 7), nil)
+	assert.True(ok)
+	assert.Equal(7, index)
+}
+
+func TestSkipPartial(t *testing.T) {
+	assert := assert.New(t)
+
+	info := newInfo(2)
+	info.PieceLength = 2 * BlockSize
+	info.TotalLength = 4 * BlockSize
+	info.Paths = []common.Path{{Length: 2 * BlockSize}, {Length: 2 * BlockSize}}
+	pk := New(info)
+	peerHas := newBitfield(2, 1)
+	first, ok := pk.PickBlock(peerHas, nil, "a")
+	require.True(t, ok)
+	second, ok := pk.PickBlock(peerHas, nil, "b")
+	require.True(t, ok)
+	_, err := pk.AddBlock("a", first, make([]byte, first.Length))
+	require.Nil(t, err)
+
+	// Skipping a file drops the blocks of its pieces and cancels their requests, so its file can be removed
+	cancelled := pk.Cancelled()
+	info.Paths[1].Priority = common.PrioritySkip
+	pk.SetPriorities(info.PiecePriorities())
+	assert.True(pk.Skipped(1))
+	select {
+	case <-cancelled:
+	default:
+		t.Fatal("Requests for the skipped piece were not cancelled")
+	}
+	assert.False(pk.Assigned("b", second))
+	piece, err := pk.AddBlock("b", second, make([]byte, second.Length))
+	assert.Nil(err)
+	assert.Nil(piece)
+	_, ok = pk.PickBlock(peerHas, nil, "b")
+	assert.False(ok)
+}
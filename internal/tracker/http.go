@@ -2,6 +2,9 @@ package tracker
 
 import (
 	"fmt"
+	"io"
+	"math"
+	"net"
 	"net/url"
 	"strconv"
 
@@ -9,19 +12,82 @@ import (
 	"github.com/kylec725/graytorrent/internal/common"
 	"github.com/kylec725/graytorrent/internal/peer"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
 // Errors
 var (
 	ErrBadStatusCode = errors.New("Expected status code 200")
+	ErrFailure       = errors.New("Tracker refused the request")
 )
 
-type bencodeTrackerResp struct {
-	Interval   int    `bencode:"interval"`
-	Peers      string `bencode:"peers"`
-	Failure    string `bencode:"failure reason"`
-	Complete   int    `bencode:"complete"`
-	Incomplete int    `bencode:"incomplete"`
+// trackerResp holds the fields of an HTTP tracker's response that we use
+type trackerResp struct {
+	Interval    int
+	MinInterval int    // Announces should not be sent more often than this
+	TrackerID   string // Sent back on later announces
+	Warning     string
+	Failure     string
+	Complete    int
+	Incomplete  int
+	Peers       interface{} // Either a compact string or the original list of dictionaries
+	Peers6      string      // IPv6 peers (BEP 7)
+}
+
+// decodeTrackerResp reads a tracker response, peers can be in either format so it is decoded without a struct
+func decodeTrackerResp(r io.Reader) (trackerResp, error) {
+	decoded, err := bencode.Decode(r)
+	if err != nil {
+		return trackerResp{}, err
+	}
+	dict, _ := decoded.(map[string]interface{})
+	intValue := func(key string) int {
+		value, _ := dict[key].(int64)
+		return int(value)
+	}
+	stringValue := func(key string) string {
+		value, _ := dict[key].(string)
+		return value
+	}
+	return trackerResp{
+		Interval:    intValue("interval"),
+		MinInterval: intValue("min interval"),
+		TrackerID:   stringValue("tracker id"),
+		Warning:     stringValue("warning message"),
+		Failure:     stringValue("failure reason"),
+		Complete:    intValue("complete"),
+		Incomplete:  intValue("incomplete"),
+		Peers:       dict["peers"],
+		Peers6:      stringValue("peers6"),
+	}, nil
+}
+
+// peers parses the IPv4 and IPv6 peers of a response, IPv4 peers may be compact or a list of dictionaries
+func (trResp trackerResp) peers(info *common.TorrentInfo) ([]peer.Peer, error) {
+	var peersList []peer.Peer
+	switch peers := trResp.Peers.(type) {
+	case string:
+		compact, err := peer.Unmarshal([]byte(peers), info)
+		if err != nil {
+			return nil, err
+		}
+		peersList = compact
+	case []interface{}:
+		for _, entry := range peers {
+			dict, _ := entry.(map[string]interface{})
+			ip, _ := dict["ip"].(string) // Can also be a DNS name
+			port, _ := dict["port"].(int64)
+			if ip == "" || port <= 0 || port > math.MaxUint16 {
+				continue
+			}
+			peersList = append(peersList, peer.New(net.JoinHostPort(ip, strconv.Itoa(int(port))), nil, info))
+		}
+	}
+	peers6, err := peer.Unmarshal6([]byte(trResp.Peers6), info)
+	if err != nil {
+		return nil, err
+	}
+	return append(peersList, peers6...), nil
 }
 
 func (tr Tracker) buildURL(event string, info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) (string, error) {
@@ -40,21 +106,26 @@ func (tr Tracker) buildURL(event string, info *common.TorrentInfo, port uint16,
 		"compact":    []string{"1"},
 		"event":      []string{event},
 		"numwant":    []string{strconv.Itoa(numWant)},
+		"key":        []string{fmt.Sprintf("%08x", info.Key)},
 	}
 
 	if event == "" {
 		delete(params, "event")
 	}
+	if tr.TrackerID != "" {
+		params.Set("trackerid", tr.TrackerID)
+	}
 
 	base.RawQuery = params.Encode()
 	return base.String(), nil
 }
 
-func (tr *Tracker) httpStarted(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) ([]peer.Peer, error) {
+// httpRequest sends an announce for an event and updates the tracker from its response
+func (tr *Tracker) httpRequest(event string, info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) (trackerResp, error) {
 	// Request
-	req, err := tr.buildURL("started", info, port, uploaded, downloaded, left)
+	req, err := tr.buildURL(event, info, port, uploaded, downloaded, left)
 	if err != nil {
-		return nil, errors.Wrap(err, "httpStarted")
+		return trackerResp{}, errors.Wrap(err, "httpRequest")
 	}
 
 	resp, err := tr.httpClient.Get(req)
@@ -62,126 +133,72 @@ func (tr *Tracker) httpStarted(info *common.TorrentInfo, port uint16, uploaded,
 		unwrapped := errors.Unwrap(err)
 		// Retry again if connection was reset
 		if unwrapped != nil && unwrapped.Error() == "read: connection reset by peer" {
-			fmt.Println("connection was reset but we good")
 			resp, err = tr.httpClient.Get(req)
 			if err != nil {
-				return nil, errors.Wrap(err, "httpStarted")
+				return trackerResp{}, errors.Wrap(err, "httpRequest")
 			}
 		} else {
-			return nil, errors.Wrap(err, "httpStarted")
+			return trackerResp{}, errors.Wrap(err, "httpRequest")
 		}
 	}
 	defer resp.Body.Close()
 
-	// Unmarshal tracker response to get details and list of peers
-	var trResp bencodeTrackerResp
-	err = bencode.Unmarshal(resp.Body, &trResp)
+	// Decode tracker response to get details and list of peers
+	trResp, err := decodeTrackerResp(resp.Body)
 	if err != nil {
-		return nil, errors.Wrap(err, "httpStarted")
+		return trackerResp{}, errors.Wrap(err, "httpRequest")
 	}
 
 	if resp.StatusCode != 200 {
-		return nil, errors.Wrapf(ErrBadStatusCode, "httpStarted: GET status code %d and reason '%s'", resp.StatusCode, trResp.Failure)
+		tr.Failure = trResp.Failure
+		return trackerResp{}, errors.Wrapf(ErrBadStatusCode, "httpRequest: GET status code %d and reason '%s'", resp.StatusCode, trResp.Failure)
+	} else if trResp.Failure != "" {
+		tr.Failure = trResp.Failure
+		return trackerResp{}, errors.Wrapf(ErrFailure, "httpRequest: reason '%s'", trResp.Failure)
 	}
 
 	// Update tracker information
 	tr.Interval = trResp.Interval
-
-	// Get peer information
-	peersBytes := []byte(trResp.Peers)
-	peersList, err := peer.Unmarshal(peersBytes, info)
-	return peersList, errors.Wrap(err, "httpStarted")
-}
-
-func (tr *Tracker) httpStopped(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) error {
-	// Request
-	req, err := tr.buildURL("stopped", info, port, uploaded, downloaded, left)
-	if err != nil {
-		return errors.Wrap(err, "httpStopped")
+	tr.MinInterval = trResp.MinInterval
+	tr.Warning = trResp.Warning
+	if trResp.TrackerID != "" { // Trackers don't have to repeat their ID
+		tr.TrackerID = trResp.TrackerID
 	}
-
-	resp, err := tr.httpClient.Get(req)
-	if err != nil {
-		return errors.Wrap(err, "httpStopped")
+	if trResp.Warning != "" {
+		log.WithFields(log.Fields{"tracker": tr.Announce, "warning": trResp.Warning}).Debug("Got warning message from tracker")
 	}
-	defer resp.Body.Close()
 
-	// Unmarshal tracker response to get details
-	var trResp bencodeTrackerResp
-	err = bencode.Unmarshal(resp.Body, &trResp)
-	if err != nil {
-		return errors.Wrap(err, "httpStopped")
-	}
-
-	if resp.StatusCode != 200 {
-		return errors.Wrapf(ErrBadStatusCode, "httpStopped: GET status code %d and reason '%s'", resp.StatusCode, trResp.Failure)
-	}
-
-	// Update tracker information
-	tr.Interval = trResp.Interval
-
-	return nil
+	return trResp, nil
 }
 
-func (tr *Tracker) httpCompleted(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) error {
-	// Request
-	req, err := tr.buildURL("completed", info, port, uploaded, downloaded, left)
-	if err != nil {
-		return errors.Wrap(err, "httpCompleted")
-	}
-
-	resp, err := tr.httpClient.Get(req)
-	if err != nil {
-		return errors.Wrap(err, "httpCompleted")
-	}
-	defer resp.Body.Close()
-
-	// Unmarshal tracker response to get details
-	var trResp bencodeTrackerResp
-	err = bencode.Unmarshal(resp.Body, &trResp)
+func (tr *Tracker) httpStarted(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) ([]peer.Peer, error) {
+	trResp, err := tr.httpRequest("started", info, port, uploaded, downloaded, left)
 	if err != nil {
-		return errors.Wrap(err, "httpCompleted")
+		return nil, errors.Wrap(err, "httpStarted")
 	}
 
-	if resp.StatusCode != 200 {
-		return errors.Wrapf(ErrBadStatusCode, "httpCompleted: GET status code %d and reason '%s'", resp.StatusCode, trResp.Failure)
-	}
+	// Get peer information
+	peersList, err := trResp.peers(info)
+	return peersList, errors.Wrap(err, "httpStarted")
+}
 
-	// Update tracker information
-	tr.Interval = trResp.Interval
+func (tr *Tracker) httpStopped(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) error {
+	_, err := tr.httpRequest("stopped", info, port, uploaded, downloaded, left)
+	return errors.Wrap(err, "httpStopped")
+}
 
-	return nil
+func (tr *Tracker) httpCompleted(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) error {
+	_, err := tr.httpRequest("completed", info, port, uploaded, downloaded, left)
+	return errors.Wrap(err, "httpCompleted")
 }
 
 func (tr *Tracker) httpAnnounce(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) ([]peer.Peer, error) {
-	// Request
-	req, err := tr.buildURL("", info, port, uploaded, downloaded, left)
-	if err != nil {
-		return nil, errors.Wrap(err, "httpAnnounce")
-	}
-
-	resp, err := tr.httpClient.Get(req)
+	trResp, err := tr.httpRequest("", info, port, uploaded, downloaded, left)
 	if err != nil {
 		return nil, errors.Wrap(err, "httpAnnounce")
 	}
-	defer resp.Body.Close()
-
-	// Unmarshal tracker response to get details
-	var trResp bencodeTrackerResp
-	err = bencode.Unmarshal(resp.Body, &trResp)
-	if err != nil {
-		return nil, errors.Wrap(err, "httpAnnounce")
-	}
-
-	if resp.StatusCode != 200 {
-		return nil, errors.Wrapf(ErrBadStatusCode, "httpAnnounce: GET status code %d and reason '%s'", resp.StatusCode, trResp.Failure)
-	}
-
-	// Update tracker information
-	tr.Interval = trResp.Interval
 
 	// Get peer information
-	peersBytes := []byte(trResp.Peers)
-	peersList, err := peer.Unmarshal(peersBytes, info)
-	return peersList, errors.Wrap(err, "httpStarted")
+	peersList, err := trResp.peers(info)
+	return peersList, errors.Wrap(err, "httpAnnounce")
 }
@@ -0,0 +1,114 @@
+package tracker
+
+import (
+	"context"
+	"encoding/binary"
+	"net/url"
+	"path"
+	"strings"
+
+	bencode "github.com/jackpal/bencode-go"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/udptracker"
+	"github.com/pkg/errors"
+)
+
+// Errors
+var (
+	ErrNoScrape       = errors.New("Tracker does not support scraping")
+	ErrScrapeNotFound = errors.New("Tracker did not return statistics for the torrent")
+)
+
+// Scrape holds a tracker's statistics for a torrent's swarm
+type Scrape struct {
+	Complete   int // Number of seeders
+	Downloaded int // Number of times the torrent has been downloaded
+	Incomplete int // Number of leechers
+}
+
+// ScrapeURL derives an HTTP tracker's scrape URL from its announce URL by replacing the "announce" that starts
+// the last path segment with "scrape", trackers whose URLs don't follow that convention can't be scraped
+func ScrapeURL(announce string) (string, error) {
+	base, err := url.Parse(announce)
+	if err != nil {
+		return "", errors.Wrap(err, "ScrapeURL")
+	}
+	dir, last := path.Split(base.Path)
+	if !strings.HasPrefix(last, "announce") {
+		return "", errors.Wrap(ErrNoScrape, "ScrapeURL")
+	}
+	base.Path = dir + "scrape" + strings.TrimPrefix(last, "announce")
+	return base.String(), nil
+}
+
+// Scrape asks the tracker for the number of seeders and leechers in a torrent's swarm, UDP trackers are asked through the
+// context's UDP tracker client if it has one
+func (tr *Tracker) Scrape(ctx context.Context, info *common.TorrentInfo) (Scrape, error) {
+	if strings.HasPrefix(tr.Announce, "http") {
+		scrape, err := tr.httpScrape(info)
+		return scrape, errors.Wrap(err, "Scrape")
+	}
+	if tr.udp == nil {
+		tr.udp, _ = udptracker.FromContext(ctx)
+	}
+	scrape, err := tr.udpScrape(ctx, info)
+	return scrape, errors.Wrap(err, "Scrape")
+}
+
+func (tr *Tracker) httpScrape(info *common.TorrentInfo) (Scrape, error) {
+	// Request
+	scrapeURL, err := ScrapeURL(tr.Announce)
+	if err != nil {
+		return Scrape{}, errors.Wrap(err, "httpScrape")
+	}
+	base, err := url.Parse(scrapeURL)
+	if err != nil {
+		return Scrape{}, errors.Wrap(err, "httpScrape")
+	}
+	params := base.Query() // Keep parameters such as passkeys
+	params.Set("info_hash", string(info.InfoHash[:]))
+	base.RawQuery = params.Encode()
+
+	resp, err := tr.httpClient.Get(base.String())
+	if err != nil {
+		return Scrape{}, errors.Wrap(err, "httpScrape")
+	}
+	defer resp.Body.Close()
+
+	// The files dictionary is keyed by raw infohashes, so it is decoded without a struct
+	decoded, err := bencode.Decode(resp.Body)
+	if err != nil {
+		return Scrape{}, errors.Wrap(err, "httpScrape")
+	}
+	scrapeResp, _ := decoded.(map[string]interface{})
+
+	if resp.StatusCode != 200 {
+		failure, _ := scrapeResp["failure reason"].(string)
+		return Scrape{}, errors.Wrapf(ErrBadStatusCode, "httpScrape: GET status code %d and reason '%s'", resp.StatusCode, failure)
+	}
+
+	files, _ := scrapeResp["files"].(map[string]interface{})
+	file, ok := files[string(info.InfoHash[:])].(map[string]interface{})
+	if !ok {
+		return Scrape{}, errors.Wrap(ErrScrapeNotFound, "httpScrape")
+	}
+	complete, _ := file["complete"].(int64)
+	downloaded, _ := file["downloaded"].(int64)
+	incomplete, _ := file["incomplete"].(int64)
+	return Scrape{Complete: int(complete), Downloaded: int(downloaded), Incomplete: int(incomplete)}, nil
+}
+
+func (tr *Tracker) udpScrape(ctx context.Context, info *common.TorrentInfo) (Scrape, error) {
+	resp, _, err := tr.udpRequest(ctx, udptracker.ActionScrape, info.InfoHash[:])
+	if err != nil {
+		return Scrape{}, errors.Wrap(err, "udpScrape")
+	} else if len(resp) < 12 {
+		return Scrape{}, errors.Wrap(ErrSize, "udpScrape")
+	}
+
+	return Scrape{
+		Complete:   int(binary.BigEndian.Uint32(resp[0:4])),  // Seeders
+		Downloaded: int(binary.BigEndian.Uint32(resp[4:8])),  // Completed
+		Incomplete: int(binary.BigEndian.Uint32(resp[8:12])), // Leechers
+	}, nil
+}
@@ -1,20 +1,23 @@
 package tracker
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"math/rand"
-	"net"
 	"net/http"
 	"time"
 
 	"github.com/kylec725/graytorrent/internal/common"
 	"github.com/kylec725/graytorrent/internal/metainfo"
 	"github.com/kylec725/graytorrent/internal/peer"
+	"github.com/kylec725/graytorrent/internal/udptracker"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
-const numWant = 30 // Max peers to receive in tracker response
+const numWant = 30                     // Max peers to receive in tracker response
+const stoppedTimeout = 5 * time.Second // How long to try sending a stopped event once the torrent stops
 
 // TODO: test that tracker messages have correct numbers
 
@@ -25,15 +28,16 @@ var (
 
 // Tracker stores information about a torrent tracker
 type Tracker struct {
-	Announce string `json:"Announce"`
-	Working  bool   `json:"-"`
-	Interval int    `json:"-"`
+	Announce    string `json:"Announce"`
+	Working     bool   `json:"-"`
+	Interval    int    `json:"-"`
+	MinInterval int    `json:"-"` // Least time the tracker wants between announces
+	TrackerID   string `json:"-"` // Given by HTTP trackers to be sent back on later announces
+	Failure     string `json:"-"` // Why the tracker refused our last request
+	Warning     string `json:"-"` // Warning from the tracker's last response
 
-	conn *net.UDPConn `json:"-"` // Used by UDP trackers
-	txID uint32       `json:"-"`
-	cnID uint64       `json:"-"`
-
-	httpClient *http.Client `json:"-"`
+	udp        *udptracker.Client `json:"-"` // The session's UDP tracker client, shared by every torrent
+	httpClient *http.Client       `json:"-"`
 }
 
 // NOTE: consider structuring trackers as an interface and separate http vs udp trackers
@@ -49,170 +53,214 @@ func New(announce string) *Tracker {
 	}
 }
 
-// TODO: change to use tiers of trackers
+// Tier is a group of trackers from an announce-list, they are tried in order and the one that responds is moved to the front (BEP 12)
+type Tier []*Tracker
+
+// UnmarshalJSON also reads saves from before tiers were kept, where each tracker was saved on its own
+func (tier *Tier) UnmarshalJSON(data []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		var tr Tracker
+		if err := json.Unmarshal(data, &tr); err != nil {
+			return err
+		}
+		*tier = Tier{&tr}
+		return nil
+	}
+	var trackers []*Tracker
+	if err := json.Unmarshal(data, &trackers); err != nil {
+		return err
+	}
+	*tier = trackers
+	return nil
+}
 
-// GetTrackers parses metainfo to retrieve a list of trackers
-func GetTrackers(m metainfo.Metainfo) ([]*Tracker, error) {
+// GetTrackers parses metainfo to retrieve the tiers of trackers, each tier is shuffled
+func GetTrackers(m metainfo.Metainfo) ([]Tier, error) {
 	// If announce-list is empty, use announce only
 	if len(m.AnnounceList) == 0 {
 		// Check if no announce strings exist
 		if m.Announce == "" {
 			return nil, errors.Wrap(ErrNoAnnounce, "GetTrackers")
 		}
-
-		trackers := make([]*Tracker, 1)
-		trackers[0] = New(m.Announce)
-		return trackers, nil
+		return []Tier{{New(m.Announce)}}, nil
 	}
 
-	// Make list of multiple trackers
-	var trackers []*Tracker
-	var numAnnounce int
-	// Add each announce in announce-list as a tracker
+	// Add each announce in announce-list as a tracker in its group's tier
+	var tiers []Tier
+	rand.Seed(time.Now().UnixNano())
 	for _, group := range m.AnnounceList {
+		var tier Tier
 		for _, announce := range group {
 			if len(announce) < 4 {
 				continue
 			} else if announce[:4] != "http" && announce[:3] != "udp" {
 				continue
 			}
-			trackers = append(trackers, New(announce))
-			numAnnounce++
+			tier = append(tier, New(announce))
+		}
+		if len(tier) == 0 {
+			continue
 		}
+		rand.Shuffle(len(tier), func(x, y int) {
+			tier[x], tier[y] = tier[y], tier[x]
+		})
+		tiers = append(tiers, tier)
 	}
 
-	// Shuffle list before returning
-	rand.Seed(time.Now().UnixNano())
-	rand.Shuffle(numAnnounce, func(x, y int) {
-		trackers[x], trackers[y] = trackers[y], trackers[x]
-	})
-
-	return trackers, nil
+	return tiers, nil
 }
 
-func (tr *Tracker) sendStarted(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) ([]peer.Peer, error) {
+func (tr *Tracker) sendStarted(ctx context.Context, info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) ([]peer.Peer, error) {
 	if tr.Announce[:4] == "http" {
 		peerList, err := tr.httpStarted(info, port, uploaded, downloaded, left)
 		return peerList, errors.Wrap(err, "sendStarted")
 	}
-	if err := tr.udpConnect(); err != nil {
-		return nil, errors.Wrap(err, "sendStarted")
-	}
-	peerList, err := tr.udpStarted(info, port, uploaded, downloaded, left)
+	peerList, err := tr.udpAnnounce(ctx, "started", info, port, uploaded, downloaded, left)
 	return peerList, errors.Wrap(err, "sendStarted")
 }
 
-func (tr *Tracker) sendStopped(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) error {
+func (tr *Tracker) sendStopped(ctx context.Context, info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) error {
 	if tr.Announce[:4] == "http" {
 		err := tr.httpStopped(info, port, uploaded, downloaded, left)
 		return errors.Wrap(err, "sendStopped")
 	}
-	if tr.conn == nil {
-		if err := tr.udpConnect(); err != nil {
-			return errors.Wrap(err, "sendStopped")
-		}
-	}
-	err := tr.udpStopped(info, port, uploaded, downloaded, left)
+	_, err := tr.udpAnnounce(ctx, "stopped", info, port, uploaded, downloaded, left)
 	return errors.Wrap(err, "sendStopped")
 }
 
-func (tr *Tracker) sendCompleted(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) error {
+func (tr *Tracker) sendCompleted(ctx context.Context, info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) error {
 	if tr.Announce[:4] == "http" {
 		err := tr.httpCompleted(info, port, uploaded, downloaded, left)
 		return errors.Wrap(err, "sendCompleted")
 	}
-	if tr.conn == nil {
-		if err := tr.udpConnect(); err != nil {
-			return errors.Wrap(err, "sendCompleted")
-		}
-	}
-	err := tr.udpCompleted(info, port, uploaded, downloaded, left)
+	_, err := tr.udpAnnounce(ctx, "completed", info, port, uploaded, downloaded, left)
 	return errors.Wrap(err, "sendCompleted")
 }
 
-func (tr *Tracker) sendAnnounce(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) ([]peer.Peer, error) {
+func (tr *Tracker) sendAnnounce(ctx context.Context, info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) ([]peer.Peer, error) {
 	if tr.Announce[:4] == "http" {
 		peerList, err := tr.httpAnnounce(info, port, uploaded, downloaded, left)
 		return peerList, errors.Wrap(err, "sendAnnounce")
 	}
-	if tr.conn == nil {
-		if err := tr.udpConnect(); err != nil {
-			return nil, errors.Wrap(err, "sendAnnounce")
-		}
-	}
-	peerList, err := tr.udpAnnounce(info, port, uploaded, downloaded, left)
+	peerList, err := tr.udpAnnounce(ctx, "announce", info, port, uploaded, downloaded, left)
 	return peerList, errors.Wrap(err, "sendAnnounce")
 }
 
-// Run starts a tracker and gets peers for a torrent
-func (tr *Tracker) Run(ctx context.Context, info *common.TorrentInfo, peers chan peer.Peer, complete chan bool) {
-	startLeft := info.Left
+// Run announces a torrent to one tracker at a time and sends the peers it returns through the channel. Tiers are tried in order,
+// and so are the trackers in a tier, the first tracker that responds is moved to the front of its tier (BEP 12). Announces continue
+// after the torrent completes until the context is done
+func Run(ctx context.Context, tiers []Tier, info *common.TorrentInfo, peers chan peer.Peer, complete chan bool) {
 	port := common.Port(ctx)
-	trackerLog := log.WithField("tracker", tr.Announce)
-	tr.Interval = 2 // Initialize values that can't be saved
-	tr.httpClient = &http.Client{Timeout: 20 * time.Second}
-
-	peerList, err := tr.sendStarted(info, port, 0, 0, info.Left)
-	if err != nil {
-		tr.Working = false
-		trackerLog.WithField("error", err.Error()).Debug("Error while sending started message")
-	} else {
-		tr.Working = true
-		trackerLog.WithField("amount", len(peerList)).Debug("Received list of peers")
+	interval := 2              // Seconds until the next announce
+	var current *Tracker       // The tracker we are announcing to
+	var startUp, startDown int // Bytes transferred when the current tracker was sent a started event
+
+	// transferred returns the bytes uploaded and downloaded since the current tracker's started event, which is what trackers expect
+	transferred := func() (int, int) {
+		uploaded, downloaded := info.Transferred()
+		return uploaded - startUp, downloaded - startDown
+	}
+	udp, ok := udptracker.FromContext(ctx)
+	if !ok { // Torrents outside of a session get a client of their own
+		var err error
+		if udp, err = udptracker.New(); err != nil {
+			log.WithField("error", err.Error()).Debug("Failed to open a UDP tracker client")
+		} else {
+			defer udp.Close()
+		}
+	}
+	for _, tier := range tiers {
+		for _, tr := range tier {
+			tr.Interval = 2 // Initialize values that can't be saved
+			tr.udp = udp
+			tr.httpClient = &http.Client{Timeout: 20 * time.Second}
+		}
+	}
+
+	// announce goes through the tiers until a tracker responds, trackers other than the current one are sent a started event
+	announce := func() {
+		for _, tier := range tiers {
+			for i, tr := range tier {
+				trackerLog := log.WithField("tracker", tr.Announce)
+				var peerList []peer.Peer
+				var err error
+				uploaded, downloaded := info.Transferred() // Counts at the started event if the tracker isn't current
+				if tr == current {
+					peerList, err = tr.sendAnnounce(ctx, info, port, uploaded-startUp, downloaded-startDown, info.Left)
+				} else {
+					peerList, err = tr.sendStarted(ctx, info, port, 0, 0, info.Left)
+				}
+				if err != nil {
+					tr.Working = false
+					trackerLog.WithField("error", err.Error()).Debug("Error while announcing")
+					continue
+				}
+
+				tr.Working = true
+				tr.Failure = ""
+				copy(tier[1:i+1], tier[:i]) // Promote the tracker to the front of its tier
+				tier[0] = tr
+				if current != nil && current != tr && current.Working { // An earlier tier works again
+					if err = current.sendStopped(ctx, info, port, uploaded-startUp, downloaded-startDown, info.Left); err != nil {
+						log.WithFields(log.Fields{"tracker": current.Announce, "error": err.Error()}).Debug("Error while sending stopped message")
+					}
+				}
+				if current != tr {
+					startUp, startDown = uploaded, downloaded
+				}
+				current = tr
+				interval = tr.Interval
+				if tr.MinInterval > interval {
+					interval = tr.MinInterval
+				}
+
+				trackerLog.WithField("amount", len(peerList)).Debug("Received list of peers")
+				// Send peers through channel
+				for _, p := range peerList {
+					peers <- p
+				}
+				return
+			}
+		}
+
+		if current != nil { // Reset interval if trackers just stopped working
+			interval = 2
+		} else { // Double interval if trackers were already not working
+			interval *= 2
+		}
+		current = nil
 	}
 
 	// Cleanup
 	defer func() {
-		if tr.Working { // Send stopped message if necessary
-			uploaded := 0
-			downloaded := info.Left - startLeft
-			if err = tr.sendStopped(info, port, uploaded, downloaded, info.Left); err != nil {
-				trackerLog.WithField("error", err.Error()).Debug("Error while sending stopped message")
+		if current != nil && current.Working { // Send stopped message if necessary
+			uploaded, downloaded := transferred()
+			stopCtx, cancel := context.WithTimeout(context.Background(), stoppedTimeout) // The torrent's context is already done
+			defer cancel()
+			if err := current.sendStopped(stopCtx, info, port, uploaded, downloaded, info.Left); err != nil {
+				log.WithFields(log.Fields{"tracker": current.Announce, "error": err.Error()}).Debug("Error while sending stopped message")
 			}
 		}
-		if tr.conn != nil { // Close connections for UDP trackers
-			tr.conn.Close()
-		}
 	}()
 
-	// Send peers through channel
-	for i := range peerList {
-		peers <- peerList[i]
-	}
-
+	announce()
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-time.After(time.Duration(tr.Interval) * time.Second): // Send announce at intervals
-			uploaded := 0
-			downloaded := info.Left - startLeft
-			if peerList, err = tr.sendAnnounce(info, port, uploaded, downloaded, info.Left); err != nil {
-				if tr.Working { // Reset interval if tracker just stopped working
-					tr.Interval = 2
-				} else { // Double interval if tracker was already not working
-					tr.Interval *= 2
-				}
-				tr.Working = false
-			} else {
-				trackerLog.WithField("amount", len(peerList)).Debug("Received list of peers")
-				// Send peers through channel
-				for i := range peerList {
-					peers <- peerList[i]
-				}
-				tr.Working = true
+		case <-time.After(time.Duration(interval) * time.Second): // Send announce at intervals
+			announce()
+		case _, ok := <-complete:
+			if ok {
+				continue
 			}
-		case _, ok := <-complete: // WARNING: if we don't return here, this case will loop
-			if !ok && tr.Working {
-				uploaded := 0
-				downloaded := info.Left - startLeft
-				if err = tr.sendCompleted(info, port, uploaded, downloaded, info.Left); err != nil {
-					tr.Working = false
-					trackerLog.WithField("error", err.Error()).Debug("Error while sending completed message")
-				} else {
-					tr.Working = true
+			complete = nil // A closed channel is always ready, so stop selecting it and keep announcing while seeding
+			if current != nil {
+				uploaded, downloaded := transferred()
+				if err := current.sendCompleted(ctx, info, port, uploaded, downloaded, info.Left); err != nil {
+					current.Working = false
+					log.WithFields(log.Fields{"tracker": current.Announce, "error": err.Error()}).Debug("Error while sending completed message")
 				}
-				return // TODO: find way to have tracker continue sending messages when complete without loop
 			}
 		}
 	}
@@ -1,27 +1,26 @@
 package tracker
 
 import (
+	"context"
 	"encoding/binary"
-	"math/rand"
 	"net"
+	"net/url"
 	"strings"
-	"time"
 
 	"github.com/kylec725/graytorrent/internal/common"
 	"github.com/kylec725/graytorrent/internal/peer"
+	"github.com/kylec725/graytorrent/internal/udptracker"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
-const udpTimeout = 10 * time.Second
+const optionURLData = 0x2 // BEP 41 option holding part of the announce URL's path and query
+const maxOptionLen = 255
 
 // Errors
 var (
-	ErrSize         = errors.New("Got packet with unexpected size")
-	ErrTransaction  = errors.New("Received incorrect transaction ID")
-	ErrAction       = errors.New("Got wrong action code from the tracker")
-	ErrTrackerError = errors.New("Received an error message from the tracker")
-	ErrEvent        = errors.New("Tried to create packet with invalid event")
+	ErrSize  = errors.New("Got packet with unexpected size")
+	ErrEvent = errors.New("Tried to create packet with invalid event")
 )
 
 func (tr *Tracker) udpAddr() string {
@@ -32,60 +31,39 @@ func (tr *Tracker) udpAddr() string {
 	return splitAddr[2]
 }
 
-// udpConnect initializes a UDP exchange with a tracker
-func (tr *Tracker) udpConnect() error {
-	rand.Seed(time.Now().UnixNano())
-	tr.txID = rand.Uint32()
-
-	addr := tr.udpAddr()
-	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+// udpRequest sends a request through the session's UDP tracker client, and notes the message of a tracker that refuses it
+func (tr *Tracker) udpRequest(ctx context.Context, action uint32, body []byte) ([]byte, *net.UDPAddr, error) {
+	addr, err := net.ResolveUDPAddr("udp", tr.udpAddr())
 	if err != nil {
-		return errors.Wrap(err, "udpConnect")
+		return nil, nil, errors.Wrap(err, "udpRequest")
 	}
-	tr.conn, err = net.DialUDP("udp", nil, udpAddr)
-	if err != nil {
-		return errors.Wrap(err, "udpConnect")
+	client := tr.udp
+	if client == nil { // Trackers used outside of Run, such as for scrapes, may not have the session's client
+		if client, err = udptracker.New(); err != nil {
+			return nil, nil, errors.Wrap(err, "udpRequest")
+		}
+		defer client.Close()
 	}
 
-	// Request
-	req := make([]byte, 16)
-	connectionID := uint64(0x41727101980)
-	action := uint32(0)
-	binary.BigEndian.PutUint64(req[0:8], connectionID) // Protocol ID
-	binary.BigEndian.PutUint32(req[8:12], action)      // Action: Connection
-	binary.BigEndian.PutUint32(req[12:16], tr.txID)    // Transaction ID
-	_, err = tr.conn.Write(req)
-	if err != nil {
-		return errors.Wrap(err, "udpConnect")
+	resp, err := client.Request(ctx, addr, action, body)
+	var trackerErr *udptracker.TrackerError
+	if errors.As(err, &trackerErr) {
+		tr.Failure = trackerErr.Message
+		log.WithFields(log.Fields{"tracker": tr.Announce, "message": trackerErr.Message}).Debug("Got error message from tracker")
 	}
+	return resp, addr, errors.Wrap(err, "udpRequest")
+}
 
-	// Response
-	resp := make([]byte, 16)
-	bytesRead, err := tr.conn.Read(resp)
-	if err != nil {
-		return errors.Wrap(err, "udpConnect")
-	} else if bytesRead < 16 {
-		return errors.Wrap(ErrSize, "udpConnect")
-	}
-	action = binary.BigEndian.Uint32(resp[0:4])   // Action
-	txID := binary.BigEndian.Uint32(resp[4:8])    // Transaction ID
-	tr.cnID = binary.BigEndian.Uint64(resp[8:16]) // Connection ID
-
-	// Verify response
-	if action == 3 {
-		errorString := string(resp[8:])
-		log.WithFields(log.Fields{"tracker": tr.Announce, "message": errorString}).Debug("Got error message from tracker")
-		return errors.Wrap(ErrTrackerError, "udpConnect")
-	} else if action != 0 {
-		return errors.Wrap(ErrAction, "udpConnect")
-	} else if txID != tr.txID {
-		return errors.Wrap(ErrTransaction, "udpConnect")
+// udpPeers parses the peers of an announce response, trackers reached over IPv6 respond with IPv6 peers (BEP 15)
+func udpPeers(addr *net.UDPAddr, peersBytes []byte, info *common.TorrentInfo) ([]peer.Peer, error) {
+	if addr.IP.To4() == nil {
+		return peer.Unmarshal6(peersBytes, info)
 	}
-	return nil
+	return peer.Unmarshal(peersBytes, info)
 }
 
-// buildPacket creates an announce packet for a corresponding event
-func (tr *Tracker) buildPacket(event string, info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) ([]byte, error) {
+// buildPacket creates the body of an announce request for a corresponding event, the client adds the header
+func (tr Tracker) buildPacket(event string, info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) ([]byte, error) {
 	var eventCode uint32
 	switch event {
 	case "announce":
@@ -99,193 +77,58 @@ func (tr *Tracker) buildPacket(event string, info *common.TorrentInfo, port uint
 	default:
 		return nil, errors.Wrap(ErrEvent, "buildPacket")
 	}
-	rand.Seed(time.Now().UnixNano())
-	key := rand.Uint32()
-
-	packet := make([]byte, 100)
-	binary.BigEndian.PutUint64(packet[0:8], tr.cnID)              // Connection ID
-	binary.BigEndian.PutUint32(packet[8:12], 1)                   // Action: Announce
-	binary.BigEndian.PutUint32(packet[12:16], tr.txID)            // Transaction ID
-	copy(packet[16:36], info.InfoHash[:])                         // Info Hash
-	copy(packet[36:56], info.PeerID[:])                           // Peer ID
-	binary.BigEndian.PutUint64(packet[56:64], uint64(downloaded)) // Downloaded
-	binary.BigEndian.PutUint64(packet[64:72], uint64(left))       // Left
-	binary.BigEndian.PutUint64(packet[72:80], uint64(uploaded))   // Uploaded
-	binary.BigEndian.PutUint32(packet[80:84], eventCode)          // Event
-	binary.BigEndian.PutUint32(packet[84:88], uint32(0))          // IP Address
-	binary.BigEndian.PutUint32(packet[88:92], key)                // Key
-	binary.BigEndian.PutUint32(packet[92:96], uint32(numWant))    // Max peers we want
-	binary.BigEndian.PutUint16(packet[96:98], port)               // Port
-	binary.BigEndian.PutUint16(packet[98:100], uint16(0))         // Extensions
-	return packet, nil
-}
-
-func (tr *Tracker) udpStarted(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) ([]peer.Peer, error) {
-	// Request
-	req, err := tr.buildPacket("started", info, port, uploaded, downloaded, left)
-	if err != nil {
-		return nil, errors.Wrap(err, "udpStarted")
-	}
-
-	_, err = tr.conn.Write(req)
-	if err != nil {
-		return nil, errors.Wrap(err, "udpStarted")
-	}
-
-	// Response
-	resp := make([]byte, 20+6*numWant)
-	bytesRead, err := tr.conn.Read(resp)
-	if err != nil {
-		return nil, errors.Wrap(err, "udpStarted")
-	} else if bytesRead < 20 {
-		return nil, errors.Wrap(ErrSize, "udpStarted")
-	}
-	action := binary.BigEndian.Uint32(resp[0:4])    // Action
-	txID := binary.BigEndian.Uint32(resp[4:8])      // Transaction ID
-	interval := binary.BigEndian.Uint32(resp[8:12]) // New tracker interval
-
-	// Verify response
-	if action == 3 {
-		errorString := string(resp[8:])
-		log.WithFields(log.Fields{"tracker": tr.Announce, "message": errorString}).Debug("Got error message from tracker")
-		return nil, errors.Wrap(ErrTrackerError, "udpStarted")
-	} else if action != 1 {
-		return nil, errors.Wrap(ErrAction, "udpStarted")
-	} else if txID != tr.txID {
-		return nil, errors.Wrap(ErrTransaction, "udpStarted")
-	}
-
-	// Update tracker information
-	tr.Interval = int(interval)
-
-	// Get peer information
-	peersBytes := resp[20:]
-	peersList, err := peer.Unmarshal(peersBytes, info)
-	return peersList, errors.Wrap(err, "udpStarted")
-}
-
-func (tr *Tracker) udpStopped(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) error {
-	// Request
-	req, err := tr.buildPacket("stopped", info, port, uploaded, downloaded, left)
-	if err != nil {
-		return errors.Wrap(err, "udpStopped")
-	}
 
-	_, err = tr.conn.Write(req)
-	if err != nil {
-		return errors.Wrap(err, "udpStopped")
-	}
-
-	// Response
-	resp := make([]byte, 20+6*numWant)
-	bytesRead, err := tr.conn.Read(resp)
-	if err != nil {
-		return errors.Wrap(err, "udpStopped")
-	} else if bytesRead < 20 {
-		return errors.Wrap(ErrSize, "udpStopped")
-	}
-	action := binary.BigEndian.Uint32(resp[0:4])    // Action
-	txID := binary.BigEndian.Uint32(resp[4:8])      // Transaction ID
-	interval := binary.BigEndian.Uint32(resp[8:12]) // New tracker interval
-
-	// Verify response
-	if action == 3 {
-		errorString := string(resp[8:])
-		log.WithFields(log.Fields{"tracker": tr.Announce, "message": errorString}).Debug("Got error message from tracker")
-		return errors.Wrap(ErrTrackerError, "udpStopped")
-	} else if action != 1 {
-		return errors.Wrap(ErrAction, "udpStopped")
-	} else if txID != tr.txID {
-		return errors.Wrap(ErrTransaction, "udpStopped")
-	}
-
-	// Update tracker information
-	tr.Interval = int(interval)
-
-	return nil
+	packet := make([]byte, 82)
+	copy(packet[0:20], info.InfoHash[:])                          // Info Hash
+	copy(packet[20:40], info.PeerID[:])                           // Peer ID
+	binary.BigEndian.PutUint64(packet[40:48], uint64(downloaded)) // Downloaded
+	binary.BigEndian.PutUint64(packet[48:56], uint64(left))       // Left
+	binary.BigEndian.PutUint64(packet[56:64], uint64(uploaded))   // Uploaded
+	binary.BigEndian.PutUint32(packet[64:68], eventCode)          // Event
+	binary.BigEndian.PutUint32(packet[68:72], uint32(0))          // IP Address
+	binary.BigEndian.PutUint32(packet[72:76], info.Key)           // Key
+	binary.BigEndian.PutUint32(packet[76:80], uint32(numWant))    // Max peers we want
+	binary.BigEndian.PutUint16(packet[80:82], port)               // Port
+	return append(packet, tr.urlData()...), nil
 }
 
-func (tr *Tracker) udpCompleted(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) error {
-	// Request
-	req, err := tr.buildPacket("completed", info, port, uploaded, downloaded, left)
-	if err != nil {
-		return errors.Wrap(err, "udpCompleted")
-	}
-
-	_, err = tr.conn.Write(req)
-	if err != nil {
-		return errors.Wrap(err, "udpCompleted")
-	}
-
-	// Response
-	resp := make([]byte, 20+6*numWant)
-	bytesRead, err := tr.conn.Read(resp)
-	if err != nil {
-		return errors.Wrap(err, "udpCompleted")
-	} else if bytesRead < 20 {
-		return errors.Wrap(ErrSize, "udpCompleted")
-	}
-	action := binary.BigEndian.Uint32(resp[0:4])    // Action
-	txID := binary.BigEndian.Uint32(resp[4:8])      // Transaction ID
-	interval := binary.BigEndian.Uint32(resp[8:12]) // New tracker interval
-
-	// Verify response
-	if action == 3 {
-		errorString := string(resp[8:])
-		log.WithFields(log.Fields{"tracker": tr.Announce, "message": errorString}).Debug("Got error message from tracker")
-		return errors.Wrap(ErrTrackerError, "udpCompleted")
-	} else if action != 1 {
-		return errors.Wrap(ErrAction, "udpCompleted")
-	} else if txID != tr.txID {
-		return errors.Wrap(ErrTransaction, "udpCompleted")
-	}
-
-	// Update tracker information
-	tr.Interval = int(interval)
-
-	return nil
+// urlData encodes the path and query of the announce URL as options (BEP 41), trackers can use them for passkeys
+func (tr Tracker) urlData() []byte {
+	base, err := url.Parse(tr.Announce)
+	if err != nil || (base.Path == "" && base.RawQuery == "") {
+		return nil
+	}
+	data := base.RequestURI()
+	var options []byte
+	for len(data) > 0 {
+		chunk := data[:common.Min(len(data), maxOptionLen)]
+		options = append(options, optionURLData, byte(len(chunk)))
+		options = append(options, chunk...)
+		data = data[len(chunk):]
+	}
+	return options
 }
 
-func (tr *Tracker) udpAnnounce(info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) ([]peer.Peer, error) {
+func (tr *Tracker) udpAnnounce(ctx context.Context, event string, info *common.TorrentInfo, port uint16, uploaded, downloaded, left int) ([]peer.Peer, error) {
 	// Request
-	req, err := tr.buildPacket("announce", info, port, uploaded, downloaded, left)
-	if err != nil {
-		return nil, errors.Wrap(err, "udpAnnounce")
-	}
-
-	_, err = tr.conn.Write(req)
+	req, err := tr.buildPacket(event, info, port, uploaded, downloaded, left)
 	if err != nil {
 		return nil, errors.Wrap(err, "udpAnnounce")
 	}
 
 	// Response
-	resp := make([]byte, 20+6*numWant)
-	bytesRead, err := tr.conn.Read(resp)
+	resp, addr, err := tr.udpRequest(ctx, udptracker.ActionAnnounce, req)
 	if err != nil {
 		return nil, errors.Wrap(err, "udpAnnounce")
-	} else if bytesRead < 20 {
+	} else if len(resp) < 12 {
 		return nil, errors.Wrap(ErrSize, "udpAnnounce")
 	}
-	action := binary.BigEndian.Uint32(resp[0:4])    // Action
-	txID := binary.BigEndian.Uint32(resp[4:8])      // Transaction ID
-	interval := binary.BigEndian.Uint32(resp[8:12]) // New tracker interval
-
-	// Verify response
-	if action == 3 {
-		errorString := string(resp[8:])
-		log.WithFields(log.Fields{"tracker": tr.Announce, "message": errorString}).Debug("Got error message from tracker")
-		return nil, errors.Wrap(ErrTrackerError, "udpAnnounce")
-	} else if action != 1 {
-		return nil, errors.Wrap(ErrAction, "udpAnnounce")
-	} else if txID != tr.txID {
-		return nil, errors.Wrap(ErrTransaction, "udpAnnounce")
-	}
+	interval := binary.BigEndian.Uint32(resp[0:4]) // New tracker interval
 
 	// Update tracker information
 	tr.Interval = int(interval)
 
 	// Get peer information
-	peersBytes := resp[20:]
-	peersList, err := peer.Unmarshal(peersBytes, info)
-	return peersList, errors.Wrap(err, "udpStarted")
+	peersList, err := udpPeers(addr, resp[12:], info)
+	return peersList, errors.Wrap(err, "udpAnnounce")
 }
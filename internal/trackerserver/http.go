@@ -0,0 +1,136 @@
+package trackerserver
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	bencode "github.com/jackpal/bencode-go"
+	"github.com/kylec725/graytorrent/internal/peer"
+	"github.com/kylec725/graytorrent/internal/tracker"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const compactLen6 = 18 // Length of an IPv6 compact peer
+
+// parseAnnounce reads the parameters of an HTTP announce, the peer's IP is the address the request came from
+func parseAnnounce(r *http.Request) (announce, error) {
+	params := r.URL.Query()
+	var req announce
+	infoHash := params.Get("info_hash")
+	req.peerID = params.Get("peer_id")
+	if len(infoHash) != 20 || len(req.peerID) != 20 {
+		return announce{}, ErrBadRequest
+	}
+	copy(req.infoHash[:], infoHash)
+
+	port, err := strconv.ParseUint(params.Get("port"), 10, 16)
+	if err != nil {
+		return announce{}, ErrBadRequest
+	}
+	req.port = uint16(port)
+	if req.left, err = strconv.Atoi(params.Get("left")); err != nil {
+		return announce{}, ErrBadRequest
+	}
+	req.event = params.Get("event")
+	req.numWant, _ = strconv.Atoi(params.Get("numwant")) // Optional
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return announce{}, ErrBadRequest
+	}
+	req.ip = net.ParseIP(host)
+	return req, nil
+}
+
+func (s *Server) handleAnnounce(w http.ResponseWriter, r *http.Request) {
+	req, err := parseAnnounce(r)
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+	peers, scrape, err := s.announce(req, func(string) bool { return true })
+	if err != nil {
+		writeFailure(w, err)
+		return
+	}
+
+	resp := map[string]interface{}{
+		"interval":   int(s.interval.Seconds()),
+		"complete":   scrape.Complete,
+		"incomplete": scrape.Incomplete,
+	}
+	if r.URL.Query().Get("compact") == "0" {
+		list := make([]interface{}, 0, len(peers))
+		for _, p := range peers {
+			host, port, _ := net.SplitHostPort(p.addr)
+			portNum, _ := strconv.Atoi(port)
+			list = append(list, map[string]interface{}{"peer id": p.id, "ip": host, "port": portNum})
+		}
+		resp["peers"] = list
+	} else {
+		var peers4, peers6 []byte
+		for _, p := range peers {
+			compact, _ := peer.CompactAddr(p.addr)
+			if len(compact) == compactLen6 {
+				peers6 = append(peers6, compact...)
+			} else {
+				peers4 = append(peers4, compact...)
+			}
+		}
+		resp["peers"] = string(peers4)
+		if len(peers6) > 0 {
+			resp["peers6"] = string(peers6)
+		}
+	}
+	writeResponse(w, resp)
+}
+
+// handleScrape returns the statistics of the requested torrents, or of every torrent if none are requested
+func (s *Server) handleScrape(w http.ResponseWriter, r *http.Request) {
+	var scrapes map[[20]byte]tracker.Scrape
+	if infoHashes, ok := r.URL.Query()["info_hash"]; ok {
+		scrapes = make(map[[20]byte]tracker.Scrape)
+		for _, value := range infoHashes {
+			var infoHash [20]byte
+			if len(value) != 20 {
+				writeFailure(w, ErrBadRequest)
+				return
+			}
+			copy(infoHash[:], value)
+			if s.tracked(infoHash) {
+				scrapes[infoHash], _ = s.Scrape(infoHash) // Torrents no one has announced yet have empty swarms
+			}
+		}
+	} else {
+		scrapes = s.scrapeAll()
+	}
+
+	files := make(map[string]interface{}, len(scrapes))
+	for infoHash, scrape := range scrapes {
+		files[string(infoHash[:])] = map[string]interface{}{
+			"complete":   scrape.Complete,
+			"downloaded": scrape.Downloaded,
+			"incomplete": scrape.Incomplete,
+		}
+	}
+	writeResponse(w, map[string]interface{}{"files": files})
+}
+
+// tracked checks if a torrent is on the allow-list
+func (s *Server) tracked(infoHash [20]byte) bool {
+	return s.allowed == nil || s.allowed[infoHash]
+}
+
+// writeFailure responds with a failure reason, which clients read regardless of the status code
+func writeFailure(w http.ResponseWriter, err error) {
+	writeResponse(w, map[string]interface{}{"failure reason": err.Error()})
+}
+
+func writeResponse(w http.ResponseWriter, resp map[string]interface{}) {
+	w.Header().Set("Content-Type", "text/plain")
+	if err := bencode.Marshal(w, resp); err != nil {
+		log.WithField("error", errors.Wrap(err, "writeResponse").Error()).Debug("Failed to send tracker response")
+	}
+}
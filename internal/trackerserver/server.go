@@ -0,0 +1,254 @@
+/*
+Package trackerserver is a BitTorrent tracker that answers HTTP announces and
+scrapes (BEP 3, BEP 48) and UDP connects, announces and scrapes (BEP 15). The
+swarms are only kept in memory, and the tracker can be limited to an
+allow-list of infohashes.
+*/
+package trackerserver
+
+import (
+	"crypto/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/peer"
+	"github.com/kylec725/graytorrent/internal/tracker"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultInterval = 30 * time.Minute
+const defaultNumWant = 50
+const maxNumWant = 200
+const maxSwarmPeers = 2000 // Peers kept in a swarm, announces from more peers are answered without recording them
+
+// Errors
+var (
+	ErrNotAllowed = errors.New("Torrent is not tracked")
+	ErrBadRequest = errors.New("Malformed announce request")
+)
+
+// swarmPeer is a peer that announced a torrent
+type swarmPeer struct {
+	id       string
+	addr     string
+	complete bool // Seeders have nothing left to download
+	lastSeen time.Time
+}
+
+// swarm holds the peers of a torrent by peer ID
+type swarm struct {
+	peers      map[string]*swarmPeer
+	downloaded int // Completed events received
+}
+
+// announce is an announce request from either protocol
+type announce struct {
+	infoHash [20]byte
+	peerID   string
+	ip       net.IP
+	port     uint16
+	left     int
+	event    string
+	numWant  int
+}
+
+// Server is a tracker listening for HTTP announces over TCP and UDP announces on the same port number
+type Server struct {
+	interval time.Duration     // Time peers are told to wait between announces, they are dropped after missing two
+	allowed  map[[20]byte]bool // nil if every torrent is tracked
+	mu       sync.Mutex
+	swarms   map[[20]byte]*swarm
+	secret   []byte // Key for connection IDs handed out to UDP clients
+	listener net.Listener
+	http     *http.Server
+	conn     *net.UDPConn
+	done     chan struct{}
+}
+
+// New starts a tracker on addr that asks peers to announce every interval, or every 30 minutes if it is zero. If allowed is
+// not empty only the torrents with those infohashes are tracked
+func New(addr string, interval time.Duration, allowed [][20]byte) (*Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "New")
+	}
+	udpAddr := &net.UDPAddr{Port: listener.Addr().(*net.TCPAddr).Port} // The same port as HTTP when addr asks for any port
+	if host, _, err := net.SplitHostPort(addr); err == nil && host != "" {
+		udpAddr.IP = net.ParseIP(host)
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		listener.Close()
+		return nil, errors.Wrap(err, "New")
+	}
+
+	s := &Server{
+		interval: interval,
+		swarms:   make(map[[20]byte]*swarm),
+		secret:   make([]byte, 20),
+		listener: listener,
+		conn:     conn,
+		done:     make(chan struct{}),
+	}
+	rand.Read(s.secret)
+	if s.interval <= 0 {
+		s.interval = defaultInterval
+	}
+	if len(allowed) > 0 {
+		s.allowed = make(map[[20]byte]bool)
+		for _, infoHash := range allowed {
+			s.allowed[infoHash] = true
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/announce", s.handleAnnounce)
+	mux.HandleFunc("/scrape", s.handleScrape)
+	s.http = &http.Server{Handler: mux}
+	go s.http.Serve(listener)
+	go s.udpListen()
+	go s.expire()
+
+	log.WithField("addr", listener.Addr().String()).Info("Tracker started")
+	return s, nil
+}
+
+// Close stops the tracker
+func (s *Server) Close() error {
+	select {
+	case <-s.done:
+		return nil
+	default:
+	}
+	close(s.done)
+	s.conn.Close()
+	return s.http.Close()
+}
+
+// Scrape returns the statistics of a torrent's swarm, false if no peers have announced it
+func (s *Server) Scrape(infoHash [20]byte) (tracker.Scrape, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sw, ok := s.swarm(infoHash, false)
+	if !ok {
+		return tracker.Scrape{}, false
+	}
+	return sw.scrape(), true
+}
+
+// scrapeAll returns the statistics of every swarm
+func (s *Server) scrapeAll() map[[20]byte]tracker.Scrape {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scrapes := make(map[[20]byte]tracker.Scrape, len(s.swarms))
+	for infoHash := range s.swarms {
+		sw, _ := s.swarm(infoHash, false)
+		scrapes[infoHash] = sw.scrape()
+	}
+	return scrapes
+}
+
+// expire drops the peers that stopped announcing and the swarms they leave empty every interval, so that announces for
+// torrents no one shares don't pile up
+func (s *Server) expire() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			for infoHash := range s.swarms {
+				if sw, _ := s.swarm(infoHash, false); len(sw.peers) == 0 {
+					delete(s.swarms, infoHash)
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// swarm returns a torrent's swarm without the peers that stopped announcing, creating it if create is set, s.mu must be held
+func (s *Server) swarm(infoHash [20]byte, create bool) (*swarm, bool) {
+	sw, ok := s.swarms[infoHash]
+	if !ok {
+		if !create {
+			return nil, false
+		}
+		sw = &swarm{peers: make(map[string]*swarmPeer)}
+		s.swarms[infoHash] = sw
+	}
+	for id, p := range sw.peers {
+		if time.Since(p.lastSeen) > 2*s.interval {
+			delete(sw.peers, id)
+		}
+	}
+	return sw, true
+}
+
+func (sw *swarm) scrape() tracker.Scrape {
+	scrape := tracker.Scrape{Downloaded: sw.downloaded}
+	for _, p := range sw.peers {
+		if p.complete {
+			scrape.Complete++
+		} else {
+			scrape.Incomplete++
+		}
+	}
+	return scrape
+}
+
+// announce records a peer's announce and returns other peers in the swarm along with its statistics, wanted decides
+// which peers can be returned to the requester
+func (s *Server) announce(req announce, wanted func(addr string) bool) ([]swarmPeer, tracker.Scrape, error) {
+	if !s.tracked(req.infoHash) {
+		return nil, tracker.Scrape{}, ErrNotAllowed
+	} else if req.port == 0 || req.ip == nil {
+		return nil, tracker.Scrape{}, ErrBadRequest
+	}
+	if req.numWant <= 0 {
+		req.numWant = defaultNumWant
+	} else if req.numWant > maxNumWant {
+		req.numWant = maxNumWant
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sw, ok := s.swarm(req.infoHash, req.event != "stopped")
+	if !ok { // Stopping doesn't start a swarm
+		return nil, tracker.Scrape{}, nil
+	}
+	addr := peer.JoinAddr(req.ip, req.port)
+	switch req.event {
+	case "stopped": // Only the peer that announced the peer ID can remove it
+		if p, ok := sw.peers[req.peerID]; ok && p.addr == addr {
+			delete(sw.peers, req.peerID)
+		}
+	case "completed":
+		sw.downloaded++
+		fallthrough
+	default:
+		if _, ok := sw.peers[req.peerID]; ok || len(sw.peers) < maxSwarmPeers {
+			sw.peers[req.peerID] = &swarmPeer{
+				id:       req.peerID,
+				addr:     addr,
+				complete: req.left == 0,
+				lastSeen: time.Now(),
+			}
+		}
+	}
+
+	var peers []swarmPeer
+	for id, p := range sw.peers { // Map order picks a different set of peers each time
+		if len(peers) == req.numWant {
+			break
+		} else if id != req.peerID && wanted(p.addr) {
+			peers = append(peers, *p)
+		}
+	}
+	return peers, sw.scrape(), nil
+}
@@ -0,0 +1,200 @@
+package trackerserver
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	bencode "github.com/jackpal/bencode-go"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/tracker"
+	"github.com/kylec725/graytorrent/internal/udptracker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testHash    = [20]byte{1, 2, 3}
+	otherHash   = [20]byte{4, 5, 6}
+	testPeerID  = "-GT0001-aaaaaaaaaaaa"
+	otherPeerID = "-GT0001-bbbbbbbbbbbb"
+)
+
+func newServer(t *testing.T, interval time.Duration, allowed ...[20]byte) *Server {
+	s, err := New("127.0.0.1:0", interval, allowed)
+	require.Nil(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// httpAnnounce sends an HTTP announce and returns the decoded response
+func httpAnnounce(t *testing.T, s *Server, infoHash [20]byte, peerID string, port, left int, event string, compact bool) map[string]interface{} {
+	params := url.Values{
+		"info_hash": []string{string(infoHash[:])},
+		"peer_id":   []string{peerID},
+		"port":      []string{strconv.Itoa(port)},
+		"left":      []string{strconv.Itoa(left)},
+		"event":     []string{event},
+	}
+	if !compact {
+		params.Set("compact", "0")
+	}
+	resp, err := http.Get("http://" + s.listener.Addr().String() + "/announce?" + params.Encode())
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	decoded, err := bencode.Decode(resp.Body)
+	require.Nil(t, err)
+	return decoded.(map[string]interface{})
+}
+
+// udpAnnounce sends a UDP announce and returns the response after its header
+func udpAnnounce(t *testing.T, c *udptracker.Client, s *Server, peerID string, port uint16, left uint64, event uint32) ([]byte, error) {
+	body := make([]byte, 84)
+	copy(body[0:20], testHash[:])
+	copy(body[20:40], peerID)
+	binary.BigEndian.PutUint64(body[48:56], left)
+	binary.BigEndian.PutUint32(body[64:68], event)
+	binary.BigEndian.PutUint32(body[76:80], 0xffffffff) // Default number of peers
+	binary.BigEndian.PutUint16(body[80:82], port)
+	return c.Request(context.Background(), s.conn.LocalAddr().(*net.UDPAddr), udptracker.ActionAnnounce, body)
+}
+
+func TestHTTP(t *testing.T) {
+	assert := assert.New(t)
+	s := newServer(t, 0)
+
+	resp := httpAnnounce(t, s, testHash, testPeerID, 6881, 0, "started", true)
+	assert.Equal(int64(defaultInterval.Seconds()), resp["interval"])
+	assert.Equal("", resp["peers"])
+
+	// Other peers are returned in either format, without the requester
+	resp = httpAnnounce(t, s, testHash, otherPeerID, 6882, 100, "started", true)
+	assert.Equal("\x7f\x00\x00\x01\x1a\xe1", resp["peers"])
+	assert.Equal(int64(1), resp["complete"])
+	assert.Equal(int64(1), resp["incomplete"])
+	resp = httpAnnounce(t, s, testHash, otherPeerID, 6882, 0, "completed", false)
+	assert.Equal([]interface{}{map[string]interface{}{"peer id": testPeerID, "ip": "127.0.0.1", "port": int64(6881)}}, resp["peers"])
+
+	// Our own client can scrape it
+	info := &common.TorrentInfo{InfoHash: testHash}
+	scrape, err := tracker.New("http://"+s.listener.Addr().String()+"/announce").Scrape(context.Background(), info)
+	assert.Nil(err)
+	assert.Equal(tracker.Scrape{Complete: 2, Downloaded: 1, Incomplete: 0}, scrape)
+
+	httpAnnounce(t, s, testHash, otherPeerID, 6882, 0, "stopped", true)
+	scrape, _ = s.Scrape(testHash)
+	assert.Equal(1, scrape.Complete)
+
+	// Malformed announces are refused
+	resp = httpAnnounce(t, s, testHash, "short", 6881, 0, "", true)
+	assert.Equal(ErrBadRequest.Error(), resp["failure reason"])
+}
+
+func TestUDP(t *testing.T) {
+	assert := assert.New(t)
+	s := newServer(t, 0)
+	c, err := udptracker.New()
+	require.Nil(t, err)
+	defer c.Close()
+	c.Timeout = 100 * time.Millisecond
+
+	resp, err := udpAnnounce(t, c, s, testPeerID, 6881, 100, 2)
+	require.Nil(t, err)
+	assert.Equal(uint32(defaultInterval.Seconds()), binary.BigEndian.Uint32(resp[0:4]))
+	assert.Len(resp, 12)
+
+	resp, err = udpAnnounce(t, c, s, otherPeerID, 6882, 0, 1)
+	require.Nil(t, err)
+	assert.Equal(uint32(1), binary.BigEndian.Uint32(resp[4:8]))  // Leechers
+	assert.Equal(uint32(1), binary.BigEndian.Uint32(resp[8:12])) // Seeders
+	assert.Equal([]byte{127, 0, 0, 1, 0x1a, 0xe1}, resp[12:])
+
+	info := &common.TorrentInfo{InfoHash: testHash}
+	scrape, err := tracker.New("udp://"+s.conn.LocalAddr().String()+"/announce").Scrape(context.Background(), info)
+	assert.Nil(err)
+	assert.Equal(tracker.Scrape{Complete: 1, Downloaded: 1, Incomplete: 1}, scrape)
+
+	// Connection IDs from the tracker are required
+	packet := make([]byte, 36)
+	binary.BigEndian.PutUint64(packet[0:8], 1234)                     // Connection ID
+	binary.BigEndian.PutUint32(packet[8:12], udptracker.ActionScrape) // Action
+	binary.BigEndian.PutUint32(packet[12:16], 7)                      // Transaction ID
+	packet = s.udpHandle(packet, s.conn.LocalAddr().(*net.UDPAddr))
+	assert.Equal(udptracker.ActionError, binary.BigEndian.Uint32(packet[0:4]))
+	assert.Equal(uint32(7), binary.BigEndian.Uint32(packet[4:8]))
+	assert.Equal(ErrConnection.Error(), string(packet[8:]))
+}
+
+func TestAllowed(t *testing.T) {
+	assert := assert.New(t)
+	s := newServer(t, 0, otherHash)
+
+	resp := httpAnnounce(t, s, testHash, testPeerID, 6881, 0, "started", true)
+	assert.Equal(ErrNotAllowed.Error(), resp["failure reason"])
+	resp = httpAnnounce(t, s, otherHash, testPeerID, 6881, 0, "started", true)
+	assert.Nil(resp["failure reason"])
+
+	c, err := udptracker.New()
+	require.Nil(t, err)
+	defer c.Close()
+	_, err = udpAnnounce(t, c, s, testPeerID, 6881, 0, 2)
+	var trackerErr *udptracker.TrackerError
+	if assert.ErrorAs(err, &trackerErr) {
+		assert.Equal(ErrNotAllowed.Error(), trackerErr.Message)
+	}
+
+	info := &common.TorrentInfo{InfoHash: testHash}
+	_, err = tracker.New("http://"+s.listener.Addr().String()+"/announce").Scrape(context.Background(), info)
+	assert.ErrorIs(err, tracker.ErrScrapeNotFound)
+}
+
+func TestExpiry(t *testing.T) {
+	assert := assert.New(t)
+	s := newServer(t, 10*time.Millisecond)
+
+	httpAnnounce(t, s, testHash, testPeerID, 6881, 0, "started", true)
+	time.Sleep(30 * time.Millisecond)
+	resp := httpAnnounce(t, s, testHash, otherPeerID, 6882, 10, "started", true)
+	assert.Equal("", resp["peers"])
+	scrape, ok := s.Scrape(testHash)
+	assert.True(ok)
+	assert.Equal(tracker.Scrape{Incomplete: 1}, scrape)
+
+	// Swarms without peers are dropped
+	time.Sleep(50 * time.Millisecond)
+	s.mu.Lock()
+	assert.Empty(s.swarms)
+	s.mu.Unlock()
+}
+
+func TestSwarmLimits(t *testing.T) {
+	assert := assert.New(t)
+	s := newServer(t, 0)
+
+	// Peers can only be stopped from the address that announced them
+	httpAnnounce(t, s, testHash, testPeerID, 6881, 0, "started", true)
+	httpAnnounce(t, s, testHash, testPeerID, 6882, 0, "stopped", true)
+	scrape, _ := s.Scrape(testHash)
+	assert.Equal(1, scrape.Complete)
+	httpAnnounce(t, s, otherHash, testPeerID, 6881, 0, "stopped", true)
+	_, ok := s.Scrape(otherHash)
+	assert.False(ok)
+
+	// Full swarms still answer announces without recording new peers
+	s.mu.Lock()
+	sw, _ := s.swarm(testHash, false)
+	for i := len(sw.peers); i < maxSwarmPeers; i++ {
+		sw.peers[strconv.Itoa(i)] = &swarmPeer{id: strconv.Itoa(i), addr: "10.0.0.1:6881", complete: true, lastSeen: time.Now()}
+	}
+	s.mu.Unlock()
+	resp := httpAnnounce(t, s, testHash, otherPeerID, 6882, 10, "started", true)
+	assert.NotEmpty(resp["peers"])
+	scrape, _ = s.Scrape(testHash)
+	assert.Equal(maxSwarmPeers, scrape.Complete+scrape.Incomplete)
+	assert.Zero(scrape.Incomplete)
+}
@@ -0,0 +1,172 @@
+package trackerserver
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"net"
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/peer"
+	"github.com/kylec725/graytorrent/internal/udptracker"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const maxPacketSize = 4096
+const maxScrapes = 74 // Infohashes a UDP scrape can ask for
+const connectionLifetime = time.Minute
+
+// Errors
+var (
+	ErrConnection = errors.New("Connection ID is invalid or expired")
+	ErrAction     = errors.New("Unknown action")
+)
+
+func (s *Server) udpListen() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-s.done:
+				return
+			default:
+				continue
+			}
+		} else if n < 16 {
+			continue
+		}
+		if resp := s.udpHandle(buf[:n], addr); resp != nil {
+			if _, err := s.conn.WriteToUDP(resp, addr); err != nil {
+				log.WithFields(log.Fields{"addr": addr.String(), "error": err.Error()}).Debug("Failed to send UDP tracker response")
+			}
+		}
+	}
+}
+
+// udpHandle returns the response to a request, nil if it should be ignored
+func (s *Server) udpHandle(packet []byte, addr *net.UDPAddr) []byte {
+	id := binary.BigEndian.Uint64(packet[0:8])
+	action := binary.BigEndian.Uint32(packet[8:12])
+	txID := binary.BigEndian.Uint32(packet[12:16])
+
+	if action == udptracker.ActionConnect {
+		if id != udptracker.ProtocolID {
+			return nil
+		}
+		resp := udpHeader(udptracker.ActionConnect, txID, 8)
+		binary.BigEndian.PutUint64(resp[8:16], s.connectionID(addr, time.Now()))
+		return resp
+	}
+	// IDs are good for their current minute and the next one, so clients can use them for a full minute
+	now := time.Now()
+	if id != s.connectionID(addr, now) && id != s.connectionID(addr, now.Add(-connectionLifetime)) {
+		return udpError(txID, ErrConnection)
+	}
+
+	var resp []byte
+	var err error
+	switch action {
+	case udptracker.ActionAnnounce:
+		resp, err = s.udpAnnounce(packet[16:], addr)
+	case udptracker.ActionScrape:
+		resp, err = s.udpScrape(packet[16:])
+	default:
+		err = ErrAction
+	}
+	if err != nil {
+		return udpError(txID, err)
+	}
+	binary.BigEndian.PutUint32(resp[4:8], txID)
+	return resp
+}
+
+// connectionID derives the connection ID of an address for the minute of t, so that IDs don't need to be stored
+func (s *Server) connectionID(addr *net.UDPAddr, t time.Time) uint64 {
+	var buf bytes.Buffer
+	buf.Write(s.secret)
+	buf.WriteString(addr.String())
+	binary.Write(&buf, binary.BigEndian, t.Unix()/int64(connectionLifetime.Seconds()))
+	sum := sha1.Sum(buf.Bytes())
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// udpAnnounce answers an announce with peers of the same address family as the request (BEP 15)
+func (s *Server) udpAnnounce(body []byte, addr *net.UDPAddr) ([]byte, error) {
+	if len(body) < 82 {
+		return nil, ErrBadRequest
+	}
+	req := announce{
+		peerID:  string(body[20:40]),
+		ip:      addr.IP,
+		left:    int(binary.BigEndian.Uint64(body[48:56])),
+		numWant: int(int32(binary.BigEndian.Uint32(body[76:80]))), // -1 for the default
+		port:    binary.BigEndian.Uint16(body[80:82]),
+	}
+	copy(req.infoHash[:], body[0:20])
+	switch binary.BigEndian.Uint32(body[64:68]) {
+	case 1:
+		req.event = "completed"
+	case 2:
+		req.event = "started"
+	case 3:
+		req.event = "stopped"
+	}
+
+	compactLen := 6
+	if addr.IP.To4() == nil {
+		compactLen = compactLen6
+	}
+	peers, scrape, err := s.announce(req, func(peerAddr string) bool {
+		compact, ok := peer.CompactAddr(peerAddr)
+		return ok && len(compact) == compactLen
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp := udpHeader(udptracker.ActionAnnounce, 0, 12)
+	binary.BigEndian.PutUint32(resp[8:12], uint32(s.interval.Seconds())) // Interval
+	binary.BigEndian.PutUint32(resp[12:16], uint32(scrape.Incomplete))   // Leechers
+	binary.BigEndian.PutUint32(resp[16:20], uint32(scrape.Complete))     // Seeders
+	for _, p := range peers {
+		compact, _ := peer.CompactAddr(p.addr)
+		resp = append(resp, compact...)
+	}
+	return resp, nil
+}
+
+func (s *Server) udpScrape(body []byte) ([]byte, error) {
+	numHashes := len(body) / 20
+	if numHashes == 0 || numHashes > maxScrapes {
+		return nil, ErrBadRequest
+	}
+
+	resp := udpHeader(udptracker.ActionScrape, 0, 12*numHashes)
+	for i := 0; i < numHashes; i++ {
+		var infoHash [20]byte
+		copy(infoHash[:], body[i*20:(i+1)*20])
+		if !s.tracked(infoHash) {
+			return nil, ErrNotAllowed
+		}
+		scrape, _ := s.Scrape(infoHash)
+		entry := resp[8+12*i : 8+12*(i+1)]
+		binary.BigEndian.PutUint32(entry[0:4], uint32(scrape.Complete))    // Seeders
+		binary.BigEndian.PutUint32(entry[4:8], uint32(scrape.Downloaded))  // Completed
+		binary.BigEndian.PutUint32(entry[8:12], uint32(scrape.Incomplete)) // Leechers
+	}
+	return resp, nil
+}
+
+// udpHeader creates a response with its action and transaction ID followed by size bytes
+func udpHeader(action, txID uint32, size int) []byte {
+	resp := make([]byte, 8+size)
+	binary.BigEndian.PutUint32(resp[0:4], action)
+	binary.BigEndian.PutUint32(resp[4:8], txID)
+	return resp
+}
+
+func udpError(txID uint32, err error) []byte {
+	return append(udpHeader(udptracker.ActionError, txID, 0), err.Error()...)
+}
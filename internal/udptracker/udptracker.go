@@ -0,0 +1,231 @@
+/*
+Package udptracker is a client for UDP trackers (BEP 15) that is shared by
+every torrent in a session. Transactions are multiplexed over one socket,
+connection IDs are cached per tracker for their one minute lifetime, and
+requests are retransmitted on BEP 15's timeout schedule.
+*/
+package udptracker
+
+import (
+	"context"
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/pkg/errors"
+)
+
+const ProtocolID = 0x41727101980 // Magic constant sent in place of a connection ID when connecting
+const connectionLifetime = time.Minute
+const maxPacketSize = 4096
+const defaultRetries = 2 // BEP 15 allows up to 8, we give up sooner so that the next tracker in the tier gets a chance
+
+// Actions
+const (
+	ActionConnect  uint32 = 0
+	ActionAnnounce uint32 = 1
+	ActionScrape   uint32 = 2
+	ActionError    uint32 = 3
+)
+
+// Errors
+var (
+	ErrTimeout = errors.New("UDP tracker did not respond")
+	ErrAction  = errors.New("Got wrong action code from the tracker")
+	ErrSize    = errors.New("Got packet with unexpected size")
+	ErrClosed  = errors.New("UDP tracker client is closed")
+)
+
+// TrackerError is an error message sent by a tracker
+type TrackerError struct {
+	Message string
+}
+
+func (e *TrackerError) Error() string {
+	return "Received an error message from the tracker: " + e.Message
+}
+
+// connection is a connection ID given by a tracker
+type connection struct {
+	id      uint64
+	expires time.Time
+}
+
+// Client sends requests to UDP trackers over a single socket
+type Client struct {
+	Timeout time.Duration // Time to wait for the first attempt, doubled for each retransmission
+	Retries int           // Retransmissions before giving up
+
+	conn        *net.UDPConn
+	mu          sync.Mutex
+	transaction map[uint32]chan []byte // Responses waited on by transaction ID
+	connections map[string]connection  // Connection IDs by tracker address
+	done        chan struct{}
+}
+
+// New opens a socket for talking to UDP trackers over IPv4 and IPv6
+func New() (*Client, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{})
+	if err != nil {
+		return nil, errors.Wrap(err, "New")
+	}
+	c := &Client{
+		Timeout:     15 * time.Second,
+		Retries:     defaultRetries,
+		conn:        conn,
+		transaction: make(map[uint32]chan []byte),
+		connections: make(map[string]connection),
+		done:        make(chan struct{}),
+	}
+	go c.listen()
+	return c, nil
+}
+
+// FromContext returns the session's UDP tracker client from the context, if there is one
+func FromContext(ctx context.Context) (*Client, bool) {
+	c, ok := ctx.Value(common.KeyUDPTracker).(*Client)
+	return c, ok && c != nil
+}
+
+// Close stops the client, requests waiting on a response fail
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+		return nil
+	default:
+	}
+	close(c.done)
+	return c.conn.Close()
+}
+
+// listen hands responses to the requests waiting on their transaction IDs
+func (c *Client) listen() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, _, err := c.conn.ReadFromUDP(buf)
+		if err != nil {
+			select {
+			case <-c.done:
+				return
+			default:
+				continue
+			}
+		} else if n < 8 {
+			continue
+		}
+		txID := binary.BigEndian.Uint32(buf[4:8])
+		c.mu.Lock()
+		if resp, ok := c.transaction[txID]; ok {
+			select {
+			case resp <- append([]byte{}, buf[:n]...):
+			default: // Already answered
+			}
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Request sends a request to a tracker, connecting first if we don't have a current connection ID, and returns the response
+// after its action and transaction ID. Requests are retransmitted after 15 * 2^n seconds, reconnecting if the connection ID expired
+func (c *Client) Request(ctx context.Context, addr *net.UDPAddr, action uint32, body []byte) ([]byte, error) {
+	for n := 0; n <= c.Retries; n++ {
+		id, ok := c.connectionID(addr)
+		if !ok {
+			resp, err := c.transact(ctx, addr, ProtocolID, ActionConnect, nil, n)
+			if errors.Is(err, ErrTimeout) {
+				continue
+			} else if err != nil {
+				return nil, errors.Wrap(err, "Request")
+			} else if len(resp) < 8 {
+				return nil, errors.Wrap(ErrSize, "Request")
+			}
+			id = binary.BigEndian.Uint64(resp[0:8])
+			c.mu.Lock()
+			c.connections[addr.String()] = connection{id: id, expires: time.Now().Add(connectionLifetime)}
+			c.mu.Unlock()
+		}
+
+		resp, err := c.transact(ctx, addr, id, action, body, n)
+		if errors.Is(err, ErrTimeout) {
+			continue
+		} else if err != nil {
+			var trackerErr *TrackerError
+			if errors.As(err, &trackerErr) {
+				c.forget(addr) // The connection ID may be why the tracker refused
+			}
+			return nil, errors.Wrap(err, "Request")
+		}
+		return resp, nil
+	}
+	return nil, errors.Wrap(ErrTimeout, "Request")
+}
+
+// connectionID returns the cached connection ID for a tracker if it hasn't expired
+func (c *Client) connectionID(addr *net.UDPAddr) (uint64, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cn, ok := c.connections[addr.String()]
+	if !ok || time.Now().After(cn.expires) {
+		delete(c.connections, addr.String())
+		return 0, false
+	}
+	return cn.id, true
+}
+
+func (c *Client) forget(addr *net.UDPAddr) {
+	c.mu.Lock()
+	delete(c.connections, addr.String())
+	c.mu.Unlock()
+}
+
+// transact sends one attempt of a request and waits for its response, the wait is the timeout doubled n times
+func (c *Client) transact(ctx context.Context, addr *net.UDPAddr, id uint64, action uint32, body []byte, n int) ([]byte, error) {
+	resp := make(chan []byte, 1)
+	c.mu.Lock()
+	txID := rand.Uint32()
+	for _, taken := c.transaction[txID]; taken; _, taken = c.transaction[txID] {
+		txID = rand.Uint32()
+	}
+	c.transaction[txID] = resp
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.transaction, txID)
+		c.mu.Unlock()
+	}()
+
+	packet := make([]byte, 16+len(body))
+	binary.BigEndian.PutUint64(packet[0:8], id)      // Connection ID
+	binary.BigEndian.PutUint32(packet[8:12], action) // Action
+	binary.BigEndian.PutUint32(packet[12:16], txID)  // Transaction ID
+	copy(packet[16:], body)
+	if _, err := c.conn.WriteToUDP(packet, addr); err != nil {
+		return nil, errors.Wrap(err, "transact")
+	}
+
+	timer := time.NewTimer(c.Timeout << n)
+	defer timer.Stop()
+	select {
+	case packet = <-resp:
+	case <-timer.C:
+		return nil, errors.Wrap(ErrTimeout, "transact")
+	case <-ctx.Done():
+		return nil, errors.Wrap(ctx.Err(), "transact")
+	case <-c.done:
+		return nil, errors.Wrap(ErrClosed, "transact")
+	}
+
+	switch binary.BigEndian.Uint32(packet[0:4]) {
+	case action:
+		return packet[8:], nil
+	case ActionError:
+		return nil, errors.Wrap(&TrackerError{Message: string(packet[8:])}, "transact")
+	default:
+		return nil, errors.Wrap(ErrAction, "transact")
+	}
+}
@@ -0,0 +1,181 @@
+package udptracker
+
+import (
+	"context"
+	"encoding/binary"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeTracker answers connects with a connection ID and echoes the body of other requests back, it can drop packets and refuse requests
+type fakeTracker struct {
+	conn     net.PacketConn
+	mu       sync.Mutex
+	connects int
+	requests int
+	drop     int    // Packets to ignore before answering
+	refuse   string // Error message sent for requests other than connects
+}
+
+func newFakeTracker(t *testing.T) *fakeTracker {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.Nil(t, err)
+	tr := &fakeTracker{conn: conn}
+	go tr.serve()
+	t.Cleanup(func() { conn.Close() })
+	return tr
+}
+
+func (tr *fakeTracker) addr() *net.UDPAddr {
+	return tr.conn.LocalAddr().(*net.UDPAddr)
+}
+
+func (tr *fakeTracker) serve() {
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := tr.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		id := binary.BigEndian.Uint64(buf[0:8])
+		action := binary.BigEndian.Uint32(buf[8:12])
+
+		tr.mu.Lock()
+		if tr.drop > 0 {
+			tr.drop--
+			tr.mu.Unlock()
+			continue
+		}
+		resp := make([]byte, 8, 16+n)
+		copy(resp[4:8], buf[12:16]) // Transaction ID
+		switch {
+		case action == ActionConnect && id == ProtocolID:
+			tr.connects++
+			resp = append(resp, 0, 0, 0, 0, 0, 0, 0x12, 0x34)
+		case tr.refuse != "" || id != 0x1234:
+			binary.BigEndian.PutUint32(resp[0:4], ActionError)
+			resp = append(resp, tr.refuse...)
+		default:
+			tr.requests++
+			binary.BigEndian.PutUint32(resp[0:4], action)
+			resp = append(resp, buf[16:n]...)
+		}
+		tr.mu.Unlock()
+		tr.conn.WriteTo(resp, addr)
+	}
+}
+
+func (tr *fakeTracker) counts() (int, int) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	return tr.connects, tr.requests
+}
+
+func newClient(t *testing.T) *Client {
+	c, err := New()
+	require.Nil(t, err)
+	c.Timeout = 20 * time.Millisecond
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestRequest(t *testing.T) {
+	assert := assert.New(t)
+	tracker := newFakeTracker(t)
+	c := newClient(t)
+	ctx := context.Background()
+
+	resp, err := c.Request(ctx, tracker.addr(), ActionAnnounce, []byte("first"))
+	assert.Nil(err)
+	assert.Equal([]byte("first"), resp)
+
+	// Many torrents share the socket and the cached connection ID
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := []byte{byte(i)}
+			resp, err := c.Request(ctx, tracker.addr(), ActionScrape, body)
+			assert.Nil(err)
+			assert.Equal(body, resp)
+		}(i)
+	}
+	wg.Wait()
+	connects, requests := tracker.counts()
+	assert.Equal(1, connects)
+	assert.Equal(51, requests)
+
+	// Expired connection IDs are requested again
+	c.mu.Lock()
+	cn := c.connections[tracker.addr().String()]
+	cn.expires = time.Now().Add(-time.Second)
+	c.connections[tracker.addr().String()] = cn
+	c.mu.Unlock()
+	_, err = c.Request(ctx, tracker.addr(), ActionAnnounce, nil)
+	assert.Nil(err)
+	connects, _ = tracker.counts()
+	assert.Equal(2, connects)
+}
+
+func TestRequestRetries(t *testing.T) {
+	assert := assert.New(t)
+	tracker := newFakeTracker(t)
+	c := newClient(t)
+
+	// Lost packets are sent again after each timeout, which doubles every time
+	tracker.mu.Lock()
+	tracker.drop = 2
+	tracker.mu.Unlock()
+	start := time.Now()
+	resp, err := c.Request(context.Background(), tracker.addr(), ActionAnnounce, []byte("late"))
+	assert.Nil(err)
+	assert.Equal([]byte("late"), resp)
+	assert.GreaterOrEqual(time.Since(start), c.Timeout+2*c.Timeout)
+
+	// The client gives up after its retries
+	tracker.mu.Lock()
+	tracker.drop = c.Retries + 1
+	tracker.mu.Unlock()
+	c.forget(tracker.addr())
+	_, err = c.Request(context.Background(), tracker.addr(), ActionAnnounce, nil)
+	assert.ErrorIs(err, ErrTimeout)
+
+	// Waiting stops with the context
+	tracker.mu.Lock()
+	tracker.drop = 1
+	tracker.mu.Unlock()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = c.Request(ctx, tracker.addr(), ActionAnnounce, nil)
+	assert.ErrorIs(err, context.Canceled)
+}
+
+func TestRequestRefused(t *testing.T) {
+	assert := assert.New(t)
+	tracker := newFakeTracker(t)
+	c := newClient(t)
+
+	tracker.mu.Lock()
+	tracker.refuse = "torrent not registered"
+	tracker.mu.Unlock()
+	_, err := c.Request(context.Background(), tracker.addr(), ActionAnnounce, nil)
+	var trackerErr *TrackerError
+	if assert.True(errors.As(err, &trackerErr)) {
+		assert.Equal("torrent not registered", trackerErr.Message)
+	}
+
+	// The connection ID is dropped in case it is why the tracker refused
+	_, ok := c.connectionID(tracker.addr())
+	assert.False(ok)
+
+	c.Close()
+	_, err = c.Request(context.Background(), tracker.addr(), ActionAnnounce, nil)
+	assert.NotNil(err)
+}
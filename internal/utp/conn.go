@@ -0,0 +1,497 @@
+package utp
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const maxPayload = 1200                       // Payload bytes per packet, keeps packets under common path MTUs
+const recvWindow = 1 << 20                    // Receive buffer size that we advertise
+const ccontrolTarget = 100 * time.Millisecond // Queuing delay LEDBAT aims for
+const maxCwndIncrease = 3000                  // Max bytes the congestion window grows by per RTT
+const minWindow = 2 * maxPayload              // Smallest congestion window
+const initialTimeout = time.Second            // Retransmit timeout before the RTT is known
+const minTimeout = 500 * time.Millisecond     // Smallest retransmit timeout
+const maxTransmits = 8                        // Transmissions of a packet before the connection is dropped
+const tickInterval = 50 * time.Millisecond    // How often to check for timeouts
+const baseDelayInterval = time.Minute         // How long each base delay measurement lasts
+const closeLinger = 10 * time.Second          // How long a closed connection waits for its data to be acked
+const maxOutOfOrder = recvWindow / maxPayload // Max packets buffered ahead of a gap
+
+// Connection states
+const (
+	csSynSent = iota
+	csConnected
+	csClosed
+)
+
+// Errors
+var (
+	ErrReset   = errors.New("Connection reset by peer")
+	ErrTimeout = errors.New("Connection timed out")
+	ErrClosed  = errors.New("Use of closed uTP connection")
+)
+
+// timeoutError is returned when a deadline passes, it satisfies net.Error
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "uTP i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+type outPacket struct {
+	typ       uint8
+	seqNr     uint16
+	payload   []byte
+	sent      time.Time
+	transmits int
+}
+
+// Conn is a uTP connection, it provides a reliable ordered stream like TCP while backing off when it sees queuing delay
+type Conn struct {
+	socket *Socket
+	addr   net.Addr
+	recvID uint16 // Connection ID of packets we receive
+	sendID uint16 // Connection ID of packets we send
+
+	mu    sync.Mutex
+	state int
+	err   error // Set once the connection fails
+	seqNr uint16
+	ackNr uint16
+
+	// Sending
+	inflight   []*outPacket // Unacknowledged packets in sequence order
+	curWindow  int          // Payload bytes in flight
+	maxWindow  float64      // Congestion window in bytes
+	peerWindow int
+	lastAck    uint16
+	dupAcks    int
+	rtt        time.Duration
+	rttVar     time.Duration
+	rto        time.Duration
+	baseDelay  [2]uint32 // Min delay measured in the previous and the current interval
+	baseStart  time.Time
+	replyDiff  uint32 // Delay of the last packet we received, echoed back to the peer
+	closing    bool
+	closedAt   time.Time
+
+	// Receiving
+	readBuf       bytes.Buffer
+	outOfOrder    map[uint16]*outPacket
+	outOfOrderLen int // Bytes of payload buffered in outOfOrder
+	eof           bool
+
+	connected chan struct{}
+	readable  chan struct{}
+	writable  chan struct{}
+	done      chan struct{} // Closed once the connection is torn down
+
+	readDeadline  time.Time
+	writeDeadline time.Time
+}
+
+func newConn(socket *Socket, addr net.Addr, recvID, sendID uint16) *Conn {
+	return &Conn{
+		socket:     socket,
+		addr:       addr,
+		recvID:     recvID,
+		sendID:     sendID,
+		maxWindow:  minWindow,
+		peerWindow: maxPayload,
+		rto:        initialTimeout,
+		baseStart:  time.Now(),
+		outOfOrder: make(map[uint16]*outPacket),
+		connected:  make(chan struct{}),
+		readable:   make(chan struct{}, 1),
+		writable:   make(chan struct{}, 1),
+		done:       make(chan struct{}),
+	}
+}
+
+func notify(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
+
+// wait blocks until signalled, the deadline passes or the connection is torn down
+func (c *Conn) wait(ch chan struct{}, deadline time.Time) error {
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		d := time.Until(deadline)
+		if d <= 0 {
+			return timeoutError{}
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-c.done:
+		return nil // The caller sees the error set on teardown
+	case <-timeout:
+		return timeoutError{}
+	}
+}
+
+// Read reads data from the connection
+func (c *Conn) Read(b []byte) (int, error) {
+	for {
+		c.mu.Lock()
+		if c.readBuf.Len() > 0 {
+			n, _ := c.readBuf.Read(b)
+			c.mu.Unlock()
+			return n, nil
+		} else if c.eof {
+			c.mu.Unlock()
+			return 0, io.EOF
+		} else if c.err != nil {
+			err := c.err
+			c.mu.Unlock()
+			return 0, err
+		} else if c.closing {
+			c.mu.Unlock()
+			return 0, ErrClosed
+		}
+		deadline := c.readDeadline
+		c.mu.Unlock()
+
+		if err := c.wait(c.readable, deadline); err != nil {
+			return 0, err
+		}
+	}
+}
+
+// Write sends data over the connection, it blocks while the congestion window is full
+func (c *Conn) Write(b []byte) (int, error) {
+	written := 0
+	for written < len(b) {
+		c.mu.Lock()
+		if c.err != nil {
+			err := c.err
+			c.mu.Unlock()
+			return written, err
+		} else if c.closing {
+			c.mu.Unlock()
+			return written, ErrClosed
+		}
+
+		size := len(b) - written
+		if size > maxPayload {
+			size = maxPayload
+		}
+		if c.curWindow == 0 || c.curWindow+size <= c.window() {
+			c.send(stData, b[written:written+size])
+			written += size
+			c.mu.Unlock()
+			continue
+		}
+		deadline := c.writeDeadline
+		c.mu.Unlock()
+
+		if err := c.wait(c.writable, deadline); err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// window returns the number of bytes that may be in flight
+func (c *Conn) window() int {
+	if int(c.maxWindow) < c.peerWindow {
+		return int(c.maxWindow)
+	}
+	return c.peerWindow
+}
+
+// Close sends a FIN after any queued data, the connection lingers until it is acknowledged
+func (c *Conn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closing || c.state == csClosed {
+		return nil
+	}
+	c.closing = true
+	c.closedAt = time.Now()
+	if c.state == csConnected && c.err == nil {
+		c.send(stFin, nil)
+	} else {
+		c.teardown(ErrClosed)
+	}
+	notify(c.readable)
+	notify(c.writable)
+	return nil
+}
+
+// LocalAddr returns the address of the socket
+func (c *Conn) LocalAddr() net.Addr {
+	return c.socket.Addr()
+}
+
+// RemoteAddr returns the address of the peer
+func (c *Conn) RemoteAddr() net.Addr {
+	return c.addr
+}
+
+// SetDeadline sets the read and write deadlines
+func (c *Conn) SetDeadline(t time.Time) error {
+	c.SetReadDeadline(t)
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets when blocked reads time out
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.readDeadline = t
+	c.mu.Unlock()
+	notify(c.readable)
+	return nil
+}
+
+// SetWriteDeadline sets when blocked writes time out
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.writeDeadline = t
+	c.mu.Unlock()
+	notify(c.writable)
+	return nil
+}
+
+// send transmits a packet that takes up a sequence number and keeps it until it is acknowledged, c.mu must be held
+func (c *Conn) send(typ uint8, payload []byte) {
+	pkt := &outPacket{typ: typ, seqNr: c.seqNr, payload: append([]byte(nil), payload...)}
+	c.seqNr++
+	c.inflight = append(c.inflight, pkt)
+	c.curWindow += len(pkt.payload)
+	c.transmit(pkt)
+}
+
+// transmit sends or resends a packet, c.mu must be held
+func (c *Conn) transmit(pkt *outPacket) {
+	pkt.sent = time.Now()
+	pkt.transmits++
+	connID := c.sendID
+	if pkt.typ == stSyn {
+		connID = c.recvID
+	}
+	h := header{typ: pkt.typ, connID: connID, seqNr: pkt.seqNr, ackNr: c.ackNr}
+	c.write(h, pkt.payload)
+}
+
+// sendState acknowledges what we have received, c.mu must be held
+func (c *Conn) sendState() {
+	c.write(header{typ: stState, connID: c.sendID, seqNr: c.seqNr, ackNr: c.ackNr}, nil)
+}
+
+func (c *Conn) write(h header, payload []byte) {
+	h.timestamp = timestamp()
+	h.timestampDiff = c.replyDiff
+	if free := recvWindow - c.readBuf.Len(); free > 0 {
+		h.wndSize = uint32(free)
+	}
+	c.socket.writeTo(h.encode(payload), c.addr)
+}
+
+// handle processes a packet sent to this connection
+func (c *Conn) handle(h header, payload []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == csClosed {
+		return
+	}
+	c.replyDiff = timestamp() - h.timestamp
+	c.peerWindow = int(h.wndSize)
+
+	switch {
+	case h.typ == stReset:
+		c.teardown(ErrReset)
+		return
+	case c.state == csSynSent:
+		if h.typ != stState {
+			return
+		}
+		c.state = csConnected
+		c.ackNr = h.seqNr - 1 // State packets carry the next sequence number without using it
+		close(c.connected)
+	case h.typ == stSyn: // Our state packet was lost, the peer is still waiting for it
+		c.sendState()
+		return
+	}
+
+	c.processAck(h)
+
+	if h.typ == stData || h.typ == stFin {
+		c.receive(h, payload)
+		c.sendState()
+	}
+
+	if c.closing && len(c.inflight) == 0 {
+		c.teardown(ErrClosed)
+	}
+	notify(c.writable)
+}
+
+// processAck removes acknowledged packets and adjusts the congestion window, c.mu must be held
+func (c *Conn) processAck(h header) {
+	acked := 0
+	now := time.Now()
+	for len(c.inflight) > 0 && !seqLess(h.ackNr, c.inflight[0].seqNr) {
+		pkt := c.inflight[0]
+		c.inflight = c.inflight[1:]
+		c.curWindow -= len(pkt.payload)
+		acked += len(pkt.payload)
+		if pkt.transmits == 1 { // Retransmitted packets give ambiguous RTT samples
+			c.updateRTT(now.Sub(pkt.sent))
+		}
+	}
+
+	if acked > 0 || (len(c.inflight) > 0 && h.ackNr != c.lastAck) {
+		c.dupAcks = 0
+		c.lastAck = h.ackNr
+		if acked > 0 {
+			c.ledbat(acked, h.timestampDiff)
+		}
+		return
+	}
+
+	// Three duplicate acks mean the next packet was lost
+	if h.typ == stState && len(c.inflight) > 0 {
+		c.dupAcks++
+		if c.dupAcks == 3 {
+			c.maxWindow /= 2
+			if c.maxWindow < minWindow {
+				c.maxWindow = minWindow
+			}
+			c.transmit(c.inflight[0])
+		}
+	}
+}
+
+func (c *Conn) updateRTT(sample time.Duration) {
+	if c.rtt == 0 {
+		c.rtt, c.rttVar = sample, sample/2
+	} else {
+		delta := c.rtt - sample
+		if delta < 0 {
+			delta = -delta
+		}
+		c.rttVar += (delta - c.rttVar) / 4
+		c.rtt += (sample - c.rtt) / 8
+	}
+	c.rto = c.rtt + 4*c.rttVar
+	if c.rto < minTimeout {
+		c.rto = minTimeout
+	}
+}
+
+// ledbat grows the congestion window while the peer's measured delay is under the target and shrinks it above
+func (c *Conn) ledbat(acked int, delaySample uint32) {
+	if delaySample == 0 { // The peer hasn't measured anything yet
+		return
+	}
+	if time.Since(c.baseStart) > baseDelayInterval {
+		c.baseDelay[0], c.baseDelay[1] = c.baseDelay[1], 0
+		c.baseStart = time.Now()
+	}
+	if c.baseDelay[1] == 0 || delaySample < c.baseDelay[1] {
+		c.baseDelay[1] = delaySample
+	}
+	base := c.baseDelay[1]
+	if c.baseDelay[0] != 0 && c.baseDelay[0] < base {
+		base = c.baseDelay[0]
+	}
+
+	ourDelay := time.Duration(delaySample-base) * time.Microsecond
+	offTarget := float64(ccontrolTarget-ourDelay) / float64(ccontrolTarget)
+	windowFactor := float64(acked) / c.maxWindow
+	if windowFactor > 1 {
+		windowFactor = 1
+	}
+	c.maxWindow += maxCwndIncrease * offTarget * windowFactor
+	if c.maxWindow < minWindow {
+		c.maxWindow = minWindow
+	}
+}
+
+// receive delivers data in order and buffers packets that arrive early, c.mu must be held. Data past the window we
+// advertised is dropped without being acknowledged, so a peer that ignores the window has to send it again later
+func (c *Conn) receive(h header, payload []byte) {
+	if h.seqNr != c.ackNr+1 {
+		_, buffered := c.outOfOrder[h.seqNr]
+		if seqLess(c.ackNr, h.seqNr) && !buffered && len(c.outOfOrder) < maxOutOfOrder &&
+			c.readBuf.Len()+c.outOfOrderLen+len(payload) <= recvWindow {
+			c.outOfOrder[h.seqNr] = &outPacket{typ: h.typ, seqNr: h.seqNr, payload: payload}
+			c.outOfOrderLen += len(payload)
+		}
+		return
+	}
+
+	pkt := &outPacket{typ: h.typ, seqNr: h.seqNr, payload: payload}
+	for pkt != nil && !c.eof {
+		if c.readBuf.Len()+len(pkt.payload) > recvWindow {
+			break
+		}
+		c.ackNr = pkt.seqNr
+		if pkt.typ == stFin {
+			c.eof = true
+		} else {
+			c.readBuf.Write(pkt.payload)
+		}
+		if buffered, ok := c.outOfOrder[pkt.seqNr]; ok {
+			delete(c.outOfOrder, pkt.seqNr)
+			c.outOfOrderLen -= len(buffered.payload)
+		}
+		pkt = c.outOfOrder[c.ackNr+1]
+	}
+	notify(c.readable)
+}
+
+// tick retransmits lost packets and gives up on connections that stopped responding
+func (c *Conn) tick(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == csClosed {
+		return
+	}
+	if c.closing && now.Sub(c.closedAt) > closeLinger {
+		c.teardown(ErrClosed)
+		return
+	}
+	if len(c.inflight) == 0 {
+		return
+	}
+
+	pkt := c.inflight[0]
+	if now.Sub(pkt.sent) < c.rto {
+		return
+	}
+	if pkt.transmits >= maxTransmits {
+		c.teardown(ErrTimeout)
+		return
+	}
+	c.rto *= 2
+	c.maxWindow = minWindow
+	c.transmit(pkt)
+}
+
+// teardown ends the connection and removes it from the socket, c.mu must be held
+func (c *Conn) teardown(err error) {
+	if c.state == csClosed {
+		return
+	}
+	c.state = csClosed
+	if c.err == nil {
+		c.err = err
+	}
+	close(c.done)
+	c.socket.remove(c)
+}
@@ -0,0 +1,91 @@
+package utp
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Packet types
+const (
+	stData  = 0 // Data payload
+	stFin   = 1 // Last packet of the connection
+	stState = 2 // Acknowledgement without data
+	stReset = 3 // Forcibly end the connection
+	stSyn   = 4 // Start a connection
+)
+
+const version = 1
+const headerLen = 20
+
+// ErrHeader is returned for packets that aren't uTP
+var ErrHeader = errors.New("Malformed uTP header")
+
+type header struct {
+	typ           uint8
+	connID        uint16
+	timestamp     uint32 // Sender's clock in microseconds when the packet was sent
+	timestampDiff uint32 // Sender's measured delay of the last packet it received
+	wndSize       uint32 // Receive window of the sender in bytes
+	seqNr         uint16
+	ackNr         uint16
+}
+
+// isPacket returns whether a datagram looks like a uTP packet, other protocols such as the DHT share the socket
+func isPacket(data []byte) bool {
+	return len(data) >= headerLen && data[0]&0x0f == version && data[0]>>4 <= stSyn
+}
+
+func (h *header) encode(payload []byte) []byte {
+	buf := make([]byte, headerLen+len(payload))
+	buf[0] = h.typ<<4 | version
+	buf[1] = 0 // No extensions
+	binary.BigEndian.PutUint16(buf[2:4], h.connID)
+	binary.BigEndian.PutUint32(buf[4:8], h.timestamp)
+	binary.BigEndian.PutUint32(buf[8:12], h.timestampDiff)
+	binary.BigEndian.PutUint32(buf[12:16], h.wndSize)
+	binary.BigEndian.PutUint16(buf[16:18], h.seqNr)
+	binary.BigEndian.PutUint16(buf[18:20], h.ackNr)
+	copy(buf[headerLen:], payload)
+	return buf
+}
+
+// decodePacket parses a packet's header and returns its payload, extensions such as selective acks are skipped
+func decodePacket(data []byte) (header, []byte, error) {
+	if !isPacket(data) {
+		return header{}, nil, errors.Wrap(ErrHeader, "decodePacket")
+	}
+	h := header{
+		typ:           data[0] >> 4,
+		connID:        binary.BigEndian.Uint16(data[2:4]),
+		timestamp:     binary.BigEndian.Uint32(data[4:8]),
+		timestampDiff: binary.BigEndian.Uint32(data[8:12]),
+		wndSize:       binary.BigEndian.Uint32(data[12:16]),
+		seqNr:         binary.BigEndian.Uint16(data[16:18]),
+		ackNr:         binary.BigEndian.Uint16(data[18:20]),
+	}
+
+	ext, pos := data[1], headerLen
+	for ext != 0 {
+		if pos+2 > len(data) {
+			return header{}, nil, errors.Wrap(ErrHeader, "decodePacket")
+		}
+		ext = data[pos]
+		pos += 2 + int(data[pos+1])
+		if pos > len(data) {
+			return header{}, nil, errors.Wrap(ErrHeader, "decodePacket")
+		}
+	}
+	return h, data[pos:], nil
+}
+
+// timestamp returns the current time in microseconds, truncated to fit in a header
+func timestamp() uint32 {
+	return uint32(time.Now().UnixNano() / int64(time.Microsecond))
+}
+
+// seqLess compares sequence numbers that wrap around
+func seqLess(a, b uint16) bool {
+	return int16(a-b) < 0
+}
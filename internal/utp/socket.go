@@ -0,0 +1,335 @@
+/*
+Package utp implements the Micro Transport Protocol (BEP 29), a reliable
+stream over UDP with LEDBAT congestion control. It backs off as soon as
+it sees queuing delay, so it yields bandwidth to other traffic on the link.
+*/
+package utp
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/pkg/errors"
+)
+
+const maxPacketSize = 65535
+const acceptBacklog = 32 // Incoming connections waiting to be accepted
+const otherBacklog = 64  // Datagrams of other protocols waiting to be read
+
+// ErrSocketClosed is returned once the socket is closed
+var ErrSocketClosed = errors.New("Use of closed uTP socket")
+
+type connKey struct {
+	addr   string
+	recvID uint16
+}
+
+type datagram struct {
+	data []byte
+	addr net.Addr
+}
+
+// Socket sends and receives uTP packets on a UDP socket, it implements net.Listener for incoming connections
+type Socket struct {
+	conn   net.PacketConn
+	mu     sync.Mutex
+	conns  map[connKey]*Conn
+	accept chan *Conn
+	other  chan datagram // Datagrams that aren't uTP packets
+	closed chan struct{}
+	once   sync.Once
+}
+
+// NewSocket starts handling uTP packets on conn
+func NewSocket(conn net.PacketConn) *Socket {
+	s := &Socket{
+		conn:   conn,
+		conns:  make(map[connKey]*Conn),
+		accept: make(chan *Conn, acceptBacklog),
+		other:  make(chan datagram, otherBacklog),
+		closed: make(chan struct{}),
+	}
+	go s.readLoop()
+	go s.tickLoop()
+	return s
+}
+
+// FromContext returns the session's uTP socket from the context, if there is one
+func FromContext(ctx context.Context) (*Socket, bool) {
+	s, ok := ctx.Value(common.KeyUTP).(*Socket)
+	return s, ok && s != nil
+}
+
+// Addr returns the local address of the socket
+func (s *Socket) Addr() net.Addr {
+	return s.conn.LocalAddr()
+}
+
+// Accept waits for an incoming uTP connection
+func (s *Socket) Accept() (net.Conn, error) {
+	select {
+	case c := <-s.accept:
+		return c, nil
+	case <-s.closed:
+		return nil, errors.Wrap(ErrSocketClosed, "Accept")
+	}
+}
+
+// Close closes the socket and every connection on it
+func (s *Socket) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.closed)
+		err = s.conn.Close()
+
+		s.mu.Lock()
+		conns := make([]*Conn, 0, len(s.conns))
+		for _, c := range s.conns {
+			conns = append(conns, c)
+		}
+		s.mu.Unlock()
+		for _, c := range conns {
+			c.mu.Lock()
+			c.teardown(ErrSocketClosed)
+			c.mu.Unlock()
+		}
+	})
+	return err
+}
+
+// Dial connects to a uTP peer
+func (s *Socket) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "Dial")
+	}
+
+	// Pick a connection ID that isn't used with this peer yet
+	s.mu.Lock()
+	var recvID uint16
+	for {
+		idBytes := make([]byte, 2)
+		rand.Read(idBytes)
+		recvID = binary.BigEndian.Uint16(idBytes)
+		if _, ok := s.conns[connKey{udpAddr.String(), recvID}]; !ok {
+			break
+		}
+	}
+	c := newConn(s, udpAddr, recvID, recvID+1)
+	s.conns[connKey{udpAddr.String(), recvID}] = c
+	s.mu.Unlock()
+
+	c.mu.Lock()
+	c.seqNr = 1
+	c.send(stSyn, nil)
+	c.mu.Unlock()
+
+	select {
+	case <-c.connected:
+		return c, nil
+	case <-c.done:
+		c.mu.Lock()
+		err := c.err
+		c.mu.Unlock()
+		return nil, errors.Wrap(err, "Dial")
+	case <-ctx.Done():
+		c.mu.Lock()
+		c.teardown(ErrTimeout)
+		c.mu.Unlock()
+		return nil, errors.Wrap(ctx.Err(), "Dial")
+	}
+}
+
+// DialTimeout connects to a uTP peer, giving up after the timeout
+func (s *Socket) DialTimeout(addr string, timeout time.Duration) (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return s.Dial(ctx, addr)
+}
+
+func (s *Socket) writeTo(data []byte, addr net.Addr) {
+	s.conn.WriteTo(data, addr) // Lost packets are handled by retransmission
+}
+
+func (s *Socket) remove(c *Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := connKey{c.addr.String(), c.recvID}
+	if s.conns[key] == c {
+		delete(s.conns, key)
+	}
+}
+
+func (s *Socket) readLoop() {
+	defer s.Close()
+	buf := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := s.conn.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return
+		} else if err != nil { // Timeouts and ICMP errors don't affect the socket
+			continue
+		}
+		data := append([]byte(nil), buf[:n]...)
+		if !isPacket(data) {
+			select {
+			case s.other <- datagram{data, addr}:
+			default: // Drop datagrams if nobody is reading them
+			}
+			continue
+		}
+
+		h, payload, err := decodePacket(data)
+		if err != nil {
+			continue
+		}
+		if h.typ == stSyn {
+			s.handleSyn(h, addr)
+			continue
+		}
+
+		s.mu.Lock()
+		c, ok := s.conns[connKey{addr.String(), h.connID}]
+		s.mu.Unlock()
+		if ok {
+			c.handle(h, payload)
+		} else if h.typ != stReset {
+			s.writeTo((&header{typ: stReset, connID: h.connID - 1, ackNr: h.seqNr}).encode(nil), addr)
+		}
+	}
+}
+
+// handleSyn sets up an incoming connection
+func (s *Socket) handleSyn(h header, addr net.Addr) {
+	key := connKey{addr.String(), h.connID + 1}
+	s.mu.Lock()
+	if c, ok := s.conns[key]; ok { // Repeated SYN
+		s.mu.Unlock()
+		c.handle(h, nil)
+		return
+	}
+
+	idBytes := make([]byte, 2)
+	rand.Read(idBytes)
+	c := newConn(s, addr, h.connID+1, h.connID)
+	c.state = csConnected
+	c.seqNr = binary.BigEndian.Uint16(idBytes)
+	c.ackNr = h.seqNr
+	c.replyDiff = timestamp() - h.timestamp
+	c.peerWindow = int(h.wndSize)
+	close(c.connected)
+
+	select {
+	case s.accept <- c:
+		s.conns[key] = c
+		s.mu.Unlock()
+		c.mu.Lock()
+		c.sendState()
+		c.mu.Unlock()
+	default: // Too many connections waiting to be accepted
+		s.mu.Unlock()
+		s.writeTo((&header{typ: stReset, connID: h.connID, ackNr: h.seqNr}).encode(nil), addr)
+	}
+}
+
+func (s *Socket) tickLoop() {
+	ticker := time.NewTicker(tickInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.closed:
+			return
+		case now := <-ticker.C:
+			s.mu.Lock()
+			conns := make([]*Conn, 0, len(s.conns))
+			for _, c := range s.conns {
+				conns = append(conns, c)
+			}
+			s.mu.Unlock()
+			for _, c := range conns {
+				c.tick(now)
+			}
+		}
+	}
+}
+
+// PacketConn returns a view of the socket for other protocols, it reads every datagram that isn't a uTP packet
+func (s *Socket) PacketConn() net.PacketConn {
+	return &packetConn{socket: s, closed: make(chan struct{})}
+}
+
+// packetConn shares the socket with another protocol such as the DHT
+type packetConn struct {
+	socket   *Socket
+	mu       sync.Mutex
+	deadline time.Time
+	closed   chan struct{}
+	once     sync.Once
+}
+
+func (pc *packetConn) ReadFrom(b []byte) (int, net.Addr, error) {
+	pc.mu.Lock()
+	deadline := pc.deadline
+	pc.mu.Unlock()
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case d := <-pc.socket.other:
+		return copy(b, d.data), d.addr, nil
+	case <-timeout:
+		return 0, nil, timeoutError{}
+	case <-pc.closed:
+		return 0, nil, errors.Wrap(ErrSocketClosed, "ReadFrom")
+	case <-pc.socket.closed:
+		return 0, nil, errors.Wrap(ErrSocketClosed, "ReadFrom")
+	}
+}
+
+func (pc *packetConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	return pc.socket.conn.WriteTo(b, addr)
+}
+
+// Close stops reading from the socket, the socket itself stays open for uTP
+func (pc *packetConn) Close() error {
+	pc.once.Do(func() { close(pc.closed) })
+	return nil
+}
+
+func (pc *packetConn) LocalAddr() net.Addr {
+	return pc.socket.Addr()
+}
+
+func (pc *packetConn) SetDeadline(t time.Time) error {
+	return pc.SetReadDeadline(t)
+}
+
+func (pc *packetConn) SetReadDeadline(t time.Time) error {
+	pc.mu.Lock()
+	pc.deadline = t
+	pc.mu.Unlock()
+	return nil
+}
+
+func (pc *packetConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// Listen opens a dual-stack UDP socket for uTP on the given port
+func Listen(port uint16) (*Socket, error) {
+	conn, err := net.ListenPacket("udp", ":"+strconv.Itoa(int(port)))
+	if err != nil {
+		return nil, errors.Wrap(err, "Listen")
+	}
+	return NewSocket(conn), nil
+}
@@ -0,0 +1,188 @@
+package utp
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSocket(t *testing.T) *Socket {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.Nil(t, err)
+	s := NewSocket(conn)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// connect returns both ends of a uTP connection between two sockets
+func connect(t *testing.T) (net.Conn, net.Conn) {
+	server, client := newSocket(t), newSocket(t)
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := server.Accept()
+		if err == nil {
+			accepted <- conn
+		}
+	}()
+
+	conn, err := client.DialTimeout(server.Addr().String(), 5*time.Second)
+	require.Nil(t, err)
+	select {
+	case remote := <-accepted:
+		return conn, remote
+	case <-time.After(5 * time.Second):
+		t.Fatal("Connection was not accepted")
+		return nil, nil
+	}
+}
+
+func TestHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	h := header{typ: stData, connID: 7, timestamp: 1000, timestampDiff: 20, wndSize: recvWindow, seqNr: 65535, ackNr: 3}
+	data := h.encode([]byte("payload"))
+	assert.True(isPacket(data))
+
+	decoded, payload, err := decodePacket(data)
+	assert.Nil(err)
+	assert.Equal(h, decoded)
+	assert.Equal([]byte("payload"), payload)
+
+	// Extensions are skipped
+	data[1] = 1
+	withExt := append(append(data[:headerLen:headerLen], 0, 4, 0, 0, 0, 0), "payload"...)
+	_, payload, err = decodePacket(withExt)
+	assert.Nil(err)
+	assert.Equal([]byte("payload"), payload)
+
+	_, _, err = decodePacket([]byte("d1:ad2:id20:"))
+	assert.ErrorIs(err, ErrHeader)
+	assert.True(seqLess(65535, 1))
+}
+
+func TestTransfer(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	local, remote := connect(t)
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+
+	// Data passes through both directions at once
+	errs := make(chan error, 2)
+	go func() {
+		_, err := local.Write(data)
+		errs <- err
+	}()
+	go func() {
+		_, err := remote.Write(data)
+		errs <- err
+	}()
+
+	buf := make([]byte, len(data))
+	_, err := io.ReadFull(remote, buf)
+	require.Nil(err)
+	assert.True(bytes.Equal(data, buf))
+	_, err = io.ReadFull(local, buf)
+	require.Nil(err)
+	assert.True(bytes.Equal(data, buf))
+	assert.Nil(<-errs)
+	assert.Nil(<-errs)
+
+	// Closing sends a FIN after the data
+	local.Write([]byte("last"))
+	local.Close()
+	buf = make([]byte, 4)
+	_, err = io.ReadFull(remote, buf)
+	assert.Nil(err)
+	assert.Equal([]byte("last"), buf)
+	_, err = remote.Read(buf)
+	assert.Equal(io.EOF, err)
+	remote.Close()
+}
+
+func TestDeadline(t *testing.T) {
+	local, remote := connect(t)
+	defer local.Close()
+	defer remote.Close()
+
+	local.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	_, err := local.Read(make([]byte, 1))
+	netErr, ok := err.(net.Error)
+	require.True(t, ok)
+	assert.True(t, netErr.Timeout())
+}
+
+func TestDialNoPeer(t *testing.T) {
+	s := newSocket(t)
+	other := newSocket(t)
+	addr := other.Addr().String()
+	other.Close()
+
+	_, err := s.DialTimeout(addr, 200*time.Millisecond)
+	assert.NotNil(t, err)
+}
+
+func TestPacketConn(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	s := newSocket(t)
+	pc := s.PacketConn()
+	sender, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	require.Nil(err)
+	defer sender.Close()
+
+	// Datagrams of other protocols are passed on
+	_, err = sender.WriteTo([]byte("d1:ad2:id20:"), s.Addr())
+	require.Nil(err)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64)
+	n, addr, err := pc.ReadFrom(buf)
+	require.Nil(err)
+	assert.Equal("d1:ad2:id20:", string(buf[:n]))
+	assert.Equal(sender.LocalAddr().String(), addr.String())
+
+	// Closing the view leaves the socket open
+	pc.Close()
+	_, _, err = pc.ReadFrom(buf)
+	assert.ErrorIs(err, ErrSocketClosed)
+	select {
+	case <-s.closed:
+		t.Fatal("Socket was closed")
+	default:
+	}
+}
+
+func TestReceiveWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newConn(nil, nil, 1, 2)
+	chunk := recvWindow / 4
+	for seq := uint16(1); seq <= 4; seq++ {
+		c.receive(header{typ: stData, seqNr: seq}, make([]byte, chunk))
+	}
+	assert.Equal(recvWindow, c.readBuf.Len())
+
+	// Data past the advertised window is dropped without being acknowledged, in order or not
+	c.receive(header{typ: stData, seqNr: 5}, make([]byte, chunk))
+	c.receive(header{typ: stData, seqNr: 6}, make([]byte, chunk))
+	assert.Equal(uint16(4), c.ackNr)
+	assert.Equal(recvWindow, c.readBuf.Len())
+	assert.Empty(c.outOfOrder)
+
+	// Reading makes room for more
+	c.readBuf.Next(chunk)
+	c.receive(header{typ: stData, seqNr: 6}, make([]byte, chunk))
+	assert.Len(c.outOfOrder, 1)
+	c.receive(header{typ: stData, seqNr: 5}, make([]byte, chunk))
+	assert.Equal(uint16(5), c.ackNr)
+	assert.Equal(recvWindow, c.readBuf.Len())
+	assert.Equal(chunk, c.outOfOrderLen)
+}
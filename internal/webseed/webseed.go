@@ -0,0 +1,180 @@
+/*
+Package webseed downloads torrent pieces from HTTP mirrors (BEP 19).
+Pieces are fetched with range requests that are split across file
+boundaries, then verified and written like pieces from peers.
+*/
+package webseed
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/picker"
+	"github.com/kylec725/graytorrent/internal/write"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const requestTimeout = 60 * time.Second // Time to wait on the data for a piece
+const minBackoff = 30 * time.Second     // How long to wait after the first failure
+const maxBackoff = 30 * time.Minute     // Longest wait between attempts on a failing mirror
+
+// Errors
+var (
+	ErrStatus = errors.New("Web seed did not respond with partial content")
+	ErrLength = errors.New("Web seed sent an unexpected amount of data")
+	ErrHash   = errors.New("Piece from web seed failed verification")
+)
+
+// Seed is an HTTP mirror of a torrent's files
+type Seed struct {
+	URL      string
+	client   *http.Client
+	failures int // Consecutive failures, used for backing off
+}
+
+// New creates a web seed for a url-list entry
+func New(rawURL string) *Seed {
+	return &Seed{URL: rawURL, client: &http.Client{Timeout: requestTimeout}}
+}
+
+// Run downloads pieces from the picker until the context is done, finished pieces are sent on results
+// and pieces that failed are put back for peers or other mirrors
+func (s *Seed) Run(ctx context.Context, info *common.TorrentInfo, pk *picker.Picker, results chan<- int) {
+	for {
+		index, err := pk.Wait(ctx, nil) // Mirrors have every piece
+		if err != nil {
+			return
+		}
+
+		err = s.download(ctx, info, index)
+		if err == nil {
+			s.failures = 0
+			select {
+			case results <- index:
+			case <-ctx.Done():
+			}
+			continue
+		}
+
+		pk.Return(index)
+		s.failures++
+		wait := s.backoff()
+		log.WithFields(log.Fields{"url": s.URL, "piece": index, "retry": wait.String(), "error": err.Error()}).Debug("Web seed failed")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// backoff returns how long to wait before using the mirror again, doubling with each consecutive failure
+func (s *Seed) backoff() time.Duration {
+	wait := minBackoff
+	for i := 1; i < s.failures && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return wait
+}
+
+// download fetches a piece, verifies it and writes it to file
+func (s *Seed) download(ctx context.Context, info *common.TorrentInfo, index int) error {
+	piece, err := s.FetchPiece(ctx, info, index)
+	if err != nil {
+		return errors.Wrap(err, "download")
+	}
+	if !write.VerifyPiece(info, index, piece) {
+		return errors.Wrap(ErrHash, "download")
+	}
+	err = write.AddPiece(info, index, piece)
+	return errors.Wrap(err, "download")
+}
+
+// FetchPiece requests a piece from the mirror, with one range request for each file the piece spans
+func (s *Seed) FetchPiece(ctx context.Context, info *common.TorrentInfo, index int) ([]byte, error) {
+	if index < 0 || index >= info.TotalPieces {
+		return nil, errors.Wrap(write.ErrPieceIndex, "FetchPiece")
+	}
+	pieceLeft := info.PieceSize(index)
+	piece := make([]byte, 0, pieceLeft)
+	offset := index * info.PieceLength // Offset into the current file
+
+	for _, path := range info.Paths {
+		if offset < path.Length { // Piece is part of the file
+			length := common.Min(path.Length-offset, pieceLeft)
+			if !path.HasData() { // Padding and symlinks aren't on the mirror
+				piece = append(piece, make([]byte, length)...)
+			} else {
+				data, err := s.fetchRange(ctx, s.fileURL(info, path), offset, length)
+				if err != nil {
+					return nil, errors.Wrap(err, "FetchPiece")
+				}
+				piece = append(piece, data...)
+			}
+
+			pieceLeft -= length
+			if pieceLeft == 0 {
+				break
+			}
+		}
+		offset -= path.Length
+		if offset < 0 { // The rest of the piece starts at the beginning of the next file
+			offset = 0
+		}
+	}
+	return piece, nil
+}
+
+// fileURL returns the URL of one of the torrent's files on the mirror
+func (s *Seed) fileURL(info *common.TorrentInfo, path common.Path) string {
+	singleFile := len(info.Paths) == 1 && path.Path == info.Name
+	if singleFile && !strings.HasSuffix(s.URL, "/") { // The URL is the file itself
+		return s.URL
+	}
+
+	base := s.URL
+	if !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	// Paths of multiple file torrents start with the torrent's name, as the mirror's directory layout does
+	var escaped []string
+	for _, part := range strings.Split(filepath.ToSlash(path.Path), "/") {
+		escaped = append(escaped, url.PathEscape(part))
+	}
+	return base + strings.Join(escaped, "/")
+}
+
+// fetchRange requests length bytes of a file starting at offset
+func (s *Seed) fetchRange(ctx context.Context, fileURL string, offset, length int) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, errors.WithMessagef(ErrStatus, "status code %d", resp.StatusCode)
+	}
+
+	data := make([]byte, length)
+	if _, err = io.ReadFull(resp.Body, data); err != nil {
+		return nil, errors.WithMessage(ErrLength, err.Error())
+	}
+	return data, nil
+}
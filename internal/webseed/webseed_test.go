@@ -0,0 +1,144 @@
+package webseed
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/picker"
+	"github.com/kylec725/graytorrent/internal/write"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTorrent creates the files of a multiple file torrent in a mirror directory, and its info for downloading into another directory
+func newTorrent(t *testing.T) (*common.TorrentInfo, string, []byte) {
+	paths := []common.Path{{Length: 5000, Path: filepath.Join("multi", "a.bin")}, {Length: 3000, Path: filepath.Join("multi", "b", "c d.bin")}}
+	mirror := t.TempDir()
+	var data []byte
+	for _, path := range paths {
+		fileData := make([]byte, path.Length)
+		rand.Read(fileData)
+		data = append(data, fileData...)
+		fullPath := filepath.Join(mirror, path.Path)
+		require.Nil(t, os.MkdirAll(filepath.Dir(fullPath), 0755))
+		require.Nil(t, ioutil.WriteFile(fullPath, fileData, 0644))
+	}
+
+	info := &common.TorrentInfo{Name: "multi", Paths: paths, PieceLength: 2048, TotalLength: len(data), Directory: t.TempDir()}
+	info.TotalPieces = (len(data) + info.PieceLength - 1) / info.PieceLength
+	for i := 0; i < info.TotalPieces; i++ {
+		end := common.Min((i+1)*info.PieceLength, len(data))
+		info.PieceHashes = append(info.PieceHashes, sha1.Sum(data[i*info.PieceLength:end]))
+	}
+	require.Nil(t, write.NewWrite(info))
+	return info, mirror, data
+}
+
+func TestRun(t *testing.T) {
+	assert := assert.New(t)
+
+	info, mirror, data := newTorrent(t)
+	server := httptest.NewServer(http.FileServer(http.Dir(mirror)))
+	defer server.Close()
+
+	results := make(chan int, info.TotalPieces)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go New(server.URL).Run(ctx, info, picker.New(info), results)
+
+	done := make(map[int]bool)
+	for len(done) < info.TotalPieces {
+		select {
+		case index := <-results:
+			done[index] = true
+		case <-time.After(5 * time.Second):
+			t.Fatal("Web seed did not finish the torrent")
+		}
+	}
+
+	// Pieces spanning both files were split into separate range requests
+	a, err := ioutil.ReadFile(filepath.Join(info.Directory, info.Paths[0].Path))
+	assert.Nil(err)
+	b, err := ioutil.ReadFile(filepath.Join(info.Directory, info.Paths[1].Path))
+	assert.Nil(err)
+	assert.Equal(data, append(a, b...))
+}
+
+func TestRunFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	info, _, _ := newTorrent(t)
+	requested := make(chan bool, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case requested <- true:
+		default:
+		}
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	pk := picker.New(info)
+	for i := 0; i < info.TotalPieces; i++ {
+		if i != 1 {
+			pk.Done(i)
+		}
+	}
+	results := make(chan int, info.TotalPieces)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	seed := New(server.URL)
+	go seed.Run(ctx, info, pk, results)
+
+	// The piece goes back to the picker for other sources while the mirror backs off
+	waitCtx, waitCancel := context.WithTimeout(ctx, 5*time.Second)
+	defer waitCancel()
+	<-requested
+	index, err := pk.Wait(waitCtx, nil)
+	if assert.Nil(err, "Piece was not returned to the picker") {
+		assert.Equal(1, index)
+	}
+	assert.Empty(results)
+}
+
+func TestBadPiece(t *testing.T) {
+	info, mirror, _ := newTorrent(t)
+	server := httptest.NewServer(http.FileServer(http.Dir(mirror)))
+	defer server.Close()
+
+	info.PieceHashes[0] = [20]byte{}
+	err := New(server.URL).download(context.Background(), info, 0)
+	assert.ErrorIs(t, err, ErrHash)
+}
+
+func TestBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	seed := New("http://example.com/")
+	seed.failures = 1
+	assert.Equal(minBackoff, seed.backoff())
+	seed.failures = 3
+	assert.Equal(4*minBackoff, seed.backoff())
+	seed.failures = 100
+	assert.Equal(maxBackoff, seed.backoff())
+}
+
+func TestFileURL(t *testing.T) {
+	assert := assert.New(t)
+
+	single := &common.TorrentInfo{Name: "file.iso", Paths: []common.Path{{Length: 1, Path: "file.iso"}}}
+	assert.Equal("http://example.com/file.iso", New("http://example.com/file.iso").fileURL(single, single.Paths[0]))
+	assert.Equal("http://example.com/pub/file.iso", New("http://example.com/pub/").fileURL(single, single.Paths[0]))
+
+	multi := &common.TorrentInfo{Name: "multi", Paths: []common.Path{{Length: 1, Path: filepath.Join("multi", "b", "c d.bin")}}}
+	assert.Equal("http://example.com/pub/multi/b/c%20d.bin", New("http://example.com/pub").fileURL(multi, multi.Paths[0]))
+}
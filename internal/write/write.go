@@ -5,8 +5,10 @@ import (
 	"crypto/sha1"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/merkle"
 	"github.com/pkg/errors"
 )
 
@@ -18,35 +20,153 @@ var (
 	ErrWriteFailed = errors.New("Unexpected number of bytes written")
 	ErrReadFailed  = errors.New("Unexpected number of bytes read")
 	ErrPieceIndex  = errors.New("Piece index was out of bounds")
+	ErrSymlink     = errors.New("Symlink points outside of the torrent")
 )
 
-// NewWrite sets up the files a torrent needs info write info
+const executableMode = 0755 // Mode of files with the executable attribute once they are complete
+
+// NewWrite sets up the files a torrent needs info write info, skipped files that share no pieces with other files aren't created
 func NewWrite(info *common.TorrentInfo) error {
 	for _, path := range info.Paths {
-		fullPath := filepath.Join(info.Directory, path.Path)
-
+		if path.Pad { // Padding is only virtual zeros
+			continue
+		}
 		// Return an error if the file already exists
-		if _, err := os.Stat(fullPath); err == nil {
+		if _, err := os.Lstat(filepath.Join(info.Directory, path.Path)); err == nil {
 			return errors.Wrap(ErrFileExists, "NewWrite")
 		}
+	}
+	err := CreateFiles(info)
+	return errors.Wrap(err, "NewWrite")
+}
+
+// CreateFiles creates the files that the torrent's pieces need that don't exist yet, such as after their priorities change
+func CreateFiles(info *common.TorrentInfo) error {
+	needed := neededFiles(info)
+	for i, path := range info.Paths {
+		if path.Pad {
+			continue
+		}
+		fullPath := filepath.Join(info.Directory, path.Path)
+		if _, err := os.Lstat(fullPath); err == nil || !needed[i] {
+			continue
+		}
 
 		// Create directories recursively if necessary
 		if makeDir := filepath.Dir(fullPath); makeDir != "" {
 			err := os.MkdirAll(makeDir, 0755)
 			if err != nil {
-				return errors.Wrap(err, "NewWrite")
+				return errors.Wrap(err, "CreateFiles")
 			}
 		}
 
-		_, err := os.Create(fullPath)
+		if path.Symlink != "" {
+			if err := createSymlink(info, path); err != nil {
+				return errors.Wrap(err, "CreateFiles")
+			}
+			continue
+		}
+		file, err := os.Create(fullPath)
 		if err != nil {
-			return errors.Wrap(err, "NewWrite")
+			return errors.Wrap(err, "CreateFiles")
+		}
+		file.Close()
+		if path.Length == 0 && path.Executable { // Empty files are already complete
+			if err = os.Chmod(fullPath, executableMode); err != nil {
+				return errors.Wrap(err, "CreateFiles")
+			}
 		}
 	}
 
 	return nil
 }
 
+// RemoveSkipped removes the empty files of skipped files that no longer share pieces with other files. Pieces of these
+// files must not be written anymore, so a running torrent first stops downloading them
+func RemoveSkipped(info *common.TorrentInfo) error {
+	needed := neededFiles(info)
+	for i, path := range info.Paths {
+		if needed[i] || !path.HasData() || path.Length == 0 {
+			continue
+		}
+		fullPath := filepath.Join(info.Directory, path.Path)
+		stat, err := os.Lstat(fullPath)
+		if err == nil && stat.Mode().IsRegular() && stat.Size() == 0 { // Nothing was written to it
+			if err := os.Remove(fullPath); err != nil {
+				return errors.Wrap(err, "RemoveSkipped")
+			}
+		}
+	}
+	return nil
+}
+
+// neededFiles returns which files must be on disk, files that aren't skipped and skipped files that share a piece with them
+func neededFiles(info *common.TorrentInfo) []bool {
+	priorities := info.PiecePriorities()
+	needed := make([]bool, len(info.Paths))
+	offset := 0 // Offset of the current file in the torrent
+	for i, path := range info.Paths {
+		start, end := offset, offset+path.Length
+		offset = end
+		needed[i] = path.Priority != common.PrioritySkip
+		if !path.HasData() || path.Length == 0 {
+			continue
+		}
+		for j := start / info.PieceLength; j <= (end-1)/info.PieceLength && j < len(priorities) && !needed[i]; j++ {
+			needed[i] = priorities[j] != common.PrioritySkip
+		}
+	}
+	return needed
+}
+
+// createSymlink links a path to its target with a relative symlink, targets must stay within the torrent's directory
+func createSymlink(info *common.TorrentInfo, path common.Path) error {
+	root := info.Name // Directory of a multiple file torrent
+	if len(info.Paths) == 1 && info.Paths[0].Path == info.Name {
+		root = "."
+	}
+	target := filepath.Clean(path.Symlink)
+	inRoot, err := filepath.Rel(root, target)
+	if err != nil || filepath.IsAbs(target) || inRoot == ".." || strings.HasPrefix(inRoot, ".."+string(filepath.Separator)) {
+		err := errors.WithMessagef(ErrSymlink, "path %s target %s", path.Path, path.Symlink)
+		return errors.Wrap(err, "createSymlink")
+	}
+	relTarget, err := filepath.Rel(filepath.Dir(path.Path), target)
+	if err != nil {
+		return errors.Wrap(err, "createSymlink")
+	}
+	err = os.Symlink(relTarget, filepath.Join(info.Directory, path.Path))
+	return errors.Wrap(err, "createSymlink")
+}
+
+// CompleteFiles finishes the files that a newly written piece completed, setting their executable bits if they need them,
+// the piece must already be set in the torrent's bitfield
+func CompleteFiles(info *common.TorrentInfo, index int) error {
+	offset := 0 // Offset of the current file in the torrent
+	for _, path := range info.Paths {
+		start, end := offset, offset+path.Length
+		offset = end
+		if !path.Executable || !path.HasData() || path.Length == 0 {
+			continue
+		}
+		first, last := start/info.PieceLength, (end-1)/info.PieceLength
+		if index < first || index > last {
+			continue
+		}
+
+		complete := true
+		for i := first; i <= last && complete; i++ {
+			complete = info.Bitfield.Has(i)
+		}
+		if complete {
+			if err := os.Chmod(filepath.Join(info.Directory, path.Path), executableMode); err != nil {
+				return errors.Wrap(err, "CompleteFiles")
+			}
+		}
+	}
+	return nil
+}
+
 // pieceBounds returns the start and ending indices of a piece (end is exclusive)
 func pieceBounds(info *common.TorrentInfo, index int) (int, int) {
 	start := index * info.PieceLength // start byte index
@@ -131,10 +251,12 @@ func AddPiece(info *common.TorrentInfo, index int, piece []byte) error {
 			bytesToWrite = common.Min(bytesToWrite, pieceLeft)
 			pieceEnd = pieceStart + bytesToWrite
 
-			err := writeOffset(fullPath, piece[pieceStart:pieceEnd], offset)
-			if err != nil {
-				err = errors.WithMessagef(err, "index %d path %s", index, fullPath)
-				return errors.Wrap(err, "AddPiece")
+			if path.HasData() {
+				err := writeOffset(fullPath, piece[pieceStart:pieceEnd], offset)
+				if err != nil {
+					err = errors.WithMessagef(err, "index %d path %s", index, fullPath)
+					return errors.Wrap(err, "AddPiece")
+				}
 			}
 
 			// Exit if the rest of the piece has been written info file
@@ -171,15 +293,17 @@ func ReadPiece(info *common.TorrentInfo, index int) ([]byte, error) {
 			bytesToRead = common.Min(bytesToRead, pieceLeft)
 			pieceEnd = pieceStart + bytesToRead
 
-			data, err := readOffset(fullPath, bytesToRead, offset)
-			if err != nil {
-				return nil, errors.Wrap(err, "ReadPiece")
-			}
+			if path.HasData() { // Padding is left as zeros
+				data, err := readOffset(fullPath, bytesToRead, offset)
+				if err != nil {
+					return nil, errors.Wrap(err, "ReadPiece")
+				}
 
-			// Copy data info the return piece
-			bytesCopied := copy(piece[pieceStart:pieceEnd], data)
-			if bytesCopied != bytesToRead {
-				return nil, errors.Wrap(ErrCopyFailed, "ReadPiece")
+				// Copy data info the return piece
+				bytesCopied := copy(piece[pieceStart:pieceEnd], data)
+				if bytesCopied != bytesToRead {
+					return nil, errors.Wrap(ErrCopyFailed, "ReadPiece")
+				}
 			}
 
 			// Exit if the rest of the piece has been written info file
@@ -197,9 +321,69 @@ func ReadPiece(info *common.TorrentInfo, index int) ([]byte, error) {
 	return piece, nil
 }
 
-// VerifyPiece checks that a completed piece has the correct hash
+// HashKnown returns whether a piece can be verified, v2 only torrents added from magnet links don't know a file's piece
+// hashes until a peer sends its piece layer
+func HashKnown(info *common.TorrentInfo, index int) bool {
+	if len(info.PieceHashes) > 0 {
+		return true
+	}
+	return index >= 0 && index < len(info.PieceHashesV2) && info.PieceHashesV2[index] != [32]byte{}
+}
+
+// VerifyPiece checks that a completed piece has the correct hash, hybrid torrents must match both of their hashes
 func VerifyPiece(info *common.TorrentInfo, index int, piece []byte) bool {
-	expected := info.PieceHashes[index]
-	actual := sha1.Sum(piece)
-	return bytes.Equal(expected[:], actual[:])
+	verified := false
+	if len(info.PieceHashes) > 0 {
+		expected := info.PieceHashes[index]
+		actual := sha1.Sum(piece)
+		if !bytes.Equal(expected[:], actual[:]) {
+			return false
+		}
+		verified = true
+	}
+	if info.V2() && info.PieceHashesV2[index] != [32]byte{} {
+		if !VerifyPieceV2(info, index, piece) {
+			return false
+		}
+		verified = true
+	}
+	return verified
+}
+
+// VerifyPieceV2 checks a completed piece against the merkle tree of its file, the piece's padding isn't hashed
+func VerifyPieceV2(info *common.TorrentInfo, index int, piece []byte) bool {
+	if index < 0 || index >= len(info.PieceHashesV2) {
+		return false
+	}
+	start, _ := pieceBounds(info, index)
+	offset := 0 // Offset of the current file in the torrent
+	for _, path := range info.Paths {
+		if path.Pad || start >= offset+path.Length {
+			offset += path.Length
+			continue
+		}
+
+		dataLength := common.Min(offset+path.Length-start, len(piece))
+		width := info.PieceLength / merkle.BlockSize
+		if path.Length <= info.PieceLength { // Trees of small files only span the file's blocks
+			width = merkle.NextPow2((path.Length + merkle.BlockSize - 1) / merkle.BlockSize)
+		}
+		actual := merkle.Root(merkle.Leaves(piece[:dataLength]), width, [32]byte{})
+		return actual == info.PieceHashesV2[index]
+	}
+	return false
+}
+
+// FilePieces returns the index of the first piece of a v2 file and how many pieces it spans
+func FilePieces(info *common.TorrentInfo, piecesRoot [32]byte) (int, int, bool) {
+	offset := 0
+	for _, path := range info.Paths {
+		if !path.Pad && path.Length > 0 && path.PiecesRoot == piecesRoot {
+			first := offset / info.PieceLength
+			count := (path.Length + info.PieceLength - 1) / info.PieceLength
+			return first, count, true
+		}
+		offset += path.Length
+	}
+	return 0, 0, false
 }
@@ -1,6 +1,6 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
 // versions:
-// 	protoc-gen-go v1.26.0
+// 	protoc-gen-go v1.30.0
 // 	protoc        v3.17.3
 // source: graytorrent.proto
 
@@ -23,11 +23,12 @@ const (
 type Torrent_State int32
 
 const (
-	Torrent_DOWNLOADING Torrent_State = 0
-	Torrent_STOPPED     Torrent_State = 1
-	Torrent_STALLED     Torrent_State = 2
-	Torrent_SEEDING     Torrent_State = 3
-	Torrent_COMPLETE    Torrent_State = 4
+	Torrent_DOWNLOADING       Torrent_State = 0
+	Torrent_STOPPED           Torrent_State = 1
+	Torrent_STALLED           Torrent_State = 2
+	Torrent_SEEDING           Torrent_State = 3
+	Torrent_COMPLETE          Torrent_State = 4
+	Torrent_FETCHING_METADATA Torrent_State = 5
 )
 
 // Enum value maps for Torrent_State.
@@ -38,13 +39,15 @@ var (
 		2: "STALLED",
 		3: "SEEDING",
 		4: "COMPLETE",
+		5: "FETCHING_METADATA",
 	}
 	Torrent_State_value = map[string]int32{
-		"DOWNLOADING": 0,
-		"STOPPED":     1,
-		"STALLED":     2,
-		"SEEDING":     3,
-		"COMPLETE":    4,
+		"DOWNLOADING":       0,
+		"STOPPED":           1,
+		"STALLED":           2,
+		"SEEDING":           3,
+		"COMPLETE":          4,
+		"FETCHING_METADATA": 5,
 	}
 )
 
@@ -75,6 +78,116 @@ func (Torrent_State) EnumDescriptor() ([]byte, []int) {
 	return file_graytorrent_proto_rawDescGZIP(), []int{1, 0}
 }
 
+type Peer_Source int32
+
+const (
+	Peer_TRACKER  Peer_Source = 0
+	Peer_INCOMING Peer_Source = 1
+	Peer_DHT      Peer_Source = 2
+	Peer_PEX      Peer_Source = 3
+	Peer_MAGNET   Peer_Source = 4
+	Peer_LSD      Peer_Source = 5
+)
+
+// Enum value maps for Peer_Source.
+var (
+	Peer_Source_name = map[int32]string{
+		0: "TRACKER",
+		1: "INCOMING",
+		2: "DHT",
+		3: "PEX",
+		4: "MAGNET",
+		5: "LSD",
+	}
+	Peer_Source_value = map[string]int32{
+		"TRACKER":  0,
+		"INCOMING": 1,
+		"DHT":      2,
+		"PEX":      3,
+		"MAGNET":   4,
+		"LSD":      5,
+	}
+)
+
+func (x Peer_Source) Enum() *Peer_Source {
+	p := new(Peer_Source)
+	*p = x
+	return p
+}
+
+func (x Peer_Source) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (Peer_Source) Descriptor() protoreflect.EnumDescriptor {
+	return file_graytorrent_proto_enumTypes[1].Descriptor()
+}
+
+func (Peer_Source) Type() protoreflect.EnumType {
+	return &file_graytorrent_proto_enumTypes[1]
+}
+
+func (x Peer_Source) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use Peer_Source.Descriptor instead.
+func (Peer_Source) EnumDescriptor() ([]byte, []int) {
+	return file_graytorrent_proto_rawDescGZIP(), []int{3, 0}
+}
+
+type File_Priority int32
+
+const (
+	File_NORMAL File_Priority = 0
+	File_SKIP   File_Priority = 1
+	File_LOW    File_Priority = 2
+	File_HIGH   File_Priority = 3
+)
+
+// Enum value maps for File_Priority.
+var (
+	File_Priority_name = map[int32]string{
+		0: "NORMAL",
+		1: "SKIP",
+		2: "LOW",
+		3: "HIGH",
+	}
+	File_Priority_value = map[string]int32{
+		"NORMAL": 0,
+		"SKIP":   1,
+		"LOW":    2,
+		"HIGH":   3,
+	}
+)
+
+func (x File_Priority) Enum() *File_Priority {
+	p := new(File_Priority)
+	*p = x
+	return p
+}
+
+func (x File_Priority) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (File_Priority) Descriptor() protoreflect.EnumDescriptor {
+	return file_graytorrent_proto_enumTypes[2].Descriptor()
+}
+
+func (File_Priority) Type() protoreflect.EnumType {
+	return &file_graytorrent_proto_enumTypes[2]
+}
+
+func (x File_Priority) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use File_Priority.Descriptor instead.
+func (File_Priority) EnumDescriptor() ([]byte, []int) {
+	return file_graytorrent_proto_rawDescGZIP(), []int{11, 0}
+}
+
 type SessionRequest_Type int32
 
 const (
@@ -111,11 +224,11 @@ func (x SessionRequest_Type) String() string {
 }
 
 func (SessionRequest_Type) Descriptor() protoreflect.EnumDescriptor {
-	return file_graytorrent_proto_enumTypes[1].Descriptor()
+	return file_graytorrent_proto_enumTypes[3].Descriptor()
 }
 
 func (SessionRequest_Type) Type() protoreflect.EnumType {
-	return &file_graytorrent_proto_enumTypes[1]
+	return &file_graytorrent_proto_enumTypes[3]
 }
 
 func (x SessionRequest_Type) Number() protoreflect.EnumNumber {
@@ -124,7 +237,7 @@ func (x SessionRequest_Type) Number() protoreflect.EnumNumber {
 
 // Deprecated: Use SessionRequest_Type.Descriptor instead.
 func (SessionRequest_Type) EnumDescriptor() ([]byte, []int) {
-	return file_graytorrent_proto_rawDescGZIP(), []int{6, 0}
+	return file_graytorrent_proto_rawDescGZIP(), []int{15, 0}
 }
 
 type SessionReply_Event int32
@@ -166,11 +279,11 @@ func (x SessionReply_Event) String() string {
 }
 
 func (SessionReply_Event) Descriptor() protoreflect.EnumDescriptor {
-	return file_graytorrent_proto_enumTypes[2].Descriptor()
+	return file_graytorrent_proto_enumTypes[4].Descriptor()
 }
 
 func (SessionReply_Event) Type() protoreflect.EnumType {
-	return &file_graytorrent_proto_enumTypes[2]
+	return &file_graytorrent_proto_enumTypes[4]
 }
 
 func (x SessionReply_Event) Number() protoreflect.EnumNumber {
@@ -179,7 +292,7 @@ func (x SessionReply_Event) Number() protoreflect.EnumNumber {
 
 // Deprecated: Use SessionReply_Event.Descriptor instead.
 func (SessionReply_Event) EnumDescriptor() ([]byte, []int) {
-	return file_graytorrent_proto_rawDescGZIP(), []int{7, 0}
+	return file_graytorrent_proto_rawDescGZIP(), []int{16, 0}
 }
 
 type Empty struct {
@@ -233,6 +346,11 @@ type Torrent struct {
 	UpRate      uint32        `protobuf:"varint,6,opt,name=upRate,proto3" json:"upRate,omitempty"`
 	State       Torrent_State `protobuf:"varint,7,opt,name=state,proto3,enum=graytorrent.Torrent_State" json:"state,omitempty"`
 	Id          uint32        `protobuf:"varint,8,opt,name=id,proto3" json:"id,omitempty"`
+	Peers       []*Peer       `protobuf:"bytes,9,rep,name=peers,proto3" json:"peers,omitempty"`
+	Trackers    []*Tracker    `protobuf:"bytes,10,rep,name=trackers,proto3" json:"trackers,omitempty"`
+	Wanted      uint64        `protobuf:"varint,11,opt,name=wanted,proto3" json:"wanted,omitempty"` // Bytes of the pieces of files that aren't skipped
+	Sequential  bool          `protobuf:"varint,12,opt,name=sequential,proto3" json:"sequential,omitempty"`
+	FirstLast   bool          `protobuf:"varint,13,opt,name=firstLast,proto3" json:"firstLast,omitempty"`
 }
 
 func (x *Torrent) Reset() {
@@ -323,6 +441,183 @@ func (x *Torrent) GetId() uint32 {
 	return 0
 }
 
+func (x *Torrent) GetPeers() []*Peer {
+	if x != nil {
+		return x.Peers
+	}
+	return nil
+}
+
+func (x *Torrent) GetTrackers() []*Tracker {
+	if x != nil {
+		return x.Trackers
+	}
+	return nil
+}
+
+func (x *Torrent) GetWanted() uint64 {
+	if x != nil {
+		return x.Wanted
+	}
+	return 0
+}
+
+func (x *Torrent) GetSequential() bool {
+	if x != nil {
+		return x.Sequential
+	}
+	return false
+}
+
+func (x *Torrent) GetFirstLast() bool {
+	if x != nil {
+		return x.FirstLast
+	}
+	return false
+}
+
+type Tracker struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Announce string `protobuf:"bytes,1,opt,name=announce,proto3" json:"announce,omitempty"`
+	Tier     uint32 `protobuf:"varint,2,opt,name=tier,proto3" json:"tier,omitempty"`
+	Working  bool   `protobuf:"varint,3,opt,name=working,proto3" json:"working,omitempty"`
+	Failure  string `protobuf:"bytes,4,opt,name=failure,proto3" json:"failure,omitempty"` // Why the tracker refused our last request
+	Warning  string `protobuf:"bytes,5,opt,name=warning,proto3" json:"warning,omitempty"`
+}
+
+func (x *Tracker) Reset() {
+	*x = Tracker{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_graytorrent_proto_msgTypes[2]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Tracker) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Tracker) ProtoMessage() {}
+
+func (x *Tracker) ProtoReflect() protoreflect.Message {
+	mi := &file_graytorrent_proto_msgTypes[2]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Tracker.ProtoReflect.Descriptor instead.
+func (*Tracker) Descriptor() ([]byte, []int) {
+	return file_graytorrent_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Tracker) GetAnnounce() string {
+	if x != nil {
+		return x.Announce
+	}
+	return ""
+}
+
+func (x *Tracker) GetTier() uint32 {
+	if x != nil {
+		return x.Tier
+	}
+	return 0
+}
+
+func (x *Tracker) GetWorking() bool {
+	if x != nil {
+		return x.Working
+	}
+	return false
+}
+
+func (x *Tracker) GetFailure() string {
+	if x != nil {
+		return x.Failure
+	}
+	return ""
+}
+
+func (x *Tracker) GetWarning() string {
+	if x != nil {
+		return x.Warning
+	}
+	return ""
+}
+
+type Peer struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Addr   string      `protobuf:"bytes,1,opt,name=addr,proto3" json:"addr,omitempty"`
+	Source Peer_Source `protobuf:"varint,2,opt,name=source,proto3,enum=graytorrent.Peer_Source" json:"source,omitempty"`
+	Client string      `protobuf:"bytes,3,opt,name=client,proto3" json:"client,omitempty"`
+}
+
+func (x *Peer) Reset() {
+	*x = Peer{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_graytorrent_proto_msgTypes[3]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Peer) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Peer) ProtoMessage() {}
+
+func (x *Peer) ProtoReflect() protoreflect.Message {
+	mi := &file_graytorrent_proto_msgTypes[3]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Peer.ProtoReflect.Descriptor instead.
+func (*Peer) Descriptor() ([]byte, []int) {
+	return file_graytorrent_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Peer) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+func (x *Peer) GetSource() Peer_Source {
+	if x != nil {
+		return x.Source
+	}
+	return Peer_TRACKER
+}
+
+func (x *Peer) GetClient() string {
+	if x != nil {
+		return x.Client
+	}
+	return ""
+}
+
 type ListReply struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -334,7 +629,7 @@ type ListReply struct {
 func (x *ListReply) Reset() {
 	*x = ListReply{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_graytorrent_proto_msgTypes[2]
+		mi := &file_graytorrent_proto_msgTypes[4]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -347,7 +642,7 @@ func (x *ListReply) String() string {
 func (*ListReply) ProtoMessage() {}
 
 func (x *ListReply) ProtoReflect() protoreflect.Message {
-	mi := &file_graytorrent_proto_msgTypes[2]
+	mi := &file_graytorrent_proto_msgTypes[4]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -360,7 +655,7 @@ func (x *ListReply) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use ListReply.ProtoReflect.Descriptor instead.
 func (*ListReply) Descriptor() ([]byte, []int) {
-	return file_graytorrent_proto_rawDescGZIP(), []int{2}
+	return file_graytorrent_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *ListReply) GetTorrents() []*Torrent {
@@ -382,7 +677,7 @@ type TorrentRequest struct {
 func (x *TorrentRequest) Reset() {
 	*x = TorrentRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_graytorrent_proto_msgTypes[3]
+		mi := &file_graytorrent_proto_msgTypes[5]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -395,7 +690,7 @@ func (x *TorrentRequest) String() string {
 func (*TorrentRequest) ProtoMessage() {}
 
 func (x *TorrentRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_graytorrent_proto_msgTypes[3]
+	mi := &file_graytorrent_proto_msgTypes[5]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -408,7 +703,7 @@ func (x *TorrentRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use TorrentRequest.ProtoReflect.Descriptor instead.
 func (*TorrentRequest) Descriptor() ([]byte, []int) {
-	return file_graytorrent_proto_rawDescGZIP(), []int{3}
+	return file_graytorrent_proto_rawDescGZIP(), []int{5}
 }
 
 func (x *TorrentRequest) GetInfoHash() []byte {
@@ -430,15 +725,17 @@ type AddRequest struct {
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Name      string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
-	Magnet    bool   `protobuf:"varint,2,opt,name=magnet,proto3" json:"magnet,omitempty"`
-	Directory string `protobuf:"bytes,3,opt,name=directory,proto3" json:"directory,omitempty"`
+	Name       string `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Magnet     bool   `protobuf:"varint,2,opt,name=magnet,proto3" json:"magnet,omitempty"`
+	Directory  string `protobuf:"bytes,3,opt,name=directory,proto3" json:"directory,omitempty"`
+	Sequential bool   `protobuf:"varint,4,opt,name=sequential,proto3" json:"sequential,omitempty"` // Download pieces in order, for playing files while they download
+	FirstLast  bool   `protobuf:"varint,5,opt,name=firstLast,proto3" json:"firstLast,omitempty"`   // Download the first and last pieces of each file before the rest
 }
 
 func (x *AddRequest) Reset() {
 	*x = AddRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_graytorrent_proto_msgTypes[4]
+		mi := &file_graytorrent_proto_msgTypes[6]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -451,7 +748,7 @@ func (x *AddRequest) String() string {
 func (*AddRequest) ProtoMessage() {}
 
 func (x *AddRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_graytorrent_proto_msgTypes[4]
+	mi := &file_graytorrent_proto_msgTypes[6]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -464,7 +761,7 @@ func (x *AddRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AddRequest.ProtoReflect.Descriptor instead.
 func (*AddRequest) Descriptor() ([]byte, []int) {
-	return file_graytorrent_proto_rawDescGZIP(), []int{4}
+	return file_graytorrent_proto_rawDescGZIP(), []int{6}
 }
 
 func (x *AddRequest) GetName() string {
@@ -488,6 +785,20 @@ func (x *AddRequest) GetDirectory() string {
 	return ""
 }
 
+func (x *AddRequest) GetSequential() bool {
+	if x != nil {
+		return x.Sequential
+	}
+	return false
+}
+
+func (x *AddRequest) GetFirstLast() bool {
+	if x != nil {
+		return x.FirstLast
+	}
+	return false
+}
+
 type RemoveRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -500,7 +811,7 @@ type RemoveRequest struct {
 func (x *RemoveRequest) Reset() {
 	*x = RemoveRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_graytorrent_proto_msgTypes[5]
+		mi := &file_graytorrent_proto_msgTypes[7]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -513,7 +824,7 @@ func (x *RemoveRequest) String() string {
 func (*RemoveRequest) ProtoMessage() {}
 
 func (x *RemoveRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_graytorrent_proto_msgTypes[5]
+	mi := &file_graytorrent_proto_msgTypes[7]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -526,7 +837,7 @@ func (x *RemoveRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RemoveRequest.ProtoReflect.Descriptor instead.
 func (*RemoveRequest) Descriptor() ([]byte, []int) {
-	return file_graytorrent_proto_rawDescGZIP(), []int{5}
+	return file_graytorrent_proto_rawDescGZIP(), []int{7}
 }
 
 func (x *RemoveRequest) GetTorrentRequest() *TorrentRequest {
@@ -543,39 +854,36 @@ func (x *RemoveRequest) GetRmFiles() bool {
 	return false
 }
 
-type SessionRequest struct {
+type ScrapeRequest struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Type SessionRequest_Type `protobuf:"varint,1,opt,name=type,proto3,enum=graytorrent.SessionRequest_Type" json:"type,omitempty"`
 	// Union (Oneof)
 	//
 	// Types that are assignable to Request:
-	//	*SessionRequest_Add
-	//	*SessionRequest_Remove
-	//	*SessionRequest_Start
-	//	*SessionRequest_Stop
-	Request isSessionRequest_Request `protobuf_oneof:"request"`
+	//	*ScrapeRequest_TorrentRequest
+	//	*ScrapeRequest_File
+	Request isScrapeRequest_Request `protobuf_oneof:"request"`
 }
 
-func (x *SessionRequest) Reset() {
-	*x = SessionRequest{}
+func (x *ScrapeRequest) Reset() {
+	*x = ScrapeRequest{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_graytorrent_proto_msgTypes[6]
+		mi := &file_graytorrent_proto_msgTypes[8]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
 }
 
-func (x *SessionRequest) String() string {
+func (x *ScrapeRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*SessionRequest) ProtoMessage() {}
+func (*ScrapeRequest) ProtoMessage() {}
 
-func (x *SessionRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_graytorrent_proto_msgTypes[6]
+func (x *ScrapeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_graytorrent_proto_msgTypes[8]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -586,43 +894,506 @@ func (x *SessionRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use SessionRequest.ProtoReflect.Descriptor instead.
-func (*SessionRequest) Descriptor() ([]byte, []int) {
-	return file_graytorrent_proto_rawDescGZIP(), []int{6}
-}
-
-func (x *SessionRequest) GetType() SessionRequest_Type {
-	if x != nil {
-		return x.Type
-	}
-	return SessionRequest_ADD
+// Deprecated: Use ScrapeRequest.ProtoReflect.Descriptor instead.
+func (*ScrapeRequest) Descriptor() ([]byte, []int) {
+	return file_graytorrent_proto_rawDescGZIP(), []int{8}
 }
 
-func (m *SessionRequest) GetRequest() isSessionRequest_Request {
+func (m *ScrapeRequest) GetRequest() isScrapeRequest_Request {
 	if m != nil {
 		return m.Request
 	}
 	return nil
 }
 
-func (x *SessionRequest) GetAdd() *AddRequest {
-	if x, ok := x.GetRequest().(*SessionRequest_Add); ok {
-		return x.Add
+func (x *ScrapeRequest) GetTorrentRequest() *TorrentRequest {
+	if x, ok := x.GetRequest().(*ScrapeRequest_TorrentRequest); ok {
+		return x.TorrentRequest
 	}
 	return nil
 }
 
-func (x *SessionRequest) GetRemove() *RemoveRequest {
-	if x, ok := x.GetRequest().(*SessionRequest_Remove); ok {
-		return x.Remove
+func (x *ScrapeRequest) GetFile() string {
+	if x, ok := x.GetRequest().(*ScrapeRequest_File); ok {
+		return x.File
 	}
-	return nil
+	return ""
 }
 
-func (x *SessionRequest) GetStart() *TorrentRequest {
-	if x, ok := x.GetRequest().(*SessionRequest_Start); ok {
-		return x.Start
-	}
+type isScrapeRequest_Request interface {
+	isScrapeRequest_Request()
+}
+
+type ScrapeRequest_TorrentRequest struct {
+	TorrentRequest *TorrentRequest `protobuf:"bytes,1,opt,name=torrentRequest,proto3,oneof"` // A managed torrent
+}
+
+type ScrapeRequest_File struct {
+	File string `protobuf:"bytes,2,opt,name=file,proto3,oneof"` // A .torrent file that doesn't need to be added
+}
+
+func (*ScrapeRequest_TorrentRequest) isScrapeRequest_Request() {}
+
+func (*ScrapeRequest_File) isScrapeRequest_Request() {}
+
+type TrackerScrape struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Announce   string `protobuf:"bytes,1,opt,name=announce,proto3" json:"announce,omitempty"`
+	Complete   uint32 `protobuf:"varint,2,opt,name=complete,proto3" json:"complete,omitempty"`
+	Downloaded uint32 `protobuf:"varint,3,opt,name=downloaded,proto3" json:"downloaded,omitempty"`
+	Incomplete uint32 `protobuf:"varint,4,opt,name=incomplete,proto3" json:"incomplete,omitempty"`
+	Error      string `protobuf:"bytes,5,opt,name=error,proto3" json:"error,omitempty"` // Set if the tracker could not be scraped
+}
+
+func (x *TrackerScrape) Reset() {
+	*x = TrackerScrape{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_graytorrent_proto_msgTypes[9]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *TrackerScrape) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TrackerScrape) ProtoMessage() {}
+
+func (x *TrackerScrape) ProtoReflect() protoreflect.Message {
+	mi := &file_graytorrent_proto_msgTypes[9]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TrackerScrape.ProtoReflect.Descriptor instead.
+func (*TrackerScrape) Descriptor() ([]byte, []int) {
+	return file_graytorrent_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *TrackerScrape) GetAnnounce() string {
+	if x != nil {
+		return x.Announce
+	}
+	return ""
+}
+
+func (x *TrackerScrape) GetComplete() uint32 {
+	if x != nil {
+		return x.Complete
+	}
+	return 0
+}
+
+func (x *TrackerScrape) GetDownloaded() uint32 {
+	if x != nil {
+		return x.Downloaded
+	}
+	return 0
+}
+
+func (x *TrackerScrape) GetIncomplete() uint32 {
+	if x != nil {
+		return x.Incomplete
+	}
+	return 0
+}
+
+func (x *TrackerScrape) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type ScrapeReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Trackers []*TrackerScrape `protobuf:"bytes,1,rep,name=trackers,proto3" json:"trackers,omitempty"`
+}
+
+func (x *ScrapeReply) Reset() {
+	*x = ScrapeReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_graytorrent_proto_msgTypes[10]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *ScrapeReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ScrapeReply) ProtoMessage() {}
+
+func (x *ScrapeReply) ProtoReflect() protoreflect.Message {
+	mi := &file_graytorrent_proto_msgTypes[10]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ScrapeReply.ProtoReflect.Descriptor instead.
+func (*ScrapeReply) Descriptor() ([]byte, []int) {
+	return file_graytorrent_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *ScrapeReply) GetTrackers() []*TrackerScrape {
+	if x != nil {
+		return x.Trackers
+	}
+	return nil
+}
+
+type File struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Path     string        `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Length   uint64        `protobuf:"varint,2,opt,name=length,proto3" json:"length,omitempty"`
+	Priority File_Priority `protobuf:"varint,3,opt,name=priority,proto3,enum=graytorrent.File_Priority" json:"priority,omitempty"`
+	Done     uint64        `protobuf:"varint,4,opt,name=done,proto3" json:"done,omitempty"`   // Bytes of the file in pieces we have
+	Index    uint32        `protobuf:"varint,5,opt,name=index,proto3" json:"index,omitempty"` // Selects the file when changing priorities, padding files aren't listed
+}
+
+func (x *File) Reset() {
+	*x = File{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_graytorrent_proto_msgTypes[11]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *File) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*File) ProtoMessage() {}
+
+func (x *File) ProtoReflect() protoreflect.Message {
+	mi := &file_graytorrent_proto_msgTypes[11]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use File.ProtoReflect.Descriptor instead.
+func (*File) Descriptor() ([]byte, []int) {
+	return file_graytorrent_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *File) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *File) GetLength() uint64 {
+	if x != nil {
+		return x.Length
+	}
+	return 0
+}
+
+func (x *File) GetPriority() File_Priority {
+	if x != nil {
+		return x.Priority
+	}
+	return File_NORMAL
+}
+
+func (x *File) GetDone() uint64 {
+	if x != nil {
+		return x.Done
+	}
+	return 0
+}
+
+func (x *File) GetIndex() uint32 {
+	if x != nil {
+		return x.Index
+	}
+	return 0
+}
+
+type FilesReply struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Files []*File `protobuf:"bytes,1,rep,name=files,proto3" json:"files,omitempty"`
+}
+
+func (x *FilesReply) Reset() {
+	*x = FilesReply{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_graytorrent_proto_msgTypes[12]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FilesReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FilesReply) ProtoMessage() {}
+
+func (x *FilesReply) ProtoReflect() protoreflect.Message {
+	mi := &file_graytorrent_proto_msgTypes[12]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FilesReply.ProtoReflect.Descriptor instead.
+func (*FilesReply) Descriptor() ([]byte, []int) {
+	return file_graytorrent_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *FilesReply) GetFiles() []*File {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+type PriorityRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TorrentRequest *TorrentRequest `protobuf:"bytes,1,opt,name=torrentRequest,proto3" json:"torrentRequest,omitempty"`
+	Files          []uint32        `protobuf:"varint,2,rep,packed,name=files,proto3" json:"files,omitempty"` // Indices of the files to change, every file if empty
+	Priority       File_Priority   `protobuf:"varint,3,opt,name=priority,proto3,enum=graytorrent.File_Priority" json:"priority,omitempty"`
+}
+
+func (x *PriorityRequest) Reset() {
+	*x = PriorityRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_graytorrent_proto_msgTypes[13]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *PriorityRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PriorityRequest) ProtoMessage() {}
+
+func (x *PriorityRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_graytorrent_proto_msgTypes[13]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PriorityRequest.ProtoReflect.Descriptor instead.
+func (*PriorityRequest) Descriptor() ([]byte, []int) {
+	return file_graytorrent_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *PriorityRequest) GetTorrentRequest() *TorrentRequest {
+	if x != nil {
+		return x.TorrentRequest
+	}
+	return nil
+}
+
+func (x *PriorityRequest) GetFiles() []uint32 {
+	if x != nil {
+		return x.Files
+	}
+	return nil
+}
+
+func (x *PriorityRequest) GetPriority() File_Priority {
+	if x != nil {
+		return x.Priority
+	}
+	return File_NORMAL
+}
+
+type OrderRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	TorrentRequest *TorrentRequest `protobuf:"bytes,1,opt,name=torrentRequest,proto3" json:"torrentRequest,omitempty"`
+	Sequential     bool            `protobuf:"varint,2,opt,name=sequential,proto3" json:"sequential,omitempty"`
+	FirstLast      bool            `protobuf:"varint,3,opt,name=firstLast,proto3" json:"firstLast,omitempty"`
+}
+
+func (x *OrderRequest) Reset() {
+	*x = OrderRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_graytorrent_proto_msgTypes[14]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *OrderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OrderRequest) ProtoMessage() {}
+
+func (x *OrderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_graytorrent_proto_msgTypes[14]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OrderRequest.ProtoReflect.Descriptor instead.
+func (*OrderRequest) Descriptor() ([]byte, []int) {
+	return file_graytorrent_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *OrderRequest) GetTorrentRequest() *TorrentRequest {
+	if x != nil {
+		return x.TorrentRequest
+	}
+	return nil
+}
+
+func (x *OrderRequest) GetSequential() bool {
+	if x != nil {
+		return x.Sequential
+	}
+	return false
+}
+
+func (x *OrderRequest) GetFirstLast() bool {
+	if x != nil {
+		return x.FirstLast
+	}
+	return false
+}
+
+type SessionRequest struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Type SessionRequest_Type `protobuf:"varint,1,opt,name=type,proto3,enum=graytorrent.SessionRequest_Type" json:"type,omitempty"`
+	// Union (Oneof)
+	//
+	// Types that are assignable to Request:
+	//	*SessionRequest_Add
+	//	*SessionRequest_Remove
+	//	*SessionRequest_Start
+	//	*SessionRequest_Stop
+	Request isSessionRequest_Request `protobuf_oneof:"request"`
+}
+
+func (x *SessionRequest) Reset() {
+	*x = SessionRequest{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_graytorrent_proto_msgTypes[15]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *SessionRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SessionRequest) ProtoMessage() {}
+
+func (x *SessionRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_graytorrent_proto_msgTypes[15]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SessionRequest.ProtoReflect.Descriptor instead.
+func (*SessionRequest) Descriptor() ([]byte, []int) {
+	return file_graytorrent_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *SessionRequest) GetType() SessionRequest_Type {
+	if x != nil {
+		return x.Type
+	}
+	return SessionRequest_ADD
+}
+
+func (m *SessionRequest) GetRequest() isSessionRequest_Request {
+	if m != nil {
+		return m.Request
+	}
+	return nil
+}
+
+func (x *SessionRequest) GetAdd() *AddRequest {
+	if x, ok := x.GetRequest().(*SessionRequest_Add); ok {
+		return x.Add
+	}
+	return nil
+}
+
+func (x *SessionRequest) GetRemove() *RemoveRequest {
+	if x, ok := x.GetRequest().(*SessionRequest_Remove); ok {
+		return x.Remove
+	}
+	return nil
+}
+
+func (x *SessionRequest) GetStart() *TorrentRequest {
+	if x, ok := x.GetRequest().(*SessionRequest_Start); ok {
+		return x.Start
+	}
 	return nil
 }
 
@@ -673,7 +1444,7 @@ type SessionReply struct {
 func (x *SessionReply) Reset() {
 	*x = SessionReply{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_graytorrent_proto_msgTypes[7]
+		mi := &file_graytorrent_proto_msgTypes[16]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -686,7 +1457,7 @@ func (x *SessionReply) String() string {
 func (*SessionReply) ProtoMessage() {}
 
 func (x *SessionReply) ProtoReflect() protoreflect.Message {
-	mi := &file_graytorrent_proto_msgTypes[7]
+	mi := &file_graytorrent_proto_msgTypes[16]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -699,7 +1470,7 @@ func (x *SessionReply) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use SessionReply.ProtoReflect.Descriptor instead.
 func (*SessionReply) Descriptor() ([]byte, []int) {
-	return file_graytorrent_proto_rawDescGZIP(), []int{7}
+	return file_graytorrent_proto_rawDescGZIP(), []int{16}
 }
 
 func (x *SessionReply) GetTorrent() *Torrent {
@@ -721,7 +1492,7 @@ var File_graytorrent_proto protoreflect.FileDescriptor
 var file_graytorrent_proto_rawDesc = []byte{
 	0x0a, 0x11, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x70, 0x72,
 	0x6f, 0x74, 0x6f, 0x12, 0x0b, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74,
-	0x22, 0x07, 0x0a, 0x05, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0xb4, 0x02, 0x0a, 0x07, 0x54, 0x6f,
+	0x22, 0x07, 0x0a, 0x05, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0xfc, 0x03, 0x0a, 0x07, 0x54, 0x6f,
 	0x72, 0x72, 0x65, 0x6e, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20,
 	0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x69, 0x6e, 0x66,
 	0x6f, 0x48, 0x61, 0x73, 0x68, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x69, 0x6e, 0x66,
@@ -736,91 +1507,202 @@ var file_graytorrent_proto_rawDesc = []byte{
 	0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x54, 0x6f, 0x72,
 	0x72, 0x65, 0x6e, 0x74, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x65, 0x52, 0x05, 0x73, 0x74, 0x61, 0x74,
 	0x65, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x02, 0x69,
-	0x64, 0x22, 0x4d, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x0f, 0x0a, 0x0b, 0x44, 0x4f,
-	0x57, 0x4e, 0x4c, 0x4f, 0x41, 0x44, 0x49, 0x4e, 0x47, 0x10, 0x00, 0x12, 0x0b, 0x0a, 0x07, 0x53,
-	0x54, 0x4f, 0x50, 0x50, 0x45, 0x44, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x54, 0x41, 0x4c,
-	0x4c, 0x45, 0x44, 0x10, 0x02, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x45, 0x45, 0x44, 0x49, 0x4e, 0x47,
-	0x10, 0x03, 0x12, 0x0c, 0x0a, 0x08, 0x43, 0x4f, 0x4d, 0x50, 0x4c, 0x45, 0x54, 0x45, 0x10, 0x04,
-	0x22, 0x3d, 0x0a, 0x09, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x30, 0x0a,
-	0x08, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32,
-	0x14, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x54, 0x6f,
-	0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x08, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x73, 0x22,
-	0x3c, 0x0a, 0x0e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
-	0x74, 0x12, 0x1a, 0x0a, 0x08, 0x69, 0x6e, 0x66, 0x6f, 0x48, 0x61, 0x73, 0x68, 0x18, 0x01, 0x20,
-	0x01, 0x28, 0x0c, 0x52, 0x08, 0x69, 0x6e, 0x66, 0x6f, 0x48, 0x61, 0x73, 0x68, 0x12, 0x0e, 0x0a,
-	0x02, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x02, 0x69, 0x64, 0x22, 0x56, 0x0a,
-	0x0a, 0x41, 0x64, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x12, 0x0a, 0x04, 0x6e,
-	0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12,
-	0x16, 0x0a, 0x06, 0x6d, 0x61, 0x67, 0x6e, 0x65, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52,
-	0x06, 0x6d, 0x61, 0x67, 0x6e, 0x65, 0x74, 0x12, 0x1c, 0x0a, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63,
-	0x74, 0x6f, 0x72, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09, 0x64, 0x69, 0x72, 0x65,
-	0x63, 0x74, 0x6f, 0x72, 0x79, 0x22, 0x6e, 0x0a, 0x0d, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x52,
-	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x43, 0x0a, 0x0e, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e,
-	0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b,
-	0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x54, 0x6f, 0x72,
-	0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x52, 0x0e, 0x74, 0x6f, 0x72,
-	0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x18, 0x0a, 0x07, 0x72,
-	0x6d, 0x46, 0x69, 0x6c, 0x65, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x72, 0x6d,
-	0x46, 0x69, 0x6c, 0x65, 0x73, 0x22, 0xce, 0x02, 0x0a, 0x0e, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f,
-	0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x34, 0x0a, 0x04, 0x74, 0x79, 0x70, 0x65,
-	0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x20, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72,
-	0x72, 0x65, 0x6e, 0x74, 0x2e, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75,
-	0x65, 0x73, 0x74, 0x2e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65, 0x12, 0x2b,
-	0x0a, 0x03, 0x61, 0x64, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x67, 0x72,
-	0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x41, 0x64, 0x64, 0x52, 0x65, 0x71,
-	0x75, 0x65, 0x73, 0x74, 0x48, 0x00, 0x52, 0x03, 0x61, 0x64, 0x64, 0x12, 0x34, 0x0a, 0x06, 0x72,
-	0x65, 0x6d, 0x6f, 0x76, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x72,
-	0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65,
-	0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x48, 0x00, 0x52, 0x06, 0x72, 0x65, 0x6d, 0x6f, 0x76,
-	0x65, 0x12, 0x33, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x72, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b,
-	0x32, 0x1b, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x54,
-	0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x48, 0x00, 0x52,
-	0x05, 0x73, 0x74, 0x61, 0x72, 0x74, 0x12, 0x31, 0x0a, 0x04, 0x73, 0x74, 0x6f, 0x70, 0x18, 0x05,
-	0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65,
+	0x64, 0x12, 0x27, 0x0a, 0x05, 0x70, 0x65, 0x65, 0x72, 0x73, 0x18, 0x09, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x11, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x50,
+	0x65, 0x65, 0x72, 0x52, 0x05, 0x70, 0x65, 0x65, 0x72, 0x73, 0x12, 0x30, 0x0a, 0x08, 0x74, 0x72,
+	0x61, 0x63, 0x6b, 0x65, 0x72, 0x73, 0x18, 0x0a, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x67,
+	0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x54, 0x72, 0x61, 0x63, 0x6b,
+	0x65, 0x72, 0x52, 0x08, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x73, 0x12, 0x16, 0x0a, 0x06,
+	0x77, 0x61, 0x6e, 0x74, 0x65, 0x64, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x77, 0x61,
+	0x6e, 0x74, 0x65, 0x64, 0x12, 0x1e, 0x0a, 0x0a, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x74, 0x69,
+	0x61, 0x6c, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e,
+	0x74, 0x69, 0x61, 0x6c, 0x12, 0x1c, 0x0a, 0x09, 0x66, 0x69, 0x72, 0x73, 0x74, 0x4c, 0x61, 0x73,
+	0x74, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x66, 0x69, 0x72, 0x73, 0x74, 0x4c, 0x61,
+	0x73, 0x74, 0x22, 0x64, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x74, 0x65, 0x12, 0x0f, 0x0a, 0x0b, 0x44,
+	0x4f, 0x57, 0x4e, 0x4c, 0x4f, 0x41, 0x44, 0x49, 0x4e, 0x47, 0x10, 0x00, 0x12, 0x0b, 0x0a, 0x07,
+	0x53, 0x54, 0x4f, 0x50, 0x50, 0x45, 0x44, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x54, 0x41,
+	0x4c, 0x4c, 0x45, 0x44, 0x10, 0x02, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x45, 0x45, 0x44, 0x49, 0x4e,
+	0x47, 0x10, 0x03, 0x12, 0x0c, 0x0a, 0x08, 0x43, 0x4f, 0x4d, 0x50, 0x4c, 0x45, 0x54, 0x45, 0x10,
+	0x04, 0x12, 0x15, 0x0a, 0x11, 0x46, 0x45, 0x54, 0x43, 0x48, 0x49, 0x4e, 0x47, 0x5f, 0x4d, 0x45,
+	0x54, 0x41, 0x44, 0x41, 0x54, 0x41, 0x10, 0x05, 0x22, 0x87, 0x01, 0x0a, 0x07, 0x54, 0x72, 0x61,
+	0x63, 0x6b, 0x65, 0x72, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x6e, 0x6e, 0x6f, 0x75, 0x6e, 0x63, 0x65,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x61, 0x6e, 0x6e, 0x6f, 0x75, 0x6e, 0x63, 0x65,
+	0x12, 0x12, 0x0a, 0x04, 0x74, 0x69, 0x65, 0x72, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04,
+	0x74, 0x69, 0x65, 0x72, 0x12, 0x18, 0x0a, 0x07, 0x77, 0x6f, 0x72, 0x6b, 0x69, 0x6e, 0x67, 0x18,
+	0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x07, 0x77, 0x6f, 0x72, 0x6b, 0x69, 0x6e, 0x67, 0x12, 0x18,
+	0x0a, 0x07, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x07, 0x66, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x12, 0x18, 0x0a, 0x07, 0x77, 0x61, 0x72, 0x6e,
+	0x69, 0x6e, 0x67, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x77, 0x61, 0x72, 0x6e, 0x69,
+	0x6e, 0x67, 0x22, 0xb0, 0x01, 0x0a, 0x04, 0x50, 0x65, 0x65, 0x72, 0x12, 0x12, 0x0a, 0x04, 0x61,
+	0x64, 0x64, 0x72, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x61, 0x64, 0x64, 0x72, 0x12,
+	0x30, 0x0a, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32,
+	0x18, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x50, 0x65,
+	0x65, 0x72, 0x2e, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x52, 0x06, 0x73, 0x6f, 0x75, 0x72, 0x63,
+	0x65, 0x12, 0x16, 0x0a, 0x06, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x06, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x22, 0x4a, 0x0a, 0x06, 0x53, 0x6f, 0x75,
+	0x72, 0x63, 0x65, 0x12, 0x0b, 0x0a, 0x07, 0x54, 0x52, 0x41, 0x43, 0x4b, 0x45, 0x52, 0x10, 0x00,
+	0x12, 0x0c, 0x0a, 0x08, 0x49, 0x4e, 0x43, 0x4f, 0x4d, 0x49, 0x4e, 0x47, 0x10, 0x01, 0x12, 0x07,
+	0x0a, 0x03, 0x44, 0x48, 0x54, 0x10, 0x02, 0x12, 0x07, 0x0a, 0x03, 0x50, 0x45, 0x58, 0x10, 0x03,
+	0x12, 0x0a, 0x0a, 0x06, 0x4d, 0x41, 0x47, 0x4e, 0x45, 0x54, 0x10, 0x04, 0x12, 0x07, 0x0a, 0x03,
+	0x4c, 0x53, 0x44, 0x10, 0x05, 0x22, 0x3d, 0x0a, 0x09, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x65, 0x70,
+	0x6c, 0x79, 0x12, 0x30, 0x0a, 0x08, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x01,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65,
+	0x6e, 0x74, 0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x08, 0x74, 0x6f, 0x72, 0x72,
+	0x65, 0x6e, 0x74, 0x73, 0x22, 0x3c, 0x0a, 0x0e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x69, 0x6e, 0x66, 0x6f, 0x48, 0x61,
+	0x73, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x08, 0x69, 0x6e, 0x66, 0x6f, 0x48, 0x61,
+	0x73, 0x68, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x02,
+	0x69, 0x64, 0x22, 0x94, 0x01, 0x0a, 0x0a, 0x41, 0x64, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x16, 0x0a, 0x06, 0x6d, 0x61, 0x67, 0x6e, 0x65, 0x74, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x06, 0x6d, 0x61, 0x67, 0x6e, 0x65, 0x74, 0x12, 0x1c, 0x0a,
+	0x09, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x09, 0x64, 0x69, 0x72, 0x65, 0x63, 0x74, 0x6f, 0x72, 0x79, 0x12, 0x1e, 0x0a, 0x0a, 0x73,
+	0x65, 0x71, 0x75, 0x65, 0x6e, 0x74, 0x69, 0x61, 0x6c, 0x18, 0x04, 0x20, 0x01, 0x28, 0x08, 0x52,
+	0x0a, 0x73, 0x65, 0x71, 0x75, 0x65, 0x6e, 0x74, 0x69, 0x61, 0x6c, 0x12, 0x1c, 0x0a, 0x09, 0x66,
+	0x69, 0x72, 0x73, 0x74, 0x4c, 0x61, 0x73, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09,
+	0x66, 0x69, 0x72, 0x73, 0x74, 0x4c, 0x61, 0x73, 0x74, 0x22, 0x6e, 0x0a, 0x0d, 0x52, 0x65, 0x6d,
+	0x6f, 0x76, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x43, 0x0a, 0x0e, 0x74, 0x6f,
+	0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74,
+	0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x52,
+	0x0e, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12,
+	0x18, 0x0a, 0x07, 0x72, 0x6d, 0x46, 0x69, 0x6c, 0x65, 0x73, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x07, 0x72, 0x6d, 0x46, 0x69, 0x6c, 0x65, 0x73, 0x22, 0x77, 0x0a, 0x0d, 0x53, 0x63, 0x72,
+	0x61, 0x70, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x45, 0x0a, 0x0e, 0x74, 0x6f,
+	0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74,
+	0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x48,
+	0x00, 0x52, 0x0e, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
+	0x74, 0x12, 0x14, 0x0a, 0x04, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x48,
+	0x00, 0x52, 0x04, 0x66, 0x69, 0x6c, 0x65, 0x42, 0x09, 0x0a, 0x07, 0x72, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x22, 0x9d, 0x01, 0x0a, 0x0d, 0x54, 0x72, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x53, 0x63,
+	0x72, 0x61, 0x70, 0x65, 0x12, 0x1a, 0x0a, 0x08, 0x61, 0x6e, 0x6e, 0x6f, 0x75, 0x6e, 0x63, 0x65,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x61, 0x6e, 0x6e, 0x6f, 0x75, 0x6e, 0x63, 0x65,
+	0x12, 0x1a, 0x0a, 0x08, 0x63, 0x6f, 0x6d, 0x70, 0x6c, 0x65, 0x74, 0x65, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x0d, 0x52, 0x08, 0x63, 0x6f, 0x6d, 0x70, 0x6c, 0x65, 0x74, 0x65, 0x12, 0x1e, 0x0a, 0x0a,
+	0x64, 0x6f, 0x77, 0x6e, 0x6c, 0x6f, 0x61, 0x64, 0x65, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x0a, 0x64, 0x6f, 0x77, 0x6e, 0x6c, 0x6f, 0x61, 0x64, 0x65, 0x64, 0x12, 0x1e, 0x0a, 0x0a,
+	0x69, 0x6e, 0x63, 0x6f, 0x6d, 0x70, 0x6c, 0x65, 0x74, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x0a, 0x69, 0x6e, 0x63, 0x6f, 0x6d, 0x70, 0x6c, 0x65, 0x74, 0x65, 0x12, 0x14, 0x0a, 0x05,
+	0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72,
+	0x6f, 0x72, 0x22, 0x45, 0x0a, 0x0b, 0x53, 0x63, 0x72, 0x61, 0x70, 0x65, 0x52, 0x65, 0x70, 0x6c,
+	0x79, 0x12, 0x36, 0x0a, 0x08, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x73, 0x18, 0x01, 0x20,
+	0x03, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e,
+	0x74, 0x2e, 0x54, 0x72, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x53, 0x63, 0x72, 0x61, 0x70, 0x65, 0x52,
+	0x08, 0x74, 0x72, 0x61, 0x63, 0x6b, 0x65, 0x72, 0x73, 0x22, 0xc9, 0x01, 0x0a, 0x04, 0x46, 0x69,
+	0x6c, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x61, 0x74, 0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x70, 0x61, 0x74, 0x68, 0x12, 0x16, 0x0a, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x12, 0x36,
+	0x0a, 0x08, 0x70, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e,
+	0x32, 0x1a, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x46,
+	0x69, 0x6c, 0x65, 0x2e, 0x50, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x52, 0x08, 0x70, 0x72,
+	0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x6f, 0x6e, 0x65, 0x18, 0x04,
+	0x20, 0x01, 0x28, 0x04, 0x52, 0x04, 0x64, 0x6f, 0x6e, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x69, 0x6e,
+	0x64, 0x65, 0x78, 0x18, 0x05, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x69, 0x6e, 0x64, 0x65, 0x78,
+	0x22, 0x33, 0x0a, 0x08, 0x50, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x12, 0x0a, 0x0a, 0x06,
+	0x4e, 0x4f, 0x52, 0x4d, 0x41, 0x4c, 0x10, 0x00, 0x12, 0x08, 0x0a, 0x04, 0x53, 0x4b, 0x49, 0x50,
+	0x10, 0x01, 0x12, 0x07, 0x0a, 0x03, 0x4c, 0x4f, 0x57, 0x10, 0x02, 0x12, 0x08, 0x0a, 0x04, 0x48,
+	0x49, 0x47, 0x48, 0x10, 0x03, 0x22, 0x35, 0x0a, 0x0a, 0x46, 0x69, 0x6c, 0x65, 0x73, 0x52, 0x65,
+	0x70, 0x6c, 0x79, 0x12, 0x27, 0x0a, 0x05, 0x66, 0x69, 0x6c, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03,
+	0x28, 0x0b, 0x32, 0x11, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74,
+	0x2e, 0x46, 0x69, 0x6c, 0x65, 0x52, 0x05, 0x66, 0x69, 0x6c, 0x65, 0x73, 0x22, 0xa4, 0x01, 0x0a,
+	0x0f, 0x50, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x12, 0x43, 0x0a, 0x0e, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65,
+	0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74,
+	0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x52, 0x0e, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x66, 0x69, 0x6c, 0x65, 0x73, 0x18, 0x02,
+	0x20, 0x03, 0x28, 0x0d, 0x52, 0x05, 0x66, 0x69, 0x6c, 0x65, 0x73, 0x12, 0x36, 0x0a, 0x08, 0x70,
+	0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1a, 0x2e,
+	0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x46, 0x69, 0x6c, 0x65,
+	0x2e, 0x50, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x52, 0x08, 0x70, 0x72, 0x69, 0x6f, 0x72,
+	0x69, 0x74, 0x79, 0x22, 0x91, 0x01, 0x0a, 0x0c, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x12, 0x43, 0x0a, 0x0e, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67,
+	0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65,
+	0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x52, 0x0e, 0x74, 0x6f, 0x72, 0x72, 0x65,
+	0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x1e, 0x0a, 0x0a, 0x73, 0x65, 0x71,
+	0x75, 0x65, 0x6e, 0x74, 0x69, 0x61, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0a, 0x73,
+	0x65, 0x71, 0x75, 0x65, 0x6e, 0x74, 0x69, 0x61, 0x6c, 0x12, 0x1c, 0x0a, 0x09, 0x66, 0x69, 0x72,
+	0x73, 0x74, 0x4c, 0x61, 0x73, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x09, 0x66, 0x69,
+	0x72, 0x73, 0x74, 0x4c, 0x61, 0x73, 0x74, 0x22, 0xce, 0x02, 0x0a, 0x0e, 0x53, 0x65, 0x73, 0x73,
+	0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x12, 0x34, 0x0a, 0x04, 0x74, 0x79,
+	0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x20, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74,
+	0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65,
+	0x71, 0x75, 0x65, 0x73, 0x74, 0x2e, 0x54, 0x79, 0x70, 0x65, 0x52, 0x04, 0x74, 0x79, 0x70, 0x65,
+	0x12, 0x2b, 0x0a, 0x03, 0x61, 0x64, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e,
+	0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x41, 0x64, 0x64, 0x52,
+	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x48, 0x00, 0x52, 0x03, 0x61, 0x64, 0x64, 0x12, 0x34, 0x0a,
+	0x06, 0x72, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e,
+	0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x52, 0x65, 0x6d, 0x6f,
+	0x76, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x48, 0x00, 0x52, 0x06, 0x72, 0x65, 0x6d,
+	0x6f, 0x76, 0x65, 0x12, 0x33, 0x0a, 0x05, 0x73, 0x74, 0x61, 0x72, 0x74, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74,
+	0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x48,
+	0x00, 0x52, 0x05, 0x73, 0x74, 0x61, 0x72, 0x74, 0x12, 0x31, 0x0a, 0x04, 0x73, 0x74, 0x6f, 0x70,
+	0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1b, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72,
+	0x72, 0x65, 0x6e, 0x74, 0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x48, 0x00, 0x52, 0x04, 0x73, 0x74, 0x6f, 0x70, 0x22, 0x30, 0x0a, 0x04, 0x54,
+	0x79, 0x70, 0x65, 0x12, 0x07, 0x0a, 0x03, 0x41, 0x44, 0x44, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06,
+	0x52, 0x45, 0x4d, 0x4f, 0x56, 0x45, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x53, 0x54, 0x41, 0x52,
+	0x54, 0x10, 0x02, 0x12, 0x08, 0x0a, 0x04, 0x53, 0x54, 0x4f, 0x50, 0x10, 0x03, 0x42, 0x09, 0x0a,
+	0x07, 0x72, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0xbc, 0x01, 0x0a, 0x0c, 0x53, 0x65, 0x73,
+	0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x2e, 0x0a, 0x07, 0x74, 0x6f, 0x72,
+	0x72, 0x65, 0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x67, 0x72, 0x61,
+	0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74,
+	0x52, 0x07, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x12, 0x35, 0x0a, 0x05, 0x65, 0x76, 0x65,
+	0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1f, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74,
+	0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65,
+	0x70, 0x6c, 0x79, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x52, 0x05, 0x65, 0x76, 0x65, 0x6e, 0x74,
+	0x22, 0x45, 0x0a, 0x05, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x0a, 0x0a, 0x06, 0x55, 0x50, 0x44,
+	0x41, 0x54, 0x45, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x41, 0x44, 0x44, 0x45, 0x44, 0x10, 0x01,
+	0x12, 0x0b, 0x0a, 0x07, 0x52, 0x45, 0x4d, 0x4f, 0x56, 0x45, 0x44, 0x10, 0x02, 0x12, 0x0b, 0x0a,
+	0x07, 0x53, 0x54, 0x41, 0x52, 0x54, 0x45, 0x44, 0x10, 0x03, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x54,
+	0x4f, 0x50, 0x50, 0x45, 0x44, 0x10, 0x04, 0x32, 0xfb, 0x04, 0x0a, 0x0e, 0x54, 0x6f, 0x72, 0x72,
+	0x65, 0x6e, 0x74, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x34, 0x0a, 0x04, 0x4c, 0x69,
+	0x73, 0x74, 0x12, 0x12, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74,
+	0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x1a, 0x16, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72,
+	0x72, 0x65, 0x6e, 0x74, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00,
+	0x12, 0x34, 0x0a, 0x03, 0x41, 0x64, 0x64, 0x12, 0x17, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f,
+	0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x41, 0x64, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74,
+	0x1a, 0x12, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x45,
+	0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x3a, 0x0a, 0x06, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65,
+	0x12, 0x1a, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x52,
+	0x65, 0x6d, 0x6f, 0x76, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x67,
+	0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79,
+	0x22, 0x00, 0x12, 0x3a, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x72, 0x74, 0x12, 0x1b, 0x2e, 0x67, 0x72,
+	0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e,
+	0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74,
+	0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x39,
+	0x0a, 0x04, 0x53, 0x74, 0x6f, 0x70, 0x12, 0x1b, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72,
+	0x72, 0x65, 0x6e, 0x74, 0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75,
+	0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e,
+	0x74, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x40, 0x0a, 0x06, 0x53, 0x63, 0x72,
+	0x61, 0x70, 0x65, 0x12, 0x1a, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e,
+	0x74, 0x2e, 0x53, 0x63, 0x72, 0x61, 0x70, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
+	0x18, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x53, 0x63,
+	0x72, 0x61, 0x70, 0x65, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x3f, 0x0a, 0x05, 0x46,
+	0x69, 0x6c, 0x65, 0x73, 0x12, 0x1b, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65,
 	0x6e, 0x74, 0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
-	0x74, 0x48, 0x00, 0x52, 0x04, 0x73, 0x74, 0x6f, 0x70, 0x22, 0x30, 0x0a, 0x04, 0x54, 0x79, 0x70,
-	0x65, 0x12, 0x07, 0x0a, 0x03, 0x41, 0x44, 0x44, 0x10, 0x00, 0x12, 0x0a, 0x0a, 0x06, 0x52, 0x45,
-	0x4d, 0x4f, 0x56, 0x45, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x53, 0x54, 0x41, 0x52, 0x54, 0x10,
-	0x02, 0x12, 0x08, 0x0a, 0x04, 0x53, 0x54, 0x4f, 0x50, 0x10, 0x03, 0x42, 0x09, 0x0a, 0x07, 0x72,
-	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x22, 0xbc, 0x01, 0x0a, 0x0c, 0x53, 0x65, 0x73, 0x73, 0x69,
-	0x6f, 0x6e, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x12, 0x2e, 0x0a, 0x07, 0x74, 0x6f, 0x72, 0x72, 0x65,
-	0x6e, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74,
-	0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x07,
-	0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x12, 0x35, 0x0a, 0x05, 0x65, 0x76, 0x65, 0x6e, 0x74,
-	0x18, 0x02, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x1f, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72,
-	0x72, 0x65, 0x6e, 0x74, 0x2e, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x70, 0x6c,
-	0x79, 0x2e, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x52, 0x05, 0x65, 0x76, 0x65, 0x6e, 0x74, 0x22, 0x45,
-	0x0a, 0x05, 0x45, 0x76, 0x65, 0x6e, 0x74, 0x12, 0x0a, 0x0a, 0x06, 0x55, 0x50, 0x44, 0x41, 0x54,
-	0x45, 0x10, 0x00, 0x12, 0x09, 0x0a, 0x05, 0x41, 0x44, 0x44, 0x45, 0x44, 0x10, 0x01, 0x12, 0x0b,
-	0x0a, 0x07, 0x52, 0x45, 0x4d, 0x4f, 0x56, 0x45, 0x44, 0x10, 0x02, 0x12, 0x0b, 0x0a, 0x07, 0x53,
-	0x54, 0x41, 0x52, 0x54, 0x45, 0x44, 0x10, 0x03, 0x12, 0x0b, 0x0a, 0x07, 0x53, 0x54, 0x4f, 0x50,
-	0x50, 0x45, 0x44, 0x10, 0x04, 0x32, 0xf8, 0x02, 0x0a, 0x0e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e,
-	0x74, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x34, 0x0a, 0x04, 0x4c, 0x69, 0x73, 0x74,
-	0x12, 0x12, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x45,
-	0x6d, 0x70, 0x74, 0x79, 0x1a, 0x16, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65,
-	0x6e, 0x74, 0x2e, 0x4c, 0x69, 0x73, 0x74, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x34,
-	0x0a, 0x03, 0x41, 0x64, 0x64, 0x12, 0x17, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72,
-	0x65, 0x6e, 0x74, 0x2e, 0x41, 0x64, 0x64, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12,
-	0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x45, 0x6d, 0x70,
-	0x74, 0x79, 0x22, 0x00, 0x12, 0x3a, 0x0a, 0x06, 0x52, 0x65, 0x6d, 0x6f, 0x76, 0x65, 0x12, 0x1a,
-	0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x52, 0x65, 0x6d,
-	0x6f, 0x76, 0x65, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x67, 0x72, 0x61,
-	0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00,
-	0x12, 0x3a, 0x0a, 0x05, 0x53, 0x74, 0x61, 0x72, 0x74, 0x12, 0x1b, 0x2e, 0x67, 0x72, 0x61, 0x79,
-	0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52,
+	0x74, 0x1a, 0x17, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e,
+	0x46, 0x69, 0x6c, 0x65, 0x73, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x12, 0x41, 0x0a, 0x0b,
+	0x53, 0x65, 0x74, 0x50, 0x72, 0x69, 0x6f, 0x72, 0x69, 0x74, 0x79, 0x12, 0x1c, 0x2e, 0x67, 0x72,
+	0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x50, 0x72, 0x69, 0x6f, 0x72, 0x69,
+	0x74, 0x79, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x67, 0x72, 0x61, 0x79,
+	0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12,
+	0x3b, 0x0a, 0x08, 0x53, 0x65, 0x74, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x12, 0x19, 0x2e, 0x67, 0x72,
+	0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x4f, 0x72, 0x64, 0x65, 0x72, 0x52,
 	0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a, 0x12, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72,
-	0x72, 0x65, 0x6e, 0x74, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x39, 0x0a, 0x04,
-	0x53, 0x74, 0x6f, 0x70, 0x12, 0x1b, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65,
-	0x6e, 0x74, 0x2e, 0x54, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73,
-	0x74, 0x1a, 0x12, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e,
-	0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x47, 0x0a, 0x07, 0x53, 0x65, 0x73, 0x73, 0x69,
-	0x6f, 0x6e, 0x12, 0x1b, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74,
-	0x2e, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71, 0x75, 0x65, 0x73, 0x74, 0x1a,
-	0x19, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x53, 0x65,
-	0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22, 0x00, 0x28, 0x01, 0x30, 0x01,
-	0x42, 0x25, 0x5a, 0x23, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x6b,
-	0x79, 0x6c, 0x65, 0x63, 0x37, 0x32, 0x35, 0x2f, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72,
-	0x65, 0x6e, 0x74, 0x2f, 0x72, 0x70, 0x63, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x72, 0x65, 0x6e, 0x74, 0x2e, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x22, 0x00, 0x12, 0x47, 0x0a, 0x07,
+	0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x1b, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f,
+	0x72, 0x72, 0x65, 0x6e, 0x74, 0x2e, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x71,
+	0x75, 0x65, 0x73, 0x74, 0x1a, 0x19, 0x2e, 0x67, 0x72, 0x61, 0x79, 0x74, 0x6f, 0x72, 0x72, 0x65,
+	0x6e, 0x74, 0x2e, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x52, 0x65, 0x70, 0x6c, 0x79, 0x22,
+	0x00, 0x28, 0x01, 0x30, 0x01, 0x42, 0x25, 0x5a, 0x23, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
+	0x63, 0x6f, 0x6d, 0x2f, 0x6b, 0x79, 0x6c, 0x65, 0x63, 0x37, 0x32, 0x35, 0x2f, 0x67, 0x72, 0x61,
+	0x79, 0x74, 0x6f, 0x72, 0x72, 0x65, 0x6e, 0x74, 0x2f, 0x72, 0x70, 0x63, 0x62, 0x06, 0x70, 0x72,
+	0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -835,49 +1717,78 @@ func file_graytorrent_proto_rawDescGZIP() []byte {
 	return file_graytorrent_proto_rawDescData
 }
 
-var file_graytorrent_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
-var file_graytorrent_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_graytorrent_proto_enumTypes = make([]protoimpl.EnumInfo, 5)
+var file_graytorrent_proto_msgTypes = make([]protoimpl.MessageInfo, 17)
 var file_graytorrent_proto_goTypes = []interface{}{
 	(Torrent_State)(0),       // 0: graytorrent.Torrent.State
-	(SessionRequest_Type)(0), // 1: graytorrent.SessionRequest.Type
-	(SessionReply_Event)(0),  // 2: graytorrent.SessionReply.Event
-	(*Empty)(nil),            // 3: graytorrent.Empty
-	(*Torrent)(nil),          // 4: graytorrent.Torrent
-	(*ListReply)(nil),        // 5: graytorrent.ListReply
-	(*TorrentRequest)(nil),   // 6: graytorrent.TorrentRequest
-	(*AddRequest)(nil),       // 7: graytorrent.AddRequest
-	(*RemoveRequest)(nil),    // 8: graytorrent.RemoveRequest
-	(*SessionRequest)(nil),   // 9: graytorrent.SessionRequest
-	(*SessionReply)(nil),     // 10: graytorrent.SessionReply
+	(Peer_Source)(0),         // 1: graytorrent.Peer.Source
+	(File_Priority)(0),       // 2: graytorrent.File.Priority
+	(SessionRequest_Type)(0), // 3: graytorrent.SessionRequest.Type
+	(SessionReply_Event)(0),  // 4: graytorrent.SessionReply.Event
+	(*Empty)(nil),            // 5: graytorrent.Empty
+	(*Torrent)(nil),          // 6: graytorrent.Torrent
+	(*Tracker)(nil),          // 7: graytorrent.Tracker
+	(*Peer)(nil),             // 8: graytorrent.Peer
+	(*ListReply)(nil),        // 9: graytorrent.ListReply
+	(*TorrentRequest)(nil),   // 10: graytorrent.TorrentRequest
+	(*AddRequest)(nil),       // 11: graytorrent.AddRequest
+	(*RemoveRequest)(nil),    // 12: graytorrent.RemoveRequest
+	(*ScrapeRequest)(nil),    // 13: graytorrent.ScrapeRequest
+	(*TrackerScrape)(nil),    // 14: graytorrent.TrackerScrape
+	(*ScrapeReply)(nil),      // 15: graytorrent.ScrapeReply
+	(*File)(nil),             // 16: graytorrent.File
+	(*FilesReply)(nil),       // 17: graytorrent.FilesReply
+	(*PriorityRequest)(nil),  // 18: graytorrent.PriorityRequest
+	(*OrderRequest)(nil),     // 19: graytorrent.OrderRequest
+	(*SessionRequest)(nil),   // 20: graytorrent.SessionRequest
+	(*SessionReply)(nil),     // 21: graytorrent.SessionReply
 }
 var file_graytorrent_proto_depIdxs = []int32{
 	0,  // 0: graytorrent.Torrent.state:type_name -> graytorrent.Torrent.State
-	4,  // 1: graytorrent.ListReply.torrents:type_name -> graytorrent.Torrent
-	6,  // 2: graytorrent.RemoveRequest.torrentRequest:type_name -> graytorrent.TorrentRequest
-	1,  // 3: graytorrent.SessionRequest.type:type_name -> graytorrent.SessionRequest.Type
-	7,  // 4: graytorrent.SessionRequest.add:type_name -> graytorrent.AddRequest
-	8,  // 5: graytorrent.SessionRequest.remove:type_name -> graytorrent.RemoveRequest
-	6,  // 6: graytorrent.SessionRequest.start:type_name -> graytorrent.TorrentRequest
-	6,  // 7: graytorrent.SessionRequest.stop:type_name -> graytorrent.TorrentRequest
-	4,  // 8: graytorrent.SessionReply.torrent:type_name -> graytorrent.Torrent
-	2,  // 9: graytorrent.SessionReply.event:type_name -> graytorrent.SessionReply.Event
-	3,  // 10: graytorrent.TorrentService.List:input_type -> graytorrent.Empty
-	7,  // 11: graytorrent.TorrentService.Add:input_type -> graytorrent.AddRequest
-	8,  // 12: graytorrent.TorrentService.Remove:input_type -> graytorrent.RemoveRequest
-	6,  // 13: graytorrent.TorrentService.Start:input_type -> graytorrent.TorrentRequest
-	6,  // 14: graytorrent.TorrentService.Stop:input_type -> graytorrent.TorrentRequest
-	9,  // 15: graytorrent.TorrentService.Session:input_type -> graytorrent.SessionRequest
-	5,  // 16: graytorrent.TorrentService.List:output_type -> graytorrent.ListReply
-	3,  // 17: graytorrent.TorrentService.Add:output_type -> graytorrent.Empty
-	3,  // 18: graytorrent.TorrentService.Remove:output_type -> graytorrent.Empty
-	3,  // 19: graytorrent.TorrentService.Start:output_type -> graytorrent.Empty
-	3,  // 20: graytorrent.TorrentService.Stop:output_type -> graytorrent.Empty
-	10, // 21: graytorrent.TorrentService.Session:output_type -> graytorrent.SessionReply
-	16, // [16:22] is the sub-list for method output_type
-	10, // [10:16] is the sub-list for method input_type
-	10, // [10:10] is the sub-list for extension type_name
-	10, // [10:10] is the sub-list for extension extendee
-	0,  // [0:10] is the sub-list for field type_name
+	8,  // 1: graytorrent.Torrent.peers:type_name -> graytorrent.Peer
+	7,  // 2: graytorrent.Torrent.trackers:type_name -> graytorrent.Tracker
+	1,  // 3: graytorrent.Peer.source:type_name -> graytorrent.Peer.Source
+	6,  // 4: graytorrent.ListReply.torrents:type_name -> graytorrent.Torrent
+	10, // 5: graytorrent.RemoveRequest.torrentRequest:type_name -> graytorrent.TorrentRequest
+	10, // 6: graytorrent.ScrapeRequest.torrentRequest:type_name -> graytorrent.TorrentRequest
+	14, // 7: graytorrent.ScrapeReply.trackers:type_name -> graytorrent.TrackerScrape
+	2,  // 8: graytorrent.File.priority:type_name -> graytorrent.File.Priority
+	16, // 9: graytorrent.FilesReply.files:type_name -> graytorrent.File
+	10, // 10: graytorrent.PriorityRequest.torrentRequest:type_name -> graytorrent.TorrentRequest
+	2,  // 11: graytorrent.PriorityRequest.priority:type_name -> graytorrent.File.Priority
+	10, // 12: graytorrent.OrderRequest.torrentRequest:type_name -> graytorrent.TorrentRequest
+	3,  // 13: graytorrent.SessionRequest.type:type_name -> graytorrent.SessionRequest.Type
+	11, // 14: graytorrent.SessionRequest.add:type_name -> graytorrent.AddRequest
+	12, // 15: graytorrent.SessionRequest.remove:type_name -> graytorrent.RemoveRequest
+	10, // 16: graytorrent.SessionRequest.start:type_name -> graytorrent.TorrentRequest
+	10, // 17: graytorrent.SessionRequest.stop:type_name -> graytorrent.TorrentRequest
+	6,  // 18: graytorrent.SessionReply.torrent:type_name -> graytorrent.Torrent
+	4,  // 19: graytorrent.SessionReply.event:type_name -> graytorrent.SessionReply.Event
+	5,  // 20: graytorrent.TorrentService.List:input_type -> graytorrent.Empty
+	11, // 21: graytorrent.TorrentService.Add:input_type -> graytorrent.AddRequest
+	12, // 22: graytorrent.TorrentService.Remove:input_type -> graytorrent.RemoveRequest
+	10, // 23: graytorrent.TorrentService.Start:input_type -> graytorrent.TorrentRequest
+	10, // 24: graytorrent.TorrentService.Stop:input_type -> graytorrent.TorrentRequest
+	13, // 25: graytorrent.TorrentService.Scrape:input_type -> graytorrent.ScrapeRequest
+	10, // 26: graytorrent.TorrentService.Files:input_type -> graytorrent.TorrentRequest
+	18, // 27: graytorrent.TorrentService.SetPriority:input_type -> graytorrent.PriorityRequest
+	19, // 28: graytorrent.TorrentService.SetOrder:input_type -> graytorrent.OrderRequest
+	20, // 29: graytorrent.TorrentService.Session:input_type -> graytorrent.SessionRequest
+	9,  // 30: graytorrent.TorrentService.List:output_type -> graytorrent.ListReply
+	5,  // 31: graytorrent.TorrentService.Add:output_type -> graytorrent.Empty
+	5,  // 32: graytorrent.TorrentService.Remove:output_type -> graytorrent.Empty
+	5,  // 33: graytorrent.TorrentService.Start:output_type -> graytorrent.Empty
+	5,  // 34: graytorrent.TorrentService.Stop:output_type -> graytorrent.Empty
+	15, // 35: graytorrent.TorrentService.Scrape:output_type -> graytorrent.ScrapeReply
+	17, // 36: graytorrent.TorrentService.Files:output_type -> graytorrent.FilesReply
+	5,  // 37: graytorrent.TorrentService.SetPriority:output_type -> graytorrent.Empty
+	5,  // 38: graytorrent.TorrentService.SetOrder:output_type -> graytorrent.Empty
+	21, // 39: graytorrent.TorrentService.Session:output_type -> graytorrent.SessionReply
+	30, // [30:40] is the sub-list for method output_type
+	20, // [20:30] is the sub-list for method input_type
+	20, // [20:20] is the sub-list for extension type_name
+	20, // [20:20] is the sub-list for extension extendee
+	0,  // [0:20] is the sub-list for field type_name
 }
 
 func init() { file_graytorrent_proto_init() }
@@ -911,7 +1822,7 @@ func file_graytorrent_proto_init() {
 			}
 		}
 		file_graytorrent_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*ListReply); i {
+			switch v := v.(*Tracker); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -923,7 +1834,7 @@ func file_graytorrent_proto_init() {
 			}
 		}
 		file_graytorrent_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*TorrentRequest); i {
+			switch v := v.(*Peer); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -935,7 +1846,7 @@ func file_graytorrent_proto_init() {
 			}
 		}
 		file_graytorrent_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*AddRequest); i {
+			switch v := v.(*ListReply); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -947,7 +1858,7 @@ func file_graytorrent_proto_init() {
 			}
 		}
 		file_graytorrent_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*RemoveRequest); i {
+			switch v := v.(*TorrentRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -959,7 +1870,7 @@ func file_graytorrent_proto_init() {
 			}
 		}
 		file_graytorrent_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*SessionRequest); i {
+			switch v := v.(*AddRequest); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -971,6 +1882,114 @@ func file_graytorrent_proto_init() {
 			}
 		}
 		file_graytorrent_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RemoveRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_graytorrent_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ScrapeRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_graytorrent_proto_msgTypes[9].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*TrackerScrape); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_graytorrent_proto_msgTypes[10].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*ScrapeReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_graytorrent_proto_msgTypes[11].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*File); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_graytorrent_proto_msgTypes[12].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FilesReply); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_graytorrent_proto_msgTypes[13].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*PriorityRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_graytorrent_proto_msgTypes[14].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*OrderRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_graytorrent_proto_msgTypes[15].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*SessionRequest); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_graytorrent_proto_msgTypes[16].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*SessionReply); i {
 			case 0:
 				return &v.state
@@ -983,7 +2002,11 @@ func file_graytorrent_proto_init() {
 			}
 		}
 	}
-	file_graytorrent_proto_msgTypes[6].OneofWrappers = []interface{}{
+	file_graytorrent_proto_msgTypes[8].OneofWrappers = []interface{}{
+		(*ScrapeRequest_TorrentRequest)(nil),
+		(*ScrapeRequest_File)(nil),
+	}
+	file_graytorrent_proto_msgTypes[15].OneofWrappers = []interface{}{
 		(*SessionRequest_Add)(nil),
 		(*SessionRequest_Remove)(nil),
 		(*SessionRequest_Start)(nil),
@@ -994,8 +2017,8 @@ func file_graytorrent_proto_init() {
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_graytorrent_proto_rawDesc,
-			NumEnums:      3,
-			NumMessages:   8,
+			NumEnums:      5,
+			NumMessages:   17,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -28,6 +28,14 @@ type TorrentServiceClient interface {
 	Start(ctx context.Context, in *TorrentRequest, opts ...grpc.CallOption) (*Empty, error)
 	// Stops a torrent's download/upload
 	Stop(ctx context.Context, in *TorrentRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Requests swarm statistics from a torrent's trackers
+	Scrape(ctx context.Context, in *ScrapeRequest, opts ...grpc.CallOption) (*ScrapeReply, error)
+	// Requests a list of a torrent's files and their priorities
+	Files(ctx context.Context, in *TorrentRequest, opts ...grpc.CallOption) (*FilesReply, error)
+	// Changes the priority of a torrent's files
+	SetPriority(ctx context.Context, in *PriorityRequest, opts ...grpc.CallOption) (*Empty, error)
+	// Changes the order a torrent's pieces are downloaded in
+	SetOrder(ctx context.Context, in *OrderRequest, opts ...grpc.CallOption) (*Empty, error)
 	// Streams a session between a client and the server
 	Session(ctx context.Context, opts ...grpc.CallOption) (TorrentService_SessionClient, error)
 }
@@ -85,6 +93,42 @@ func (c *torrentServiceClient) Stop(ctx context.Context, in *TorrentRequest, opt
 	return out, nil
 }
 
+func (c *torrentServiceClient) Scrape(ctx context.Context, in *ScrapeRequest, opts ...grpc.CallOption) (*ScrapeReply, error) {
+	out := new(ScrapeReply)
+	err := c.cc.Invoke(ctx, "/graytorrent.TorrentService/Scrape", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *torrentServiceClient) Files(ctx context.Context, in *TorrentRequest, opts ...grpc.CallOption) (*FilesReply, error) {
+	out := new(FilesReply)
+	err := c.cc.Invoke(ctx, "/graytorrent.TorrentService/Files", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *torrentServiceClient) SetPriority(ctx context.Context, in *PriorityRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/graytorrent.TorrentService/SetPriority", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *torrentServiceClient) SetOrder(ctx context.Context, in *OrderRequest, opts ...grpc.CallOption) (*Empty, error) {
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, "/graytorrent.TorrentService/SetOrder", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
 func (c *torrentServiceClient) Session(ctx context.Context, opts ...grpc.CallOption) (TorrentService_SessionClient, error) {
 	stream, err := c.cc.NewStream(ctx, &TorrentService_ServiceDesc.Streams[0], "/graytorrent.TorrentService/Session", opts...)
 	if err != nil {
@@ -130,6 +174,14 @@ type TorrentServiceServer interface {
 	Start(context.Context, *TorrentRequest) (*Empty, error)
 	// Stops a torrent's download/upload
 	Stop(context.Context, *TorrentRequest) (*Empty, error)
+	// Requests swarm statistics from a torrent's trackers
+	Scrape(context.Context, *ScrapeRequest) (*ScrapeReply, error)
+	// Requests a list of a torrent's files and their priorities
+	Files(context.Context, *TorrentRequest) (*FilesReply, error)
+	// Changes the priority of a torrent's files
+	SetPriority(context.Context, *PriorityRequest) (*Empty, error)
+	// Changes the order a torrent's pieces are downloaded in
+	SetOrder(context.Context, *OrderRequest) (*Empty, error)
 	// Streams a session between a client and the server
 	Session(TorrentService_SessionServer) error
 	mustEmbedUnimplementedTorrentServiceServer()
@@ -154,6 +206,18 @@ func (UnimplementedTorrentServiceServer) Start(context.Context, *TorrentRequest)
 func (UnimplementedTorrentServiceServer) Stop(context.Context, *TorrentRequest) (*Empty, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Stop not implemented")
 }
+func (UnimplementedTorrentServiceServer) Scrape(context.Context, *ScrapeRequest) (*ScrapeReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Scrape not implemented")
+}
+func (UnimplementedTorrentServiceServer) Files(context.Context, *TorrentRequest) (*FilesReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Files not implemented")
+}
+func (UnimplementedTorrentServiceServer) SetPriority(context.Context, *PriorityRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetPriority not implemented")
+}
+func (UnimplementedTorrentServiceServer) SetOrder(context.Context, *OrderRequest) (*Empty, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetOrder not implemented")
+}
 func (UnimplementedTorrentServiceServer) Session(TorrentService_SessionServer) error {
 	return status.Errorf(codes.Unimplemented, "method Session not implemented")
 }
@@ -260,6 +324,78 @@ func _TorrentService_Stop_Handler(srv interface{}, ctx context.Context, dec func
 	return interceptor(ctx, in, info, handler)
 }
 
+func _TorrentService_Scrape_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ScrapeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TorrentServiceServer).Scrape(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/graytorrent.TorrentService/Scrape",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TorrentServiceServer).Scrape(ctx, req.(*ScrapeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TorrentService_Files_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TorrentRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TorrentServiceServer).Files(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/graytorrent.TorrentService/Files",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TorrentServiceServer).Files(ctx, req.(*TorrentRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TorrentService_SetPriority_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PriorityRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TorrentServiceServer).SetPriority(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/graytorrent.TorrentService/SetPriority",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TorrentServiceServer).SetPriority(ctx, req.(*PriorityRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _TorrentService_SetOrder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(OrderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(TorrentServiceServer).SetOrder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/graytorrent.TorrentService/SetOrder",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(TorrentServiceServer).SetOrder(ctx, req.(*OrderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
 func _TorrentService_Session_Handler(srv interface{}, stream grpc.ServerStream) error {
 	return srv.(TorrentServiceServer).Session(&torrentServiceSessionServer{stream})
 }
@@ -313,6 +449,22 @@ var TorrentService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Stop",
 			Handler:    _TorrentService_Stop_Handler,
 		},
+		{
+			MethodName: "Scrape",
+			Handler:    _TorrentService_Scrape_Handler,
+		},
+		{
+			MethodName: "Files",
+			Handler:    _TorrentService_Files_Handler,
+		},
+		{
+			MethodName: "SetPriority",
+			Handler:    _TorrentService_SetPriority_Handler,
+		},
+		{
+			MethodName: "SetOrder",
+			Handler:    _TorrentService_SetOrder_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
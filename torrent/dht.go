@@ -0,0 +1,88 @@
+package torrent
+
+import (
+	"context"
+	"path/filepath"
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/config"
+	"github.com/kylec725/graytorrent/internal/dht"
+	"github.com/kylec725/graytorrent/internal/peer"
+	"github.com/kylec725/graytorrent/internal/utp"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const dhtAnnounceInterval = 5 * time.Minute // How often a torrent announces itself to the DHT
+const dhtRetryInterval = 30 * time.Second   // How soon to retry if the DHT has no nodes yet
+const dhtBootstrapTimeout = time.Minute
+
+var dhtFile = filepath.Join(common.GrayTorrentPath, "dht.json")
+
+// initDHT starts a DHT node that shares the uTP socket, returns nil if the DHT is disabled
+func initDHT(socket *utp.Socket) (*dht.DHT, error) {
+	cfg := config.GetConfig().Network
+	if !cfg.DHT {
+		return nil, nil
+	} else if socket == nil {
+		return nil, errors.Wrap(ErrNoUDP, "initDHT")
+	}
+
+	node := dht.New(socket.PacketConn())
+	if err := node.Load(dhtFile); err != nil {
+		log.WithField("error", err.Error()).Debug("Failed to load the DHT routing table")
+	}
+	go node.Run()
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), dhtBootstrapTimeout)
+		defer cancel()
+		node.Bootstrap(ctx, cfg.DHTBootstrap)
+	}()
+	return node, nil
+}
+
+// closeDHT saves the routing table of a DHT node and stops it
+func closeDHT(node *dht.DHT) {
+	if node == nil {
+		return
+	}
+	if err := node.Save(dhtFile); err != nil {
+		log.WithField("error", err.Error()).Debug("Failed to save the DHT routing table")
+	}
+	node.Close()
+}
+
+// runDHT periodically announces the torrent to the DHT and sends any peers found to the torrent
+func (to *Torrent) runDHT(ctx context.Context, node *dht.DHT) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		addrs, err := node.Announce(ctx, to.Info.InfoHash, common.Port(ctx))
+		if err != nil {
+			log.WithFields(log.Fields{"name": to.Info.Name, "error": err.Error()}).Debug("DHT announce failed")
+			timer.Reset(dhtRetryInterval)
+			continue
+		}
+		log.WithFields(log.Fields{"name": to.Info.Name, "peers": len(addrs)}).Debug("DHT announce successful")
+
+		for _, addr := range addrs {
+			p := peer.New(addr, nil, to.Info)
+			p.Source = peer.SourceDHT
+			select {
+			case <-ctx.Done():
+				return
+			case to.NewPeers <- p:
+			}
+		}
+		timer.Reset(dhtAnnounceInterval)
+	}
+}
@@ -0,0 +1,92 @@
+package torrent
+
+import (
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/write"
+	pb "github.com/kylec725/graytorrent/rpc"
+	"github.com/pkg/errors"
+)
+
+// Errors
+var (
+	ErrFileIndex = errors.New("File index out of range")
+)
+
+// SetPriority changes the priority of some of the torrent's files, or of every file if none are given. Files that
+// are no longer skipped are created, and a running torrent starts or stops downloading their pieces. Empty skipped
+// files are removed, by a running torrent once it has stopped downloading their pieces
+func (to *Torrent) SetPriority(files []int, priority common.Priority) error {
+	for _, index := range files {
+		if index < 0 || index >= len(to.Info.Paths) {
+			return errors.Wrap(ErrFileIndex, "SetPriority")
+		}
+	}
+	if len(files) == 0 {
+		for i := range to.Info.Paths {
+			files = append(files, i)
+		}
+	}
+
+	for _, index := range files {
+		to.Info.Paths[index].Priority = priority
+	}
+	if err := write.CreateFiles(to.Info); err != nil {
+		return errors.Wrap(err, "SetPriority")
+	}
+	if !to.Started {
+		to.Info.UpdateLeft()
+		if err := write.RemoveSkipped(to.Info); err != nil {
+			return errors.Wrap(err, "SetPriority")
+		}
+	}
+	to.notifySettings()
+	return nil
+}
+
+// SetOrder changes whether the torrent's pieces are downloaded in order and whether the first and last pieces of its
+// files are downloaded before the rest, such as for playing files while they download
+func (to *Torrent) SetOrder(sequential, firstLast bool) {
+	to.Info.Sequential = sequential
+	to.Info.FirstLast = firstLast
+	to.notifySettings()
+}
+
+// notifySettings has the running torrent update its picker and what is left
+func (to *Torrent) notifySettings() {
+	select {
+	case to.settingsChanged <- struct{}{}:
+	default:
+	}
+}
+
+// fileList returns the torrent's files for grpc replies, padding files are left out
+func (to *Torrent) fileList() []*pb.File {
+	var files []*pb.File
+	offset := 0 // Offset of the current file in the torrent
+	for i, path := range to.Info.Paths {
+		start, end := offset, offset+path.Length
+		offset = end
+		if path.Pad {
+			continue
+		}
+
+		done := 0
+		for j := start / to.Info.PieceLength; path.Length > 0 && j <= (end-1)/to.Info.PieceLength; j++ {
+			if to.Info.Bitfield.Has(j) {
+				pieceStart := j * to.Info.PieceLength
+				if pieceStart < start { // The file starts partway into its first piece
+					pieceStart = start
+				}
+				done += common.Min(end, j*to.Info.PieceLength+to.Info.PieceSize(j)) - pieceStart
+			}
+		}
+		files = append(files, &pb.File{
+			Path:     path.Path,
+			Length:   uint64(path.Length),
+			Priority: pb.File_Priority(path.Priority),
+			Done:     uint64(done),
+			Index:    uint32(i),
+		})
+	}
+	return files
+}
@@ -0,0 +1,84 @@
+package torrent
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/merkle"
+	"github.com/kylec725/graytorrent/internal/write"
+	pb "github.com/kylec725/graytorrent/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetPriority(t *testing.T) {
+	assert := assert.New(t)
+
+	filename, data := newAttrTorrent(t, []string{"bin", "run"})
+	to := Torrent{File: filename}
+	require.Nil(t, to.Init())
+	to.Info.Directory = t.TempDir()
+	require.Nil(t, write.NewWrite(to.Info))
+	hiddenPath := filepath.Join(to.Info.Directory, to.Info.Paths[3].Path)
+	assert.FileExists(hiddenPath)
+
+	// A running torrent removes skipped files once it stops downloading their pieces
+	to.Started = true
+	require.Nil(t, to.SetPriority([]int{3}, common.PrioritySkip))
+	assert.FileExists(hiddenPath)
+	select {
+	case <-to.settingsChanged:
+	default:
+		t.Fatal("Running torrent was not notified")
+	}
+	to.Started = false
+
+	// Skipped files are removed if nothing was written to them, and their pieces aren't left to download
+	assert.ErrorIs(to.SetPriority([]int{4}, common.PrioritySkip), ErrFileIndex)
+	require.Nil(t, to.SetPriority([]int{3}, common.PrioritySkip))
+	assert.NoFileExists(hiddenPath)
+	assert.Equal(merkle.BlockSize, to.Info.Left)
+	assert.Equal(merkle.BlockSize, to.Info.WantedLength())
+
+	// Files list their progress, padding files are left out
+	require.True(t, write.VerifyPiece(to.Info, 0, data[:merkle.BlockSize]))
+	require.Nil(t, write.AddPiece(to.Info, 0, data[:merkle.BlockSize]))
+	to.Info.Bitfield.Set(0)
+	files := to.fileList()
+	require.Len(t, files, 3)
+	assert.Equal(&pb.File{Path: to.Info.Paths[0].Path, Length: 1000, Done: 1000}, files[0])
+	assert.Equal(uint32(2), files[1].Index)
+	assert.Equal(pb.File_SKIP, files[2].Priority)
+	assert.Zero(files[2].Done)
+
+	// Files that are wanted again are created
+	require.Nil(t, to.SetPriority(nil, common.PriorityHigh))
+	assert.FileExists(hiddenPath)
+	to.Info.UpdateLeft()
+	assert.Equal(10, to.Info.Left)
+	for _, file := range to.fileList() {
+		assert.Equal(pb.File_HIGH, file.Priority)
+	}
+}
+
+func TestSetOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	filename, _ := newAttrTorrent(t, []string{"bin", "run"})
+	to := Torrent{File: filename}
+	require.Nil(t, to.Init())
+
+	// The setting is kept in the torrent's info so that it is saved, and a running torrent is told to pick it up
+	to.SetOrder(true, true)
+	assert.True(to.Info.Sequential)
+	assert.True(to.Info.FirstLast)
+	to.SetOrder(true, false)
+	assert.False(to.Info.FirstLast)
+	select {
+	case <-to.settingsChanged:
+	default:
+		t.Fatal("Running torrent was not notified")
+	}
+	assert.Equal([]bool{true, true}, to.Info.FirstLastPieces())
+}
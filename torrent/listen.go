@@ -3,17 +3,27 @@ package torrent
 import (
 	"net"
 	"strconv"
+	"time"
 
 	"github.com/kylec725/graytorrent/internal/config"
 	"github.com/kylec725/graytorrent/internal/connect"
+	"github.com/kylec725/graytorrent/internal/mse"
 	"github.com/kylec725/graytorrent/internal/peer"
 	"github.com/kylec725/graytorrent/internal/peer/handshake"
+	"github.com/kylec725/graytorrent/internal/utp"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
-// ErrListener is used to close the peerListener safely
-var ErrListener = errors.New("use of closed network connection")
+const encryptionTimeout = 20 * time.Second // Time to wait on an incoming peer's encryption handshake
+
+// Errors
+var (
+	ErrListener  = errors.New("use of closed network connection") // Used to close the peerListener safely
+	ErrPlaintext = errors.New("Peer did not encrypt the connection")
+	ErrEncrypted = errors.New("Peer encrypted the connection while encryption is disabled")
+	ErrNoUDP     = errors.New("No UDP socket is open")
+)
 
 // initListener initializes a listener and gets an open port for incoming peers
 func initListener() (net.Listener, uint16, error) {
@@ -39,12 +49,18 @@ func initListener() (net.Listener, uint16, error) {
 	return listener, port, nil
 }
 
-// peerListen loops to listen for incoming connections of peers
-func (s *Session) peerListen() {
+// initUTP opens a uTP socket on the same port number as the TCP listener
+func initUTP(port uint16) (*utp.Socket, error) {
+	socket, err := utp.Listen(port)
+	return socket, errors.Wrap(err, "initUTP")
+}
+
+// peerListen loops to listen for incoming connections of peers over TCP or uTP
+func (s *Session) peerListen(listener net.Listener) {
 	// loop will exit as long as we call listener.Close()
 	for {
 		// TODO: limit max number of accepted peers at any time (don't want too many open TCP connections)
-		conn, err := s.peerListener.Accept()
+		conn, err := listener.Accept()
 		if err != nil { // Exit if the peerListener encounters an error
 			if errors.Is(err, ErrListener) {
 				log.WithField("error", err.Error()).Debug("Listener shutdown")
@@ -58,24 +74,77 @@ func (s *Session) peerListen() {
 func (s *Session) acceptPeer(conn net.Conn) {
 	addr := conn.RemoteAddr().String()
 
-	infoHash, err := handshake.Read(conn)
+	conn, err := s.acceptEncryption(conn)
+	if err != nil {
+		log.WithFields(log.Fields{"peer": addr, "error": err.Error()}).Debug("Error with incoming peer encryption")
+		conn.Close()
+		return
+	}
+
+	h, err := handshake.Read(conn)
 	if err != nil {
 		log.WithFields(log.Fields{"peer": addr, "error": err.Error()}).Debug("Error with incoming peer handshake")
 		return
 	}
 
 	// Check if the infohash matches any torrents we are serving
-	if to, ok := s.torrents[infoHash]; ok {
-		// Check if the torrent's goroutine is running first
-		if !to.Started {
+	if to, ok := s.findTorrent(h.InfoHash); ok {
+		// Check if the torrent's goroutine is running and downloading first
+		if !to.Started || !to.hasMetadata() {
 			return
 		}
 		newPeer := peer.New(addr, conn, to.Info)
-		if err := newPeer.RespondHandshake(to.Info); err != nil {
+		if err := newPeer.RespondHandshake(to.Info, h, s.dht != nil); err != nil {
 			log.WithFields(log.Fields{"peer": newPeer.String(), "error": err.Error()}).Debug("Error when responding to handshake")
 		}
 
 		to.NewPeers <- newPeer // Send to torrent session
-		log.WithField("peer", newPeer.String()).Debug("Incoming peer was accepted")
+		log.WithFields(log.Fields{"peer": newPeer.String(), "source": newPeer.Source.String()}).Debug("Incoming peer was accepted")
+	}
+}
+
+// findTorrent returns the torrent that a handshake's infohash refers to, which may be the truncated v2 infohash of a hybrid torrent
+func (s *Session) findTorrent(infoHash [20]byte) (*Torrent, bool) {
+	if to, ok := s.torrents[infoHash]; ok {
+		return to, true
+	}
+	for _, to := range s.torrents {
+		if to.Info.MatchesInfoHash(infoHash) {
+			return to, true
+		}
+	}
+	return nil, false
+}
+
+// acceptEncryption detects whether an incoming peer started with a plaintext or an encrypted handshake,
+// and completes the encrypted handshake if the encryption policy allows it
+func (s *Session) acceptEncryption(conn net.Conn) (net.Conn, error) {
+	policy := peer.EncryptionPolicy()
+	conn.SetDeadline(time.Now().Add(encryptionTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	peekConn, plaintext, err := mse.IsPlaintext(conn)
+	if err != nil {
+		return conn, errors.Wrap(err, "acceptEncryption")
+	} else if plaintext {
+		if policy == mse.PolicyRequire {
+			return conn, errors.Wrap(ErrPlaintext, "acceptEncryption")
+		}
+		return peekConn, nil
+	} else if policy == mse.PolicyDisabled {
+		return conn, errors.Wrap(ErrEncrypted, "acceptEncryption")
+	}
+
+	skeys := make([][20]byte, 0, len(s.torrents))
+	for infoHash, to := range s.torrents {
+		skeys = append(skeys, infoHash)
+		if to.Info.V2() && to.Info.InfoHash != to.Info.TruncatedV2() { // Peers of hybrid torrents may use either infohash
+			skeys = append(skeys, to.Info.TruncatedV2())
+		}
+	}
+	encConn, _, err := mse.Receive(peekConn, skeys, policy.Allowed())
+	if err != nil {
+		return conn, errors.Wrap(err, "acceptEncryption")
 	}
+	return encConn, nil
 }
@@ -0,0 +1,55 @@
+package torrent
+
+import (
+	"context"
+	"time"
+
+	"github.com/kylec725/graytorrent/internal/config"
+	"github.com/kylec725/graytorrent/internal/lsd"
+	"github.com/kylec725/graytorrent/internal/peer"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+)
+
+const lsdAnnounceInterval = 5 * time.Minute // How often a torrent is announced on the local network
+
+// initLSD starts local service discovery for the peer listener's port, returns nil if it is disabled
+func initLSD(port uint16) (*lsd.LSD, error) {
+	if !config.GetConfig().Network.LSD {
+		return nil, nil
+	}
+	service, err := lsd.New(port)
+	return service, errors.Wrap(err, "initLSD")
+}
+
+// runLSD periodically announces the torrent on the local network and sends LAN peers that announce it to the torrent
+func (to *Torrent) runLSD(ctx context.Context, service *lsd.LSD) {
+	addrs := service.Watch(to.Info.InfoHash)
+	defer service.Unwatch(to.Info.InfoHash)
+	ticker := time.NewTicker(lsdAnnounceInterval)
+	defer ticker.Stop()
+
+	announce := func() {
+		if err := service.Announce(to.Info.InfoHash); err != nil {
+			log.WithFields(log.Fields{"name": to.Info.Name, "error": err.Error()}).Debug("LSD announce failed")
+		}
+	}
+	announce()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			announce()
+		case addr := <-addrs:
+			p := peer.New(addr, nil, to.Info)
+			p.Source = peer.SourceLSD
+			select {
+			case <-ctx.Done():
+				return
+			case to.NewPeers <- p:
+			}
+		}
+	}
+}
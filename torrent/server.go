@@ -2,10 +2,13 @@ package torrent
 
 import (
 	"context"
+	"sync"
 
 	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/tracker"
 	"github.com/kylec725/graytorrent/rpc"
 	pb "github.com/kylec725/graytorrent/rpc"
+	"github.com/pkg/errors"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
@@ -28,9 +31,14 @@ func (s *Session) List(ctx context.Context, in *pb.Empty) (*pb.ListReply, error)
 				InfoHash:    to.Info.InfoHash[:],
 				TotalLength: uint32(to.Info.TotalLength),
 				Left:        uint32(to.Info.Left),
+				Wanted:      uint64(to.Info.WantedLength()),
+				Sequential:  to.Info.Sequential,
+				FirstLast:   to.Info.FirstLast,
 				DownRate:    uint32(to.DownRate()),
 				UpRate:      uint32(to.UpRate()),
 				State:       rpc.Torrent_State(to.State()),
+				Peers:       to.peerList(),
+				Trackers:    to.trackerList(),
 			})
 	}
 	reply := pb.ListReply{Torrents: torrents}
@@ -39,10 +47,14 @@ func (s *Session) List(ctx context.Context, in *pb.Empty) (*pb.ListReply, error)
 
 // Add a new torrent to be managed
 func (s *Session) Add(ctx context.Context, in *pb.AddRequest) (*pb.Empty, error) {
-	_, err := s.AddTorrent(ctx, in.GetName(), in.GetMagnet(), in.GetDirectory())
+	to, err := s.AddTorrent(ctx, in.GetName(), in.GetMagnet(), in.GetDirectory())
 	if err != nil {
 		return nil, err
 	}
+	to.SetOrder(in.GetSequential(), in.GetFirstLast())
+	if !to.hasMetadata() { // Torrents from magnet links start right away so that their metadata is fetched in the background
+		go to.Start(s.torrentContext(context.Background()))
+	}
 	return &pb.Empty{}, nil
 }
 
@@ -73,7 +85,7 @@ func (s *Session) Start(ctx context.Context, in *pb.TorrentRequest) (*pb.Empty,
 
 	if to, ok := s.torrents[infoHash]; ok {
 		if !to.Started {
-			newCtx := context.WithValue(context.Background(), common.KeyPort, s.port) // NOTE: using ctx causes to.Start() to end immediately
+			newCtx := s.torrentContext(context.Background()) // NOTE: using ctx causes to.Start() to end immediately
 			go to.Start(newCtx)
 		}
 		return &pb.Empty{}, nil
@@ -82,7 +94,7 @@ func (s *Session) Start(ctx context.Context, in *pb.TorrentRequest) (*pb.Empty,
 	for _, to := range s.torrents {
 		if to.ID == in.GetId() {
 			if !to.Started {
-				newCtx := context.WithValue(context.Background(), common.KeyPort, s.port)
+				newCtx := s.torrentContext(context.Background())
 				go to.Start(newCtx)
 			}
 			return &pb.Empty{}, nil
@@ -112,4 +124,147 @@ func (s *Session) Stop(ctx context.Context, in *pb.TorrentRequest) (*pb.Empty, e
 	return nil, ErrTorrentNotFound
 }
 
+// Scrape a torrent's trackers for the size of its swarm, the torrent can be a .torrent file that isn't managed
+func (s *Session) Scrape(ctx context.Context, in *pb.ScrapeRequest) (*pb.ScrapeReply, error) {
+	var info *common.TorrentInfo
+	var tiers []tracker.Tier
+	if file := in.GetFile(); file != "" {
+		var err error
+		if info, tiers, err = InfoFromFile(file); err != nil {
+			return nil, err
+		}
+	} else {
+		var infoHash [20]byte
+		copy(infoHash[:], in.GetTorrentRequest().GetInfoHash())
+
+		to, ok := s.findTorrent(infoHash)
+		if !ok { // Check ID instead
+			for _, candidate := range s.torrents {
+				if candidate.ID == in.GetTorrentRequest().GetId() {
+					to, ok = candidate, true
+					break
+				}
+			}
+		}
+		if !ok {
+			return nil, ErrTorrentNotFound
+		}
+		info, tiers = to.Info, to.Trackers
+	}
+
+	var trackers []*tracker.Tracker
+	for _, tier := range tiers {
+		trackers = append(trackers, tier...)
+	}
+	return &pb.ScrapeReply{Trackers: scrapeTrackers(s.torrentContext(ctx), info, trackers)}, nil
+}
+
+// Files lists a torrent's files and their priorities
+func (s *Session) Files(ctx context.Context, in *pb.TorrentRequest) (*pb.FilesReply, error) {
+	to, ok := s.requestedTorrent(in)
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+	return &pb.FilesReply{Files: to.fileList()}, nil
+}
+
+// SetPriority changes the priority of a torrent's files while it runs
+func (s *Session) SetPriority(ctx context.Context, in *pb.PriorityRequest) (*pb.Empty, error) {
+	to, ok := s.requestedTorrent(in.GetTorrentRequest())
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+	files := make([]int, len(in.GetFiles()))
+	for i, index := range in.GetFiles() {
+		files[i] = int(index)
+	}
+	if err := to.SetPriority(files, common.Priority(in.GetPriority())); errors.Is(err, ErrFileIndex) {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	} else if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &pb.Empty{}, nil
+}
+
+// SetOrder changes the order a torrent's pieces are downloaded in while it runs
+func (s *Session) SetOrder(ctx context.Context, in *pb.OrderRequest) (*pb.Empty, error) {
+	to, ok := s.requestedTorrent(in.GetTorrentRequest())
+	if !ok {
+		return nil, ErrTorrentNotFound
+	}
+	to.SetOrder(in.GetSequential(), in.GetFirstLast())
+	if !to.hasMetadata() { // Torrents from magnet links start right away so that their metadata is fetched in the background
+		go to.Start(s.torrentContext(context.Background()))
+	}
+	return &pb.Empty{}, nil
+}
+
+// requestedTorrent finds the torrent a request refers to by its infohash or its ID
+func (s *Session) requestedTorrent(in *pb.TorrentRequest) (*Torrent, bool) {
+	var infoHash [20]byte
+	copy(infoHash[:], in.GetInfoHash())
+	if to, ok := s.findTorrent(infoHash); ok {
+		return to, true
+	}
+	for _, to := range s.torrents {
+		if to.ID == in.GetId() {
+			return to, true
+		}
+	}
+	return nil, false
+}
+
+// scrapeTrackers scrapes each tracker at the same time, a scraped tracker is a copy so it doesn't disturb a running tracker
+func scrapeTrackers(ctx context.Context, info *common.TorrentInfo, trackers []*tracker.Tracker) []*pb.TrackerScrape {
+	results := make([]*pb.TrackerScrape, len(trackers))
+	var wg sync.WaitGroup
+	for i := range trackers {
+		wg.Add(1)
+		go func(i int, announce string) {
+			defer wg.Done()
+			result := &pb.TrackerScrape{Announce: announce}
+			if scrape, err := tracker.New(announce).Scrape(ctx, info); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Complete = uint32(scrape.Complete)
+				result.Downloaded = uint32(scrape.Downloaded)
+				result.Incomplete = uint32(scrape.Incomplete)
+			}
+			results[i] = result
+		}(i, trackers[i].Announce)
+	}
+	wg.Wait()
+	return results
+}
+
 // TODO: session will send updates based on a ticker (every second)
+
+// peerList returns the torrent's connected peers for grpc replies
+func (to *Torrent) peerList() []*pb.Peer {
+	peers := make([]*pb.Peer, len(to.Peers))
+	for i, p := range to.Peers {
+		peers[i] = &pb.Peer{
+			Addr:   p.String(),
+			Source: pb.Peer_Source(p.Source),
+			Client: p.Client,
+		}
+	}
+	return peers
+}
+
+// trackerList returns the torrent's trackers for grpc replies, tiers are numbered from 1
+func (to *Torrent) trackerList() []*pb.Tracker {
+	var trackers []*pb.Tracker
+	for i, tier := range to.Trackers {
+		for _, tr := range tier {
+			trackers = append(trackers, &pb.Tracker{
+				Announce: tr.Announce,
+				Tier:     uint32(i + 1),
+				Working:  tr.Working,
+				Failure:  tr.Failure,
+				Warning:  tr.Warning,
+			})
+		}
+	}
+	return trackers
+}
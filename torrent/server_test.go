@@ -0,0 +1,133 @@
+package torrent
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	bencode "github.com/jackpal/bencode-go"
+	"github.com/kylec725/graytorrent/internal/tracker"
+	pb "github.com/kylec725/graytorrent/rpc"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serveUDPScrape answers a connect and a scrape request like a UDP tracker
+func serveUDPScrape(t *testing.T, conn net.PacketConn) {
+	buf := make([]byte, 512)
+	n, addr, err := conn.ReadFrom(buf)
+	require.Nil(t, err)
+	require.Equal(t, 16, n)
+	resp := make([]byte, 16)
+	copy(resp[4:8], buf[12:16])                 // Transaction ID
+	binary.BigEndian.PutUint64(resp[8:16], 777) // Connection ID
+	_, err = conn.WriteTo(resp, addr)
+	require.Nil(t, err)
+
+	n, addr, err = conn.ReadFrom(buf)
+	require.Nil(t, err)
+	require.Equal(t, 36, n)
+	assert.Equal(t, uint64(777), binary.BigEndian.Uint64(buf[0:8]))
+	assert.Equal(t, uint32(2), binary.BigEndian.Uint32(buf[8:12]))
+	resp = make([]byte, 20)
+	binary.BigEndian.PutUint32(resp[0:4], 2) // Action: Scrape
+	copy(resp[4:8], buf[12:16])
+	binary.BigEndian.PutUint32(resp[8:12], 4)
+	binary.BigEndian.PutUint32(resp[12:16], 5)
+	binary.BigEndian.PutUint32(resp[16:20], 6)
+	_, err = conn.WriteTo(resp, addr)
+	require.Nil(t, err)
+}
+
+func TestScrape(t *testing.T) {
+	assert := assert.New(t)
+
+	filename, _ := newAttrTorrent(t, []string{"bin", "run"})
+	info, _, err := InfoFromFile(filename)
+	require.Nil(t, err)
+
+	httpTracker := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal("/scrape", r.URL.Path)
+		assert.Equal("secret", r.URL.Query().Get("passkey"))
+		assert.Equal(string(info.InfoHash[:]), r.URL.Query().Get("info_hash"))
+		files := map[string]interface{}{string(info.InfoHash[:]): map[string]interface{}{"complete": 1, "downloaded": 2, "incomplete": 3}}
+		bencode.Marshal(w, map[string]interface{}{"files": files})
+	}))
+	defer httpTracker.Close()
+	udpTracker, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer udpTracker.Close()
+	go serveUDPScrape(t, udpTracker)
+
+	// Rewrite the torrent with our trackers
+	announces := map[string]*pb.TrackerScrape{
+		httpTracker.URL + "/announce?passkey=secret":             {Complete: 1, Downloaded: 2, Incomplete: 3},
+		"udp://" + udpTracker.LocalAddr().String() + "/announce": {Complete: 4, Downloaded: 5, Incomplete: 6},
+		httpTracker.URL + "/tracker":                             {Error: "Scrape: httpScrape: ScrapeURL: " + tracker.ErrNoScrape.Error()},
+	}
+	data, err := ioutil.ReadFile(filename)
+	require.Nil(t, err)
+	decoded, err := bencode.Decode(bytes.NewReader(data))
+	require.Nil(t, err)
+	torrent := decoded.(map[string]interface{})
+	var announceList []interface{}
+	for announce := range announces {
+		announceList = append(announceList, []interface{}{announce})
+	}
+	torrent["announce-list"] = announceList
+	var buf bytes.Buffer
+	require.Nil(t, bencode.Marshal(&buf, torrent))
+	filename = filepath.Join(t.TempDir(), "trackers.torrent")
+	require.Nil(t, ioutil.WriteFile(filename, buf.Bytes(), 0644))
+
+	s := &Session{torrents: make(map[[20]byte]*Torrent)}
+	reply, err := s.Scrape(context.Background(), &pb.ScrapeRequest{Request: &pb.ScrapeRequest_File{File: filename}})
+	require.Nil(t, err)
+	require.Len(t, reply.Trackers, len(announces))
+	for _, result := range reply.Trackers {
+		want := announces[result.Announce]
+		require.NotNil(t, want, result.Announce)
+		assert.Equal(want.Error, result.Error)
+		assert.Equal(want.Complete, result.Complete)
+		assert.Equal(want.Downloaded, result.Downloaded)
+		assert.Equal(want.Incomplete, result.Incomplete)
+	}
+
+	// Managed torrents are found by ID or infohash
+	_, err = s.Scrape(context.Background(), &pb.ScrapeRequest{Request: &pb.ScrapeRequest_TorrentRequest{TorrentRequest: &pb.TorrentRequest{Id: 1}}})
+	assert.Equal(ErrTorrentNotFound, err)
+	s.torrents[info.InfoHash] = &Torrent{ID: 1, Info: info, Trackers: []tracker.Tier{{tracker.New(httpTracker.URL + "/tracker")}}}
+	reply, err = s.Scrape(context.Background(), &pb.ScrapeRequest{Request: &pb.ScrapeRequest_TorrentRequest{TorrentRequest: &pb.TorrentRequest{Id: 1}}})
+	assert.Nil(err)
+	require.Len(t, reply.Trackers, 1)
+	assert.Equal(httpTracker.URL+"/tracker", reply.Trackers[0].Announce)
+	reply, err = s.Scrape(context.Background(), &pb.ScrapeRequest{Request: &pb.ScrapeRequest_TorrentRequest{TorrentRequest: &pb.TorrentRequest{InfoHash: info.InfoHash[:]}}})
+	assert.Nil(err)
+	assert.Len(reply.Trackers, 1)
+}
+
+func TestScrapeURL(t *testing.T) {
+	assert := assert.New(t)
+
+	for announce, scrape := range map[string]string{
+		"http://example.com/announce":          "http://example.com/scrape",
+		"http://example.com/x/announce":        "http://example.com/x/scrape",
+		"http://example.com/announce.php":      "http://example.com/scrape.php",
+		"http://example.com/announce?x2%0644":  "http://example.com/scrape?x2%0644",
+		"http://example.com/x/announce?pk=abc": "http://example.com/x/scrape?pk=abc",
+	} {
+		got, err := tracker.ScrapeURL(announce)
+		assert.Nil(err)
+		assert.Equal(scrape, got)
+	}
+	for _, announce := range []string{"http://example.com/a", "http://example.com/announce/x", "http://example.com/x%064announce"} {
+		_, err := tracker.ScrapeURL(announce)
+		assert.ErrorIs(err, tracker.ErrNoScrape)
+	}
+}
@@ -12,6 +12,10 @@ import (
 
 	"github.com/kylec725/graytorrent/internal/common"
 	"github.com/kylec725/graytorrent/internal/config"
+	"github.com/kylec725/graytorrent/internal/dht"
+	"github.com/kylec725/graytorrent/internal/lsd"
+	"github.com/kylec725/graytorrent/internal/udptracker"
+	"github.com/kylec725/graytorrent/internal/utp"
 	"github.com/kylec725/graytorrent/internal/write"
 	pb "github.com/kylec725/graytorrent/rpc"
 	log "github.com/sirupsen/logrus"
@@ -30,6 +34,10 @@ type Session struct {
 	torrents     map[[20]byte]*Torrent
 	peerListener net.Listener
 	port         uint16
+	utp          *utp.Socket        // nil if no UDP socket could be opened
+	dht          *dht.DHT           // nil if the DHT is disabled
+	lsd          *lsd.LSD           // nil if local service discovery is disabled
+	udpTracker   *udptracker.Client // nil if no UDP socket could be opened
 	pb.UnimplementedTorrentServiceServer
 }
 
@@ -42,22 +50,66 @@ func NewSession() (Session, error) {
 		return Session{}, err
 	}
 
+	return newSession(torrents)
+}
+
+// newSession opens the sockets and starts the services that a session shares between its torrents
+func newSession(torrents map[[20]byte]*Torrent) (Session, error) {
 	listener, port, err := initListener()
 	if err != nil {
 		return Session{}, err
 	}
 
+	socket, err := initUTP(port)
+	if err != nil {
+		log.WithField("error", err.Error()).Warn("Failed to open the uTP socket")
+	}
+	node, err := initDHT(socket)
+	if err != nil {
+		log.WithField("error", err.Error()).Warn("Failed to start the DHT")
+	}
+	service, err := initLSD(port)
+	if err != nil {
+		log.WithField("error", err.Error()).Warn("Failed to start local service discovery")
+	}
+	client, err := udptracker.New()
+	if err != nil {
+		log.WithField("error", err.Error()).Warn("Failed to open the UDP tracker socket")
+	}
+
 	s := Session{
 		torrents:     torrents,
 		peerListener: listener,
 		port:         port,
+		utp:          socket,
+		dht:          node,
+		lsd:          service,
+		udpTracker:   client,
 	}
 
-	go s.peerListen()
+	go s.peerListen(s.peerListener)
+	if s.utp != nil {
+		go s.peerListen(s.utp)
+	}
 
 	return s, nil
 }
 
+// closeServices closes the sockets and stops the services opened by newSession
+func (s *Session) closeServices() {
+	s.peerListener.Close()
+	closeDHT(s.dht)
+	if s.utp != nil {
+		s.utp.Close()
+	}
+	if s.lsd != nil {
+		s.lsd.Close()
+	}
+	if s.udpTracker != nil {
+		s.udpTracker.Close()
+	}
+}
+
 // Close performs clean up for a session
 func (s *Session) Close() {
 	for _, to := range s.torrents {
@@ -68,7 +120,7 @@ func (s *Session) Close() {
 		log.WithField("error", err.Error()).Debug("Problem occurred while saving torrent management data")
 	}
 
-	s.peerListener.Close()
+	s.closeServices()
 
 	log.Info("Graytorrent stopped")
 }
@@ -78,6 +130,12 @@ func (s *Session) AddTorrent(ctx context.Context, name string, magnet bool, dire
 	var to Torrent
 	if magnet {
 		to = Torrent{Magnet: name}
+		var err error
+		ctx = s.torrentContext(ctx) // The metadata can only be fetched if the link has trackers or peers, or the DHT is running
+		if to.Info, to.Trackers, err = InfoFromMagnet(ctx, name); err != nil {
+			log.WithFields(log.Fields{"name": name, "error": err.Error()}).Info("Failed to add torrent")
+			return nil, status.Error(codes.Internal, err.Error())
+		}
 	} else {
 		to = Torrent{File: name}
 	}
@@ -101,8 +159,10 @@ func (s *Session) AddTorrent(ctx context.Context, name string, magnet bool, dire
 		return nil, ErrBadDirectory
 	}
 	to.Info.Directory = absDir
-	if err := write.NewWrite(to.Info); err != nil { // Should fail if torrent already is being managed
-		return nil, ErrBadDirectory
+	if to.hasMetadata() { // Torrents from magnet links create their files once their metadata is fetched
+		if err := write.NewWrite(to.Info); err != nil { // Should fail if torrent already is being managed
+			return nil, ErrBadDirectory
+		}
 	}
 
 	s.torrents[to.Info.InfoHash] = &to
@@ -110,11 +170,29 @@ func (s *Session) AddTorrent(ctx context.Context, name string, magnet bool, dire
 	return &to, nil
 }
 
+// torrentContext adds the session-wide values that torrents need to a context
+func (s *Session) torrentContext(ctx context.Context) context.Context {
+	ctx = context.WithValue(ctx, common.KeyPort, s.port)
+	if s.utp != nil {
+		ctx = context.WithValue(ctx, common.KeyUTP, s.utp)
+	}
+	if s.dht != nil {
+		ctx = context.WithValue(ctx, common.KeyDHT, s.dht)
+	}
+	if s.lsd != nil {
+		ctx = context.WithValue(ctx, common.KeyLSD, s.lsd)
+	}
+	if s.udpTracker != nil {
+		ctx = context.WithValue(ctx, common.KeyUDPTracker, s.udpTracker)
+	}
+	return ctx
+}
+
 // RemoveTorrent removes a currently managed torrent
 func (s *Session) RemoveTorrent(to *Torrent, rmFiles bool) {
 	to.Stop()
 	os.Remove(to.saveFile())
-	if rmFiles {
+	if rmFiles && to.hasMetadata() { // Torrents still fetching their metadata have no files
 		fullPath := filepath.Join(to.Info.Directory, to.Info.Name)
 		if err := os.RemoveAll(fullPath); err != nil {
 			log.WithFields(log.Fields{"name": to.Info.Name, "infohash": hex.EncodeToString(to.Info.InfoHash[:])}).Info("Error when removing torrent's file(s)")
@@ -129,21 +207,13 @@ func (s *Session) RemoveTorrent(to *Torrent, rmFiles bool) {
 // Download begins a download for a single torrent
 func Download(ctx context.Context, name string, magnet bool, directory string) error {
 	log.Info("Graytorrent started")
-	listener, port, err := initListener()
+	s, err := newSession(make(map[[20]byte]*Torrent))
 	if err != nil {
 		return err
 	}
-
-	s := Session{
-		torrents:     make(map[[20]byte]*Torrent),
-		peerListener: listener,
-		port:         port,
-	}
-
-	go s.peerListen()
-	defer s.peerListener.Close()
+	defer s.closeServices()
 	go s.catchSignal()
-	ctx = context.WithValue(ctx, common.KeyPort, s.port)
+	ctx = s.torrentContext(ctx)
 
 	to, err := s.AddTorrent(ctx, name, magnet, directory)
 	if err != nil {
@@ -151,6 +221,13 @@ func Download(ctx context.Context, name string, magnet bool, directory string) e
 		return err
 	}
 
+	if !to.hasMetadata() { // Fetch the metadata first so that failing to find it ends the download
+		if err := to.fetchInfo(ctx); err != nil {
+			log.WithFields(log.Fields{"name": name, "error": err.Error()}).Info("Failed to fetch metadata")
+			return err
+		}
+	}
+
 	go to.Start(ctx) // NOTE: maybe add an option to seed after download is complete
 	for to.Info.Left > 0 {
 		time.Sleep(time.Second)
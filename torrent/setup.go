@@ -1,54 +1,312 @@
 package torrent
 
 import (
+	"context"
+	"encoding/hex"
 	"math"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/dht"
+	"github.com/kylec725/graytorrent/internal/magnet"
+	"github.com/kylec725/graytorrent/internal/merkle"
 	"github.com/kylec725/graytorrent/internal/metainfo"
+	"github.com/kylec725/graytorrent/internal/peer"
 	"github.com/kylec725/graytorrent/internal/tracker"
 	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
 )
 
-// InfoFromFile grabs torrent metainfo from a .torrent file
-func InfoFromFile(filename string) (*common.TorrentInfo, []*tracker.Tracker, error) {
-	var info common.TorrentInfo
+const metadataTimeout = 3 * time.Minute // How long to search for peers with a magnet link's metadata
+const maxMetadataPeers = 10             // Number of peers to fetch metadata from at once
 
+// Errors
+var (
+	ErrNoSources       = errors.New("Magnet link has no trackers or peers and the DHT is disabled")
+	ErrMetadataTimeout = errors.New("Could not get metadata from any peers")
+	ErrPieceLength     = errors.New("Piece length of a v2 torrent must be a power of two of at least 16 KiB")
+	ErrPieceLayers     = errors.New("Piece layer does not match the file's pieces root")
+)
+
+// InfoFromFile grabs torrent metainfo from a .torrent file
+func InfoFromFile(filename string) (*common.TorrentInfo, []tracker.Tier, error) {
 	meta, err := metainfo.New(filename)
 	if err != nil {
 		return nil, nil, errors.Wrap(err, "InfoFromFile")
 	}
 
+	info, err := infoFromMeta(meta)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "InfoFromFile")
+	}
+
+	// Trackers
+	trackers, err := tracker.GetTrackers(meta)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "InfoFromFile")
+	}
+
+	return info, trackers, nil
+}
+
+// InfoFromMagnet grabs the partial torrent info of a magnet link, which is enough to handshake and announce with
+// while the torrent's metadata is fetched from peers
+func InfoFromMagnet(ctx context.Context, link string) (*common.TorrentInfo, []tracker.Tier, error) {
+	mag, err := magnet.New(link)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "InfoFromMagnet")
+	}
+
+	// Trackers are optional as long as the link provides peers or we can search the DHT
+	trackers, _ := tracker.GetTrackers(metainfo.Metainfo{AnnounceList: [][]string{mag.Trackers}})
+	_, hasDHT := dht.FromContext(ctx)
+	if len(trackers) == 0 && len(mag.Peers) == 0 && !hasDHT {
+		return nil, nil, errors.Wrap(ErrNoSources, "InfoFromMagnet")
+	}
+
+	// Trackers treat peers with nothing left as seeders, links without a name are named by their infohash until the metadata arrives
+	info := common.TorrentInfo{Name: mag.Name, InfoHash: mag.InfoHash, Left: 1}
+	if info.Name == "" {
+		info.Name = hex.EncodeToString(mag.InfoHash[:])
+	}
+	info.SetPeerID()
+
+	return &info, trackers, nil
+}
+
+// infoFromPeers fetches the metadata of a magnet link from peers found through its partial info and trackers
+func infoFromPeers(ctx context.Context, link string, partial *common.TorrentInfo, trackers []tracker.Tier) (*common.TorrentInfo, []tracker.Tier, error) {
+	mag, err := magnet.New(link)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "infoFromPeers")
+	}
+
+	infoBytes, err := fetchMetadata(ctx, partial, trackers, mag.Peers)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "infoFromPeers")
+	}
+
+	meta, err := metainfo.NewFromInfo(infoBytes, [][]string{mag.Trackers})
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "infoFromPeers")
+	}
+	info, err := infoFromMeta(meta)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "infoFromPeers")
+	}
+	info.InfoHash = mag.InfoHash // Already verified against the fetched metadata
+	info.PeerID = partial.PeerID
+	info.Key = partial.Key
+
+	// Use fresh trackers since the ones used for fetching may still be shutting down
+	trackers, _ = tracker.GetTrackers(meta)
+
+	return info, trackers, nil
+}
+
+// infoFromMeta fills out the torrent info that can be derived from metainfo
+func infoFromMeta(meta metainfo.Metainfo) (*common.TorrentInfo, error) {
+	var info common.TorrentInfo
+	var err error
+
 	info.Name = meta.Info.Name
 
 	info.PieceLength = meta.Info.PieceLength
 	info.TotalPieces = len(meta.Info.Pieces) / 20
 	info.TotalLength = meta.Length()
-	info.Left = info.TotalLength
-
-	bitfieldSize := int(math.Ceil(float64(info.TotalPieces) / 8))
-	info.Bitfield = make([]byte, bitfieldSize)
+	info.Private = meta.IsPrivate()
+	info.WebSeeds = meta.URLList
+	info.Metadata = meta.InfoBytes()
 
 	// Set torrent's filepaths
 	info.Paths = common.GetPaths(meta)
 
-	info.SetPeerID() // TODO: Set peerID once for the client, and make it persistent
+	if meta.V2() {
+		if info.PieceLength < merkle.BlockSize || merkle.NextPow2(info.PieceLength) != info.PieceLength {
+			return nil, errors.Wrap(ErrPieceLength, "infoFromMeta")
+		}
+		layoutLength := 0
+		for _, path := range info.Paths {
+			layoutLength += path.Length
+		}
+		if !meta.V1() { // Files of v2 only torrents are padded to pieces without any pad files in the metainfo
+			info.TotalLength = layoutLength
+			info.TotalPieces = (info.TotalLength + info.PieceLength - 1) / info.PieceLength
+		} else if padLength := info.TotalLength - layoutLength; padLength > 0 { // Hybrid torrents may also pad their last file
+			padPath := filepath.Join(info.Name, ".pad", strconv.Itoa(padLength))
+			info.Paths = append(info.Paths, common.Path{Length: padLength, Path: padPath, Pad: true})
+		}
+		if info.InfoHashV2, err = meta.InfoHashV2(); err != nil {
+			return nil, errors.Wrap(err, "infoFromMeta")
+		}
+		if info.PieceHashesV2, err = pieceHashesV2(meta, &info); err != nil {
+			return nil, errors.Wrap(err, "infoFromMeta")
+		}
+	}
+	info.Left = info.TotalLength
 
-	info.InfoHash, err = meta.InfoHash()
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "InfoFromFile")
+	// v2 only torrents use their truncated SHA-256 infohash with trackers, the DHT and in handshakes
+	if meta.V1() {
+		info.InfoHash, err = meta.InfoHash()
+		if err != nil {
+			return nil, errors.Wrap(err, "infoFromMeta")
+		}
+	} else {
+		info.InfoHash = info.TruncatedV2()
 	}
 
+	bitfieldSize := int(math.Ceil(float64(info.TotalPieces) / 8))
+	info.Bitfield = make([]byte, bitfieldSize)
+
+	info.SetPeerID() // TODO: Set peerID once for the client, and make it persistent
+
 	// Get the piece hashes from the metainfo
 	info.PieceHashes, err = meta.PieceHashes()
 	if err != nil {
-		return nil, nil, errors.Wrap(err, "InfoFromFile")
+		return nil, errors.Wrap(err, "infoFromMeta")
 	}
 
-	// Trackers
-	trackers, err := tracker.GetTrackers(meta)
-	if err != nil {
-		return nil, nil, errors.Wrap(err, "InfoFromFile")
+	return &info, nil
+}
+
+// pieceHashesV2 lays out the merkle root of every piece from the piece layers of the torrent's files,
+// pieces of files without a piece layer are left zero until peers send the layer
+func pieceHashesV2(meta metainfo.Metainfo, info *common.TorrentInfo) ([][32]byte, error) {
+	hashes := make([][32]byte, info.TotalPieces)
+	pad := merkle.PadHash(merkle.Log2(info.PieceLength / merkle.BlockSize))
+	offset := 0
+	for _, path := range info.Paths {
+		first := offset / info.PieceLength
+		offset += path.Length
+		if path.Pad || path.Length == 0 {
+			continue
+		}
+
+		count := (path.Length + info.PieceLength - 1) / info.PieceLength
+		if count == 1 { // Files that fit in a piece don't have a piece layer
+			hashes[first] = path.PiecesRoot
+			continue
+		}
+		layer, ok := meta.PieceLayers[path.PiecesRoot]
+		if !ok {
+			continue
+		}
+		if len(layer) != count || merkle.Root(layer, merkle.NextPow2(count), pad) != path.PiecesRoot {
+			return nil, errors.Wrap(ErrPieceLayers, "pieceHashesV2")
+		}
+		copy(hashes[first:], layer)
+	}
+	return hashes, nil
+}
+
+// fetchMetadata finds peers through trackers, the DHT and the provided addresses, and returns the first verified info dictionary
+func fetchMetadata(ctx context.Context, info *common.TorrentInfo, trackers []tracker.Tier, addrs []string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+	peers := make(chan peer.Peer)
+	results := make(chan []byte)
+	var wg sync.WaitGroup
+
+	// Cleanup, drain the channels so that the trackers and peers can exit
+	defer func() {
+		cancel()
+		go func() {
+			wg.Wait()
+			close(peers)
+		}()
+		go func() {
+			for range peers {
+			}
+		}()
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		tracker.Run(ctx, trackers, info, peers, nil)
+	}()
+	if node, ok := dht.FromContext(ctx); ok {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			found, err := node.GetPeers(ctx, info.InfoHash)
+			if err != nil {
+				log.WithField("error", err.Error()).Debug("DHT search for metadata peers failed")
+			}
+			for _, addr := range found {
+				p := peer.New(addr, nil, info)
+				p.Source = peer.SourceDHT
+				select {
+				case peers <- p:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	for _, addr := range addrs {
+		wg.Add(1)
+		go func(addr string) {
+			defer wg.Done()
+			p := peer.New(addr, nil, info)
+			p.Source = peer.SourceMagnet
+			select {
+			case peers <- p:
+			case <-ctx.Done():
+			}
+		}(addr)
 	}
 
-	return &info, trackers, nil
+	tried := make(map[string]bool)
+	var queue []peer.Peer
+	active := 0
+	fetch := func(p peer.Peer) {
+		active++
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var data []byte
+			if err := p.Dial(ctx); err != nil {
+				log.WithFields(log.Fields{"peer": p.String(), "error": err.Error()}).Debug("Dial failed")
+			} else if data, err = p.FetchMetadata(ctx, info); err != nil {
+				log.WithFields(log.Fields{"peer": p.String(), "error": err.Error()}).Debug("Fetching metadata failed")
+			}
+			if p.Conn != nil {
+				p.Conn.Close()
+			}
+			select {
+			case results <- data:
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, errors.Wrap(ErrMetadataTimeout, "fetchMetadata")
+		case p := <-peers:
+			if tried[p.String()] {
+				continue
+			}
+			tried[p.String()] = true
+			if active < maxMetadataPeers {
+				fetch(p)
+			} else {
+				queue = append(queue, p)
+			}
+		case data := <-results:
+			active--
+			if data != nil {
+				log.WithField("name", info.Name).Debug("Received metadata from peer")
+				return data, nil
+			}
+			if len(queue) > 0 {
+				fetch(queue[0])
+				queue = queue[1:]
+			}
+		}
+	}
 }
@@ -0,0 +1,233 @@
+package torrent
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bencode "github.com/jackpal/bencode-go"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/merkle"
+	"github.com/kylec725/graytorrent/internal/write"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testPieceLength = 2 * merkle.BlockSize
+
+// merkleFile returns the pieces root and piece layer of a file in a v2 torrent
+func merkleFile(data []byte) ([32]byte, [][32]byte) {
+	var layer [][32]byte
+	for start := 0; start < len(data); start += testPieceLength {
+		piece := data[start:common.Min(start+testPieceLength, len(data))]
+		width := testPieceLength / merkle.BlockSize
+		if len(data) <= testPieceLength {
+			width = merkle.NextPow2(len(merkle.Leaves(piece)))
+		}
+		layer = append(layer, merkle.Root(merkle.Leaves(piece), width, [32]byte{}))
+	}
+	if len(layer) == 1 {
+		return layer[0], nil
+	}
+	return merkle.Root(layer, merkle.NextPow2(len(layer)), merkle.PadHash(1)), layer
+}
+
+// newV2Torrent writes a torrent with a file of four pieces followed by a file smaller than a piece, hybrid torrents also have v1 pieces
+// and pad files, it returns the torrent's file and the data of its pieces with padding. The large file's piece layer is passed through
+// pieceLayer, or left out if it is nil
+func newV2Torrent(t *testing.T, hybrid bool, pieceLayer func([][32]byte) [][32]byte) (string, []byte) {
+	small, large := make([]byte, 20000), make([]byte, 100000)
+	rand.Read(small)
+	rand.Read(large)
+	smallRoot, _ := merkleFile(small)
+	largeRoot, largeLayer := merkleFile(large)
+
+	info := map[string]interface{}{
+		"name":         "multi",
+		"piece length": testPieceLength,
+		"meta version": 2,
+		"file tree": map[string]interface{}{
+			"small.bin": map[string]interface{}{"": map[string]interface{}{"length": len(small), "pieces root": string(smallRoot[:])}},
+			"dir": map[string]interface{}{
+				"large.bin": map[string]interface{}{"": map[string]interface{}{"length": len(large), "pieces root": string(largeRoot[:])}},
+			},
+		},
+	}
+	// Files are ordered by the file tree's keys, and the large file is padded to the next piece
+	data := append(append(append([]byte{}, large...), make([]byte, testPieceLength*4-len(large))...), small...)
+	if hybrid {
+		var pieces []byte
+		for start := 0; start < len(data); start += testPieceLength {
+			hash := sha1.Sum(data[start:common.Min(start+testPieceLength, len(data))])
+			pieces = append(pieces, hash[:]...)
+		}
+		info["pieces"] = string(pieces)
+		info["files"] = []interface{}{
+			map[string]interface{}{"length": len(large), "path": []string{"dir", "large.bin"}},
+			map[string]interface{}{"length": testPieceLength*4 - len(large), "path": []string{".pad", "31072"}, "attr": "p"},
+			map[string]interface{}{"length": len(small), "path": []string{"small.bin"}},
+		}
+	}
+
+	torrent := map[string]interface{}{"announce": "http://tracker.example.com/announce", "info": info}
+	if pieceLayer != nil {
+		var layer []byte
+		for _, hash := range pieceLayer(largeLayer) {
+			layer = append(layer, hash[:]...)
+		}
+		torrent["piece layers"] = map[string]interface{}{string(largeRoot[:]): string(layer)}
+	}
+
+	var buf bytes.Buffer
+	require.Nil(t, bencode.Marshal(&buf, torrent))
+	filename := filepath.Join(t.TempDir(), "v2.torrent")
+	require.Nil(t, ioutil.WriteFile(filename, buf.Bytes(), 0644))
+	return filename, data
+}
+
+func TestInfoFromFileV2(t *testing.T) {
+	for _, hybrid := range []bool{true, false} {
+		filename, data := newV2Torrent(t, hybrid, func(layer [][32]byte) [][32]byte { return layer })
+		info, _, err := InfoFromFile(filename)
+		require.Nil(t, err)
+
+		assert := assert.New(t)
+		assert.Equal([]common.Path{
+			{Length: 100000, Path: filepath.Join("multi", "dir", "large.bin"), PiecesRoot: info.Paths[0].PiecesRoot},
+			{Length: 31072, Path: filepath.Join("multi", ".pad", "31072"), Pad: true},
+			{Length: 20000, Path: filepath.Join("multi", "small.bin"), PiecesRoot: info.Paths[2].PiecesRoot},
+		}, info.Paths)
+		assert.Equal(len(data), info.TotalLength)
+		assert.Equal(5, info.TotalPieces)
+		assert.True(info.V2())
+		for _, hash := range info.PieceHashesV2 {
+			assert.NotEqual([32]byte{}, hash)
+		}
+		if hybrid {
+			assert.Len(info.PieceHashes, 5)
+			assert.NotEqual(info.TruncatedV2(), info.InfoHash)
+			assert.True(info.MatchesInfoHash(info.TruncatedV2()))
+		} else {
+			assert.Empty(info.PieceHashes)
+			assert.Equal(info.TruncatedV2(), info.InfoHash)
+		}
+
+		// Pieces verify against the merkle trees and the padding is never written
+		info.Directory = t.TempDir()
+		require.Nil(t, write.NewWrite(info))
+		assert.NoFileExists(filepath.Join(info.Directory, info.Paths[1].Path))
+		for i := 0; i < info.TotalPieces; i++ {
+			piece := append([]byte{}, data[i*testPieceLength:common.Min((i+1)*testPieceLength, len(data))]...)
+			assert.True(write.VerifyPiece(info, i, piece), "piece %d", i)
+			require.Nil(t, write.AddPiece(info, i, piece))
+			read, err := write.ReadPiece(info, i)
+			assert.Nil(err)
+			assert.Equal(piece, read)
+
+			piece[0]++
+			assert.False(write.VerifyPiece(info, i, piece), "piece %d", i)
+		}
+	}
+}
+
+func TestInfoFromFileV2Layers(t *testing.T) {
+	assert := assert.New(t)
+
+	// Without piece layers only the file that fits in a piece can be verified until peers send the hashes
+	filename, data := newV2Torrent(t, false, nil)
+	info, _, err := InfoFromFile(filename)
+	require.Nil(t, err)
+	assert.Equal(make([][32]byte, 4), info.PieceHashesV2[:4])
+	assert.False(write.VerifyPiece(info, 0, data[:testPieceLength]))
+	assert.True(write.VerifyPiece(info, 4, data[4*testPieceLength:]))
+
+	// A piece layer that doesn't match its pieces root is refused
+	filename, _ = newV2Torrent(t, false, func(layer [][32]byte) [][32]byte {
+		layer[1] = sha256.Sum256(nil)
+		return layer
+	})
+	_, _, err = InfoFromFile(filename)
+	assert.ErrorIs(err, ErrPieceLayers)
+}
+
+// newAttrTorrent writes a v1 torrent whose files use each attribute, it returns the torrent's file and the data of its pieces
+func newAttrTorrent(t *testing.T, symlinkPath []string) (string, []byte) {
+	run, hidden := make([]byte, 1000), make([]byte, 10)
+	rand.Read(run)
+	rand.Read(hidden)
+	data := append(append(append([]byte{}, run...), make([]byte, merkle.BlockSize-len(run))...), hidden...)
+	first, second := sha1.Sum(data[:merkle.BlockSize]), sha1.Sum(data[merkle.BlockSize:])
+
+	info := map[string]interface{}{
+		"name":         "attrs",
+		"piece length": merkle.BlockSize,
+		"pieces":       string(append(first[:], second[:]...)),
+		"files": []interface{}{
+			map[string]interface{}{"length": len(run), "path": []string{"bin", "run"}, "attr": "x"},
+			map[string]interface{}{"length": merkle.BlockSize - len(run), "path": []string{".pad", "15384"}, "attr": "p"},
+			map[string]interface{}{"length": 0, "path": []string{"link"}, "attr": "l", "symlink path": symlinkPath},
+			map[string]interface{}{"length": len(hidden), "path": []string{".hidden"}, "attr": "h"},
+		},
+	}
+	var buf bytes.Buffer
+	require.Nil(t, bencode.Marshal(&buf, map[string]interface{}{"announce": "http://tracker.example.com/announce", "info": info}))
+	filename := filepath.Join(t.TempDir(), "attrs.torrent")
+	require.Nil(t, ioutil.WriteFile(filename, buf.Bytes(), 0644))
+	return filename, data
+}
+
+func TestInfoFromFileAttrs(t *testing.T) {
+	assert := assert.New(t)
+
+	filename, data := newAttrTorrent(t, []string{"bin", "run"})
+	info, _, err := InfoFromFile(filename)
+	require.Nil(t, err)
+	assert.Equal(info.InfoHash, sha1.Sum(info.Metadata)) // Served to peers that only have the infohash
+	assert.Equal([]common.Path{
+		{Length: 1000, Path: filepath.Join("attrs", "bin", "run"), Executable: true},
+		{Length: 15384, Path: filepath.Join("attrs", ".pad", "15384"), Pad: true},
+		{Length: 0, Path: filepath.Join("attrs", "link"), Symlink: filepath.Join("attrs", "bin", "run")},
+		{Length: 10, Path: filepath.Join("attrs", ".hidden"), Hidden: true},
+	}, info.Paths)
+
+	// Pad files aren't created and symlinks point at their targets
+	info.Directory = t.TempDir()
+	require.Nil(t, write.NewWrite(info))
+	assert.NoFileExists(filepath.Join(info.Directory, info.Paths[1].Path))
+	target, err := os.Readlink(filepath.Join(info.Directory, info.Paths[2].Path))
+	assert.Nil(err)
+	assert.Equal(filepath.Join("bin", "run"), target)
+
+	// The executable bit is set once all of the file's pieces are written
+	runPath := filepath.Join(info.Directory, info.Paths[0].Path)
+	require.Nil(t, write.CompleteFiles(info, 0))
+	stat, err := os.Stat(runPath)
+	require.Nil(t, err)
+	assert.Zero(stat.Mode() & 0111)
+
+	for i := 0; i < info.TotalPieces; i++ {
+		piece := data[i*merkle.BlockSize : common.Min((i+1)*merkle.BlockSize, len(data))]
+		require.True(t, write.VerifyPiece(info, i, piece))
+		require.Nil(t, write.AddPiece(info, i, piece))
+		info.Bitfield.Set(i)
+		require.Nil(t, write.CompleteFiles(info, i))
+	}
+	stat, err = os.Stat(runPath)
+	require.Nil(t, err)
+	assert.NotZero(stat.Mode() & 0111)
+	run, err := ioutil.ReadFile(runPath)
+	assert.Nil(err)
+	assert.Equal(data[:1000], run)
+
+	// Symlinks can't leave the torrent's directory
+	filename, _ = newAttrTorrent(t, []string{"..", "..", "etc", "passwd"})
+	info, _, err = InfoFromFile(filename)
+	require.Nil(t, err)
+	info.Directory = t.TempDir()
+	assert.ErrorIs(write.NewWrite(info), write.ErrSymlink)
+}
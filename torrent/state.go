@@ -5,11 +5,12 @@ type State uint8
 
 // Possible states for torrents
 const (
-	Downloading State = iota // Torrent is downloading and has peers
-	Stopped                  // Torrent is not complete nor attempting to download
-	Stalled                  // Torrent is attempting to download, but has no peers
-	Seeding                  // Torrent is complete and seeding
-	Complete                 // Torrent is complete and not seeding
+	Downloading      State = iota // Torrent is downloading and has peers
+	Stopped                       // Torrent is not complete nor attempting to download
+	Stalled                       // Torrent is attempting to download, but has no peers
+	Seeding                       // Torrent is complete and seeding
+	Complete                      // Torrent is complete and not seeding
+	FetchingMetadata              // Torrent is fetching its metadata from peers before downloading
 )
 
 func (state State) String() string {
@@ -24,6 +25,8 @@ func (state State) String() string {
 		return "Seeding"
 	case Complete:
 		return "Complete"
+	case FetchingMetadata:
+		return "Fetching metadata"
 	default:
 		return "Unknown"
 	}
@@ -33,6 +36,9 @@ func (state State) String() string {
 func (to *Torrent) State() State {
 	// Torrent's Start() goroutine is running
 	if to.Started {
+		if !to.hasMetadata() {
+			return FetchingMetadata
+		}
 		if to.Info.Left == 0 {
 			return Seeding
 		}
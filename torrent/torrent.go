@@ -13,17 +13,26 @@ package torrent
 import (
 	"context"
 	"encoding/hex"
+	"os"
 	"time"
 
 	"github.com/kylec725/graytorrent/internal/common"
 	"github.com/kylec725/graytorrent/internal/config"
+	"github.com/kylec725/graytorrent/internal/dht"
+	"github.com/kylec725/graytorrent/internal/lsd"
+	"github.com/kylec725/graytorrent/internal/metainfo"
 	"github.com/kylec725/graytorrent/internal/peer"
 	"github.com/kylec725/graytorrent/internal/peer/message"
+	"github.com/kylec725/graytorrent/internal/picker"
 	"github.com/kylec725/graytorrent/internal/tracker"
+	"github.com/kylec725/graytorrent/internal/webseed"
+	"github.com/kylec725/graytorrent/internal/write"
 	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 )
 
+const pexInterval = time.Minute // How often to send PEX messages to peers
+
 // Errors
 var (
 	ErrPeerNotFound = errors.New("Peer not found")
@@ -37,18 +46,19 @@ type Torrent struct {
 	File     string              `json:"File"`   // .torrent file
 	Magnet   string              `json:"Magnet"` // Magnet link
 	Info     *common.TorrentInfo `json:"Info"`   // Contains meta data of the torrent
-	Trackers []*tracker.Tracker  `json:"Trackers"`
+	Trackers []tracker.Tier      `json:"Trackers"`
 	Peers    []*peer.Peer        `json:"-"`
 	NewPeers chan peer.Peer      `json:"-"` // Used by main and trackers to send in new peers
 	Started  bool                `json:"-"` // Flag to see if torrent goroutine is running
 
 	cancel            context.CancelFunc `json:"-"` // Cancel function for context, we can use it to see if the Start goroutine is running
 	optimisticUnchoke *peer.Peer         `json:"-"` // The peer that is currently optimistically unchoked
+	settingsChanged   chan struct{}      `json:"-"` // Notifies the running torrent that file priorities or the download order changed
 }
 
 // Init initializes a torrent so that it is ready to download or seed
 func (to *Torrent) Init() error {
-	// TODO: use either file or magnet link
+	// Torrents added from magnet links already have their info fetched from peers
 	if to.Info == nil {
 		var err error
 		// Convert to a TorrentInfo struct
@@ -56,9 +66,21 @@ func (to *Torrent) Init() error {
 		if err != nil {
 			return errors.Wrap(err, "Init")
 		}
+	} else if to.File != "" {
+		// Reloaded torrents take the private flag and metadata from their metainfo, since saves from older versions don't have them
+		if meta, err := metainfo.New(to.File); err == nil {
+			to.Info.Private = to.Info.Private || meta.IsPrivate()
+			if len(to.Info.Metadata) == 0 {
+				to.Info.Metadata = meta.InfoBytes()
+			}
+		}
+	}
+	if to.Info.Key == 0 { // Saves from older versions don't have a tracker key
+		to.Info.SetKey()
 	}
 
 	to.NewPeers = make(chan peer.Peer)
+	to.settingsChanged = make(chan struct{}, 1)
 
 	to.Started = false
 
@@ -73,36 +95,50 @@ func (to *Torrent) Init() error {
 // Start initiates a routine to download a torrent from peers
 func (to *Torrent) Start(ctx context.Context) {
 	to.Started = true
+	ctx, cancel := context.WithCancel(ctx)
+	to.cancel = cancel
+	if !to.hasMetadata() { // Torrents added from magnet links fetch their metadata before downloading
+		if err := to.fetchInfo(ctx); err != nil {
+			log.WithFields(log.Fields{"name": to.Info.Name, "error": err.Error()}).Info("Failed to fetch metadata")
+			to.Started = false
+			cancel()
+			return
+		}
+	}
 	torrentLog := log.WithFields(log.Fields{"name": to.Info.Name, "infohash": hex.EncodeToString(to.Info.InfoHash[:])})
 	torrentLog.Info("Torrent started")
-	work := make(chan int, to.Info.TotalPieces)       // Piece indices we need
+	priorities := to.Info.PiecePriorities()           // Pieces of skipped files don't count towards what is left
+	pk := picker.New(to.Info)                         // Chooses the pieces to download from each peer
 	results := make(chan int, to.Info.TotalPieces)    // Notification that a piece is done
 	complete := make(chan bool)                       // Notify trackers that the torrent is complete
+	completed := to.Info.Left == 0                    // Complete is only closed once, more files may be wanted later
 	deadPeers := make(chan string)                    // For peers to notify they should be removed from our list
 	unchokeTicker := time.NewTicker(10 * time.Second) // Change who is unchoked after a period of time
+	pexTicker := time.NewTicker(pexInterval)          // Share our connected peers with the swarm
 	lastOpUnchoke := time.Now()                       // Keep track of when the optimistic unchoke was changed
-	ctx, cancel := context.WithCancel(ctx)
-	to.cancel = cancel
 
 	// Cleanup
 	defer func() {
 		to.Started = false
 		unchokeTicker.Stop()
+		pexTicker.Stop()
 		to.Peers = nil // Clear peers
 		cancel()       // Close all trackers and peers if the torrent goroutine returns
 		to.optimisticUnchoke = nil
 	}()
 
-	// Start tracker goroutines
-	for i := range to.Trackers {
-		go to.Trackers[i].Run(ctx, to.Info, to.NewPeers, complete)
-	}
-
-	// Populate work queue
-	for i := 0; i < to.Info.TotalPieces; i++ { // TODO: change to random order or a priority queue (use heap)
-		if !to.Info.Bitfield.Has(i) {
-			work <- i
+	// Start tracker goroutine
+	go tracker.Run(ctx, to.Trackers, to.Info, to.NewPeers, complete)
+	if !to.Info.Private { // Private torrents only get peers from their trackers
+		if node, ok := dht.FromContext(ctx); ok {
+			go to.runDHT(ctx, node)
 		}
+		if service, ok := lsd.FromContext(ctx); ok {
+			go to.runLSD(ctx, service)
+		}
+	}
+	for _, url := range to.Info.WebSeeds {
+		go webseed.New(url).Run(ctx, to.Info, pk, results)
 	}
 
 	for {
@@ -113,19 +149,43 @@ func (to *Torrent) Start(ctx context.Context) {
 		case deadPeer := <-deadPeers: // Don't exit since trackers may find peers
 			to.removePeer(deadPeer)
 		case newPeer := <-to.NewPeers: // Incoming peers that contacted us
-			if !to.hasPeer(newPeer.String()) && len(to.Peers) < config.GetConfig().Network.MaxTorrentConnections {
-				go to.addPeer(ctx, &newPeer, work, results, deadPeers)
+			if to.allowPeer(newPeer) && !pk.Banned(newPeer.String()) {
+				go to.addPeer(ctx, &newPeer, pk, results, deadPeers)
 			}
 		case index := <-results:
+			if to.Info.Bitfield.Has(index) { // Sources racing for the same piece in endgame mode
+				break
+			}
+			pk.Done(index)
 			to.Info.Bitfield.Set(index)
-			to.Info.Left -= to.Info.PieceSize(index)
+			if priorities[index] != common.PrioritySkip {
+				to.Info.Left -= to.Info.PieceSize(index)
+			}
+			to.Info.AddDownloaded(to.Info.PieceSize(index))
+			if err := write.CompleteFiles(to.Info, index); err != nil {
+				torrentLog.WithField("error", err.Error()).Warn("Failed to finish completed files")
+			}
 			msg := message.Have(uint32(index)) // Notify peers that we have a new piece
 			for i := range to.Peers {
 				to.Peers[i].Send <- msg
 			}
 
-			if to.Info.Left == 0 { // WARNING: goroutine leak when seeding begins (high cpu usage)
+			if to.Info.Left == 0 && !completed { // WARNING: goroutine leak when seeding begins (high cpu usage)
+				torrentLog.Info("Torrent completed")
+				completed = true
+				close(complete)
+			}
+		case <-to.settingsChanged:
+			priorities = to.Info.PiecePriorities()
+			pk.SetPriorities(priorities) // Stops downloading newly skipped pieces, so their files can be removed
+			if err := write.RemoveSkipped(to.Info); err != nil {
+				torrentLog.WithField("error", err.Error()).Warn("Failed to remove skipped files")
+			}
+			pk.SetOrder(to.Info.Sequential, to.Info.FirstLast, to.Info.FirstLastPieces()) // Skipped files have no first and last pieces
+			to.Info.UpdateLeft()
+			if to.Info.Left == 0 && !completed { // Only skipped files were left
 				torrentLog.Info("Torrent completed")
+				completed = true
 				close(complete)
 			}
 		case <-unchokeTicker.C:
@@ -135,6 +195,10 @@ func (to *Torrent) Start(ctx context.Context) {
 				}
 				to.unchokeAlg()
 			}
+		case <-pexTicker.C:
+			if !to.Info.Private {
+				to.sharePeers()
+			}
 		}
 	}
 }
@@ -145,19 +209,64 @@ func (to *Torrent) Stop() {
 	to.cancel()
 }
 
-func (to *Torrent) addPeer(ctx context.Context, p *peer.Peer, work chan int, results chan int, deadPeers chan string) {
+// hasMetadata returns whether the torrent's info is complete, torrents added from magnet links only have partial info until
+// their metadata is fetched
+func (to *Torrent) hasMetadata() bool {
+	return to.Info.TotalPieces > 0
+}
+
+// fetchInfo replaces the partial info of a torrent added from a magnet link with the info from the metadata its peers send,
+// and creates the torrent's files
+func (to *Torrent) fetchInfo(ctx context.Context) error {
+	log.WithFields(log.Fields{"name": to.Info.Name, "infohash": hex.EncodeToString(to.Info.InfoHash[:])}).Info("Fetching metadata")
+	info, trackers, err := infoFromPeers(ctx, to.Magnet, to.Info, to.Trackers)
+	if err != nil {
+		return errors.Wrap(err, "fetchInfo")
+	}
+	// Keep the settings chosen while the metadata was fetched
+	info.Directory = to.Info.Directory
+	info.Sequential = to.Info.Sequential
+	info.FirstLast = to.Info.FirstLast
+	if err := write.NewWrite(info); err != nil {
+		return errors.Wrap(err, "fetchInfo")
+	}
+
+	oldSave := to.saveFile() // Links without a name were saved under their infohash
+	to.Info, to.Trackers = info, trackers
+	if to.saveFile() != oldSave {
+		os.Remove(oldSave)
+	}
+	return nil
+}
+
+func (to *Torrent) addPeer(ctx context.Context, p *peer.Peer, pk *picker.Picker, results chan int, deadPeers chan string) {
 	if p.Conn == nil {
-		if err := p.Dial(); err != nil {
+		_, hasDHT := dht.FromContext(ctx)
+		if err := p.Dial(ctx); err != nil {
 			log.WithFields(log.Fields{"error": err.Error(), "peer": p.String()}).Debug("Dial failed")
 			return
-		} else if err := p.InitHandshake(to.Info); err != nil {
+		} else if err := p.InitHandshake(to.Info, hasDHT); err != nil {
 			log.WithFields(log.Fields{"error": err.Error(), "peer": p.String()}).Debug("Handshake failed")
 			return
 		}
 	}
-	log.WithField("peer", p.String()).Debug("Handshake successful")
+	log.WithFields(log.Fields{"peer": p.String(), "source": p.Source.String()}).Debug("Handshake successful")
+	p.Discovered = to.NewPeers
 	to.Peers = append(to.Peers, p)
-	p.StartWork(ctx, to.Info, work, results, deadPeers)
+	p.StartWork(ctx, to.Info, pk, results, deadPeers)
+}
+
+// sharePeers sends the addresses of our connected peers to every peer for PEX
+func (to *Torrent) sharePeers() {
+	addrs := make([]string, 0, len(to.Peers))
+	for _, p := range to.Peers {
+		if p.Source != peer.SourceIncoming { // Incoming peers connect from ports that they don't listen on
+			addrs = append(addrs, p.String())
+		}
+	}
+	for _, p := range to.Peers {
+		p.SendPex(addrs)
+	}
 }
 
 func (to *Torrent) removePeer(p string) {
@@ -179,6 +288,14 @@ func (to *Torrent) hasPeer(p string) bool {
 	return false
 }
 
+// allowPeer returns whether a new peer should be added, private torrents never use peers found outside of their trackers
+func (to *Torrent) allowPeer(p peer.Peer) bool {
+	if to.Info.Private && p.Source.Public() {
+		return false
+	}
+	return !to.hasPeer(p.String()) && len(to.Peers) < config.GetConfig().Network.MaxTorrentConnections
+}
+
 // DownRate returns the current total download rate of the torrent in bytes/sec
 func (to *Torrent) DownRate() uint32 {
 	totalRate := uint32(0)
@@ -1,12 +1,32 @@
 package torrent
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 
 	// "fmt"
 
+	bencode "github.com/jackpal/bencode-go"
+	"github.com/kylec725/graytorrent/internal/common"
+	"github.com/kylec725/graytorrent/internal/peer"
+	"github.com/kylec725/graytorrent/internal/peer/handshake"
+	"github.com/kylec725/graytorrent/internal/tracker"
+	"github.com/spf13/viper"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 const debugTorrent = false
@@ -24,3 +44,287 @@ func TestSetup(t *testing.T) {
 		os.Remove(to.Info.Name)
 	}
 }
+
+func TestAddMagnet(t *testing.T) {
+	assert := assert.New(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	listener.Close() // No peer sends the metadata
+	name := strings.Repeat("ab", 20)
+	link := "magnet:?xt=urn:btih:" + name + "&x.pe=" + listener.Addr().String()
+
+	// Magnet links are added without waiting for their metadata
+	s := &Session{torrents: make(map[[20]byte]*Torrent)}
+	dir := t.TempDir()
+	to, err := s.AddTorrent(context.Background(), link, true, dir)
+	require.Nil(t, err)
+	assert.Equal(name, to.Info.Name)
+	assert.Equal(dir, to.Info.Directory)
+	assert.False(to.hasMetadata())
+	assert.Equal(Stopped, to.State())
+	found, ok := s.findTorrent(to.Info.InfoHash)
+	assert.True(ok)
+	assert.Equal(to, found)
+	files, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	assert.Empty(files)
+	to.Started = true
+	assert.Equal(FetchingMetadata, to.State())
+	to.Started = false
+
+	// Stopping the torrent ends the fetch
+	ctx, cancel := context.WithCancel(s.torrentContext(context.Background()))
+	cancel()
+	to.Start(ctx)
+	assert.False(to.Started)
+	assert.False(to.hasMetadata())
+
+	// Only the torrent's data is removed, and it has none yet
+	require.Nil(t, os.Mkdir(filepath.Join(dir, name), 0755))
+	s.RemoveTorrent(to, true)
+	assert.DirExists(filepath.Join(dir, name))
+	assert.Empty(s.torrents)
+}
+
+func TestPrivate(t *testing.T) {
+	assert := assert.New(t)
+
+	info := map[string]interface{}{"name": "private", "piece length": 16384, "pieces": strings.Repeat("p", 20), "length": 100, "private": 1}
+	var buf bytes.Buffer
+	require.Nil(t, bencode.Marshal(&buf, map[string]interface{}{"announce": "http://tracker.example.com/announce", "info": info}))
+	filename := filepath.Join(t.TempDir(), "private.torrent")
+	require.Nil(t, ioutil.WriteFile(filename, buf.Bytes(), 0644))
+
+	to := Torrent{File: filename}
+	require.Nil(t, to.Init())
+	assert.True(to.Info.Private)
+
+	// Saves from before the private flag was stored are reloaded as private
+	saved := Torrent{File: filename, Info: &common.TorrentInfo{Name: "private"}}
+	require.Nil(t, saved.Init())
+	assert.True(saved.Info.Private)
+
+	// Only peers from the torrent's trackers, or that contacted us, are used
+	viper.Set("network.max_torrent_connections", 30)
+	defer viper.Set("network.max_torrent_connections", nil)
+	for _, source := range []peer.Source{peer.SourceTracker, peer.SourceIncoming, peer.SourceDHT, peer.SourcePEX, peer.SourceLSD} {
+		p := peer.New("10.0.0.1:6881", nil, to.Info)
+		p.Source = source
+		assert.Equal(!source.Public(), to.allowPeer(p), source.String())
+	}
+	assert.False(peer.SourceTracker.Public())
+	assert.True(peer.SourceDHT.Public())
+
+	// The DHT is only advertised in handshakes when we run a node, and never for private torrents
+	h := handshake.New(to.Info, true)
+	assert.False(h.DHT())
+	to.Info.Private = false
+	h = handshake.New(to.Info, true)
+	assert.True(h.DHT())
+	h = handshake.New(to.Info, false)
+	assert.False(h.DHT())
+}
+
+func TestTrackerTiers(t *testing.T) {
+	assert := assert.New(t)
+
+	var mu sync.Mutex
+	var events []string
+	announced := make(chan bool, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		events = append(events, r.URL.Path+" "+r.URL.Query().Get("event"))
+		mu.Unlock()
+		if strings.HasPrefix(r.URL.Path, "/down") {
+			w.WriteHeader(http.StatusInternalServerError)
+			bencode.Marshal(w, map[string]interface{}{"failure reason": "down"})
+			return
+		}
+		bencode.Marshal(w, map[string]interface{}{"interval": 60, "peers": ""})
+		announced <- true
+	}))
+	defer server.Close()
+
+	run := func(tiers []tracker.Tier) []string {
+		mu.Lock()
+		events = nil
+		mu.Unlock()
+		info := &common.TorrentInfo{Left: 1}
+		ctx, cancel := context.WithCancel(context.WithValue(context.Background(), common.KeyPort, uint16(6881)))
+		done := make(chan bool)
+		go func() {
+			tracker.Run(ctx, tiers, info, make(chan peer.Peer), nil)
+			close(done)
+		}()
+		<-announced
+		cancel()
+		<-done
+		mu.Lock()
+		defer mu.Unlock()
+		return events
+	}
+
+	// Trackers in a tier are tried in order and the one that responds is promoted, later tiers aren't used
+	tiers := []tracker.Tier{
+		{tracker.New(server.URL + "/down/announce"), tracker.New(server.URL + "/up/announce")},
+		{tracker.New(server.URL + "/backup/announce")},
+	}
+	assert.Equal([]string{"/down/announce started", "/up/announce started", "/up/announce stopped"}, run(tiers))
+	assert.Equal(server.URL+"/up/announce", tiers[0][0].Announce)
+	assert.Equal(server.URL+"/down/announce", tiers[0][1].Announce)
+
+	// The next tier is used once a whole tier fails
+	tiers = []tracker.Tier{{tracker.New(server.URL + "/down/announce")}, {tracker.New(server.URL + "/backup/announce")}}
+	assert.Equal([]string{"/down/announce started", "/backup/announce started", "/backup/announce stopped"}, run(tiers))
+
+	// Tiers are saved, and saves with a flat list of trackers load each one as its own tier
+	var loaded []tracker.Tier
+	require.Nil(t, json.Unmarshal([]byte(`[{"Announce":"a"},[{"Announce":"b"},{"Announce":"c"}]]`), &loaded))
+	require.Len(t, loaded, 2)
+	assert.Equal("a", loaded[0][0].Announce)
+	assert.Len(loaded[1], 2)
+	data, err := json.Marshal(loaded)
+	require.Nil(t, err)
+	assert.Equal(`[[{"Announce":"a"}],[{"Announce":"b"},{"Announce":"c"}]]`, string(data))
+}
+
+func TestTrackerResponses(t *testing.T) {
+	assert := assert.New(t)
+
+	requests := make(chan url.Values, 2)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.URL.Query()
+		if r.URL.Query().Get("event") == "started" { // Peers in the original dictionary format
+			peers := []interface{}{
+				map[string]interface{}{"ip": "10.0.0.1", "port": 6881, "peer id": strings.Repeat("a", 20)},
+				map[string]interface{}{"ip": "peer.example.com", "port": 51413, "peer id": strings.Repeat("b", 20)},
+				map[string]interface{}{"ip": "10.0.0.2"},
+			}
+			bencode.Marshal(w, map[string]interface{}{"interval": 0, "min interval": 1, "tracker id": "abc", "warning message": "slow down", "peers": peers})
+			return
+		}
+		bencode.Marshal(w, map[string]interface{}{"failure reason": "banned"})
+	}))
+	defer server.Close()
+
+	tr := tracker.New(server.URL + "/announce")
+	peers := make(chan peer.Peer)
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), common.KeyPort, uint16(6881)))
+	done := make(chan bool)
+	go func() {
+		tracker.Run(ctx, []tracker.Tier{{tr}}, &common.TorrentInfo{Left: 1}, peers, nil)
+		close(done)
+	}()
+
+	assert.Equal("", (<-requests).Get("trackerid"))
+	assert.Equal("10.0.0.1:6881", (<-peers).Addr)
+	assert.Equal("peer.example.com:51413", (<-peers).Addr)
+
+	// The tracker ID is sent back, and a failure reason is an error even with a 200 status code
+	assert.Equal("abc", (<-requests).Get("trackerid"))
+	cancel()
+	<-done
+	assert.False(tr.Working)
+	assert.Equal("banned", tr.Failure)
+	assert.Equal("slow down", tr.Warning)
+	assert.Equal(1, tr.MinInterval)
+}
+
+func TestTrackerCompletion(t *testing.T) {
+	assert := assert.New(t)
+
+	requests := make(chan url.Values, 4)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bencode.Marshal(w, map[string]interface{}{"interval": 1, "peers": ""})
+		requests <- r.URL.Query()
+	}))
+	defer server.Close()
+
+	// Counters from earlier sessions are saved but trackers only hear about this session
+	info := &common.TorrentInfo{Uploaded: 1000, Downloaded: 2000, Left: 300}
+	complete := make(chan bool)
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), common.KeyPort, uint16(6881)))
+	done := make(chan bool)
+	go func() {
+		tracker.Run(ctx, []tracker.Tier{{tracker.New(server.URL + "/announce")}}, info, make(chan peer.Peer), complete)
+		close(done)
+	}()
+
+	query := <-requests
+	assert.Equal([]string{"started", "0", "0"}, []string{query.Get("event"), query.Get("uploaded"), query.Get("downloaded")})
+	info.AddUploaded(500)
+	info.AddDownloaded(300)
+	info.Left = 0
+	close(complete)
+	query = <-requests
+	assert.Equal([]string{"completed", "500", "300", "0"}, []string{query.Get("event"), query.Get("uploaded"), query.Get("downloaded"), query.Get("left")})
+
+	// Seeding torrents keep announcing
+	query = <-requests
+	assert.Equal([]string{"", "500"}, []string{query.Get("event"), query.Get("uploaded")})
+	cancel()
+	<-done
+	query = <-requests
+	assert.Equal("stopped", query.Get("event"))
+
+	uploaded, downloaded := info.Transferred()
+	assert.Equal(1500, uploaded)
+	assert.Equal(2300, downloaded)
+	data, err := json.Marshal(info)
+	require.Nil(t, err)
+	var loaded common.TorrentInfo
+	require.Nil(t, json.Unmarshal(data, &loaded))
+	assert.Equal(int64(1500), loaded.Uploaded)
+	assert.Equal(int64(2300), loaded.Downloaded)
+}
+
+func TestTrackerKey(t *testing.T) {
+	assert := assert.New(t)
+
+	info := &common.TorrentInfo{Left: 1}
+	info.SetPeerID()
+	require.NotZero(t, info.Key)
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), common.KeyPort, uint16(6881)))
+	defer cancel()
+
+	// HTTP announces send the key in hex
+	keys := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bencode.Marshal(w, map[string]interface{}{"interval": 60, "peers": ""})
+		select {
+		case keys <- r.URL.Query().Get("key"):
+		default:
+		}
+	}))
+	defer server.Close()
+	go tracker.Run(ctx, []tracker.Tier{{tracker.New(server.URL + "/announce")}}, info, make(chan peer.Peer), nil)
+	assert.Equal(fmt.Sprintf("%08x", info.Key), <-keys)
+
+	// UDP announces send the key and the announce URL's path and query as BEP 41 options
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer conn.Close()
+	passkey := strings.Repeat("p", 300) // Split across two options
+	go tracker.Run(ctx, []tracker.Tier{{tracker.New("udp://" + conn.LocalAddr().String() + "/announce?passkey=" + passkey)}}, info, make(chan peer.Peer), nil)
+
+	buf := make([]byte, 1024)
+	_, addr, err := conn.ReadFrom(buf)
+	require.Nil(t, err)
+	resp := make([]byte, 16)
+	copy(resp[4:8], buf[12:16]) // Transaction ID
+	binary.BigEndian.PutUint64(resp[8:16], 777)
+	_, err = conn.WriteTo(resp, addr)
+	require.Nil(t, err)
+
+	n, _, err := conn.ReadFrom(buf)
+	require.Nil(t, err)
+	packet := buf[16:n]
+	assert.Equal(info.Key, binary.BigEndian.Uint32(packet[72:76]))
+	options := packet[82:]
+	urlData := "/announce?passkey=" + passkey
+	require.Len(t, options, len(urlData)+4)
+	assert.Equal([]byte{0x2, 255}, options[0:2])
+	assert.Equal([]byte{0x2, byte(len(urlData) - 255)}, options[257:259])
+	assert.Equal(urlData, string(options[2:257])+string(options[259:]))
+}